@@ -43,7 +43,11 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	metricAgent := agent.NewAgent(cfg)
+	metricAgent, err := agent.NewAgent(cfg)
+	if err != nil {
+		log.Printf("Error while creating agent: %v", err)
+		return
+	}
 
 	log.Println("Starting agent...")
 
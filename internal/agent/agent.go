@@ -3,31 +3,116 @@ package agent
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
 	"sync"
 	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/a2sh3r/sysmetrics/internal/agent/collector"
 	"github.com/a2sh3r/sysmetrics/internal/agent/metrics"
 	"github.com/a2sh3r/sysmetrics/internal/agent/sender"
+	"github.com/a2sh3r/sysmetrics/internal/agent/utils"
+	"github.com/a2sh3r/sysmetrics/internal/compression"
 	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/encryption"
+	pb "github.com/a2sh3r/sysmetrics/internal/proto"
+	"github.com/a2sh3r/sysmetrics/internal/tlsconfig"
 )
 
 // Agent represents the metrics agent.
 type Agent struct {
-	cfg     *config.AgentConfig
-	metrics *metrics.Metrics
-	worker  *MetricsWorker
-	sender  *sender.Sender
-	mu      sync.RWMutex
+	cfg       *config.AgentConfig
+	metrics   *metrics.Metrics
+	collector *collector.Collector
+	worker    *MetricsWorker
+	sender    *sender.Sender
+	conn      *grpc.ClientConn
+	mu        sync.RWMutex
 }
 
 // NewAgent creates a new Agent instance.
-func NewAgent(cfg *config.AgentConfig) *Agent {
-	return &Agent{
-		cfg:     cfg,
-		metrics: metrics.NewMetrics(),
-		sender:  sender.NewSender(cfg.Address, cfg.SecretKey),
+func NewAgent(cfg *config.AgentConfig) (*Agent, error) {
+	opts := []sender.Option{
+		sender.WithKeyID(cfg.SecretKeyID),
+		sender.WithAPIToken(cfg.APIToken),
+		sender.WithTenant(cfg.Tenant),
+	}
+
+	instanceID := cfg.InstanceID
+	if instanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Printf("Failed to read the host name, sending no instance ID: %v", err)
+		}
+		instanceID = hostname
+	}
+	opts = append(opts, sender.WithInstanceID(instanceID))
+
+	if cfg.CryptoKey != "" {
+		publicKey, err := encryption.LoadPublicKey(cfg.CryptoKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load public key: %w", err)
+		}
+		opts = append(opts, sender.WithPublicKey(publicKey))
+	}
+
+	if _, ok := compression.Lookup(cfg.Compression); !ok {
+		return nil, fmt.Errorf("unknown compression %q", cfg.Compression)
+	}
+	opts = append(opts, sender.WithCompression(cfg.Compression))
+
+	switch cfg.BatchFormat {
+	case "", config.BatchFormatJSON:
+	case config.BatchFormatBinary:
+		opts = append(opts, sender.WithBinaryBatches(true))
+	default:
+		return nil, fmt.Errorf("unknown batch format %q", cfg.BatchFormat)
+	}
+
+	serverURL := cfg.Address
+	creds := insecure.NewCredentials()
+	if cfg.Scheme() == "https" {
+		tlsConfig, err := tlsconfig.NewClientConfig(cfg.TLSCAFile, cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		opts = append(opts, sender.WithTLSConfig(tlsConfig))
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	var conn *grpc.ClientConn
+	switch cfg.Transport {
+	case "", config.TransportHTTP:
+	case config.TransportGRPC:
+		var err error
+		conn, err = grpc.NewClient(cfg.GRPCAddress, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+		}
+		opts = append(opts, sender.WithGRPCClient(pb.NewMetricsClient(conn)))
+		serverURL = cfg.Scheme() + "://" + cfg.GRPCAddress
+	default:
+		return nil, fmt.Errorf("unknown transport %q", cfg.Transport)
+	}
+
+	if ip, err := utils.GetOutboundIP(serverURL); err != nil {
+		log.Printf("Failed to detect agent IP address: %v", err)
+	} else {
+		opts = append(opts, sender.WithRealIP(ip.String()))
 	}
+
+	return &Agent{
+		cfg:       cfg,
+		metrics:   metrics.NewMetrics(),
+		collector: collector.NewCollector(),
+		sender:    sender.NewSender(cfg.Address, cfg.SecretKey, opts...),
+		conn:      conn,
+	}, nil
 }
 
 // Run starts the agent's main loop.
@@ -35,6 +120,8 @@ func (a *Agent) Run(ctx context.Context) {
 	a.worker = NewMetricsWorker(a.cfg.RateLimit, a.sendMetrics)
 	a.worker.Start(ctx)
 
+	go a.sendMetadata(ctx)
+
 	go func() {
 		ticker := time.NewTicker(time.Duration(a.cfg.PollInterval) * time.Second)
 		defer ticker.Stop()
@@ -45,7 +132,7 @@ func (a *Agent) Run(ctx context.Context) {
 				return
 			case <-ticker.C:
 				a.mu.Lock()
-				a.metrics = metrics.NewMetrics()
+				a.metrics = a.collector.CollectMetrics()
 				a.mu.Unlock()
 				a.worker.SendMetrics(a.metrics)
 			}
@@ -73,9 +160,41 @@ func (a *Agent) Run(ctx context.Context) {
 
 	<-ctx.Done()
 	a.worker.Stop()
+
+	if a.conn != nil {
+		if err := a.conn.Close(); err != nil {
+			log.Printf("Error closing gRPC connection: %v", err)
+		}
+	}
 }
 
 // sendMetrics sends collected metrics to the server.
 func (a *Agent) sendMetrics(m *metrics.Metrics) error {
 	return a.sender.SendMetricsWithRetries(context.Background(), []*metrics.Metrics{m})
 }
+
+// sendMetadata registers the units and help texts of the metrics. A failed attempt is logged and
+// repeated every report interval until the server accepts the metadata or ctx is done, since the
+// metrics are accepted without it.
+func (a *Agent) sendMetadata(ctx context.Context) {
+	interval := time.Duration(a.cfg.ReportInterval * float64(time.Second))
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := a.sender.SendMetadata(ctx, metrics.NewMetrics())
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to register metric metadata, retrying in %v: %v", interval, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,10 +2,14 @@ package agent
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/a2sh3r/sysmetrics/internal/agent/metrics"
 	"github.com/a2sh3r/sysmetrics/internal/agent/sender"
@@ -101,10 +105,12 @@ func TestNewAgent(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := NewAgent(tt.args.cfg)
+			got, err := NewAgent(tt.args.cfg)
+			assert.NoError(t, err)
 			assert.NotNil(t, got)
 			assert.Equal(t, tt.want.cfg, got.cfg)
 			assert.NotNil(t, got.metrics)
+			assert.NotNil(t, got.collector)
 			assert.NotNil(t, got.sender)
 		})
 	}
@@ -116,7 +122,10 @@ func BenchmarkAgentRun(b *testing.B) {
 		PollInterval:   2,
 		ReportInterval: 10,
 	}
-	agent := NewAgent(cfg)
+	agent, err := NewAgent(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	b.ResetTimer()
@@ -125,3 +134,27 @@ func BenchmarkAgentRun(b *testing.B) {
 		cancel()
 	}
 }
+
+func TestAgent_SendMetadata_Retries(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	a := &Agent{
+		cfg:    &config.AgentConfig{ReportInterval: 0.01},
+		sender: sender.NewSender(srv.URL, ""),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	a.sendMetadata(ctx)
+
+	require.NoError(t, ctx.Err(), "metadata is sent before the deadline")
+	assert.Equal(t, int32(3), attempts.Load(), "failed attempts are repeated until one succeeds")
+}
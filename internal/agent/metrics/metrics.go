@@ -9,39 +9,42 @@ import (
 	"github.com/shirou/gopsutil/v4/mem"
 )
 
+// Metrics holds the values collected by the agent. The unit and help tags describe every metric and
+// are registered with the server once per session. Counters with the mode tag set to cumulative hold
+// the running total since the agent started rather than the increment since the last report.
 type Metrics struct {
-	PollCount      int64
-	CPUUtilization []float64
-	Alloc          float64
-	BuckHashSys    float64
-	Frees          float64
-	GCCPUFraction  float64
-	GCSys          float64
-	HeapAlloc      float64
-	HeapIdle       float64
-	HeapInuse      float64
-	HeapObjects    float64
-	HeapReleased   float64
-	HeapSys        float64
-	LastGC         float64
-	Lookups        float64
-	MCacheInuse    float64
-	MCacheSys      float64
-	MSpanInuse     float64
-	MSpanSys       float64
-	Mallocs        float64
-	NextGC         float64
-	NumForcedGC    float64
-	NumGC          float64
-	OtherSys       float64
-	PauseTotalNs   float64
-	StackInuse     float64
-	StackSys       float64
-	Sys            float64
-	TotalAlloc     float64
-	RandomValue    float64
-	TotalMemory    float64
-	FreeMemory     float64
+	PollCount      int64     `mode:"cumulative" help:"Number of times the agent polled the metrics."`
+	CPUUtilization []float64 `unit:"percent" help:"Utilization of a CPU core."`
+	Alloc          float64   `unit:"bytes" help:"Bytes of allocated heap objects."`
+	BuckHashSys    float64   `unit:"bytes" help:"Bytes of memory in profiling bucket hash tables."`
+	Frees          float64   `help:"Cumulative count of heap objects freed."`
+	GCCPUFraction  float64   `unit:"ratio" help:"Fraction of the available CPU time used by the GC since the program started."`
+	GCSys          float64   `unit:"bytes" help:"Bytes of memory in garbage collection metadata."`
+	HeapAlloc      float64   `unit:"bytes" help:"Bytes of allocated heap objects."`
+	HeapIdle       float64   `unit:"bytes" help:"Bytes in idle heap spans."`
+	HeapInuse      float64   `unit:"bytes" help:"Bytes in in-use heap spans."`
+	HeapObjects    float64   `help:"Number of allocated heap objects."`
+	HeapReleased   float64   `unit:"bytes" help:"Bytes of physical memory returned to the OS."`
+	HeapSys        float64   `unit:"bytes" help:"Bytes of heap memory obtained from the OS."`
+	LastGC         float64   `unit:"nanoseconds" help:"Time the last garbage collection finished, since the Unix epoch."`
+	Lookups        float64   `help:"Number of pointer lookups performed by the runtime."`
+	MCacheInuse    float64   `unit:"bytes" help:"Bytes of allocated mcache structures."`
+	MCacheSys      float64   `unit:"bytes" help:"Bytes of memory obtained from the OS for mcache structures."`
+	MSpanInuse     float64   `unit:"bytes" help:"Bytes of allocated mspan structures."`
+	MSpanSys       float64   `unit:"bytes" help:"Bytes of memory obtained from the OS for mspan structures."`
+	Mallocs        float64   `help:"Cumulative count of heap objects allocated."`
+	NextGC         float64   `unit:"bytes" help:"Target heap size of the next GC cycle."`
+	NumForcedGC    float64   `help:"Number of GC cycles forced by the application."`
+	NumGC          float64   `help:"Number of completed GC cycles."`
+	OtherSys       float64   `unit:"bytes" help:"Bytes of memory in miscellaneous off-heap runtime allocations."`
+	PauseTotalNs   float64   `unit:"nanoseconds" help:"Cumulative time spent in GC stop-the-world pauses."`
+	StackInuse     float64   `unit:"bytes" help:"Bytes in stack spans."`
+	StackSys       float64   `unit:"bytes" help:"Bytes of stack memory obtained from the OS."`
+	Sys            float64   `unit:"bytes" help:"Total bytes of memory obtained from the OS."`
+	TotalAlloc     float64   `unit:"bytes" help:"Cumulative bytes allocated for heap objects."`
+	RandomValue    float64   `help:"Value that changes on every poll."`
+	TotalMemory    float64   `unit:"bytes" help:"Total amount of RAM."`
+	FreeMemory     float64   `unit:"bytes" help:"Amount of free RAM."`
 }
 
 func NewMetrics() *Metrics {
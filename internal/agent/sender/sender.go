@@ -4,34 +4,139 @@ package sender
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	protobuf "google.golang.org/protobuf/proto"
+
 	"github.com/a2sh3r/sysmetrics/internal/agent/metrics"
-	"github.com/a2sh3r/sysmetrics/internal/agent/utils"
+	"github.com/a2sh3r/sysmetrics/internal/compression"
 	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/encryption"
 	"github.com/a2sh3r/sysmetrics/internal/hash"
 	"github.com/a2sh3r/sysmetrics/internal/models"
+	pb "github.com/a2sh3r/sysmetrics/internal/proto"
 	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/wire"
 )
 
 type Sender struct {
 	client        *http.Client
 	serverAddress string
 	secretKey     string
+	secretKeyID   string
+	publicKey     *rsa.PublicKey
+	realIP        string
+	apiToken      string
+	tenant        string
+	instance      string
+	grpcClient    pb.MetricsClient
+	binary        bool
+	encoding      string
+}
+
+// Option configures optional Sender settings.
+type Option func(*Sender)
+
+// WithKeyID sets the id of the secret key, sent so the server can pick the matching key during rotation.
+func WithKeyID(keyID string) Option {
+	return func(s *Sender) {
+		s.secretKeyID = keyID
+	}
+}
+
+// WithPublicKey enables encryption of request bodies with the server public key.
+func WithPublicKey(key *rsa.PublicKey) Option {
+	return func(s *Sender) {
+		s.publicKey = key
+	}
+}
+
+// WithTLSConfig makes the sender use the given TLS configuration for HTTPS connections.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(s *Sender) {
+		s.client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+}
+
+// WithRealIP sets the agent address sent in the X-Real-IP header.
+func WithRealIP(ip string) Option {
+	return func(s *Sender) {
+		s.realIP = ip
+	}
+}
+
+// WithAPIToken sets the bearer token used to authenticate against the server.
+func WithAPIToken(token string) Option {
+	return func(s *Sender) {
+		s.apiToken = token
+	}
+}
+
+// WithTenant sets the tenant sent in the X-Tenant-ID header.
+func WithTenant(tenant string) Option {
+	return func(s *Sender) {
+		s.tenant = tenant
+	}
+}
+
+// WithInstanceID sets the agent instance ID sent in the X-Agent-Instance header. The server keeps the
+// running totals of cumulative counters per instance, so agents sharing a token do not disturb each other.
+func WithInstanceID(instance string) Option {
+	return func(s *Sender) {
+		s.instance = instance
+	}
+}
+
+// WithGRPCClient makes the sender deliver metrics with the gRPC Metrics service instead of HTTP.
+// Request bodies are protected by the gRPC connection security, so WithPublicKey does not apply.
+func WithGRPCClient(client pb.MetricsClient) Option {
+	return func(s *Sender) {
+		s.grpcClient = client
+	}
+}
+
+// WithBinaryBatches makes the sender encode HTTP batches in the compact binary format instead of JSON.
+func WithBinaryBatches(enabled bool) Option {
+	return func(s *Sender) {
+		s.binary = enabled
+	}
+}
+
+// WithCompression sets the content encoding of HTTP batches. The default is gzip.
+func WithCompression(encoding string) Option {
+	return func(s *Sender) {
+		if encoding != "" {
+			s.encoding = encoding
+		}
+	}
 }
 
-func NewSender(serverAddress string, secretKey string) *Sender {
-	return &Sender{
+func NewSender(serverAddress string, secretKey string, opts ...Option) *Sender {
+	s := &Sender{
 		serverAddress: serverAddress,
 		client:        &http.Client{},
 		secretKey:     secretKey,
+		encoding:      compression.Gzip,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func toModelMetrics(m *metrics.Metrics) []*models.Metrics {
@@ -59,6 +164,7 @@ func toModelMetrics(m *metrics.Metrics) []*models.Metrics {
 				MType: constants.MetricTypeCounter,
 				Delta: &iv,
 				Value: nil,
+				Mode:  typ.Field(i).Tag.Get("mode"),
 			})
 		case reflect.Slice:
 			if fieldName == "CPUUtilization" {
@@ -80,33 +186,127 @@ func toModelMetrics(m *metrics.Metrics) []*models.Metrics {
 	return result
 }
 
+// toModelMetadata returns the metadata of the metrics sent by toModelMetrics, taken from the unit and
+// help tags of metrics.Metrics.
+func toModelMetadata(m *metrics.Metrics) []models.MetadataUpdate {
+	var result []models.MetadataUpdate
+	typ := reflect.TypeOf(m).Elem()
+
+	for _, metric := range toModelMetrics(m) {
+		fieldName := metric.ID
+		if strings.HasPrefix(fieldName, "CPUutilization") {
+			fieldName = "CPUUtilization"
+		}
+		field, ok := typ.FieldByName(fieldName)
+		if !ok {
+			continue
+		}
+		result = append(result, models.MetadataUpdate{
+			ID:    metric.ID,
+			MType: metric.MType,
+			MetricMetadata: models.MetricMetadata{
+				Unit: field.Tag.Get("unit"),
+				Help: field.Tag.Get("help"),
+			},
+		})
+	}
+
+	return result
+}
+
 func (s *Sender) sendMetricsBatchJSON(ctx context.Context, metrics []*models.Metrics) error {
-	data, err := json.Marshal(metrics)
+	contentType := "application/json"
+	marshal := func(metrics []*models.Metrics) ([]byte, error) { return json.Marshal(metrics) }
+	if s.binary {
+		contentType = wire.ContentType
+		marshal = wire.Encode
+	}
+
+	data, err := marshal(metrics)
 	if err != nil {
 		return fmt.Errorf("failed to marshal metrics batch: %w", err)
 	}
 
-	compressedData, err := utils.CompressData(data)
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set(models.BatchModeHeader, models.BatchModeBestEffort)
+
+	status, body, err := s.post(ctx, "/updates/", data, header)
 	if err != nil {
-		return fmt.Errorf("failed to compress metrics batch: %w", err)
+		return fmt.Errorf("failed to send batch request: %w", err)
+	}
+
+	log.Printf("Server batch response (status %d): %s", status, string(body))
+
+	if status != http.StatusOK {
+		return fmt.Errorf("server returned status %d for batch update", status)
 	}
 
-	url := s.serverAddress + "/updates/"
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(compressedData))
+	logRejected(body)
+	return nil
+}
+
+// post sends data to path with the compression, encryption, authentication and signature headers of
+// the sender, and returns the status and body of the response.
+func (s *Sender) post(ctx context.Context, path string, data []byte, header http.Header) (int, []byte, error) {
+	compressedData, err := compression.Compress(s.encoding, data)
 	if err != nil {
-		return fmt.Errorf("failed to create batch request: %w", err)
+		return 0, nil, fmt.Errorf("failed to compress request body: %w", err)
+	}
+
+	payload := compressedData
+	if s.publicKey != nil {
+		payload, err = encryption.Encrypt(s.publicKey, compressedData)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to encrypt request body: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.serverAddress+path, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if s.encoding != compression.Identity {
+		req.Header.Set("Content-Encoding", s.encoding)
+	}
+	if s.publicKey != nil {
+		req.Header.Set(middleware.EncryptionHeader, encryption.Scheme)
+	}
+	if s.realIP != "" {
+		req.Header.Set(middleware.RealIPHeader, s.realIP)
+	}
+	if s.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiToken)
+	}
+	if s.tenant != "" {
+		req.Header.Set(middleware.TenantHeader, s.tenant)
+	}
+	if s.instance != "" {
+		req.Header.Set(middleware.InstanceHeader, s.instance)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Content-Encoding", "gzip")
 
 	if s.secretKey != "" {
-		calculateHash := hash.CalculateHash(string(data), s.secretKey)
+		nonce, err := newNonce()
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to generate request nonce: %w", err)
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+		calculateHash := hash.CalculateHash(hash.SignedPayload(timestamp, nonce, string(data)), s.secretKey)
 		req.Header.Set(middleware.HashHeader, calculateHash)
+		req.Header.Set(middleware.TimestampHeader, timestamp)
+		req.Header.Set(middleware.NonceHeader, nonce)
+		if s.secretKeyID != "" {
+			req.Header.Set(middleware.HashKeyIDHeader, s.secretKeyID)
+		}
 	}
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send batch request: %w", err)
+		return 0, nil, err
 	}
 	defer func() {
 		if resp != nil && resp.Body != nil {
@@ -118,18 +318,134 @@ func (s *Sender) sendMetricsBatchJSON(ctx context.Context, metrics []*models.Met
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return 0, nil, fmt.Errorf("failed to read response body: %w", err)
 	}
+	return resp.StatusCode, body, nil
+}
 
-	log.Printf("Server batch response (status %d): %s", resp.StatusCode, string(body))
+// SendMetadata registers the units and help texts of the metrics in m with the server, over gRPC when
+// the sender has a gRPC client and over HTTP otherwise.
+func (s *Sender) SendMetadata(ctx context.Context, m *metrics.Metrics) error {
+	if m == nil {
+		return fmt.Errorf("metrics is nil")
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned status %d for batch update", resp.StatusCode)
+	updates := toModelMetadata(m)
+	if s.grpcClient != nil {
+		return s.sendMetadataGRPC(ctx, updates)
 	}
 
+	data, err := json.Marshal(updates)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	status, body, err := s.post(ctx, "/metadata/", data, header)
+	if err != nil {
+		return fmt.Errorf("failed to send metadata request: %w", err)
+	}
+	if status != http.StatusNoContent && status != http.StatusOK {
+		return fmt.Errorf("server returned status %d for metadata update: %s", status, string(body))
+	}
 	return nil
 }
 
+// logRejected logs the batch items the server rejected. They are dropped rather than sent again,
+// since the server would reject them on every retry.
+func logRejected(body []byte) {
+	var result models.BatchResult
+	if err := json.Unmarshal(body, &result); err != nil || result.RejectedTotal == 0 {
+		return
+	}
+	for _, r := range result.Rejected {
+		log.Printf("Dropping metric %q of type %q rejected by the server: %s", r.ID, r.MType, r.Reason)
+	}
+	if omitted := result.RejectedTotal - len(result.Rejected); omitted > 0 {
+		log.Printf("Dropping %d more metrics rejected by the server", omitted)
+	}
+}
+
+func (s *Sender) sendMetricsBatchGRPC(ctx context.Context, metrics []*models.Metrics) error {
+	req := &pb.UpdateMetricsRequest{Metrics: pb.FromModels(metrics)}
+
+	md, err := s.grpcMetadata(req)
+	if err != nil {
+		return fmt.Errorf("failed to sign metrics batch: %w", err)
+	}
+
+	resp, err := s.grpcClient.UpdateMetrics(metadata.NewOutgoingContext(ctx, md), req, grpc.UseCompressor(gzip.Name))
+	if err != nil {
+		return fmt.Errorf("failed to send batch request: %w", err)
+	}
+
+	log.Printf("Server batch response: %d metrics accepted", resp.GetAccepted())
+	return nil
+}
+
+func (s *Sender) sendMetadataGRPC(ctx context.Context, updates []models.MetadataUpdate) error {
+	req := &pb.UpdateMetadataRequest{Metadata: pb.FromModelMetadata(updates)}
+
+	md, err := s.grpcMetadata(req)
+	if err != nil {
+		return fmt.Errorf("failed to sign metadata: %w", err)
+	}
+
+	if _, err := s.grpcClient.UpdateMetadata(metadata.NewOutgoingContext(ctx, md), req, grpc.UseCompressor(gzip.Name)); err != nil {
+		return fmt.Errorf("failed to send metadata request: %w", err)
+	}
+	return nil
+}
+
+// grpcMetadata returns the request metadata of a unary call: the client address, credentials, tenant,
+// instance ID and, when a secret key is set, the signature of req.
+func (s *Sender) grpcMetadata(req protobuf.Message) (metadata.MD, error) {
+	md := metadata.MD{}
+	if s.realIP != "" {
+		md.Set(pb.RealIPMetadataKey, s.realIP)
+	}
+	if s.apiToken != "" {
+		md.Set(pb.AuthorizationMetadataKey, "Bearer "+s.apiToken)
+	}
+	if s.tenant != "" {
+		md.Set(pb.TenantMetadataKey, s.tenant)
+	}
+	if s.instance != "" {
+		md.Set(pb.InstanceMetadataKey, s.instance)
+	}
+
+	if s.secretKey != "" {
+		data, err := pb.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		nonce, err := newNonce()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate request nonce: %w", err)
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+		md.Set(pb.HashMetadataKey, hash.CalculateHash(hash.SignedPayload(timestamp, nonce, string(data)), s.secretKey))
+		md.Set(pb.TimestampMetadataKey, timestamp)
+		md.Set(pb.NonceMetadataKey, nonce)
+		if s.secretKeyID != "" {
+			md.Set(pb.HashKeyIDMetadataKey, s.secretKeyID)
+		}
+	}
+	return md, nil
+}
+
+// newNonce returns a random hex string that makes every signed request unique.
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func (s *Sender) SendMetrics(ctx context.Context, metricsBatch []*metrics.Metrics) error {
 	if metricsBatch == nil {
 		return fmt.Errorf("metricsBatch is nil")
@@ -147,6 +463,9 @@ func (s *Sender) SendMetrics(ctx context.Context, metricsBatch []*metrics.Metric
 		allModelMetrics = append(allModelMetrics, modelMetrics...)
 	}
 
+	if s.grpcClient != nil {
+		return s.sendMetricsBatchGRPC(ctx, allModelMetrics)
+	}
 	return s.sendMetricsBatchJSON(ctx, allModelMetrics)
 }
 
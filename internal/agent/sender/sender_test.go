@@ -2,15 +2,35 @@ package sender
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/a2sh3r/sysmetrics/internal/agent/metrics"
+	"github.com/a2sh3r/sysmetrics/internal/compression"
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	pb "github.com/a2sh3r/sysmetrics/internal/proto"
+	"github.com/a2sh3r/sysmetrics/internal/server/grpcserver"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
 	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/wire"
 )
 
 func TestSender_SendMetrics(t *testing.T) {
@@ -173,3 +193,234 @@ func TestSender_SendMetricsWithRetries(t *testing.T) {
 		})
 	}
 }
+
+func TestSender_DropsRejectedItems(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, models.BatchModeBestEffort, r.Header.Get(models.BatchModeHeader))
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(models.BatchResult{
+			Mode:          models.BatchModeBestEffort,
+			Accepted:      1,
+			RejectedTotal: 1,
+			Rejected:      []models.RejectedMetric{{Index: 1, ID: "HeapAlloc", MType: constants.MetricTypeGauge, Reason: "metric stored with type counter"}},
+		}))
+	}))
+	defer srv.Close()
+
+	s := NewSender(srv.URL, "")
+
+	require.NoError(t, s.SendMetricsWithRetries(context.Background(), []*metrics.Metrics{{PollCount: 1, HeapAlloc: 1}}))
+	assert.Equal(t, 1, requests)
+}
+
+func TestSender_SignedRequestsPassReplayProtection(t *testing.T) {
+	cfg := &config.ServerConfig{SecretKey: "test key", ReplayWindow: 60, NonceCacheSize: 100}
+	var accepted int
+	handler := middleware.NewGzipMiddleware()(middleware.NewHashMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted++
+		w.WriteHeader(http.StatusOK)
+	})))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	s := NewSender(srv.URL, "test key")
+	metricsBatch := []*metrics.Metrics{{PollCount: 1, HeapAlloc: 1}}
+
+	assert.NoError(t, s.SendMetrics(context.Background(), metricsBatch))
+	assert.NoError(t, s.SendMetrics(context.Background(), metricsBatch))
+	assert.Equal(t, 2, accepted)
+}
+
+func TestSender_EncryptedRequestsAreDecryptedByServer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "private.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+
+	cfg := &config.ServerConfig{SecretKey: "test key", CryptoKey: keyPath}
+	var got []models.Metrics
+	handler := middleware.NewDecryptMiddleware(cfg)(middleware.NewGzipMiddleware()(middleware.NewHashMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusOK)
+	}))))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	s := NewSender(srv.URL, "test key", WithPublicKey(&key.PublicKey))
+
+	require.NoError(t, s.SendMetrics(context.Background(), []*metrics.Metrics{{PollCount: 3, HeapAlloc: 1}}))
+	require.NotEmpty(t, got)
+	assert.Equal(t, "PollCount", got[0].ID)
+	assert.Equal(t, models.CounterModeCumulative, got[0].Mode, "PollCount is a running total")
+}
+
+func TestSender_SendsAPIToken(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	s := NewSender(srv.URL, "", WithAPIToken("agent-secret"))
+
+	require.NoError(t, s.SendMetrics(context.Background(), []*metrics.Metrics{{PollCount: 1}}))
+	assert.Equal(t, "Bearer agent-secret", gotAuth)
+}
+
+func TestSender_SendsTenant(t *testing.T) {
+	var gotTenant, gotInstance string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTenant = r.Header.Get(middleware.TenantHeader)
+		gotInstance = r.Header.Get(middleware.InstanceHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	s := NewSender(srv.URL, "", WithTenant("team-a"), WithInstanceID("node-1"))
+
+	require.NoError(t, s.SendMetrics(context.Background(), []*metrics.Metrics{{PollCount: 1}}))
+	assert.Equal(t, "team-a", gotTenant)
+	assert.Equal(t, "node-1", gotInstance)
+}
+
+func TestSender_SendsBinaryBatches(t *testing.T) {
+	cfg := &config.ServerConfig{SecretKey: "test key", ReplayWindow: 60, NonceCacheSize: 100}
+	var got []models.Metrics
+	handler := middleware.NewGzipMiddleware()(middleware.NewHashMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, wire.ContentType, r.Header.Get("Content-Type"))
+		var err error
+		got, err = wire.Decode(r.Body)
+		assert.NoError(t, err)
+		w.WriteHeader(http.StatusOK)
+	})))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	s := NewSender(srv.URL, "test key", WithBinaryBatches(true))
+
+	require.NoError(t, s.SendMetrics(context.Background(), []*metrics.Metrics{{PollCount: 3, HeapAlloc: 1}}))
+	require.NotEmpty(t, got)
+	assert.Equal(t, "PollCount", got[0].ID)
+	assert.Equal(t, int64(3), *got[0].Delta)
+}
+
+func TestSender_Compression(t *testing.T) {
+	for _, encoding := range []string{compression.Zstd, compression.Deflate, compression.Identity} {
+		t.Run(encoding, func(t *testing.T) {
+			cfg := &config.ServerConfig{SecretKey: "test key"}
+			var gotEncoding string
+			var got []models.Metrics
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotEncoding = r.Header.Get("Content-Encoding")
+				middleware.NewCompressMiddleware(cfg)(middleware.NewHashMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+					w.WriteHeader(http.StatusOK)
+				}))).ServeHTTP(w, r)
+			})
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			s := NewSender(srv.URL, "test key", WithCompression(encoding))
+
+			require.NoError(t, s.SendMetrics(context.Background(), []*metrics.Metrics{{PollCount: 3}}))
+			if encoding == compression.Identity {
+				assert.Empty(t, gotEncoding)
+			} else {
+				assert.Equal(t, encoding, gotEncoding)
+			}
+			require.NotEmpty(t, got)
+			assert.Equal(t, "PollCount", got[0].ID)
+		})
+	}
+}
+
+type recordingWriter struct {
+	tenant   string
+	metrics  map[string]repositories.Metric
+	metadata map[string]repositories.Metadata
+}
+
+func (w *recordingWriter) UpdateMetricsBatchWithRetry(ctx context.Context, metrics map[string]repositories.Metric) error {
+	w.tenant = identity.Tenant(ctx)
+	w.metrics = metrics
+	return nil
+}
+
+func (w *recordingWriter) UpdateMetadataWithRetry(ctx context.Context, metadata map[string]repositories.Metadata) error {
+	w.tenant = identity.Tenant(ctx)
+	w.metadata = metadata
+	return nil
+}
+
+func TestSender_SendMetricsGRPC(t *testing.T) {
+	cfg := &config.ServerConfig{SecretKey: "test key", ReplayWindow: 60, NonceCacheSize: 100}
+	writer := &recordingWriter{}
+	srv, err := grpcserver.NewServer(cfg, writer, middleware.NewRateLimiter(cfg))
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	s := NewSender("", "test key", WithGRPCClient(pb.NewMetricsClient(conn)), WithTenant("team-a"))
+
+	require.NoError(t, s.SendMetrics(context.Background(), []*metrics.Metrics{{PollCount: 3, HeapAlloc: 1}}))
+	assert.Equal(t, "team-a", writer.tenant)
+	assert.Equal(t, repositories.Metric{Type: constants.MetricTypeCounter, Value: int64(3), Cumulative: true}, writer.metrics["PollCount"])
+	assert.Equal(t, repositories.Metric{Type: constants.MetricTypeGauge, Value: float64(1)}, writer.metrics["HeapAlloc"])
+
+	require.NoError(t, s.SendMetadata(context.Background(), &metrics.Metrics{}))
+	assert.Equal(t, repositories.Metadata{Type: constants.MetricTypeGauge, Unit: "bytes", Help: "Total amount of RAM."},
+		writer.metadata["TotalMemory"], "metadata follows the gRPC transport")
+
+	bad := NewSender("", "wrong key", WithGRPCClient(pb.NewMetricsClient(conn)))
+	assert.Error(t, bad.SendMetrics(context.Background(), []*metrics.Metrics{{PollCount: 1}}))
+	assert.Error(t, bad.SendMetadata(context.Background(), &metrics.Metrics{}))
+}
+
+func TestSender_SendMetadata(t *testing.T) {
+	cfg := &config.ServerConfig{SecretKey: "test key"}
+	var got []models.MetadataUpdate
+	var gotPath string
+	handler := middleware.NewGzipMiddleware()(middleware.NewHashMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	s := NewSender(srv.URL, "test key")
+	require.NoError(t, s.SendMetadata(context.Background(), &metrics.Metrics{CPUUtilization: []float64{0, 0}}))
+
+	assert.Equal(t, "/metadata/", gotPath)
+	byID := make(map[string]models.MetadataUpdate, len(got))
+	for _, m := range got {
+		byID[m.ID] = m
+	}
+	assert.Equal(t, models.MetadataUpdate{
+		ID:             "TotalMemory",
+		MType:          constants.MetricTypeGauge,
+		MetricMetadata: models.MetricMetadata{Unit: "bytes", Help: "Total amount of RAM."},
+	}, byID["TotalMemory"])
+	assert.Equal(t, "nanoseconds", byID["PauseTotalNs"].Unit)
+	assert.Equal(t, constants.MetricTypeCounter, byID["PollCount"].MType)
+	assert.Equal(t, "percent", byID["CPUutilization2"].Unit)
+	assert.Len(t, got, len(toModelMetrics(&metrics.Metrics{CPUUtilization: []float64{0, 0}})))
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	assert.Error(t, NewSender(failing.URL, "").SendMetadata(context.Background(), &metrics.Metrics{}))
+}
@@ -2,23 +2,41 @@
 package utils
 
 import (
-	"bytes"
-	"compress/gzip"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/a2sh3r/sysmetrics/internal/compression"
 )
 
+// CompressData compresses data with gzip.
 func CompressData(data []byte) ([]byte, error) {
-	var buf bytes.Buffer
-	writer := gzip.NewWriter(&buf)
-	_, err := writer.Write(data)
+	return compression.Compress(compression.Gzip, data)
+}
+
+// GetOutboundIP returns the local IP address the agent uses to reach the given server URL.
+func GetOutboundIP(serverURL string) (net.IP, error) {
+	u, err := url.Parse(serverURL)
 	if err != nil {
-		closeErr := writer.Close()
-		if closeErr != nil {
-			return nil, closeErr
-		}
-		return nil, err
+		return nil, fmt.Errorf("failed to parse server address: %w", err)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
 	}
-	if err := writer.Close(); err != nil {
-		return nil, err
+
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve outbound address: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("unexpected local address type %T", conn.LocalAddr())
 	}
-	return buf.Bytes(), nil
+	return addr.IP, nil
 }
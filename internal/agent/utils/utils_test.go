@@ -71,4 +71,26 @@ func TestCompressData_EdgeCases(t *testing.T) {
 			}
 		})
 	}
-} 
\ No newline at end of file
+} 
+func TestGetOutboundIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		wantErr bool
+	}{
+		{"loopback with port", "http://127.0.0.1:8080", false},
+		{"loopback without port", "http://127.0.0.1", false},
+		{"invalid url", "http://[::1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := GetOutboundIP(tt.address)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, ip.IsLoopback())
+		})
+	}
+}
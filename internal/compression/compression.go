@@ -0,0 +1,361 @@
+// Package compression provides the content codecs used to compress HTTP request and response bodies.
+// Encoders and decoders are pooled, so a codec can be used for every request without reallocating
+// compression state.
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Names of the built-in codecs, as used in the Content-Encoding and Accept-Encoding headers.
+const (
+	Gzip     = "gzip"
+	Deflate  = "deflate"
+	Zstd     = "zstd"
+	Identity = "identity"
+)
+
+// zstdMaxWindow bounds the window a zstd frame may make a decoder allocate. It is the 8 MiB every
+// decoder is expected to support by RFC 8878.
+const zstdMaxWindow = 8 << 20
+
+// ErrDecodedSizeExceeded is returned when reading a body whose frames declare more content or a larger
+// window than the decoder may allocate.
+var ErrDecodedSizeExceeded = errors.New("compressed body needs more memory than allowed")
+
+// Codec compresses and decompresses a content encoding.
+type Codec interface {
+	// Name returns the content encoding name of the codec.
+	Name() string
+	// NewWriter returns a writer compressing into w. Closing it flushes the data and releases the encoder.
+	NewWriter(w io.Writer) io.WriteCloser
+	// NewReader returns a reader decompressing r. Closing it releases the decoder.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Codec{}
+)
+
+func init() {
+	Register(identityCodec{})
+	Register(newGzipCodec())
+	Register(newDeflateCodec())
+	Register(newZstdCodec(0))
+}
+
+// Register makes a codec available under its name, replacing any codec registered with the same name.
+func Register(c Codec) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(c.Name())] = c
+}
+
+// Lookup returns the codec registered under name. An empty name selects the identity codec.
+func Lookup(name string) (Codec, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = Identity
+	}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	c, ok := registry[name]
+	return c, ok
+}
+
+// ParseCodecs validates a comma-separated list of codec names in order of preference.
+func ParseCodecs(s string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := Lookup(name); !ok {
+			return nil, fmt.Errorf("unknown compression codec %q", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Compress compresses data with the codec registered under name.
+func Compress(name string, data []byte) ([]byte, error) {
+	c, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown compression codec %q", name)
+	}
+
+	var buf bytes.Buffer
+	w := c.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Negotiate picks the codec for a response from an Accept-Encoding header value. Among the offered
+// codecs, in order of server preference, the one with the highest client q-value wins. It returns
+// Identity when the client accepts none of them.
+func Negotiate(acceptEncoding string, offered []string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && parsed >= 0 && parsed <= 1 {
+					q = parsed
+				} else {
+					q = 0
+				}
+			}
+		}
+
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		weights[name] = q
+	}
+
+	type candidate struct {
+		name     string
+		q        float64
+		priority int
+	}
+	var candidates []candidate
+	for i, name := range offered {
+		q, ok := weights[name]
+		if !ok {
+			q = wildcard
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{name: name, q: q, priority: i})
+		}
+	}
+	if len(candidates) == 0 {
+		return Identity
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+		return candidates[i].priority < candidates[j].priority
+	})
+	return candidates[0].name
+}
+
+// identityCodec leaves data unchanged.
+type identityCodec struct{}
+
+func (identityCodec) Name() string { return Identity }
+
+func (identityCodec) NewWriter(w io.Writer) io.WriteCloser { return nopWriteCloser{w} }
+
+func (identityCodec) NewReader(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil }
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// pooledWriter returns its encoder to the pool once closed.
+type pooledWriter struct {
+	io.WriteCloser
+	release func()
+	closed  bool
+}
+
+func (w *pooledWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.WriteCloser.Close()
+	w.release()
+	return err
+}
+
+// pooledReader returns its decoder to the pool once closed.
+type pooledReader struct {
+	io.Reader
+	release func()
+	closed  bool
+}
+
+func (r *pooledReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.release()
+	return nil
+}
+
+type gzipCodec struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+func newGzipCodec() *gzipCodec {
+	c := &gzipCodec{}
+	c.writers.New = func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+		return w
+	}
+	return c
+}
+
+func (c *gzipCodec) Name() string { return Gzip }
+
+func (c *gzipCodec) NewWriter(w io.Writer) io.WriteCloser {
+	gw := c.writers.Get().(*gzip.Writer)
+	gw.Reset(w)
+	return &pooledWriter{WriteCloser: gw, release: func() { c.writers.Put(gw) }}
+}
+
+func (c *gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	if gr, ok := c.readers.Get().(*gzip.Reader); ok {
+		if err := gr.Reset(r); err != nil {
+			c.readers.Put(gr)
+			return nil, err
+		}
+		return &pooledReader{Reader: gr, release: func() { c.readers.Put(gr) }}, nil
+	}
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &pooledReader{Reader: gr, release: func() { c.readers.Put(gr) }}, nil
+}
+
+type deflateCodec struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+func newDeflateCodec() *deflateCodec {
+	c := &deflateCodec{}
+	c.writers.New = func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	}
+	return c
+}
+
+func (c *deflateCodec) Name() string { return Deflate }
+
+func (c *deflateCodec) NewWriter(w io.Writer) io.WriteCloser {
+	fw := c.writers.Get().(*flate.Writer)
+	fw.Reset(w)
+	return &pooledWriter{WriteCloser: fw, release: func() { c.writers.Put(fw) }}
+}
+
+func (c *deflateCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	if fr, ok := c.readers.Get().(io.ReadCloser); ok {
+		if err := fr.(flate.Resetter).Reset(r, nil); err != nil {
+			c.readers.Put(fr)
+			return nil, err
+		}
+		return &pooledReader{Reader: fr, release: func() { c.readers.Put(fr) }}, nil
+	}
+
+	fr := flate.NewReader(r)
+	return &pooledReader{Reader: fr, release: func() { c.readers.Put(fr) }}, nil
+}
+
+type zstdCodec struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// NewZstdCodec returns a zstd codec whose decoders refuse frames declaring more than maxDecoded bytes
+// of content or window, so that a small body cannot make them allocate large buffers. A non-positive
+// maxDecoded bounds only the window, as the registered zstd codec does.
+func NewZstdCodec(maxDecoded int64) Codec {
+	return newZstdCodec(maxDecoded)
+}
+
+func newZstdCodec(maxDecoded int64) *zstdCodec {
+	options := []zstd.DOption{zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(zstdMaxWindow)}
+	if maxDecoded > 0 {
+		options = append(options, zstd.WithDecoderMaxMemory(uint64(maxDecoded)))
+	}
+
+	c := &zstdCodec{}
+	c.writers.New = func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		return w
+	}
+	c.readers.New = func() any {
+		// A single-threaded decoder runs synchronously, so pooled decoders hold no goroutines.
+		r, _ := zstd.NewReader(nil, options...)
+		return r
+	}
+	return c
+}
+
+func (c *zstdCodec) Name() string { return Zstd }
+
+func (c *zstdCodec) NewWriter(w io.Writer) io.WriteCloser {
+	zw := c.writers.Get().(*zstd.Encoder)
+	zw.Reset(w)
+	return &pooledWriter{WriteCloser: zw, release: func() { c.writers.Put(zw) }}
+}
+
+func (c *zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	zr := c.readers.Get().(*zstd.Decoder)
+	if err := zr.Reset(r); err != nil {
+		c.readers.Put(zr)
+		return nil, zstdError(err)
+	}
+	return &pooledReader{Reader: zstdReader{zr}, release: func() {
+		_ = zr.Reset(nil)
+		c.readers.Put(zr)
+	}}, nil
+}
+
+// zstdReader reports frames over the decoder limits as ErrDecodedSizeExceeded.
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (r zstdReader) Read(p []byte) (int, error) {
+	n, err := r.Decoder.Read(p)
+	return n, zstdError(err)
+}
+
+func zstdError(err error) error {
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return fmt.Errorf("%w: %w", ErrDecodedSizeExceeded, err)
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat(`{"id":"Alloc","type":"gauge","value":123.45},`, 100))
+
+	for _, name := range []string{Gzip, Deflate, Zstd, Identity} {
+		t.Run(name, func(t *testing.T) {
+			codec, ok := Lookup(name)
+			require.True(t, ok)
+
+			for i := 0; i < 3; i++ {
+				compressed, err := Compress(name, data)
+				require.NoError(t, err)
+				if name != Identity {
+					assert.Less(t, len(compressed), len(data))
+				}
+
+				r, err := codec.NewReader(bytes.NewReader(compressed))
+				require.NoError(t, err)
+				got, err := io.ReadAll(r)
+				require.NoError(t, err)
+				require.NoError(t, r.Close())
+				assert.Equal(t, data, got, "pooled codec round %d", i+1)
+			}
+		})
+	}
+}
+
+func TestCodecs_InvalidInput(t *testing.T) {
+	for _, name := range []string{Gzip, Zstd} {
+		t.Run(name, func(t *testing.T) {
+			codec, _ := Lookup(name)
+			r, err := codec.NewReader(strings.NewReader("not compressed"))
+			if err == nil {
+				_, err = io.ReadAll(r)
+				_ = r.Close()
+			}
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestZstdCodec_DecoderLimits(t *testing.T) {
+	data := bytes.Repeat([]byte{'0'}, 16<<20)
+	single, err := Compress(Zstd, data)
+	require.NoError(t, err)
+
+	enc, err := zstd.NewWriter(nil, zstd.WithWindowSize(32<<20), zstd.WithSingleSegment(false))
+	require.NoError(t, err)
+	wideWindow := enc.EncodeAll(data, nil)
+	require.NoError(t, enc.Close())
+
+	tests := []struct {
+		name    string
+		codec   Codec
+		body    []byte
+		wantErr bool
+	}{
+		{name: "Test #1 within limit", codec: NewZstdCodec(32 << 20), body: single},
+		{name: "Test #2 content over limit", codec: NewZstdCodec(1 << 20), body: single, wantErr: true},
+		{name: "Test #3 window over bound", codec: NewZstdCodec(0), body: wideWindow, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := tt.codec.NewReader(bytes.NewReader(tt.body))
+			if err == nil {
+				var n int64
+				n, err = io.Copy(io.Discard, r)
+				_ = r.Close()
+				if !tt.wantErr {
+					assert.Equal(t, int64(len(data)), n)
+				}
+			}
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrDecodedSizeExceeded)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c, ok := Lookup("")
+	require.True(t, ok)
+	assert.Equal(t, Identity, c.Name())
+
+	c, ok = Lookup(" GZIP ")
+	require.True(t, ok)
+	assert.Equal(t, Gzip, c.Name())
+
+	_, ok = Lookup("br")
+	assert.False(t, ok)
+}
+
+func TestParseCodecs(t *testing.T) {
+	codecs, err := ParseCodecs("zstd, gzip,,deflate")
+	require.NoError(t, err)
+	assert.Equal(t, []string{Zstd, Gzip, Deflate}, codecs)
+
+	_, err = ParseCodecs("gzip,br")
+	assert.Error(t, err)
+}
+
+func TestNegotiate(t *testing.T) {
+	offered := []string{Zstd, Gzip, Deflate}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		want           string
+	}{
+		{name: "Test #1 no header", acceptEncoding: "", want: Identity},
+		{name: "Test #2 single codec", acceptEncoding: "gzip", want: Gzip},
+		{name: "Test #3 server preference on ties", acceptEncoding: "gzip, deflate, zstd", want: Zstd},
+		{name: "Test #4 client q-values", acceptEncoding: "zstd;q=0.5, gzip;q=0.8, deflate;q=0.1", want: Gzip},
+		{name: "Test #5 refused codec", acceptEncoding: "zstd;q=0, gzip", want: Gzip},
+		{name: "Test #6 wildcard", acceptEncoding: "*", want: Zstd},
+		{name: "Test #7 wildcard with exclusion", acceptEncoding: "*;q=0.5, zstd;q=0", want: Gzip},
+		{name: "Test #8 unsupported codecs only", acceptEncoding: "br, compress", want: Identity},
+		{name: "Test #9 invalid q-value", acceptEncoding: "gzip;q=2, deflate", want: Deflate},
+		{name: "Test #10 case and whitespace", acceptEncoding: " GZip ; Q=0.9 ", want: Gzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Negotiate(tt.acceptEncoding, offered))
+		})
+	}
+}
+
+func benchmarkCompress(b *testing.B, name string) {
+	data := []byte(strings.Repeat(`{"id":"Alloc","type":"gauge","value":123.45},`, 60))
+	codec, _ := Lookup(name)
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		w := codec.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompress_Gzip(b *testing.B)    { benchmarkCompress(b, Gzip) }
+func BenchmarkCompress_Deflate(b *testing.B) { benchmarkCompress(b, Deflate) }
+func BenchmarkCompress_Zstd(b *testing.B)    { benchmarkCompress(b, Zstd) }
@@ -2,11 +2,24 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/caarlos0/env/v11"
 )
 
+// Transports the agent can deliver metrics with.
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+// Formats the agent can encode HTTP batches with.
+const (
+	BatchFormatJSON   = "json"
+	BatchFormatBinary = "binary"
+)
+
 // AgentConfig holds configuration for the agent.
 type AgentConfig struct {
 	RateLimit      int64   `env:"RATE_LIMIT" envDefault:"1"`
@@ -14,17 +27,61 @@ type AgentConfig struct {
 	ReportInterval float64 `env:"REPORT_INTERVAL" envDefault:"10"`
 	Address        string  `env:"ADDRESS" envDefault:"localhost:8080"`
 	SecretKey      string  `env:"KEY" envDefault:""`
+	SecretKeyID    string  `env:"KEY_ID" envDefault:""`
+	CryptoKey      string  `env:"CRYPTO_KEY" envDefault:""`
+	APIToken       string  `env:"API_TOKEN" envDefault:""`
+	Tenant         string  `env:"TENANT" envDefault:""`
+	InstanceID     string  `env:"INSTANCE_ID" envDefault:""`
+	TLSCAFile      string  `env:"TLS_CA" envDefault:""`
+	TLSCertFile    string  `env:"TLS_CERT" envDefault:""`
+	TLSKeyFile     string  `env:"TLS_KEY" envDefault:""`
+	Transport      string  `env:"TRANSPORT" envDefault:"http"`
+	GRPCAddress    string  `env:"GRPC_ADDRESS" envDefault:"localhost:3200"`
+	BatchFormat    string  `env:"BATCH_FORMAT" envDefault:"json"`
+	Compression    string  `env:"COMPRESSION" envDefault:"gzip"`
 }
 
 // ServerConfig holds configuration for the server.
 type ServerConfig struct {
-	StoreInterval   int    `env:"STORE_INTERVAL" envDefault:"300"`
-	Address         string `env:"ADDRESS" envDefault:"localhost:8080"`
-	LogLevel        string `env:"LOG_LEVEL" envDefault:"info"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH" envDefault:"/tmp/metrics-db.json"`
-	DatabaseDSN     string `env:"DATABASE_DSN" envDefault:""`
-	SecretKey       string `env:"KEY" envDefault:""`
-	Restore         bool   `env:"RESTORE" envDefault:"true"`
+	StoreInterval       int     `env:"STORE_INTERVAL" envDefault:"300"`
+	Address             string  `env:"ADDRESS" envDefault:"localhost:8080"`
+	LogLevel            string  `env:"LOG_LEVEL" envDefault:"info"`
+	FileStoragePath     string  `env:"FILE_STORAGE_PATH" envDefault:"/tmp/metrics-db.json"`
+	DatabaseDSN         string  `env:"DATABASE_DSN" envDefault:""`
+	SecretKey           string  `env:"KEY" envDefault:""`
+	SecretKeys          string  `env:"KEYS" envDefault:""`
+	LegacyHash          bool    `env:"LEGACY_HASH" envDefault:"false"`
+	AllowUnsigned       bool    `env:"ALLOW_UNSIGNED" envDefault:"false"`
+	ReplayWindow        int     `env:"REPLAY_WINDOW" envDefault:"300"`
+	NonceCacheSize      int     `env:"NONCE_CACHE_SIZE" envDefault:"100000"`
+	CryptoKey           string  `env:"CRYPTO_KEY" envDefault:""`
+	TLSCertFile         string  `env:"TLS_CERT" envDefault:""`
+	TLSKeyFile          string  `env:"TLS_KEY" envDefault:""`
+	TLSClientCAFile     string  `env:"TLS_CLIENT_CA" envDefault:""`
+	TrustedSubnet       string  `env:"TRUSTED_SUBNET" envDefault:""`
+	ReadTrustedSubnet   string  `env:"READ_TRUSTED_SUBNET" envDefault:""`
+	TrustedProxies      string  `env:"TRUSTED_PROXIES" envDefault:""`
+	APITokens           string  `env:"API_TOKENS" envDefault:""`
+	RateLimit           float64 `env:"RATE_LIMIT" envDefault:"0"`
+	RateBurst           int     `env:"RATE_BURST" envDefault:"0"`
+	RateLimitKey        string  `env:"RATE_LIMIT_KEY" envDefault:"auto"`
+	SeriesQuota         int     `env:"SERIES_QUOTA" envDefault:"0"`
+	CardinalityLimit    int     `env:"CARDINALITY_LIMIT" envDefault:"0"`
+	CardinalityMode     string  `env:"CARDINALITY_MODE" envDefault:"reject"`
+	MetricTTL           int     `env:"METRIC_TTL" envDefault:"0"`
+	MetricTTLOverrides  string  `env:"METRIC_TTL_OVERRIDES" envDefault:""`
+	RollupWindows       string  `env:"ROLLUP_WINDOWS" envDefault:""`
+	RollupRetention     int     `env:"ROLLUP_RETENTION" envDefault:"60"`
+	RetentionTiers      string  `env:"RETENTION_TIERS" envDefault:""`
+	CompactionInterval  int     `env:"COMPACTION_INTERVAL" envDefault:"60"`
+	StreamBuffer        int     `env:"STREAM_BUFFER" envDefault:"256"`
+	StreamSubscribers   int     `env:"STREAM_MAX_SUBSCRIBERS" envDefault:"1000"`
+	CompressCodecs      string  `env:"COMPRESS_CODECS" envDefault:"zstd,gzip,deflate"`
+	CompressMinSize     int     `env:"COMPRESS_MIN_SIZE" envDefault:"1024"`
+	MaxBodySize         int64   `env:"MAX_BODY_SIZE" envDefault:"8388608"`
+	MaxDecompressedSize int64   `env:"MAX_DECOMPRESSED_SIZE" envDefault:"33554432"`
+	GRPCAddress         string  `env:"GRPC_ADDRESS" envDefault:""`
+	Restore             bool    `env:"RESTORE" envDefault:"true"`
 }
 
 // NewAgentConfig creates a new AgentConfig from environment variables.
@@ -33,16 +90,44 @@ func NewAgentConfig() (*AgentConfig, error) {
 	if err := env.Parse(cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse environment variables: %w", err)
 	}
-	cfg.Address = "http://" + cfg.Address
+	cfg.Address = cfg.Scheme() + "://" + cfg.Address
 
 	return cfg, nil
 }
 
+// Scheme returns the URL scheme used to reach the server: https when any TLS option is set.
+func (cfg *AgentConfig) Scheme() string {
+	if cfg.TLSCAFile != "" || cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		return "https"
+	}
+	return "http"
+}
+
+// TLSEnabled reports whether the server is configured to serve HTTPS.
+func (cfg *ServerConfig) TLSEnabled() bool {
+	return cfg.TLSCertFile != "" && cfg.TLSKeyFile != ""
+}
+
+// ValidateTLS rejects partial TLS configurations, which would otherwise silently serve plain HTTP:
+// the certificate and key must be set together, and a client CA requires both.
+func (cfg *ServerConfig) ValidateTLS() error {
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return errors.New("TLS_CERT and TLS_KEY must be set together")
+	}
+	if cfg.TLSClientCAFile != "" && !cfg.TLSEnabled() {
+		return errors.New("TLS_CLIENT_CA requires TLS_CERT and TLS_KEY")
+	}
+	return nil
+}
+
 // NewServerConfig creates a new ServerConfig from environment variables.
 func NewServerConfig() (*ServerConfig, error) {
 	cfg := &ServerConfig{}
 	if err := env.Parse(cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse environment variables: %w", err)
 	}
+	if err := cfg.ValidateTLS(); err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+	}
 	return cfg, nil
 }
@@ -20,6 +20,10 @@ func TestNewConfig(t *testing.T) {
 				ReportInterval: 10,
 				Address:        "http://localhost:8080",
 				RateLimit:      1,
+				Transport:      TransportHTTP,
+				GRPCAddress:    "localhost:3200",
+				BatchFormat:    BatchFormatJSON,
+				Compression:    "gzip",
 			},
 		},
 	}
@@ -42,6 +46,10 @@ func TestNewServerConfig(t *testing.T) {
 	}{
 		{"valid env", map[string]string{"ADDRESS": "localhost:9999"}, nil, false},
 		{"invalid env", map[string]string{"STORE_INTERVAL": "notanint"}, nil, true},
+		{"tls", map[string]string{"TLS_CERT": "cert.pem", "TLS_KEY": "key.pem", "TLS_CLIENT_CA": "ca.pem"}, nil, false},
+		{"tls cert without key", map[string]string{"TLS_CERT": "cert.pem"}, nil, true},
+		{"tls key without cert", map[string]string{"TLS_KEY": "key.pem"}, nil, true},
+		{"tls client ca only", map[string]string{"TLS_CLIENT_CA": "ca.pem"}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -65,3 +73,28 @@ func TestNewServerConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestAgentConfig_Scheme(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  AgentConfig
+		want string
+	}{
+		{"plain", AgentConfig{}, "http"},
+		{"CA bundle", AgentConfig{TLSCAFile: "ca.pem"}, "https"},
+		{"client certificate", AgentConfig{TLSCertFile: "agent.crt", TLSKeyFile: "agent.key"}, "https"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.cfg.Scheme())
+		})
+	}
+}
+
+func TestNewAgentConfig_TLS(t *testing.T) {
+	t.Setenv("TLS_CA", "/etc/sysmetrics/ca.pem")
+
+	cfg, err := NewAgentConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "https://localhost:8080", cfg.Address)
+}
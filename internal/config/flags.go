@@ -44,6 +44,18 @@ func (cfg *AgentConfig) ParseFlags() {
 		pollInterval   float64
 		reportInterval float64
 		secretKey      string
+		secretKeyID    string
+		cryptoKey      string
+		apiToken       string
+		tenant         string
+		instanceID     string
+		tlsCAFile      string
+		tlsCertFile    string
+		tlsKeyFile     string
+		transport      string
+		grpcAddress    string
+		batchFormat    string
+		compression    string
 		rateLimit      int64
 	)
 
@@ -51,12 +63,66 @@ func (cfg *AgentConfig) ParseFlags() {
 	flag.Float64Var(&pollInterval, "p", 2, "poll interval to collect metrics")
 	flag.Float64Var(&reportInterval, "r", 10, "report interval to report metrics to server")
 	flag.StringVar(&secretKey, "k", "", "secret key to calculate hash")
+	flag.StringVar(&secretKeyID, "key-id", "", "id of the secret key sent to the server")
+	flag.StringVar(&cryptoKey, "crypto-key", "", "path to the server public key used to encrypt metrics")
+	flag.StringVar(&apiToken, "token", "", "API token sent to the server")
+	flag.StringVar(&tenant, "tenant", "", "tenant the metrics are reported to")
+	flag.StringVar(&instanceID, "instance-id", "", "agent instance ID sent to the server, the host name by default")
+	flag.StringVar(&tlsCAFile, "tls-ca", "", "path to the CA bundle used to verify the server certificate")
+	flag.StringVar(&tlsCertFile, "tls-cert", "", "path to the client certificate for mutual TLS")
+	flag.StringVar(&tlsKeyFile, "tls-key", "", "path to the client certificate key for mutual TLS")
+	flag.StringVar(&transport, "transport", "", "transport used to send metrics: http or grpc")
+	flag.StringVar(&grpcAddress, "grpc-address", "", "gRPC server address host:port")
+	flag.StringVar(&batchFormat, "batch-format", "", "encoding of HTTP metric batches: json or binary")
+	flag.StringVar(&compression, "compression", "", "content encoding of HTTP metric batches: gzip, zstd, deflate or identity")
 	flag.Int64Var(&rateLimit, "l", 1, "number of parallel workers")
 
 	flag.Parse()
 
+	if apiToken != "" {
+		cfg.APIToken = apiToken
+	}
+
+	if tenant != "" {
+		cfg.Tenant = tenant
+	}
+
+	if instanceID != "" {
+		cfg.InstanceID = instanceID
+	}
+
+	if transport != "" {
+		cfg.Transport = transport
+	}
+
+	if grpcAddress != "" {
+		cfg.GRPCAddress = grpcAddress
+	}
+
+	if batchFormat != "" {
+		cfg.BatchFormat = batchFormat
+	}
+
+	if compression != "" {
+		cfg.Compression = compression
+	}
+
+	if tlsCAFile != "" {
+		cfg.TLSCAFile = tlsCAFile
+	}
+
+	if tlsCertFile != "" {
+		cfg.TLSCertFile = tlsCertFile
+	}
+
+	if tlsKeyFile != "" {
+		cfg.TLSKeyFile = tlsKeyFile
+	}
+
 	if addr.Port != 0 {
-		cfg.Address = "http://" + addr.String()
+		cfg.Address = cfg.Scheme() + "://" + addr.String()
+	} else if cfg.Scheme() == "https" {
+		cfg.Address = strings.Replace(cfg.Address, "http://", "https://", 1)
 	}
 
 	if pollInterval > 0 {
@@ -71,6 +137,14 @@ func (cfg *AgentConfig) ParseFlags() {
 		cfg.SecretKey = secretKey
 	}
 
+	if secretKeyID != "" {
+		cfg.SecretKeyID = secretKeyID
+	}
+
+	if cryptoKey != "" {
+		cfg.CryptoKey = cryptoKey
+	}
+
 	if rateLimit > 0 {
 		cfg.RateLimit = rateLimit
 	}
@@ -81,12 +155,43 @@ func (cfg *ServerConfig) ParseFlags() {
 	addr := new(NetAddress)
 
 	var (
-		storeInterval   int
-		fileStoragePath string
-		restore         bool
-		logLevel        string
-		databaseDSN     string
-		secretKey       string
+		storeInterval     int
+		fileStoragePath   string
+		restore           bool
+		logLevel          string
+		databaseDSN       string
+		secretKey         string
+		secretKeys        string
+		allowUnsigned     bool
+		legacyHash        bool
+		replayWindow      int
+		cryptoKey         string
+		tlsCertFile       string
+		tlsKeyFile        string
+		tlsClientCAFile   string
+		trustedSubnet     string
+		readTrustedSubnet string
+		trustedProxies    string
+		apiTokens         string
+		rateLimit         float64
+		rateBurst         int
+		rateLimitKey      string
+		seriesQuota       int
+		cardinalityLimit  int
+		cardinalityMode   string
+		metricTTL         int
+		ttlOverrides      string
+		rollupWindows     string
+		rollupRetention   int
+		retentionTiers    string
+		compactInterval   int
+		streamBuffer      int
+		streamSubscribers int
+		grpcAddress       string
+		compressCodecs    string
+		compressMinSize   int
+		maxBodySize       int64
+		maxDecompressed   int64
 	)
 
 	flag.Var(addr, "a", "Net address host:port")
@@ -96,6 +201,37 @@ func (cfg *ServerConfig) ParseFlags() {
 	flag.BoolVar(&restore, "r", true, "restore metrics on start")
 	flag.StringVar(&databaseDSN, "d", "", "Database DSN")
 	flag.StringVar(&secretKey, "k", "", "secret key to calculate hash")
+	flag.StringVar(&secretKeys, "keys", "", "additional secret keys in format id:key,id:key")
+	flag.BoolVar(&legacyHash, "legacy-hash", false, "accept legacy sha256(data+key) hashes")
+	flag.BoolVar(&allowUnsigned, "allow-unsigned", false, "accept unsigned writes while keys are configured, for rolling out signing")
+	flag.IntVar(&replayWindow, "replay-window", -1, "allowed request timestamp skew in seconds, 0 disables replay protection")
+	flag.StringVar(&cryptoKey, "crypto-key", "", "path to the private key used to decrypt metrics")
+	flag.StringVar(&tlsCertFile, "tls-cert", "", "path to the TLS certificate")
+	flag.StringVar(&tlsKeyFile, "tls-key", "", "path to the TLS certificate key")
+	flag.StringVar(&tlsClientCAFile, "tls-client-ca", "", "path to the CA bundle used to verify client certificates")
+	flag.StringVar(&trustedSubnet, "t", "", "comma-separated CIDR subnets allowed to write metrics")
+	flag.StringVar(&readTrustedSubnet, "read-trusted-subnet", "", "comma-separated CIDR subnets allowed to read metrics")
+	flag.StringVar(&apiTokens, "api-tokens", "", "API tokens in format name:sha256hex:scope,scope;...")
+	flag.Float64Var(&rateLimit, "rate-limit", 0, "allowed requests per second per client, 0 disables rate limiting")
+	flag.IntVar(&rateBurst, "rate-burst", 0, "maximum request burst per client, defaults to the rate limit")
+	flag.StringVar(&rateLimitKey, "rate-limit-key", "", "client identity used for rate limiting: auto, ip, token or tenant")
+	flag.IntVar(&seriesQuota, "series-quota", 0, "maximum number of distinct series per tenant, 0 disables the quota")
+	flag.IntVar(&cardinalityLimit, "cardinality-limit", 0, "maximum number of distinct series across all tenants, 0 disables the limit")
+	flag.StringVar(&cardinalityMode, "cardinality-mode", "", "handling of new series beyond the cardinality limit: reject or drop")
+	flag.IntVar(&metricTTL, "metric-ttl", -1, "seconds without updates after which a series is stale, 0 disables expiry")
+	flag.StringVar(&ttlOverrides, "metric-ttl-overrides", "", "per-metric TTLs in format name=seconds,prefix*=seconds")
+	flag.StringVar(&rollupWindows, "rollup-windows", "", "comma-separated gauge rollup windows such as 1m,5m,1h, empty disables rollups")
+	flag.IntVar(&rollupRetention, "rollup-retention", -1, "number of rollup windows kept per gauge and window length")
+	flag.StringVar(&retentionTiers, "retention-tiers", "", "gauge rollup retention tiers in format window:period,... such as 1m:24h,1h:30d,24h:365d")
+	flag.IntVar(&compactInterval, "compaction-interval", -1, "seconds between compactions of the rollup retention tiers")
+	flag.IntVar(&streamBuffer, "stream-buffer", -1, "metric updates buffered per stream subscriber before it is disconnected, 0 disables streaming")
+	flag.IntVar(&streamSubscribers, "stream-max-subscribers", -1, "maximum number of concurrent stream subscribers, 0 allows any number")
+	flag.StringVar(&compressCodecs, "compress-codecs", "", "comma-separated response codecs in order of preference: zstd, gzip, deflate")
+	flag.IntVar(&compressMinSize, "compress-min-size", -1, "minimum response size in bytes to compress")
+	flag.Int64Var(&maxBodySize, "max-body-size", -1, "maximum request body size in bytes, 0 disables the limit")
+	flag.Int64Var(&maxDecompressed, "max-decompressed-size", -1, "maximum decompressed request body size in bytes, 0 disables the limit")
+	flag.StringVar(&grpcAddress, "grpc-address", "", "gRPC listen address host:port, empty disables the gRPC server")
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", "comma-separated CIDR subnets of proxies whose forwarded headers are trusted")
 
 	flag.Parse()
 
@@ -154,4 +290,128 @@ func (cfg *ServerConfig) ParseFlags() {
 	} else {
 		cfg.SecretKey = secretKey
 	}
+
+	if secretKeys != "" {
+		cfg.SecretKeys = secretKeys
+	}
+
+	if legacyHash {
+		cfg.LegacyHash = true
+	}
+
+	if allowUnsigned {
+		cfg.AllowUnsigned = true
+	}
+
+	if replayWindow >= 0 {
+		cfg.ReplayWindow = replayWindow
+	}
+
+	if cryptoKey != "" {
+		cfg.CryptoKey = cryptoKey
+	}
+
+	if tlsCertFile != "" {
+		cfg.TLSCertFile = tlsCertFile
+	}
+
+	if tlsKeyFile != "" {
+		cfg.TLSKeyFile = tlsKeyFile
+	}
+
+	if tlsClientCAFile != "" {
+		cfg.TLSClientCAFile = tlsClientCAFile
+	}
+
+	if trustedSubnet != "" {
+		cfg.TrustedSubnet = trustedSubnet
+	}
+
+	if readTrustedSubnet != "" {
+		cfg.ReadTrustedSubnet = readTrustedSubnet
+	}
+
+	if trustedProxies != "" {
+		cfg.TrustedProxies = trustedProxies
+	}
+
+	if apiTokens != "" {
+		cfg.APITokens = apiTokens
+	}
+
+	if rateLimit > 0 {
+		cfg.RateLimit = rateLimit
+	}
+
+	if rateBurst > 0 {
+		cfg.RateBurst = rateBurst
+	}
+
+	if rateLimitKey != "" {
+		cfg.RateLimitKey = rateLimitKey
+	}
+
+	if seriesQuota > 0 {
+		cfg.SeriesQuota = seriesQuota
+	}
+
+	if cardinalityLimit > 0 {
+		cfg.CardinalityLimit = cardinalityLimit
+	}
+
+	if cardinalityMode != "" {
+		cfg.CardinalityMode = cardinalityMode
+	}
+
+	if metricTTL >= 0 {
+		cfg.MetricTTL = metricTTL
+	}
+
+	if ttlOverrides != "" {
+		cfg.MetricTTLOverrides = ttlOverrides
+	}
+
+	if rollupWindows != "" {
+		cfg.RollupWindows = rollupWindows
+	}
+
+	if rollupRetention >= 0 {
+		cfg.RollupRetention = rollupRetention
+	}
+
+	if retentionTiers != "" {
+		cfg.RetentionTiers = retentionTiers
+	}
+
+	if compactInterval > 0 {
+		cfg.CompactionInterval = compactInterval
+	}
+
+	if streamBuffer >= 0 {
+		cfg.StreamBuffer = streamBuffer
+	}
+
+	if streamSubscribers >= 0 {
+		cfg.StreamSubscribers = streamSubscribers
+	}
+
+	if grpcAddress != "" {
+		cfg.GRPCAddress = grpcAddress
+	}
+
+	if compressCodecs != "" {
+		cfg.CompressCodecs = compressCodecs
+	}
+
+	if compressMinSize >= 0 {
+		cfg.CompressMinSize = compressMinSize
+	}
+
+	if maxBodySize >= 0 {
+		cfg.MaxBodySize = maxBodySize
+	}
+
+	if maxDecompressed >= 0 {
+		cfg.MaxDecompressedSize = maxDecompressed
+	}
 }
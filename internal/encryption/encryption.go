@@ -0,0 +1,168 @@
+// Package encryption provides hybrid RSA-OAEP + AES-GCM encryption of request payloads.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Scheme identifies the payload encryption scheme in the Content-Encryption header.
+const Scheme = "rsa-oaep-aes256gcm"
+
+const (
+	contentKeySize = 32
+	keyLenSize     = 2
+)
+
+var (
+	ErrInvalidPEM     = errors.New("no PEM block found")
+	ErrInvalidKeyType = errors.New("key is not an RSA key")
+	ErrMalformed      = errors.New("malformed encrypted payload")
+)
+
+// LoadPublicKey reads an RSA public key from a PEM file (PKIX or PKCS#1).
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		key, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, ErrInvalidKeyType
+		}
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	return key, nil
+}
+
+// LoadPrivateKey reads an RSA private key from a PEM file (PKCS#8 or PKCS#1).
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	return key, nil
+}
+
+// Encrypt encrypts data with a fresh AES-256-GCM content key which is itself encrypted with RSA-OAEP.
+// The result is laid out as: key length (2 bytes, big endian) | encrypted key | GCM nonce | ciphertext.
+func Encrypt(pub *rsa.PublicKey, data []byte) ([]byte, error) {
+	contentKey := make([]byte, contentKeySize)
+	if _, err := rand.Read(contentKey); err != nil {
+		return nil, fmt.Errorf("failed to generate content key: %w", err)
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, contentKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt content key: %w", err)
+	}
+
+	gcm, err := newGCM(contentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := make([]byte, keyLenSize, keyLenSize+len(encryptedKey)+len(nonce)+len(data)+gcm.Overhead())
+	binary.BigEndian.PutUint16(out, uint16(len(encryptedKey)))
+	out = append(out, encryptedKey...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, nil), nil
+}
+
+// Decrypt reverses Encrypt using the server private key.
+func Decrypt(priv *rsa.PrivateKey, data []byte) ([]byte, error) {
+	if len(data) < keyLenSize {
+		return nil, ErrMalformed
+	}
+	keyLen := int(binary.BigEndian.Uint16(data))
+	data = data[keyLenSize:]
+	if len(data) < keyLen {
+		return nil, ErrMalformed
+	}
+
+	contentKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, data[:keyLen], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt content key: %w", err)
+	}
+	data = data[keyLen:]
+
+	gcm, err := newGCM(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	return block, nil
+}
@@ -0,0 +1,107 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKeys(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	privPath := filepath.Join(dir, "private.pem")
+	pubPath := filepath.Join(dir, "public.pem")
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600))
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644))
+
+	return pubPath, privPath
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	pubPath, privPath := writeKeys(t)
+
+	pub, err := LoadPublicKey(pubPath)
+	require.NoError(t, err)
+	priv, err := LoadPrivateKey(privPath)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"small", []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)},
+		{"larger than RSA block", make([]byte, 64*1024)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := Encrypt(pub, tt.data)
+			require.NoError(t, err)
+			if len(tt.data) > 0 {
+				assert.NotContains(t, string(encrypted), string(tt.data))
+			}
+
+			decrypted, err := Decrypt(priv, encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, string(tt.data), string(decrypted))
+		})
+	}
+}
+
+func TestDecrypt_Invalid(t *testing.T) {
+	pubPath, privPath := writeKeys(t)
+	pub, err := LoadPublicKey(pubPath)
+	require.NoError(t, err)
+	priv, err := LoadPrivateKey(privPath)
+	require.NoError(t, err)
+
+	encrypted, err := Encrypt(pub, []byte("payload"))
+	require.NoError(t, err)
+
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated key", encrypted[:10]},
+		{"tampered ciphertext", tampered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decrypt(priv, tt.data)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadKeys_Errors(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pem")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a pem"), 0600))
+
+	_, err := LoadPublicKey(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+	_, err = LoadPublicKey(garbage)
+	assert.ErrorIs(t, err, ErrInvalidPEM)
+	_, err = LoadPrivateKey(garbage)
+	assert.ErrorIs(t, err, ErrInvalidPEM)
+}
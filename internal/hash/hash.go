@@ -2,24 +2,47 @@
 package hash
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 )
 
-// CalculateHash calculates a SHA256 hash for the given data and key.
+var (
+	ErrHashMismatch = errors.New("hash verification failed")
+	ErrUnknownKeyID = errors.New("unknown key id")
+)
+
+// CalculateHash calculates an HMAC-SHA256 signature for the given data and key.
 func CalculateHash(data string, key string) string {
 	if key == "" {
 		return ""
 	}
 
-	h := sha256.New()
+	h := hmac.New(sha256.New, []byte(key))
+
+	h.Write([]byte(data))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CalculateLegacyHash calculates the legacy sha256(data + key) value sent by older agents.
+func CalculateLegacyHash(data string, key string) string {
+	if key == "" {
+		return ""
+	}
 
-	h.Write([]byte(data + key))
+	hashBytes := sha256.Sum256([]byte(data + key))
 
-	hashBytes := h.Sum(nil)
+	return hex.EncodeToString(hashBytes[:])
+}
 
-	return hex.EncodeToString(hashBytes)
+// SignedPayload builds the data signed for replay-protected requests: the request
+// timestamp and nonce are bound to the body so neither can be swapped on a captured request.
+func SignedPayload(timestamp string, nonce string, body string) string {
+	return timestamp + "\n" + nonce + "\n" + body
 }
 
 // VerifyHash verifies that the given hash matches the data and key.
@@ -28,10 +51,114 @@ func VerifyHash(data string, key string, hash string) error {
 		return nil
 	}
 
-	calculatedHash := CalculateHash(data, key)
-	if calculatedHash != hash {
-		return fmt.Errorf("hash verification failed: expected %s, got %s", hash, calculatedHash)
+	if !equal(CalculateHash(data, key), hash) {
+		return ErrHashMismatch
+	}
+
+	return nil
+}
+
+// VerifyLegacyHash verifies a hash produced by CalculateLegacyHash.
+func VerifyLegacyHash(data string, key string, hash string) error {
+	if key == "" {
+		return nil
+	}
+
+	if !equal(CalculateLegacyHash(data, key), hash) {
+		return ErrHashMismatch
 	}
 
 	return nil
 }
+
+// Keyring holds the set of keys accepted by the server. Several keys can be
+// active at once so that agents can be moved to a new key without downtime.
+type Keyring struct {
+	keys   map[string]string
+	legacy bool
+}
+
+// NewKeyring creates a Keyring. The primary key is registered under the empty
+// key ID and is used for requests that do not carry a key ID. When legacy is
+// set, sha256(data + key) signatures are accepted alongside HMAC ones.
+func NewKeyring(primary string, keys map[string]string, legacy bool) *Keyring {
+	k := &Keyring{
+		keys:   make(map[string]string, len(keys)+1),
+		legacy: legacy,
+	}
+	if primary != "" {
+		k.keys[""] = primary
+	}
+	for id, key := range keys {
+		if key != "" {
+			k.keys[id] = key
+		}
+	}
+	return k
+}
+
+// Enabled reports whether the keyring holds at least one key.
+func (k *Keyring) Enabled() bool {
+	return k != nil && len(k.keys) > 0
+}
+
+// Key returns the key registered under the given ID.
+func (k *Keyring) Key(keyID string) (string, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKeyID, keyID)
+	}
+	return key, nil
+}
+
+// Sign calculates the HMAC-SHA256 signature of data with the key registered under keyID.
+func (k *Keyring) Sign(data string, keyID string) (string, error) {
+	key, err := k.Key(keyID)
+	if err != nil {
+		return "", err
+	}
+	return CalculateHash(data, key), nil
+}
+
+// Verify checks the signature of data against the key registered under keyID.
+// Legacy signatures are accepted only when the keyring is in compatibility mode.
+func (k *Keyring) Verify(data string, keyID string, hash string) (legacy bool, err error) {
+	key, err := k.Key(keyID)
+	if err != nil {
+		return false, err
+	}
+
+	if VerifyHash(data, key, hash) == nil {
+		return false, nil
+	}
+
+	if k.legacy && VerifyLegacyHash(data, key, hash) == nil {
+		return true, nil
+	}
+
+	return false, ErrHashMismatch
+}
+
+// ParseKeys parses a comma-separated list of id:key pairs.
+func ParseKeys(s string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, key, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || key == "" {
+			return nil, fmt.Errorf("key must be in format id:key, got %q", pair)
+		}
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", id)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+func equal(expected, got string) bool {
+	return hmac.Equal([]byte(expected), []byte(got))
+}
@@ -1,6 +1,7 @@
 package hash
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -84,3 +85,106 @@ func TestVerifyHash(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculateHash_HMAC(t *testing.T) {
+	// RFC 4231 test case 2.
+	got := CalculateHash("what do ya want for nothing?", "Jefe")
+	want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("CalculateHash() = %v, want %v", got, want)
+	}
+	if got == CalculateLegacyHash("what do ya want for nothing?", "Jefe") {
+		t.Error("CalculateHash() must differ from the legacy hash")
+	}
+}
+
+func TestKeyring_Verify(t *testing.T) {
+	keyring := NewKeyring("primary", map[string]string{"k2": "second"}, false)
+	legacyKeyring := NewKeyring("primary", nil, true)
+
+	tests := []struct {
+		name       string
+		keyring    *Keyring
+		keyID      string
+		hash       string
+		wantLegacy bool
+		wantErr    bool
+	}{
+		{
+			name:    "Test #1 primary key",
+			keyring: keyring,
+			keyID:   "",
+			hash:    CalculateHash("data", "primary"),
+		},
+		{
+			name:    "Test #2 rotated key",
+			keyring: keyring,
+			keyID:   "k2",
+			hash:    CalculateHash("data", "second"),
+		},
+		{
+			name:    "Test #3 wrong key for id",
+			keyring: keyring,
+			keyID:   "k2",
+			hash:    CalculateHash("data", "primary"),
+			wantErr: true,
+		},
+		{
+			name:    "Test #4 unknown key id",
+			keyring: keyring,
+			keyID:   "k3",
+			hash:    CalculateHash("data", "primary"),
+			wantErr: true,
+		},
+		{
+			name:    "Test #5 legacy hash rejected without compatibility mode",
+			keyring: keyring,
+			hash:    CalculateLegacyHash("data", "primary"),
+			wantErr: true,
+		},
+		{
+			name:       "Test #6 legacy hash accepted in compatibility mode",
+			keyring:    legacyKeyring,
+			hash:       CalculateLegacyHash("data", "primary"),
+			wantLegacy: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			legacy, err := tt.keyring.Verify("data", tt.keyID, tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if legacy != tt.wantLegacy {
+				t.Errorf("Verify() legacy = %v, want %v", legacy, tt.wantLegacy)
+			}
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty", "", map[string]string{}, false},
+		{"two keys", "k1:one, k2:two", map[string]string{"k1": "one", "k2": "two"}, false},
+		{"key with colon", "k1:a:b", map[string]string{"k1": "a:b"}, false},
+		{"missing key", "k1", nil, true},
+		{"duplicate id", "k1:one,k1:two", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKeys(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
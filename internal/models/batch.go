@@ -0,0 +1,28 @@
+package models
+
+// BatchModeHeader selects how the server handles invalid items of a batch update.
+const BatchModeHeader = "X-Batch-Mode"
+
+// Batch update modes.
+const (
+	// BatchModeStrict rejects the whole batch when any item is invalid. It is the default.
+	BatchModeStrict = "strict"
+	// BatchModeBestEffort stores the valid items of a batch and reports the invalid ones.
+	BatchModeBestEffort = "best-effort"
+)
+
+// RejectedMetric describes an item of a batch update that was not stored.
+type RejectedMetric struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id"`
+	MType  string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// BatchResult is the response to a batch update.
+type BatchResult struct {
+	Mode          string           `json:"mode"`
+	Accepted      int              `json:"accepted"`
+	RejectedTotal int              `json:"rejected_total"`
+	Rejected      []RejectedMetric `json:"rejected"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// ErrorResponse is the body of an error response of the metrics API.
+type ErrorResponse struct {
+	// Code is a stable, machine-readable error code such as "metric_not_found".
+	Code string `json:"code"`
+	// Message is a human-readable description of the error.
+	Message string `json:"message"`
+	// Details carries additional, code-specific information, such as the BatchResult of a rejected batch.
+	Details interface{} `json:"details,omitempty"`
+	// RequestID is the ID of the failed request, also sent in the X-Request-ID response header.
+	RequestID string `json:"request_id,omitempty"`
+}
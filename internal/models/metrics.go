@@ -1,10 +1,100 @@
 // Package models defines data structures for metrics used in API requests and responses.
 package models
 
+import "time"
+
+// Counter modes of models.Metrics.
+const (
+	// CounterModeDelta marks the Delta of a counter as an increment. It is the default.
+	CounterModeDelta = "delta"
+	// CounterModeCumulative marks the Delta of a counter as the running total since the sender started.
+	// The server converts running totals to increments and detects the resets of restarted senders.
+	CounterModeCumulative = "cumulative"
+)
+
 // Metrics represents a metric in API requests and responses.
 type Metrics struct {
 	ID    string   `json:"id"`
 	MType string   `json:"type"`
 	Delta *int64   `json:"delta,omitempty"`
 	Value *float64 `json:"value,omitempty"`
+	// Mode is the counter mode of a request, CounterModeDelta when empty. It is ignored for gauges.
+	Mode string `json:"mode,omitempty"`
+	// Stale is set in responses on metrics not updated within their TTL.
+	Stale bool `json:"stale,omitempty"`
+	// Metadata is set in responses on metrics with registered metadata.
+	Metadata *MetricMetadata `json:"metadata,omitempty"`
+	// Rollup is set in responses on gauges queried with the rollup parameter.
+	Rollup *Rollup `json:"rollup,omitempty"`
+}
+
+// MetricMetadata describes what a metric measures.
+type MetricMetadata struct {
+	// Unit is the unit of the values, e.g. bytes, seconds or percent. It is empty for plain counts.
+	Unit  string `json:"unit,omitempty"`
+	Help  string `json:"help,omitempty"`
+	Owner string `json:"owner,omitempty"`
+}
+
+// MetadataUpdate registers the metadata of a metric. Agents send them to POST /metadata/, or the
+// UpdateMetadata gRPC call, until they are accepted.
+type MetadataUpdate struct {
+	ID    string `json:"id"`
+	MType string `json:"type,omitempty"`
+	MetricMetadata
+}
+
+// MetricList is a page of metrics returned by the v1 API.
+type MetricList struct {
+	Metrics []Metrics `json:"metrics"`
+	// NextCursor is passed as the cursor parameter to fetch the next page. It is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// CounterRate is the increase of a counter within a window, returned by the v1 API.
+type CounterRate struct {
+	ID string `json:"id"`
+	// Window is the length of the window in seconds.
+	Window   float64 `json:"window"`
+	Increase int64   `json:"increase"`
+	// Rate is the average increase per second.
+	Rate float64 `json:"rate"`
+	// Resets is the number of restarts of cumulative senders detected within the window.
+	Resets int `json:"resets"`
+}
+
+// Rollup holds the statistics of the values of a gauge within a window.
+type Rollup struct {
+	// Start is the beginning of the window, a multiple of its length since the Unix epoch.
+	Start time.Time `json:"start"`
+	// Window is the length of the window in seconds.
+	Window float64 `json:"window"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Avg    float64 `json:"avg"`
+	Sum    float64 `json:"sum"`
+	Count  int64   `json:"count"`
+	// Last is the most recent value within the window.
+	Last float64 `json:"last"`
+}
+
+// RollupList is the retained rollups of a gauge returned by the v1 API, oldest first.
+type RollupList struct {
+	ID      string   `json:"id"`
+	Rollups []Rollup `json:"rollups"`
+}
+
+// QueryResult is the result of a query of /api/query.
+type QueryResult struct {
+	// Type is "scalar" or "vector". Scalars are returned as a single sample without a name.
+	Type    string        `json:"type"`
+	Samples []QuerySample `json:"samples"`
+}
+
+// QuerySample is a value of a QueryResult.
+type QuerySample struct {
+	// Name is the name of the metric the value was computed from, empty for scalars and aggregations.
+	Name string `json:"name,omitempty"`
+	// Value is null when it is not a finite number, such as the result of a division by zero.
+	Value *float64 `json:"value"`
 }
@@ -0,0 +1,73 @@
+package proto
+
+import (
+	"fmt"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+)
+
+// FromModel converts an HTTP API metric to its protobuf form.
+func FromModel(m *models.Metrics) *Metric {
+	metric := &Metric{Id: m.ID, Delta: m.Delta, Value: m.Value}
+	switch m.MType {
+	case constants.MetricTypeGauge:
+		metric.Type = Metric_TYPE_GAUGE
+	case constants.MetricTypeCounter:
+		metric.Type = Metric_TYPE_COUNTER
+	}
+	if m.Mode == models.CounterModeCumulative {
+		metric.Mode = Metric_COUNTER_MODE_CUMULATIVE
+	}
+	return metric
+}
+
+// FromModels converts HTTP API metrics to their protobuf form.
+func FromModels(metrics []*models.Metrics) []*Metric {
+	result := make([]*Metric, 0, len(metrics))
+	for _, m := range metrics {
+		result = append(result, FromModel(m))
+	}
+	return result
+}
+
+// ToModel converts a protobuf metric to the HTTP API model.
+func ToModel(m *Metric) (models.Metrics, error) {
+	metric := models.Metrics{ID: m.GetId(), Delta: m.Delta, Value: m.Value}
+	switch m.GetType() {
+	case Metric_TYPE_GAUGE:
+		metric.MType = constants.MetricTypeGauge
+	case Metric_TYPE_COUNTER:
+		metric.MType = constants.MetricTypeCounter
+	default:
+		return models.Metrics{}, fmt.Errorf("unknown metric type %v", m.GetType())
+	}
+	switch m.GetMode() {
+	case Metric_COUNTER_MODE_DELTA:
+	case Metric_COUNTER_MODE_CUMULATIVE:
+		if metric.MType == constants.MetricTypeCounter {
+			metric.Mode = models.CounterModeCumulative
+		}
+	default:
+		return models.Metrics{}, fmt.Errorf("unknown counter mode %v", m.GetMode())
+	}
+	return metric, nil
+}
+
+// FromModelMetadata converts HTTP API metadata updates to their protobuf form.
+func FromModelMetadata(updates []models.MetadataUpdate) []*MetricMetadata {
+	result := make([]*MetricMetadata, 0, len(updates))
+	for _, u := range updates {
+		result = append(result, &MetricMetadata{Id: u.ID, Type: u.MType, Unit: u.Unit, Help: u.Help, Owner: u.Owner})
+	}
+	return result
+}
+
+// ToModelMetadata converts protobuf metadata to the HTTP API model.
+func ToModelMetadata(m *MetricMetadata) models.MetadataUpdate {
+	return models.MetadataUpdate{
+		ID:             m.GetId(),
+		MType:          m.GetType(),
+		MetricMetadata: models.MetricMetadata{Unit: m.GetUnit(), Help: m.GetHelp(), Owner: m.GetOwner()},
+	}
+}
@@ -0,0 +1,54 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+)
+
+func TestModelRoundTrip(t *testing.T) {
+	delta := int64(5)
+	value := 1.5
+	tests := []struct {
+		name  string
+		model models.Metrics
+	}{
+		{"Test #1 counter", models.Metrics{ID: "PollCount", MType: constants.MetricTypeCounter, Delta: &delta}},
+		{"Test #2 gauge", models.Metrics{ID: "HeapAlloc", MType: constants.MetricTypeGauge, Value: &value}},
+		{"Test #3 cumulative counter", models.Metrics{ID: "PollCount", MType: constants.MetricTypeCounter, Delta: &delta, Mode: models.CounterModeCumulative}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToModel(FromModel(&tt.model))
+			require.NoError(t, err)
+			assert.Equal(t, tt.model, got)
+		})
+	}
+}
+
+func TestToModel_UnknownType(t *testing.T) {
+	_, err := ToModel(&Metric{Id: "x"})
+	assert.Error(t, err)
+}
+
+func TestToModel_UnknownCounterMode(t *testing.T) {
+	delta := int64(1)
+	_, err := ToModel(&Metric{Id: "x", Type: Metric_TYPE_COUNTER, Delta: &delta, Mode: Metric_CounterMode(7)})
+	assert.Error(t, err)
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	updates := []models.MetadataUpdate{
+		{ID: "TotalMemory", MType: constants.MetricTypeGauge, MetricMetadata: models.MetricMetadata{Unit: "bytes", Help: "Total amount of RAM.", Owner: "agent"}},
+		{ID: "Unknown"},
+	}
+	converted := FromModelMetadata(updates)
+	require.Len(t, converted, 2)
+	for i, m := range converted {
+		assert.Equal(t, updates[i], ToModelMetadata(m))
+	}
+}
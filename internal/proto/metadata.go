@@ -0,0 +1,33 @@
+package proto
+
+import (
+	"strconv"
+
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/a2sh3r/sysmetrics/internal/hash"
+)
+
+// Metadata keys of the Metrics service. They carry the same values as the HTTP headers of the same name.
+const (
+	AuthorizationMetadataKey = "authorization"
+	HashMetadataKey          = "hashsha256"
+	HashKeyIDMetadataKey     = "hashkeyid"
+	TimestampMetadataKey     = "x-request-timestamp"
+	NonceMetadataKey         = "x-request-nonce"
+	TenantMetadataKey        = "x-tenant-id"
+	InstanceMetadataKey      = "x-agent-instance"
+	RealIPMetadataKey        = "x-real-ip"
+	ForwardedForMetadataKey  = "x-forwarded-for"
+)
+
+// Marshal marshals a message deterministically, the form its signature is calculated over.
+func Marshal(m protobuf.Message) ([]byte, error) {
+	return protobuf.MarshalOptions{Deterministic: true}.Marshal(m)
+}
+
+// StreamPayload builds the data signed for the seq-th batch of a StreamMetrics call opened with
+// the given timestamp and nonce, binding every batch to its stream and position.
+func StreamPayload(timestamp, nonce string, seq int, batch []byte) string {
+	return hash.SignedPayload(timestamp, nonce+"/"+strconv.Itoa(seq), string(batch))
+}
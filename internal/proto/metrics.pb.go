@@ -0,0 +1,626 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.29.3
+// source: metrics.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Metric_Type int32
+
+const (
+	Metric_TYPE_UNSPECIFIED Metric_Type = 0
+	Metric_TYPE_GAUGE       Metric_Type = 1
+	Metric_TYPE_COUNTER     Metric_Type = 2
+)
+
+// Enum value maps for Metric_Type.
+var (
+	Metric_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "TYPE_GAUGE",
+		2: "TYPE_COUNTER",
+	}
+	Metric_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"TYPE_GAUGE":       1,
+		"TYPE_COUNTER":     2,
+	}
+)
+
+func (x Metric_Type) Enum() *Metric_Type {
+	p := new(Metric_Type)
+	*p = x
+	return p
+}
+
+func (x Metric_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Metric_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_metrics_proto_enumTypes[0].Descriptor()
+}
+
+func (Metric_Type) Type() protoreflect.EnumType {
+	return &file_metrics_proto_enumTypes[0]
+}
+
+func (x Metric_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Metric_Type.Descriptor instead.
+func (Metric_Type) EnumDescriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{0, 0}
+}
+
+// CounterMode tells how the delta of a counter is interpreted.
+type Metric_CounterMode int32
+
+const (
+	// COUNTER_MODE_DELTA marks the delta as an increment.
+	Metric_COUNTER_MODE_DELTA Metric_CounterMode = 0
+	// COUNTER_MODE_CUMULATIVE marks the delta as the running total since the sender started.
+	Metric_COUNTER_MODE_CUMULATIVE Metric_CounterMode = 1
+)
+
+// Enum value maps for Metric_CounterMode.
+var (
+	Metric_CounterMode_name = map[int32]string{
+		0: "COUNTER_MODE_DELTA",
+		1: "COUNTER_MODE_CUMULATIVE",
+	}
+	Metric_CounterMode_value = map[string]int32{
+		"COUNTER_MODE_DELTA":      0,
+		"COUNTER_MODE_CUMULATIVE": 1,
+	}
+)
+
+func (x Metric_CounterMode) Enum() *Metric_CounterMode {
+	p := new(Metric_CounterMode)
+	*p = x
+	return p
+}
+
+func (x Metric_CounterMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Metric_CounterMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_metrics_proto_enumTypes[1].Descriptor()
+}
+
+func (Metric_CounterMode) Type() protoreflect.EnumType {
+	return &file_metrics_proto_enumTypes[1]
+}
+
+func (x Metric_CounterMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Metric_CounterMode.Descriptor instead.
+func (Metric_CounterMode) EnumDescriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{0, 1}
+}
+
+// Metric mirrors models.Metrics.
+type Metric struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type  Metric_Type            `protobuf:"varint,2,opt,name=type,proto3,enum=sysmetrics.v1.Metric_Type" json:"type,omitempty"`
+	// Delta is set for counters.
+	Delta *int64 `protobuf:"varint,3,opt,name=delta,proto3,oneof" json:"delta,omitempty"`
+	// Value is set for gauges.
+	Value *float64 `protobuf:"fixed64,4,opt,name=value,proto3,oneof" json:"value,omitempty"`
+	// Mode is the counter mode; it is ignored for gauges.
+	Mode          Metric_CounterMode `protobuf:"varint,5,opt,name=mode,proto3,enum=sysmetrics.v1.Metric_CounterMode" json:"mode,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Metric) Reset() {
+	*x = Metric{}
+	mi := &file_metrics_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Metric) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Metric) ProtoMessage() {}
+
+func (x *Metric) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Metric.ProtoReflect.Descriptor instead.
+func (*Metric) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Metric) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Metric) GetType() Metric_Type {
+	if x != nil {
+		return x.Type
+	}
+	return Metric_TYPE_UNSPECIFIED
+}
+
+func (x *Metric) GetDelta() int64 {
+	if x != nil && x.Delta != nil {
+		return *x.Delta
+	}
+	return 0
+}
+
+func (x *Metric) GetValue() float64 {
+	if x != nil && x.Value != nil {
+		return *x.Value
+	}
+	return 0
+}
+
+func (x *Metric) GetMode() Metric_CounterMode {
+	if x != nil {
+		return x.Mode
+	}
+	return Metric_COUNTER_MODE_DELTA
+}
+
+type UpdateMetricsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateMetricsRequest) Reset() {
+	*x = UpdateMetricsRequest{}
+	mi := &file_metrics_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateMetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateMetricsRequest) ProtoMessage() {}
+
+func (x *UpdateMetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateMetricsRequest.ProtoReflect.Descriptor instead.
+func (*UpdateMetricsRequest) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UpdateMetricsRequest) GetMetrics() []*Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+type UpdateMetricsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Accepted is the number of metrics stored.
+	Accepted      uint32 `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateMetricsResponse) Reset() {
+	*x = UpdateMetricsResponse{}
+	mi := &file_metrics_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateMetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateMetricsResponse) ProtoMessage() {}
+
+func (x *UpdateMetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateMetricsResponse.ProtoReflect.Descriptor instead.
+func (*UpdateMetricsResponse) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UpdateMetricsResponse) GetAccepted() uint32 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+// StreamMetricsRequest is a single batch of a metrics stream. When the server verifies signatures,
+// hash is the HMAC-SHA256 of the deterministically marshaled batch bound to the stream timestamp,
+// nonce and the zero-based batch sequence number.
+type StreamMetricsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Batch         *UpdateMetricsRequest  `protobuf:"bytes,1,opt,name=batch,proto3" json:"batch,omitempty"`
+	Hash          string                 `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamMetricsRequest) Reset() {
+	*x = StreamMetricsRequest{}
+	mi := &file_metrics_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamMetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamMetricsRequest) ProtoMessage() {}
+
+func (x *StreamMetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamMetricsRequest.ProtoReflect.Descriptor instead.
+func (*StreamMetricsRequest) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *StreamMetricsRequest) GetBatch() *UpdateMetricsRequest {
+	if x != nil {
+		return x.Batch
+	}
+	return nil
+}
+
+func (x *StreamMetricsRequest) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+// MetricMetadata mirrors models.MetadataUpdate.
+type MetricMetadata struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Type is "gauge", "counter" or empty.
+	Type          string `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Unit          string `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+	Help          string `protobuf:"bytes,4,opt,name=help,proto3" json:"help,omitempty"`
+	Owner         string `protobuf:"bytes,5,opt,name=owner,proto3" json:"owner,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricMetadata) Reset() {
+	*x = MetricMetadata{}
+	mi := &file_metrics_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricMetadata) ProtoMessage() {}
+
+func (x *MetricMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricMetadata.ProtoReflect.Descriptor instead.
+func (*MetricMetadata) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *MetricMetadata) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *MetricMetadata) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *MetricMetadata) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *MetricMetadata) GetHelp() string {
+	if x != nil {
+		return x.Help
+	}
+	return ""
+}
+
+func (x *MetricMetadata) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+type UpdateMetadataRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metadata      []*MetricMetadata      `protobuf:"bytes,1,rep,name=metadata,proto3" json:"metadata,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateMetadataRequest) Reset() {
+	*x = UpdateMetadataRequest{}
+	mi := &file_metrics_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateMetadataRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateMetadataRequest) ProtoMessage() {}
+
+func (x *UpdateMetadataRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateMetadataRequest.ProtoReflect.Descriptor instead.
+func (*UpdateMetadataRequest) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *UpdateMetadataRequest) GetMetadata() []*MetricMetadata {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+type UpdateMetadataResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Registered is the number of metrics whose metadata was registered.
+	Registered    uint32 `protobuf:"varint,1,opt,name=registered,proto3" json:"registered,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateMetadataResponse) Reset() {
+	*x = UpdateMetadataResponse{}
+	mi := &file_metrics_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateMetadataResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateMetadataResponse) ProtoMessage() {}
+
+func (x *UpdateMetadataResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateMetadataResponse.ProtoReflect.Descriptor instead.
+func (*UpdateMetadataResponse) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UpdateMetadataResponse) GetRegistered() uint32 {
+	if x != nil {
+		return x.Registered
+	}
+	return 0
+}
+
+var File_metrics_proto protoreflect.FileDescriptor
+
+const file_metrics_proto_rawDesc = "" +
+	"\n" +
+	"\rmetrics.proto\x12\rsysmetrics.v1\"\xcd\x02\n" +
+	"\x06Metric\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12.\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x1a.sysmetrics.v1.Metric.TypeR\x04type\x12\x19\n" +
+	"\x05delta\x18\x03 \x01(\x03H\x00R\x05delta\x88\x01\x01\x12\x19\n" +
+	"\x05value\x18\x04 \x01(\x01H\x01R\x05value\x88\x01\x01\x125\n" +
+	"\x04mode\x18\x05 \x01(\x0e2!.sysmetrics.v1.Metric.CounterModeR\x04mode\">\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\x0e\n" +
+	"\n" +
+	"TYPE_GAUGE\x10\x01\x12\x10\n" +
+	"\fTYPE_COUNTER\x10\x02\"B\n" +
+	"\vCounterMode\x12\x16\n" +
+	"\x12COUNTER_MODE_DELTA\x10\x00\x12\x1b\n" +
+	"\x17COUNTER_MODE_CUMULATIVE\x10\x01B\b\n" +
+	"\x06_deltaB\b\n" +
+	"\x06_value\"G\n" +
+	"\x14UpdateMetricsRequest\x12/\n" +
+	"\ametrics\x18\x01 \x03(\v2\x15.sysmetrics.v1.MetricR\ametrics\"3\n" +
+	"\x15UpdateMetricsResponse\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\rR\baccepted\"e\n" +
+	"\x14StreamMetricsRequest\x129\n" +
+	"\x05batch\x18\x01 \x01(\v2#.sysmetrics.v1.UpdateMetricsRequestR\x05batch\x12\x12\n" +
+	"\x04hash\x18\x02 \x01(\tR\x04hash\"r\n" +
+	"\x0eMetricMetadata\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x12\n" +
+	"\x04unit\x18\x03 \x01(\tR\x04unit\x12\x12\n" +
+	"\x04help\x18\x04 \x01(\tR\x04help\x12\x14\n" +
+	"\x05owner\x18\x05 \x01(\tR\x05owner\"R\n" +
+	"\x15UpdateMetadataRequest\x129\n" +
+	"\bmetadata\x18\x01 \x03(\v2\x1d.sysmetrics.v1.MetricMetadataR\bmetadata\"8\n" +
+	"\x16UpdateMetadataResponse\x12\x1e\n" +
+	"\n" +
+	"registered\x18\x01 \x01(\rR\n" +
+	"registered2\xa2\x02\n" +
+	"\aMetrics\x12Z\n" +
+	"\rUpdateMetrics\x12#.sysmetrics.v1.UpdateMetricsRequest\x1a$.sysmetrics.v1.UpdateMetricsResponse\x12\\\n" +
+	"\rStreamMetrics\x12#.sysmetrics.v1.StreamMetricsRequest\x1a$.sysmetrics.v1.UpdateMetricsResponse(\x01\x12]\n" +
+	"\x0eUpdateMetadata\x12$.sysmetrics.v1.UpdateMetadataRequest\x1a%.sysmetrics.v1.UpdateMetadataResponseB-Z+github.com/a2sh3r/sysmetrics/internal/protob\x06proto3"
+
+var (
+	file_metrics_proto_rawDescOnce sync.Once
+	file_metrics_proto_rawDescData []byte
+)
+
+func file_metrics_proto_rawDescGZIP() []byte {
+	file_metrics_proto_rawDescOnce.Do(func() {
+		file_metrics_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_metrics_proto_rawDesc), len(file_metrics_proto_rawDesc)))
+	})
+	return file_metrics_proto_rawDescData
+}
+
+var file_metrics_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_metrics_proto_goTypes = []any{
+	(Metric_Type)(0),               // 0: sysmetrics.v1.Metric.Type
+	(Metric_CounterMode)(0),        // 1: sysmetrics.v1.Metric.CounterMode
+	(*Metric)(nil),                 // 2: sysmetrics.v1.Metric
+	(*UpdateMetricsRequest)(nil),   // 3: sysmetrics.v1.UpdateMetricsRequest
+	(*UpdateMetricsResponse)(nil),  // 4: sysmetrics.v1.UpdateMetricsResponse
+	(*StreamMetricsRequest)(nil),   // 5: sysmetrics.v1.StreamMetricsRequest
+	(*MetricMetadata)(nil),         // 6: sysmetrics.v1.MetricMetadata
+	(*UpdateMetadataRequest)(nil),  // 7: sysmetrics.v1.UpdateMetadataRequest
+	(*UpdateMetadataResponse)(nil), // 8: sysmetrics.v1.UpdateMetadataResponse
+}
+var file_metrics_proto_depIdxs = []int32{
+	0, // 0: sysmetrics.v1.Metric.type:type_name -> sysmetrics.v1.Metric.Type
+	1, // 1: sysmetrics.v1.Metric.mode:type_name -> sysmetrics.v1.Metric.CounterMode
+	2, // 2: sysmetrics.v1.UpdateMetricsRequest.metrics:type_name -> sysmetrics.v1.Metric
+	3, // 3: sysmetrics.v1.StreamMetricsRequest.batch:type_name -> sysmetrics.v1.UpdateMetricsRequest
+	6, // 4: sysmetrics.v1.UpdateMetadataRequest.metadata:type_name -> sysmetrics.v1.MetricMetadata
+	3, // 5: sysmetrics.v1.Metrics.UpdateMetrics:input_type -> sysmetrics.v1.UpdateMetricsRequest
+	5, // 6: sysmetrics.v1.Metrics.StreamMetrics:input_type -> sysmetrics.v1.StreamMetricsRequest
+	7, // 7: sysmetrics.v1.Metrics.UpdateMetadata:input_type -> sysmetrics.v1.UpdateMetadataRequest
+	4, // 8: sysmetrics.v1.Metrics.UpdateMetrics:output_type -> sysmetrics.v1.UpdateMetricsResponse
+	4, // 9: sysmetrics.v1.Metrics.StreamMetrics:output_type -> sysmetrics.v1.UpdateMetricsResponse
+	8, // 10: sysmetrics.v1.Metrics.UpdateMetadata:output_type -> sysmetrics.v1.UpdateMetadataResponse
+	8, // [8:11] is the sub-list for method output_type
+	5, // [5:8] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_metrics_proto_init() }
+func file_metrics_proto_init() {
+	if File_metrics_proto != nil {
+		return
+	}
+	file_metrics_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_metrics_proto_rawDesc), len(file_metrics_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_metrics_proto_goTypes,
+		DependencyIndexes: file_metrics_proto_depIdxs,
+		EnumInfos:         file_metrics_proto_enumTypes,
+		MessageInfos:      file_metrics_proto_msgTypes,
+	}.Build()
+	File_metrics_proto = out.File
+	file_metrics_proto_goTypes = nil
+	file_metrics_proto_depIdxs = nil
+}
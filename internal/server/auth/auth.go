@@ -0,0 +1,138 @@
+// Package auth provides API token authentication with scopes.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+// Scopes granted to API tokens.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+var ErrInvalidToken = errors.New("invalid API token")
+
+// Token describes an API token. Only the SHA-256 hash of the secret is kept.
+// A token with a tenant can only access the metrics of that tenant.
+type Token struct {
+	Name   string
+	Hash   string
+	Scopes []string
+	Tenant string
+}
+
+// Store holds the configured API tokens indexed by their hash.
+type Store struct {
+	tokens map[string]Token
+}
+
+// HashToken returns the hex-encoded SHA-256 hash of a token secret, the form tokens are configured in.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseTokens parses a semicolon-separated list of name:sha256hex:scope,scope[:tenant] token entries.
+func ParseTokens(s string) (*Store, error) {
+	store := &Store{tokens: make(map[string]Token)}
+	names := make(map[string]struct{})
+
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if (len(parts) != 3 && len(parts) != 4) || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("token must be in format name:sha256hex:scopes[:tenant], got %q", entry)
+		}
+		name, tokenHash := parts[0], strings.ToLower(parts[1])
+
+		if decoded, err := hex.DecodeString(tokenHash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("token %q hash must be a hex-encoded SHA-256 digest", name)
+		}
+
+		scopes, err := parseScopes(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("token %q: %w", name, err)
+		}
+
+		var tenant string
+		if len(parts) == 4 {
+			tenant = strings.TrimSpace(parts[3])
+			if tenant == "" || !identity.ValidTenant(tenant) {
+				return nil, fmt.Errorf("token %q: invalid tenant %q", name, parts[3])
+			}
+		}
+
+		if _, exists := names[name]; exists {
+			return nil, fmt.Errorf("duplicate token name %q", name)
+		}
+		if _, exists := store.tokens[tokenHash]; exists {
+			return nil, fmt.Errorf("duplicate token hash for %q", name)
+		}
+		names[name] = struct{}{}
+		store.tokens[tokenHash] = Token{Name: name, Hash: tokenHash, Scopes: scopes, Tenant: tenant}
+	}
+
+	return store, nil
+}
+
+// Enabled reports whether any token is configured. Authentication is not enforced otherwise.
+func (s *Store) Enabled() bool {
+	return s != nil && len(s.tokens) > 0
+}
+
+// Authenticate returns the token matching the given secret.
+func (s *Store) Authenticate(secret string) (Token, error) {
+	if secret == "" {
+		return Token{}, ErrInvalidToken
+	}
+	token, ok := s.tokens[HashToken(secret)]
+	if !ok {
+		return Token{}, ErrInvalidToken
+	}
+	return token, nil
+}
+
+// HasScope reports whether scopes grant want. The admin scope grants every scope.
+func HasScope(scopes []string, want string) bool {
+	for _, scope := range scopes {
+		if scope == want || scope == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func parseScopes(s string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.TrimSpace(scope)
+		switch scope {
+		case ScopeRead, ScopeWrite, ScopeAdmin:
+			scopes = append(scopes, scope)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	return scopes, nil
+}
+
+// DenyAll returns an enabled store that accepts no token.
+func DenyAll() *Store {
+	return &Store{tokens: map[string]Token{"": {}}}
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTokens(t *testing.T) {
+	agentHash := HashToken("agent-secret")
+	grafanaHash := HashToken("grafana-secret")
+
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"empty", "", 0, false},
+		{"two tokens", "agent:" + agentHash + ":write; grafana:" + grafanaHash + ":read", 2, false},
+		{"multiple scopes", "ops:" + agentHash + ":read,write", 1, false},
+		{"missing scopes", "agent:" + agentHash + ":", 0, true},
+		{"unknown scope", "agent:" + agentHash + ":delete", 0, true},
+		{"plain token instead of hash", "agent:agent-secret:write", 0, true},
+		{"wrong format", "agent:" + agentHash, 0, true},
+		{"duplicate name", "agent:" + agentHash + ":write;agent:" + grafanaHash + ":read", 0, true},
+		{"duplicate hash", "a:" + agentHash + ":write;b:" + agentHash + ":read", 0, true},
+		{"tenant", "agent:" + agentHash + ":write:team-a", 1, false},
+		{"empty tenant", "agent:" + agentHash + ":write:", 0, true},
+		{"invalid tenant", "agent:" + agentHash + ":write:team/a", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := ParseTokens(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, store.tokens, tt.want)
+			assert.Equal(t, tt.want > 0, store.Enabled())
+		})
+	}
+}
+
+func TestStore_Authenticate(t *testing.T) {
+	store, err := ParseTokens("agent:" + HashToken("agent-secret") + ":write")
+	require.NoError(t, err)
+
+	token, err := store.Authenticate("agent-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "agent", token.Name)
+	assert.Equal(t, []string{ScopeWrite}, token.Scopes)
+	assert.Empty(t, token.Tenant)
+
+	_, err = store.Authenticate("wrong")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = store.Authenticate("")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestStore_Authenticate_Tenant(t *testing.T) {
+	store, err := ParseTokens("team-a:" + HashToken("team-a-secret") + ":read,write:team-a")
+	require.NoError(t, err)
+
+	token, err := store.Authenticate("team-a-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "team-a", token.Tenant)
+}
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		want   string
+		ok     bool
+	}{
+		{"exact", []string{ScopeRead}, ScopeRead, true},
+		{"missing", []string{ScopeRead}, ScopeWrite, false},
+		{"admin grants write", []string{ScopeAdmin}, ScopeWrite, true},
+		{"write does not grant admin", []string{ScopeWrite}, ScopeAdmin, false},
+		{"none", nil, ScopeRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.ok, HasScope(tt.scopes, tt.want))
+		})
+	}
+}
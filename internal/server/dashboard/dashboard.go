@@ -0,0 +1,92 @@
+// Package dashboard serves the embedded HTML dashboard of the metrics server.
+//
+// The dashboard is a set of static pages that read the /api/v1 endpoints of the server: a sortable and
+// filterable metric table and a detail page per metric with a sparkline of its recent history. The
+// history of gauges comes from their rollups when rollups are enabled; otherwise, and for counters,
+// the page plots the values it observed since it was opened. All assets are embedded, so the
+// dashboard works without access to the internet.
+//
+// The pages hold no metrics and are meant to be served without authentication. When the server
+// requires API tokens, users enter a token with the read scope in the page, which sends it to
+// /api/v1 for the rest of the browser session.
+package dashboard
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+)
+
+//go:embed static
+var static embed.FS
+
+// DefaultRefreshInterval is the auto-refresh interval the pages start with.
+const DefaultRefreshInterval = 5 * time.Second
+
+// Config configures the dashboard.
+type Config struct {
+	// RollupWindow is the window length of the gauge rollups plotted on the detail pages. Pages plot
+	// the values they observe when it is zero.
+	RollupWindow time.Duration
+	// RefreshInterval is the auto-refresh interval the pages start with, DefaultRefreshInterval when zero.
+	RefreshInterval time.Duration
+}
+
+// settings is the body of config.json, read by the pages on load.
+type settings struct {
+	// RollupWindow is a Go duration such as 1m, empty when rollups are disabled.
+	RollupWindow string `json:"rollup_window,omitempty"`
+	// Refresh is the initial auto-refresh interval in seconds.
+	Refresh float64 `json:"refresh"`
+}
+
+// New returns a handler serving the dashboard at the root of its path. Mount it with
+// http.StripPrefix to serve it under another path.
+func New(cfg Config) http.Handler {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	s := settings{Refresh: DefaultRefreshInterval.Seconds()}
+	if cfg.RefreshInterval > 0 {
+		s.Refresh = cfg.RefreshInterval.Seconds()
+	}
+	if cfg.RollupWindow > 0 {
+		s.RollupWindow = formatWindow(cfg.RollupWindow)
+	}
+	body, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		if _, err := w.Write(body); err != nil {
+			logger.Log.Error("Failed to write dashboard config", zap.Error(err))
+		}
+	})
+	mux.Handle("/", http.FileServer(http.FS(assets)))
+	return mux
+}
+
+// formatWindow formats a window length in its largest whole unit, e.g. 5m rather than 5m0s.
+func formatWindow(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
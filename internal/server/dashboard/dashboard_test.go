@@ -0,0 +1,81 @@
+package dashboard
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	handler := New(Config{RollupWindow: time.Minute})
+
+	tests := []struct {
+		name            string
+		url             string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{name: "Test #1 index", url: "/", wantStatus: http.StatusOK, wantContentType: "text/html; charset=utf-8", wantBody: `<script src="dashboard.js">`},
+		{name: "Test #2 detail page", url: "/metric.html?name=Alloc", wantStatus: http.StatusOK, wantContentType: "text/html; charset=utf-8", wantBody: `id="sparkline"`},
+		{name: "Test #3 script", url: "/dashboard.js", wantStatus: http.StatusOK, wantContentType: "text/javascript; charset=utf-8", wantBody: "const dashboard"},
+		{name: "Test #4 styles", url: "/dashboard.css", wantStatus: http.StatusOK, wantContentType: "text/css; charset=utf-8", wantBody: ".sparkline"},
+		{name: "Test #5 config", url: "/config.json", wantStatus: http.StatusOK, wantContentType: "application/json", wantBody: `{"rollup_window":"1m","refresh":5}`},
+		{name: "Test #6 missing asset", url: "/missing.js", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			require.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantContentType != "" {
+				assert.Equal(t, tt.wantContentType, rec.Header().Get("Content-Type"))
+			}
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestNew_Config(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		wantBody string
+	}{
+		{name: "Test #1 rollups disabled", cfg: Config{RefreshInterval: 15 * time.Second}, wantBody: `{"refresh":15}`},
+		{name: "Test #2 hours", cfg: Config{RollupWindow: 2 * time.Hour}, wantBody: `{"rollup_window":"2h","refresh":5}`},
+		{name: "Test #3 seconds", cfg: Config{RollupWindow: 90 * time.Second}, wantBody: `{"rollup_window":"1m30s","refresh":5}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			New(tt.cfg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config.json", nil))
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, tt.wantBody, rec.Body.String())
+		})
+	}
+}
+
+// externalRef matches references to resources on other hosts, such as scripts or styles from a CDN.
+var externalRef = regexp.MustCompile(`(?i)(src|href)\s*=\s*["']?(https?:)?//|url\(\s*["']?(https?:)?//|@import|fetch\(\s*["'](https?:)?//`)
+
+func TestAssets_NoExternalDependencies(t *testing.T) {
+	err := fs.WalkDir(static, "static", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(static, path)
+		require.NoError(t, err)
+		assert.Empty(t, externalRef.FindAllString(string(content), -1), "%s references external resources", path)
+		return nil
+	})
+	require.NoError(t, err)
+}
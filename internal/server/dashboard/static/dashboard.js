@@ -0,0 +1,308 @@
+// Dashboard of the metrics server. It reads the /api/v1 endpoints and has no dependencies. When the
+// server requires API tokens, the token entered in the page is kept for the browser session and sent
+// with every request.
+"use strict";
+
+const dashboard = (() => {
+  const api = "/api/v1";
+  const maxSamples = 120;
+  const tokenKey = "sysmetrics.token";
+
+  async function getJSON(url) {
+    const headers = { Accept: "application/json" };
+    const token = sessionStorage.getItem(tokenKey);
+    if (token) {
+      headers.Authorization = "Bearer " + token;
+    }
+    const resp = await fetch(url, { headers: headers });
+    if (!resp.ok) {
+      let message = resp.status + " " + resp.statusText;
+      if (resp.status === 401) {
+        message = token ? "the API token was rejected" : "the server requires an API token";
+      }
+      try {
+        const body = await resp.json();
+        if (body && body.message) {
+          message = body.message;
+        }
+      } catch (e) {
+        // The body is not an error response of the API.
+      }
+      throw new Error(message);
+    }
+    return resp.json();
+  }
+
+  function loadConfig() {
+    return getJSON("config.json").catch(() => ({ refresh: 5 }));
+  }
+
+  // listMetrics fetches every page of the metric listing.
+  async function listMetrics(includeStale) {
+    const metrics = [];
+    let cursor = "";
+    do {
+      const params = new URLSearchParams({ limit: "1000" });
+      if (includeStale) {
+        params.set("include_stale", "true");
+      }
+      if (cursor) {
+        params.set("cursor", cursor);
+      }
+      const page = await getJSON(api + "/metrics?" + params);
+      metrics.push(...page.metrics);
+      cursor = page.next_cursor || "";
+    } while (cursor);
+    return metrics;
+  }
+
+  function valueOf(metric) {
+    return metric.type === "counter" ? metric.delta : metric.value;
+  }
+
+  function formatValue(value) {
+    if (value === undefined || value === null) {
+      return "";
+    }
+    return Number.isInteger(value) ? String(value) : value.toPrecision(6).replace(/\.?0+$/, "");
+  }
+
+  function setStatus(text, isError) {
+    const status = document.getElementById("status");
+    status.textContent = text;
+    status.classList.toggle("error", Boolean(isError));
+  }
+
+  // tokenInput keeps the API token entered in the token field for the session and calls load when it changes.
+  function tokenInput(load) {
+    const input = document.getElementById("token");
+    input.value = sessionStorage.getItem(tokenKey) || "";
+    input.addEventListener("change", () => {
+      const token = input.value.trim();
+      if (token) {
+        sessionStorage.setItem(tokenKey, token);
+      } else {
+        sessionStorage.removeItem(tokenKey);
+      }
+      load();
+    });
+  }
+
+  // refresher calls load now and then every interval seconds chosen in the refresh select.
+  function refresher(select, initial, load) {
+    let timer = null;
+    const options = Array.from(select.options).map((o) => o.value);
+    select.value = options.includes(String(initial)) ? String(initial) : "0";
+
+    const schedule = () => {
+      clearInterval(timer);
+      const seconds = Number(select.value);
+      if (seconds > 0) {
+        timer = setInterval(load, seconds * 1000);
+      }
+    };
+    select.addEventListener("change", schedule);
+    document.addEventListener("visibilitychange", () => {
+      if (document.hidden) {
+        clearInterval(timer);
+      } else {
+        load();
+        schedule();
+      }
+    });
+    load();
+    schedule();
+  }
+
+  async function index() {
+    const config = await loadConfig();
+    const state = { metrics: [], key: "id", ascending: true };
+    const tbody = document.querySelector("#metrics tbody");
+    const filter = document.getElementById("filter");
+    const type = document.getElementById("type");
+    const stale = document.getElementById("stale");
+    const params = new URLSearchParams(location.search);
+    filter.value = params.get("q") || "";
+    type.value = params.get("type") || "";
+
+    const sortValue = (metric, key) => {
+      switch (key) {
+        case "value":
+          return valueOf(metric);
+        case "unit":
+        case "help":
+          return (metric.metadata && metric.metadata[key]) || "";
+        default:
+          return metric[key] || "";
+      }
+    };
+
+    const render = () => {
+      const query = filter.value.trim().toLowerCase();
+      const rows = state.metrics.filter((m) => {
+        if (type.value && m.type !== type.value) {
+          return false;
+        }
+        const meta = m.metadata || {};
+        return !query || [m.id, meta.unit, meta.help].some((s) => s && s.toLowerCase().includes(query));
+      });
+      rows.sort((a, b) => {
+        const x = sortValue(a, state.key);
+        const y = sortValue(b, state.key);
+        const order = typeof x === "number" && typeof y === "number" ? x - y : String(x).localeCompare(String(y));
+        return state.ascending ? order : -order;
+      });
+
+      tbody.replaceChildren(...rows.map((m) => {
+        const tr = document.createElement("tr");
+        tr.classList.toggle("stale", Boolean(m.stale));
+        const link = document.createElement("a");
+        link.href = "metric.html?name=" + encodeURIComponent(m.id);
+        link.textContent = m.id;
+        const meta = m.metadata || {};
+        const cells = [link, m.type + (m.stale ? " (stale)" : ""), formatValue(valueOf(m)), meta.unit || "", meta.help || ""];
+        cells.forEach((content, i) => {
+          const td = document.createElement("td");
+          td.append(content);
+          if (i === 2) {
+            td.className = "number";
+          }
+          tr.append(td);
+        });
+        return tr;
+      }));
+      document.getElementById("empty").hidden = rows.length > 0;
+
+      const search = new URLSearchParams();
+      if (filter.value) {
+        search.set("q", filter.value);
+      }
+      if (type.value) {
+        search.set("type", type.value);
+      }
+      history.replaceState(null, "", search.toString() ? "?" + search : location.pathname);
+    };
+
+    const load = async () => {
+      try {
+        state.metrics = await listMetrics(stale.checked);
+        setStatus("Updated " + new Date().toLocaleTimeString());
+        render();
+      } catch (e) {
+        setStatus("Failed to load metrics: " + e.message, true);
+      }
+    };
+
+    document.querySelectorAll("#metrics th").forEach((th) => {
+      th.addEventListener("click", () => {
+        const key = th.dataset.key;
+        state.ascending = state.key === key ? !state.ascending : true;
+        state.key = key;
+        document.querySelectorAll("#metrics th").forEach((other) => other.removeAttribute("aria-sort"));
+        th.setAttribute("aria-sort", state.ascending ? "ascending" : "descending");
+        render();
+      });
+    });
+    filter.addEventListener("input", render);
+    type.addEventListener("change", render);
+    stale.addEventListener("change", load);
+    tokenInput(load);
+
+    refresher(document.getElementById("refresh"), config.refresh, load);
+  }
+
+  // sparkline draws points, each with a value and an optional min and max band, into svg.
+  function sparkline(svg, points) {
+    const ns = "http://www.w3.org/2000/svg";
+    svg.replaceChildren();
+    if (points.length === 0) {
+      return;
+    }
+    const width = 600;
+    const height = 120;
+    const pad = 4;
+    const lows = points.map((p) => (p.min !== undefined ? p.min : p.value));
+    const highs = points.map((p) => (p.max !== undefined ? p.max : p.value));
+    let low = Math.min(...lows);
+    let high = Math.max(...highs);
+    if (low === high) {
+      low -= 1;
+      high += 1;
+    }
+    const x = (i) => (points.length === 1 ? width / 2 : (i * width) / (points.length - 1));
+    const y = (v) => pad + ((high - v) * (height - 2 * pad)) / (high - low);
+
+    if (points.some((p) => p.min !== undefined)) {
+      const band = document.createElementNS(ns, "polygon");
+      const upper = points.map((p, i) => x(i) + "," + y(highs[i]));
+      const lower = points.map((p, i) => x(i) + "," + y(lows[i])).reverse();
+      band.setAttribute("points", upper.concat(lower).join(" "));
+      band.setAttribute("class", "band");
+      svg.append(band);
+    }
+    const line = document.createElementNS(ns, "polyline");
+    line.setAttribute("points", points.map((p, i) => x(i) + "," + y(p.value)).join(" "));
+    svg.append(line);
+  }
+
+  async function metric() {
+    const config = await loadConfig();
+    const name = new URLSearchParams(location.search).get("name") || "";
+    const samples = [];
+    document.getElementById("name").textContent = name;
+    document.title = name + " - Metrics";
+
+    const show = (id, text) => {
+      document.getElementById(id).textContent = text || "";
+    };
+
+    const loadHistory = async (m) => {
+      if (m.type === "gauge" && config.rollup_window) {
+        try {
+          const list = await getJSON(api + "/metrics/" + encodeURIComponent(name) + "/rollups?window=" + encodeURIComponent(config.rollup_window));
+          if (list.rollups.length > 0) {
+            show("history-source", "average with min and max per " + config.rollup_window);
+            return list.rollups.map((r) => ({ value: r.avg, min: r.min, max: r.max, at: new Date(r.start) }));
+          }
+        } catch (e) {
+          // Fall back to the values observed by the page.
+        }
+      }
+      show("history-source", "values observed since the page was opened");
+      return samples;
+    };
+
+    const load = async () => {
+      try {
+        const m = await getJSON(api + "/metrics/" + encodeURIComponent(name));
+        const meta = m.metadata || {};
+        const value = valueOf(m);
+        show("type", m.type + (m.stale ? " (stale)" : ""));
+        show("value", formatValue(value));
+        show("unit", meta.unit);
+        show("help", meta.help);
+        show("owner", meta.owner);
+
+        samples.push({ value: value, at: new Date() });
+        if (samples.length > maxSamples) {
+          samples.shift();
+        }
+        const points = await loadHistory(m);
+        sparkline(document.getElementById("sparkline"), points);
+        if (points.length > 0) {
+          const values = points.map((p) => p.value);
+          show("range", "min " + formatValue(Math.min(...values)) + ", max " + formatValue(Math.max(...values)) +
+            " from " + points[0].at.toLocaleString() + " to " + points[points.length - 1].at.toLocaleString());
+        }
+        setStatus("Updated " + new Date().toLocaleTimeString());
+      } catch (e) {
+        setStatus("Failed to load " + name + ": " + e.message, true);
+      }
+    };
+
+    tokenInput(load);
+    refresher(document.getElementById("refresh"), config.refresh, load);
+  }
+
+  return { index: index, metric: metric };
+})();
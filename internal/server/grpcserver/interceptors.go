@@ -0,0 +1,349 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/hash"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	pb "github.com/a2sh3r/sysmetrics/internal/proto"
+	"github.com/a2sh3r/sysmetrics/internal/server/auth"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/tlsconfig"
+)
+
+// interceptors holds the state shared by the gRPC interceptors.
+type interceptors struct {
+	verifier *middleware.RequestVerifier
+	tokens   *auth.Store
+	// subnets restricts the client IPs when non-nil.
+	subnets []*net.IPNet
+	proxies []*net.IPNet
+	limiter *middleware.RateLimiter
+}
+
+func newInterceptors(cfg *config.ServerConfig, limiter *middleware.RateLimiter) *interceptors {
+	tokens, err := auth.ParseTokens(cfg.APITokens)
+	if err != nil {
+		logger.Log.Error("Failed to parse API tokens, rejecting all requests", zap.Error(err))
+		tokens = auth.DenyAll()
+	}
+
+	var subnets []*net.IPNet
+	if cfg.TrustedSubnet != "" {
+		subnets, err = middleware.ParseCIDRs(cfg.TrustedSubnet)
+		if err != nil || subnets == nil {
+			logger.Log.Error("Failed to parse trusted subnets, rejecting all requests", zap.Error(err))
+			subnets = []*net.IPNet{}
+		}
+	}
+
+	proxies, err := middleware.ParseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		proxies = nil
+	}
+
+	return &interceptors{
+		verifier: middleware.NewRequestVerifier(cfg),
+		tokens:   tokens,
+		subnets:  subnets,
+		proxies:  proxies,
+		limiter:  limiter,
+	}
+}
+
+func (i *interceptors) unaryLogging(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logRequest(info.FullMethod, start, err)
+	return resp, err
+}
+
+func (i *interceptors) streamLogging(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logRequest(info.FullMethod, start, err)
+	return err
+}
+
+func logRequest(method string, start time.Time, err error) {
+	logger.Log.Info("gRPC request",
+		zap.String("method", method),
+		zap.String("code", status.Code(err).String()),
+		zap.Duration("duration", time.Since(start)),
+	)
+}
+
+func (i *interceptors) unaryAuth(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, client, err := i.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := i.allow(client); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamAuth authorizes a stream when it opens and charges the rate limit of its client for every
+// batch received, so that a long-lived stream is limited like a series of unary requests.
+func (i *interceptors) streamAuth(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, client, err := i.authorize(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &limitedStream{
+		contextStream: contextStream{ServerStream: ss, ctx: ctx},
+		interceptors:  i,
+		client:        client,
+	})
+}
+
+// authorize applies the write path checks of the HTTP router: trusted subnet, client certificate
+// identity, API token with the write scope and tenant and agent instance selection. It returns the
+// client the rate limit of the request is charged to.
+func (i *interceptors) authorize(ctx context.Context) (context.Context, string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := identity.FromContext(ctx)
+
+	var ip net.IP
+	if p, ok := peer.FromContext(ctx); ok {
+		r := &http.Request{RemoteAddr: p.Addr.String(), Header: http.Header{}}
+		r.Header.Set(middleware.RealIPHeader, first(md, pb.RealIPMetadataKey))
+		r.Header.Set("X-Forwarded-For", first(md, pb.ForwardedForMetadataKey))
+		ip = middleware.RealIP(r, i.proxies)
+
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			if agent := tlsconfig.PeerIdentity(&tlsInfo.State); agent != "" {
+				id.Agent = agent
+			}
+		}
+	}
+
+	if i.subnets != nil && (ip == nil || !middleware.ContainsIP(i.subnets, ip)) {
+		logger.Log.Warn("Request from untrusted address", zap.Stringer("ip", ip))
+		return nil, "", status.Error(codes.PermissionDenied, "forbidden")
+	}
+
+	if i.tokens.Enabled() {
+		scheme, secret, _ := strings.Cut(first(md, pb.AuthorizationMetadataKey), " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return nil, "", status.Error(codes.Unauthenticated, "unauthorized")
+		}
+		token, err := i.tokens.Authenticate(strings.TrimSpace(secret))
+		if err != nil {
+			return nil, "", status.Error(codes.Unauthenticated, "unauthorized")
+		}
+		if !auth.HasScope(token.Scopes, auth.ScopeWrite) {
+			return nil, "", status.Error(codes.PermissionDenied, "forbidden")
+		}
+		id.Token = token.Name
+		id.Scopes = token.Scopes
+		id.Tenant = token.Tenant
+	}
+
+	if tenant := first(md, pb.TenantMetadataKey); tenant != "" {
+		switch {
+		case id.Tenant != "" && tenant != id.Tenant:
+			return nil, "", status.Error(codes.PermissionDenied, "forbidden")
+		case !identity.ValidTenant(tenant):
+			return nil, "", status.Error(codes.InvalidArgument, "invalid tenant")
+		}
+		id.Tenant = tenant
+	}
+
+	if instance := first(md, pb.InstanceMetadataKey); instance != "" {
+		if !identity.ValidInstance(instance) {
+			return nil, "", status.Error(codes.InvalidArgument, "invalid agent instance")
+		}
+		id.Instance = instance
+	}
+
+	var client string
+	if i.limiter.Enabled() {
+		client = i.limiter.ClientKey(id, ip)
+	}
+	return identity.WithIdentity(ctx, id), client, nil
+}
+
+// allow charges a request to the rate limit of client.
+func (i *interceptors) allow(client string) error {
+	if !i.limiter.Enabled() {
+		return nil
+	}
+	if ok, retryAfter := i.limiter.Allow(client); !ok {
+		logger.Log.Warn("Rate limit exceeded", zap.String("client", client))
+		return status.Errorf(codes.ResourceExhausted, "too many requests, retry after %s", retryAfter)
+	}
+	return nil
+}
+
+// unaryHash verifies the request signature like the HTTP hash middleware and signs the response.
+// Unsigned requests are rejected unless the verifier allows them.
+func (i *interceptors) unaryHash(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !i.verifier.Enabled() {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	keyID := first(md, pb.HashKeyIDMetadataKey)
+
+	msg, ok := req.(protobuf.Message)
+	if !ok {
+		return nil, status.Error(codes.Internal, "unexpected request type")
+	}
+	body, err := pb.Marshal(msg)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to marshal request")
+	}
+	gotHash := first(md, pb.HashMetadataKey)
+	if err := i.verifier.Verify(body, keyID, gotHash, first(md, pb.TimestampMetadataKey), first(md, pb.NonceMetadataKey)); err != nil {
+		return nil, verificationError(err)
+	}
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+
+	if msg, ok := resp.(protobuf.Message); ok {
+		if body, err := pb.Marshal(msg); err == nil {
+			if signature, err := i.verifier.Sign(string(body), keyID); err == nil {
+				header := metadata.Pairs(pb.HashMetadataKey, signature)
+				if keyID != "" {
+					header.Set(pb.HashKeyIDMetadataKey, keyID)
+				}
+				if err := grpc.SetHeader(ctx, header); err != nil {
+					logger.Log.Warn("Failed to set response hash", zap.Error(err))
+				}
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+// streamHash verifies every batch of a signed stream. The stream timestamp and nonce are checked once
+// when it opens and are required while a replay window is configured; every batch is bound to them and
+// to its position so batches cannot be replayed or reordered.
+func (i *interceptors) streamHash(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !i.verifier.Enabled() {
+		return handler(srv, ss)
+	}
+
+	md, _ := metadata.FromIncomingContext(ss.Context())
+	timestamp := first(md, pb.TimestampMetadataKey)
+	nonce := first(md, pb.NonceMetadataKey)
+	if err := i.verifier.CheckReplay(timestamp, nonce); err != nil {
+		return verificationError(err)
+	}
+
+	return handler(srv, &verifyingStream{
+		ServerStream: ss,
+		verifier:     i.verifier,
+		keyID:        first(md, pb.HashKeyIDMetadataKey),
+		timestamp:    timestamp,
+		nonce:        nonce,
+	})
+}
+
+func verificationError(err error) error {
+	if errors.Is(err, middleware.ErrNonceCacheFull) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if errors.Is(err, hash.ErrHashMismatch) || errors.Is(err, hash.ErrUnknownKeyID) {
+		return status.Error(codes.InvalidArgument, "hash verification failed")
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// verifyingStream verifies the signature of every received StreamMetricsRequest.
+type verifyingStream struct {
+	grpc.ServerStream
+	verifier  *middleware.RequestVerifier
+	keyID     string
+	timestamp string
+	nonce     string
+	seq       int
+}
+
+// RecvMsg receives a message and verifies its signature. Unsigned messages are rejected unless the
+// verifier allows unsigned requests.
+func (s *verifyingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	req, ok := m.(*pb.StreamMetricsRequest)
+	if !ok {
+		return nil
+	}
+	if req.GetHash() == "" {
+		if s.verifier.AllowsUnsigned() {
+			return nil
+		}
+		return status.Error(codes.InvalidArgument, "missing batch hash")
+	}
+
+	body, err := pb.Marshal(req.GetBatch())
+	if err != nil {
+		return status.Error(codes.Internal, "failed to marshal batch")
+	}
+
+	seq := s.seq
+	s.seq++
+	if err := s.verifier.VerifyKeyed(pb.StreamPayload(s.timestamp, s.nonce, seq, body), s.keyID, req.GetHash()); err != nil {
+		logger.Log.Error("Stream batch hash verification failed", zap.String("key_id", s.keyID), zap.Int("seq", seq), zap.Error(err))
+		return verificationError(err)
+	}
+	return nil
+}
+
+// limitedStream charges every received message to the rate limit of the client of the stream.
+type limitedStream struct {
+	contextStream
+	interceptors *interceptors
+	client       string
+}
+
+// RecvMsg receives a message and ends the stream with codes.ResourceExhausted when the rate limit of
+// the client is exhausted.
+func (s *limitedStream) RecvMsg(m any) error {
+	if err := s.contextStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.interceptors.allow(s.client)
+}
+
+// contextStream overrides the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the overridden context.
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
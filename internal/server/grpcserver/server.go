@@ -0,0 +1,198 @@
+// Package grpcserver provides the gRPC transport of the metrics server.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // accept gzip-compressed messages like the HTTP server
+	"google.golang.org/grpc/status"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	pb "github.com/a2sh3r/sysmetrics/internal/proto"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+	"github.com/a2sh3r/sysmetrics/internal/tlsconfig"
+)
+
+// Writer stores batches of metrics and their metadata.
+type Writer interface {
+	UpdateMetricsBatchWithRetry(ctx context.Context, metrics map[string]repositories.Metric) error
+	UpdateMetadataWithRetry(ctx context.Context, metadata map[string]repositories.Metadata) error
+}
+
+// MetricsServer implements the Metrics gRPC service on top of the metric service.
+type MetricsServer struct {
+	pb.UnimplementedMetricsServer
+	writer Writer
+}
+
+// NewMetricsServer creates a MetricsServer storing metrics with writer.
+func NewMetricsServer(writer Writer) *MetricsServer {
+	return &MetricsServer{writer: writer}
+}
+
+// NewServer creates a gRPC server with the Metrics service registered and the authentication,
+// signature verification, rate limiting and logging interceptors configured from cfg.
+// TLS and mutual TLS are enabled with the same settings as the HTTP server. limiter is shared with
+// the HTTP server, so that clients have one budget across transports and /admin/usage reports both.
+func NewServer(cfg *config.ServerConfig, writer Writer, limiter *middleware.RateLimiter) (*grpc.Server, error) {
+	interceptors := newInterceptors(cfg, limiter)
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(interceptors.unaryLogging, interceptors.unaryAuth, interceptors.unaryHash),
+		grpc.ChainStreamInterceptor(interceptors.streamLogging, interceptors.streamAuth, interceptors.streamHash),
+	}
+
+	if cfg.MaxBodySize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(int(cfg.MaxBodySize)))
+	}
+
+	if cfg.TLSEnabled() {
+		tlsConfig, err := tlsconfig.NewServerConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	pb.RegisterMetricsServer(srv, NewMetricsServer(writer))
+	return srv, nil
+}
+
+// UpdateMetrics stores a batch of metrics.
+func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
+	metrics, err := toRepoMetrics(req.GetMetrics())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store(ctx, metrics); err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdateMetricsResponse{Accepted: uint32(len(req.GetMetrics()))}, nil
+}
+
+// StreamMetrics stores every batch sent on the stream and replies with the total number of metrics
+// once the client closes the stream.
+func (s *MetricsServer) StreamMetrics(stream grpc.ClientStreamingServer[pb.StreamMetricsRequest, pb.UpdateMetricsResponse]) error {
+	var accepted uint32
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&pb.UpdateMetricsResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+
+		batch := req.GetBatch().GetMetrics()
+		metrics, err := toRepoMetrics(batch)
+		if err != nil {
+			return err
+		}
+
+		if err := s.store(stream.Context(), metrics); err != nil {
+			return err
+		}
+		accepted += uint32(len(batch))
+	}
+}
+
+// UpdateMetadata registers the metadata of metrics like POST /metadata/. When an id repeats, the last
+// entry wins.
+func (s *MetricsServer) UpdateMetadata(ctx context.Context, req *pb.UpdateMetadataRequest) (*pb.UpdateMetadataResponse, error) {
+	metadata := make(map[string]repositories.Metadata, len(req.GetMetadata()))
+	for _, m := range req.GetMetadata() {
+		u := pb.ToModelMetadata(m)
+		metadata[u.ID] = repositories.Metadata{Type: u.MType, Unit: u.Unit, Help: u.Help, Owner: u.Owner}
+	}
+	if len(metadata) == 0 {
+		return &pb.UpdateMetadataResponse{}, nil
+	}
+
+	err := s.writer.UpdateMetadataWithRetry(ctx, metadata)
+	switch {
+	case err == nil:
+		return &pb.UpdateMetadataResponse{Registered: uint32(len(metadata))}, nil
+	case errors.Is(err, services.ErrInvalidMetadata):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, services.ErrSeriesQuotaExceeded), errors.Is(err, services.ErrMetadataLimitExceeded):
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		logger.Log.Error("Failed to update metric metadata", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to update metadata")
+	}
+}
+
+func (s *MetricsServer) store(ctx context.Context, metrics map[string]repositories.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	err := s.writer.UpdateMetricsBatchWithRetry(ctx, metrics)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, services.ErrSeriesQuotaExceeded), errors.Is(err, services.ErrCardinalityLimitExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, services.ErrNegativeCounter):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		logger.Log.Error("Failed to update metrics batch", zap.Error(err))
+		return status.Error(codes.Internal, "failed to update metrics")
+	}
+}
+
+// toRepoMetrics converts a batch to repository metrics, summing the deltas of repeated counters
+// and keeping the last running total of repeated cumulative counters like the HTTP batch endpoint does.
+func toRepoMetrics(batch []*pb.Metric) (map[string]repositories.Metric, error) {
+	metrics := make(map[string]repositories.Metric, len(batch))
+	for _, m := range batch {
+		model, err := pb.ToModel(m)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if model.ID == "" {
+			return nil, status.Error(codes.InvalidArgument, "missing metric id")
+		}
+
+		switch model.MType {
+		case constants.MetricTypeGauge:
+			if model.Value == nil {
+				return nil, status.Errorf(codes.InvalidArgument, "missing value for gauge %q", model.ID)
+			}
+			metrics[model.ID] = repositories.Metric{Type: constants.MetricTypeGauge, Value: *model.Value}
+		case constants.MetricTypeCounter:
+			if model.Delta == nil {
+				return nil, status.Errorf(codes.InvalidArgument, "missing delta for counter %q", model.ID)
+			}
+			if *model.Delta < 0 {
+				return nil, status.Errorf(codes.InvalidArgument, "negative delta for counter %q", model.ID)
+			}
+			cumulative := model.Mode == models.CounterModeCumulative
+			delta := *model.Delta
+			if existing, ok := metrics[model.ID]; ok && existing.Type == constants.MetricTypeCounter {
+				if existing.Cumulative != cumulative {
+					return nil, status.Errorf(codes.InvalidArgument, "conflicting modes for counter %q", model.ID)
+				}
+				if !cumulative {
+					delta += existing.Value.(int64)
+				}
+			}
+			metrics[model.ID] = repositories.Metric{Type: constants.MetricTypeCounter, Value: delta, Cumulative: cumulative}
+		}
+	}
+	return metrics, nil
+}
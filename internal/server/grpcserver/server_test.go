@@ -0,0 +1,448 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/hash"
+	pb "github.com/a2sh3r/sysmetrics/internal/proto"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+)
+
+type fakeWriter struct {
+	mu       sync.Mutex
+	err      error
+	tenants  []string
+	batches  []map[string]repositories.Metric
+	metadata []map[string]repositories.Metadata
+}
+
+func (w *fakeWriter) UpdateMetricsBatchWithRetry(ctx context.Context, metrics map[string]repositories.Metric) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.tenants = append(w.tenants, identity.Tenant(ctx))
+	w.batches = append(w.batches, metrics)
+	return nil
+}
+
+func (w *fakeWriter) UpdateMetadataWithRetry(ctx context.Context, metadata map[string]repositories.Metadata) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.tenants = append(w.tenants, identity.Tenant(ctx))
+	w.metadata = append(w.metadata, metadata)
+	return nil
+}
+
+func startServer(t *testing.T, cfg *config.ServerConfig, writer Writer) pb.MetricsClient {
+	t.Helper()
+	return startServerWithLimiter(t, cfg, writer, middleware.NewRateLimiter(cfg))
+}
+
+func startServerWithLimiter(t *testing.T, cfg *config.ServerConfig, writer Writer, limiter *middleware.RateLimiter) pb.MetricsClient {
+	t.Helper()
+
+	srv, err := NewServer(cfg, writer, limiter)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return pb.NewMetricsClient(conn)
+}
+
+func testBatch() *pb.UpdateMetricsRequest {
+	value := 1.5
+	delta := int64(2)
+	return &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "Alloc", Type: pb.Metric_TYPE_GAUGE, Value: &value},
+		{Id: "PollCount", Type: pb.Metric_TYPE_COUNTER, Delta: &delta},
+		{Id: "PollCount", Type: pb.Metric_TYPE_COUNTER, Delta: &delta},
+	}}
+}
+
+func signedContext(t *testing.T, req *pb.UpdateMetricsRequest, key string) context.Context {
+	t.Helper()
+
+	data, err := pb.Marshal(req)
+	require.NoError(t, err)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := "nonce-" + timestamp + "-" + t.Name()
+
+	return metadata.AppendToOutgoingContext(context.Background(),
+		pb.HashMetadataKey, hash.CalculateHash(hash.SignedPayload(timestamp, nonce, string(data)), key),
+		pb.TimestampMetadataKey, timestamp,
+		pb.NonceMetadataKey, nonce,
+	)
+}
+
+func TestMetricsServer_UpdateMetrics(t *testing.T) {
+	writer := &fakeWriter{}
+	client := startServer(t, &config.ServerConfig{}, writer)
+
+	resp, err := client.UpdateMetrics(context.Background(), testBatch())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), resp.GetAccepted())
+
+	require.Len(t, writer.batches, 1)
+	assert.Equal(t, repositories.Metric{Type: constants.MetricTypeGauge, Value: 1.5}, writer.batches[0]["Alloc"])
+	assert.Equal(t, repositories.Metric{Type: constants.MetricTypeCounter, Value: int64(4)}, writer.batches[0]["PollCount"])
+}
+
+func TestMetricsServer_UpdateMetrics_Cumulative(t *testing.T) {
+	writer := &fakeWriter{}
+	client := startServer(t, &config.ServerConfig{}, writer)
+
+	first, last := int64(3), int64(7)
+	_, err := client.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "PollCount", Type: pb.Metric_TYPE_COUNTER, Delta: &first, Mode: pb.Metric_COUNTER_MODE_CUMULATIVE},
+		{Id: "PollCount", Type: pb.Metric_TYPE_COUNTER, Delta: &last, Mode: pb.Metric_COUNTER_MODE_CUMULATIVE},
+	}})
+	require.NoError(t, err)
+
+	require.Len(t, writer.batches, 1)
+	assert.Equal(t, repositories.Metric{Type: constants.MetricTypeCounter, Value: int64(7), Cumulative: true}, writer.batches[0]["PollCount"])
+}
+
+func TestMetricsServer_UpdateMetrics_Errors(t *testing.T) {
+	negative, total := int64(-1), int64(5)
+	tests := []struct {
+		name     string
+		req      *pb.UpdateMetricsRequest
+		writeErr error
+		wantCode codes.Code
+	}{
+		{
+			name:     "Test #1 missing value",
+			req:      &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Id: "Alloc", Type: pb.Metric_TYPE_GAUGE}}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Test #2 unknown type",
+			req:      &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Id: "Alloc"}}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Test #3 quota exceeded",
+			req:      testBatch(),
+			writeErr: services.ErrSeriesQuotaExceeded,
+			wantCode: codes.ResourceExhausted,
+		},
+		{
+			name:     "Test #4 storage failure",
+			req:      testBatch(),
+			writeErr: io.ErrUnexpectedEOF,
+			wantCode: codes.Internal,
+		},
+		{
+			name:     "Test #5 negative delta",
+			req:      &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Id: "PollCount", Type: pb.Metric_TYPE_COUNTER, Delta: &negative}}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "Test #6 conflicting counter modes",
+			req: &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+				{Id: "PollCount", Type: pb.Metric_TYPE_COUNTER, Delta: &total, Mode: pb.Metric_COUNTER_MODE_CUMULATIVE},
+				{Id: "PollCount", Type: pb.Metric_TYPE_COUNTER, Delta: &total},
+			}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Test #7 counter decreased",
+			req:      testBatch(),
+			writeErr: services.ErrNegativeCounter,
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := startServer(t, &config.ServerConfig{}, &fakeWriter{err: tt.writeErr})
+
+			_, err := client.UpdateMetrics(context.Background(), tt.req)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestMetricsServer_UpdateMetadata(t *testing.T) {
+	writer := &fakeWriter{}
+	client := startServer(t, &config.ServerConfig{}, writer)
+
+	resp, err := client.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{Metadata: []*pb.MetricMetadata{
+		{Id: "TotalMemory", Type: constants.MetricTypeGauge, Unit: "bytes"},
+		{Id: "TotalMemory", Type: constants.MetricTypeGauge, Unit: "bytes", Help: "Total amount of RAM."},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), resp.GetRegistered())
+
+	require.Len(t, writer.metadata, 1)
+	assert.Equal(t, map[string]repositories.Metadata{
+		"TotalMemory": {Type: constants.MetricTypeGauge, Unit: "bytes", Help: "Total amount of RAM."},
+	}, writer.metadata[0], "the last entry of a repeated id wins")
+}
+
+func TestMetricsServer_UpdateMetadata_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		writeErr error
+		wantCode codes.Code
+	}{
+		{name: "Test #1 invalid metadata", writeErr: services.ErrInvalidMetadata, wantCode: codes.InvalidArgument},
+		{name: "Test #2 quota exceeded", writeErr: services.ErrSeriesQuotaExceeded, wantCode: codes.ResourceExhausted},
+		{name: "Test #3 metadata limit exceeded", writeErr: services.ErrMetadataLimitExceeded, wantCode: codes.ResourceExhausted},
+		{name: "Test #4 storage failure", writeErr: io.ErrUnexpectedEOF, wantCode: codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := startServer(t, &config.ServerConfig{}, &fakeWriter{err: tt.writeErr})
+
+			_, err := client.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{Metadata: []*pb.MetricMetadata{{Id: "Alloc"}}})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestMetricsServer_UpdateMetrics_Hash(t *testing.T) {
+	cfg := &config.ServerConfig{SecretKey: "test key", ReplayWindow: 60, NonceCacheSize: 100}
+	writer := &fakeWriter{}
+	client := startServer(t, cfg, writer)
+
+	req := testBatch()
+	ctx := signedContext(t, req, "test key")
+
+	var header metadata.MD
+	_, err := client.UpdateMetrics(ctx, req, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.NotEmpty(t, header.Get(pb.HashMetadataKey), "response is signed")
+
+	_, err = client.UpdateMetrics(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "replayed request is rejected")
+
+	_, err = client.UpdateMetrics(signedContext(t, req, "wrong key"), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.UpdateMetrics(context.Background(), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "unsigned request is rejected")
+
+	assert.Len(t, writer.batches, 1)
+}
+
+func TestMetricsServer_UpdateMetrics_AllowUnsigned(t *testing.T) {
+	writer := &fakeWriter{}
+	client := startServer(t, &config.ServerConfig{SecretKey: "test key", AllowUnsigned: true}, writer)
+
+	_, err := client.UpdateMetrics(context.Background(), testBatch())
+	require.NoError(t, err)
+	assert.Len(t, writer.batches, 1)
+}
+
+func TestMetricsServer_StreamMetrics(t *testing.T) {
+	const key = "test key"
+	writer := &fakeWriter{}
+	client := startServer(t, &config.ServerConfig{SecretKey: key, ReplayWindow: 60, NonceCacheSize: 100}, writer)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	open := func(nonce string) grpc.ClientStreamingClient[pb.StreamMetricsRequest, pb.UpdateMetricsResponse] {
+		ctx := metadata.AppendToOutgoingContext(context.Background(),
+			pb.TimestampMetadataKey, timestamp,
+			pb.NonceMetadataKey, nonce,
+		)
+		stream, err := client.StreamMetrics(ctx)
+		require.NoError(t, err)
+		return stream
+	}
+	sign := func(nonce string, seq int, batch *pb.UpdateMetricsRequest) string {
+		data, err := pb.Marshal(batch)
+		require.NoError(t, err)
+		return hash.CalculateHash(pb.StreamPayload(timestamp, nonce, seq, data), key)
+	}
+
+	stream := open("stream-1")
+	for seq := 0; seq < 2; seq++ {
+		batch := testBatch()
+		require.NoError(t, stream.Send(&pb.StreamMetricsRequest{Batch: batch, Hash: sign("stream-1", seq, batch)}))
+	}
+	resp, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(6), resp.GetAccepted())
+	assert.Len(t, writer.batches, 2)
+
+	stream = open("stream-2")
+	batch := testBatch()
+	require.NoError(t, stream.Send(&pb.StreamMetricsRequest{Batch: batch, Hash: sign("stream-2", 1, batch)}))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "batch signed for another position is rejected")
+	assert.Len(t, writer.batches, 2)
+
+	stream = open("stream-3")
+	require.NoError(t, stream.Send(&pb.StreamMetricsRequest{Batch: testBatch()}))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "unsigned batch is rejected")
+
+	unprotected, err := client.StreamMetrics(context.Background())
+	require.NoError(t, err)
+	batch = testBatch()
+	data, err := pb.Marshal(batch)
+	require.NoError(t, err)
+	require.NoError(t, unprotected.Send(&pb.StreamMetricsRequest{Batch: batch, Hash: hash.CalculateHash(pb.StreamPayload("", "", 0, data), key)}))
+	_, err = unprotected.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "stream without timestamp and nonce is rejected")
+	assert.Len(t, writer.batches, 2)
+}
+
+func TestMetricsServer_Auth(t *testing.T) {
+	tokenHash := func(secret string) string {
+		sum := sha256.Sum256([]byte(secret))
+		return hex.EncodeToString(sum[:])
+	}
+	tokens := "agent:" + tokenHash("agent-secret") + ":write;reader:" + tokenHash("reader-secret") + ":read;team:" + tokenHash("team-secret") + ":write:team-a"
+
+	tests := []struct {
+		name       string
+		cfg        *config.ServerConfig
+		md         []string
+		wantCode   codes.Code
+		wantTenant string
+	}{
+		{
+			name:     "Test #1 missing token",
+			cfg:      &config.ServerConfig{APITokens: tokens},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "Test #2 unknown token",
+			cfg:      &config.ServerConfig{APITokens: tokens},
+			md:       []string{pb.AuthorizationMetadataKey, "Bearer nope"},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "Test #3 token without write scope",
+			cfg:      &config.ServerConfig{APITokens: tokens},
+			md:       []string{pb.AuthorizationMetadataKey, "Bearer reader-secret"},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:       "Test #4 token with write scope",
+			cfg:        &config.ServerConfig{APITokens: tokens},
+			md:         []string{pb.AuthorizationMetadataKey, "Bearer agent-secret", pb.TenantMetadataKey, "team-b"},
+			wantCode:   codes.OK,
+			wantTenant: "team-b",
+		},
+		{
+			name:     "Test #5 tenant of another token",
+			cfg:      &config.ServerConfig{APITokens: tokens},
+			md:       []string{pb.AuthorizationMetadataKey, "Bearer team-secret", pb.TenantMetadataKey, "team-b"},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "Test #6 untrusted subnet",
+			cfg:      &config.ServerConfig{TrustedSubnet: "10.0.0.0/8"},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "Test #7 trusted subnet",
+			cfg:      &config.ServerConfig{TrustedSubnet: "127.0.0.0/8"},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "Test #8 agent instance",
+			cfg:      &config.ServerConfig{},
+			md:       []string{pb.InstanceMetadataKey, "node-1.example.com"},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "Test #9 invalid agent instance",
+			cfg:      &config.ServerConfig{},
+			md:       []string{pb.InstanceMetadataKey, "node 1"},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &fakeWriter{}
+			client := startServer(t, tt.cfg, writer)
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), tt.md...)
+			_, err := client.UpdateMetrics(ctx, testBatch())
+			require.Equal(t, tt.wantCode, status.Code(err), err)
+
+			if tt.wantCode == codes.OK {
+				require.Len(t, writer.tenants, 1)
+				assert.Equal(t, tt.wantTenant, writer.tenants[0])
+			}
+		})
+	}
+}
+
+func TestMetricsServer_RateLimit(t *testing.T) {
+	client := startServer(t, &config.ServerConfig{RateLimit: 1}, &fakeWriter{})
+
+	_, err := client.UpdateMetrics(context.Background(), testBatch())
+	require.NoError(t, err)
+
+	_, err = client.UpdateMetrics(context.Background(), testBatch())
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestMetricsServer_RateLimit_Stream(t *testing.T) {
+	writer := &fakeWriter{}
+	client := startServer(t, &config.ServerConfig{RateLimit: 2}, writer)
+
+	stream, err := client.StreamMetrics(context.Background())
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		// The server may end the stream before every batch is sent.
+		if err := stream.Send(&pb.StreamMetricsRequest{Batch: testBatch()}); err != nil {
+			break
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "every batch of a stream is charged")
+	assert.Len(t, writer.batches, 2)
+}
+
+func TestMetricsServer_RateLimit_Shared(t *testing.T) {
+	cfg := &config.ServerConfig{RateLimit: 1}
+	limiter := middleware.NewRateLimiter(cfg)
+	client := startServerWithLimiter(t, cfg, &fakeWriter{}, limiter)
+
+	_, err := client.UpdateMetrics(context.Background(), testBatch())
+	require.NoError(t, err)
+
+	usage := limiter.Usage()
+	require.Len(t, usage, 1, "gRPC clients are reported with the HTTP ones")
+	assert.Equal(t, uint64(1), usage[0].Allowed)
+}
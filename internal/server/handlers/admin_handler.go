@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+)
+
+// ListTenants handles GET requests listing the tenants that have metrics.
+// A token bound to a tenant only sees its own tenant.
+func (h *Handler) ListTenants(w http.ResponseWriter, r *http.Request) {
+	if h.Admin == nil {
+		writeError(w, r, newAPIError(http.StatusNotImplemented, CodeNotImplemented, "tenant administration is not supported"))
+		return
+	}
+
+	tenants, err := h.Admin.ListTenantsWithRetry(r.Context())
+	if err != nil {
+		writeError(w, r, fmt.Errorf("failed to list tenants: %w", err))
+		return
+	}
+
+	if own := identity.Tenant(r.Context()); own != "" {
+		visible := make([]string, 0, 1)
+		for _, tenant := range tenants {
+			if tenant == own {
+				visible = append(visible, tenant)
+			}
+		}
+		tenants = visible
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tenants); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// DeleteTenant handles DELETE requests removing every metric of a tenant.
+func (h *Handler) DeleteTenant(w http.ResponseWriter, r *http.Request) {
+	if h.Admin == nil {
+		writeError(w, r, newAPIError(http.StatusNotImplemented, CodeNotImplemented, "tenant administration is not supported"))
+		return
+	}
+
+	tenant := chi.URLParam(r, "tenant")
+	if tenant == "" || !identity.ValidTenant(tenant) {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid tenant"))
+		return
+	}
+
+	if own := identity.Tenant(r.Context()); own != "" && own != tenant {
+		writeError(w, r, newAPIError(http.StatusForbidden, CodeForbidden, "the token is bound to another tenant"))
+		return
+	}
+
+	if err := h.Admin.DeleteTenantWithRetry(r.Context(), tenant); err != nil {
+		writeError(w, r, fmt.Errorf("failed to delete tenant %s: %w", tenant, err))
+		return
+	}
+
+	logger.Log.Info("Tenant deleted",
+		zap.String("tenant", tenant),
+		zap.String("token", identity.FromContext(r.Context()).Token))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// usageResponse is the body of the usage endpoint.
+type usageResponse struct {
+	Clients []middleware.ClientUsage `json:"clients"`
+	Tenants []services.TenantUsage   `json:"tenants"`
+}
+
+// Usage returns a handler reporting the rate limiter state of every client and the series stored by every
+// tenant. A token bound to a tenant only sees its own tenant.
+func (h *Handler) Usage(limiter *middleware.RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.Admin == nil {
+			writeError(w, r, newAPIError(http.StatusNotImplemented, CodeNotImplemented, "usage reports are not supported"))
+			return
+		}
+
+		tenants, err := h.Admin.UsageWithRetry(r.Context())
+		if err != nil {
+			writeError(w, r, fmt.Errorf("failed to get usage: %w", err))
+			return
+		}
+
+		response := usageResponse{Clients: limiter.Usage(), Tenants: tenants}
+
+		if own := identity.Tenant(r.Context()); own != "" {
+			response.Clients = []middleware.ClientUsage{}
+			visible := make([]services.TenantUsage, 0, 1)
+			for _, usage := range tenants {
+				if usage.Tenant == own {
+					visible = append(visible, usage)
+				}
+			}
+			response.Tenants = visible
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			logger.Log.Error("Failed to encode response", zap.Error(err))
+		}
+	}
+}
+
+// Cardinality handles GET requests reporting the distinct series count and the top prefixes of the
+// cardinality guard. The report spans all tenants, so tokens bound to a tenant are refused.
+func (h *Handler) Cardinality(w http.ResponseWriter, r *http.Request) {
+	if h.Admin == nil {
+		writeError(w, r, newAPIError(http.StatusNotImplemented, CodeNotImplemented, "cardinality reports are not supported"))
+		return
+	}
+
+	if identity.Tenant(r.Context()) != "" {
+		writeError(w, r, newAPIError(http.StatusForbidden, CodeForbidden, "the cardinality report spans all tenants"))
+		return
+	}
+
+	report, err := h.Admin.CardinalityWithRetry(r.Context())
+	if err != nil {
+		writeError(w, r, fmt.Errorf("failed to get cardinality: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// Retention handles GET requests reporting the retention tiers of gauge rollups with the number of
+// windows they keep and the last compaction. The report spans all tenants, so tokens bound to a tenant
+// are refused.
+func (h *Handler) Retention(w http.ResponseWriter, r *http.Request) {
+	if h.Admin == nil {
+		writeError(w, r, newAPIError(http.StatusNotImplemented, CodeNotImplemented, "retention reports are not supported"))
+		return
+	}
+
+	if identity.Tenant(r.Context()) != "" {
+		writeError(w, r, newAPIError(http.StatusForbidden, CodeForbidden, "the retention report spans all tenants"))
+		return
+	}
+
+	status, err := h.Admin.RetentionStatusWithRetry(r.Context())
+	if err != nil {
+		writeError(w, r, fmt.Errorf("failed to get retention status: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// purgeResponse is the body of the metric deletion endpoints.
+type purgeResponse struct {
+	DryRun  bool     `json:"dry_run"`
+	Deleted []string `json:"deleted"`
+}
+
+// DeleteMetric handles DELETE requests removing a metric of the tenant of the request. With the dry_run
+// parameter set, the metric is only looked up.
+func (h *Handler) DeleteMetric(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "metricName")
+
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	if dryRun {
+		_, err = h.reader.GetMetricWithRetry(r.Context(), name)
+	} else {
+		err = h.writer.DeleteMetricWithRetry(r.Context(), name)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if !dryRun {
+		logger.Log.Info("Metric deleted",
+			zap.String("metricName", name),
+			zap.String("tenant", identity.Tenant(r.Context())),
+			zap.String("token", identity.FromContext(r.Context()).Token))
+	}
+
+	writeJSON(w, http.StatusOK, purgeResponse{DryRun: dryRun, Deleted: []string{name}})
+}
+
+// DeleteMetrics handles DELETE requests removing the metrics of the tenant of the request selected by
+// the prefix and type parameters. At least one of them is required; whole tenants are removed with
+// DeleteTenant. With the dry_run parameter set, the metrics that would be removed are reported.
+func (h *Handler) DeleteMetrics(w http.ResponseWriter, r *http.Request) {
+	if h.Admin == nil {
+		writeError(w, r, newAPIError(http.StatusNotImplemented, CodeNotImplemented, "bulk deletion is not supported"))
+		return
+	}
+
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	selector := repositories.Selector{Prefix: query.Get("prefix"), Type: query.Get("type")}
+	if selector.IsEmpty() {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "a prefix or type is required"))
+		return
+	}
+	if selector.Type != "" && selector.Type != constants.MetricTypeGauge && selector.Type != constants.MetricTypeCounter {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidMetricType, fmt.Sprintf("invalid metric type %q", selector.Type)))
+		return
+	}
+
+	deleted, err := h.Admin.DeleteMetricsWithRetry(r.Context(), selector, dryRun)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("failed to delete metrics: %w", err))
+		return
+	}
+
+	if !dryRun {
+		logger.Log.Info("Metrics deleted",
+			zap.String("prefix", selector.Prefix),
+			zap.String("type", selector.Type),
+			zap.Int("count", len(deleted)),
+			zap.String("tenant", identity.Tenant(r.Context())),
+			zap.String("token", identity.FromContext(r.Context()).Token))
+	}
+
+	writeJSON(w, http.StatusOK, purgeResponse{DryRun: dryRun, Deleted: deleted})
+}
+
+// parseDryRun parses the dry_run parameter of a request. On failure it writes the error response and
+// returns false.
+func parseDryRun(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, true
+	}
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "dry_run must be a boolean"))
+		return false, false
+	}
+	return dryRun, true
+}
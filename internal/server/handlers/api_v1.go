@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+)
+
+// openAPISpec is the OpenAPI document of the v1 API.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// Page sizes of the v1 metric listing.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// OpenAPI handles GET requests for the OpenAPI document of the v1 API.
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(openAPISpec); err != nil {
+		logger.Log.Error("Failed to write OpenAPI document", zap.Error(err))
+	}
+}
+
+// ListMetricsV1 handles GET requests listing metrics ordered by name. The page size is set by the limit
+// parameter, the page by the cursor returned with the previous page, and the type parameter filters
+// the metrics by type. Stale metrics are only listed with the include_stale parameter set.
+func (h *Handler) ListMetricsV1(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultPageSize
+	if v := query.Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest,
+				fmt.Sprintf("limit must be an integer between 1 and %d", maxPageSize)))
+			return
+		}
+		limit = parsed
+	}
+
+	var after string
+	if v := query.Get("cursor"); v != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || len(decoded) == 0 {
+			writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid cursor"))
+			return
+		}
+		after = string(decoded)
+	}
+
+	metricType := query.Get("type")
+	if metricType != "" && metricType != constants.MetricTypeGauge && metricType != constants.MetricTypeCounter {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidMetricType, fmt.Sprintf("invalid metric type %q", metricType)))
+		return
+	}
+
+	includeStale := false
+	if v := query.Get("include_stale"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "include_stale must be a boolean"))
+			return
+		}
+		includeStale = parsed
+	}
+
+	stored, err := h.reader.GetMetricsWithRetry(r.Context())
+	if err != nil {
+		writeError(w, r, fmt.Errorf("failed to get metrics: %w", err))
+		return
+	}
+
+	names := make([]string, 0, len(stored))
+	for name, metric := range stored {
+		if name > after && (metricType == "" || metric.Type == metricType) && (includeStale || !metric.Stale) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	page := models.MetricList{Metrics: make([]models.Metrics, 0, min(limit, len(names)))}
+	if len(names) > limit {
+		names = names[:limit]
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(names[limit-1]))
+	}
+	for _, name := range names {
+		page.Metrics = append(page.Metrics, convertMetricToModel(name, stored[name]))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// GetMetricV1 handles GET requests for a single metric.
+func (h *Handler) GetMetricV1(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "metricName")
+
+	metric, err := h.reader.GetMetricWithRetry(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, convertMetricToModel(name, metric))
+}
+
+// defaultRateWindow is the window of counter rates requested without one.
+const defaultRateWindow = time.Minute
+
+// CounterRateV1 handles GET requests for the increase and per-second rate of a counter within the
+// window query parameter, a Go duration such as 5m that defaults to one minute.
+func (h *Handler) CounterRateV1(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "metricName")
+
+	window := defaultRateWindow
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid window %q", raw)))
+			return
+		}
+		window = parsed
+	}
+
+	rate, err := h.reader.CounterRateWithRetry(r.Context(), name, window)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.CounterRate{
+		ID:       name,
+		Window:   window.Seconds(),
+		Increase: rate.Increase,
+		Rate:     rate.Rate,
+		Resets:   rate.Resets,
+	})
+}
+
+// PutMetricV1 handles PUT requests creating a metric or replacing the value of a gauge. Counters can
+// only be created this way; existing counters are incremented with PATCH.
+func (h *Handler) PutMetricV1(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "metricName")
+
+	m, ok := decodeMetricV1(w, r, name)
+	if !ok {
+		return
+	}
+
+	switch {
+	case m.MType != constants.MetricTypeGauge && m.MType != constants.MetricTypeCounter:
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidMetricType, fmt.Sprintf("invalid metric type %q", m.MType)))
+		return
+	case m.MType == constants.MetricTypeGauge && m.Value == nil:
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidMetricValue, "missing gauge value"))
+		return
+	case m.MType == constants.MetricTypeCounter && m.Delta == nil:
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidMetricValue, "missing counter delta"))
+		return
+	}
+
+	if m.MType == constants.MetricTypeCounter {
+		h.putCounterV1(w, r, name, *m.Delta)
+		return
+	}
+
+	existing, err := h.reader.GetMetricWithRetry(r.Context(), name)
+	created := errors.Is(err, repositories.ErrMetricNotFound)
+	switch {
+	case err != nil && !created:
+		writeError(w, r, err)
+		return
+	case !created && existing.Type != m.MType:
+		writeError(w, r, newAPIError(http.StatusConflict, CodeMetricTypeConflict,
+			fmt.Sprintf("metric %s has type %s, not %s", name, existing.Type, m.MType)))
+		return
+	}
+
+	if err := h.writer.UpdateGaugeMetricWithRetry(r.Context(), name, *m.Value); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	h.writeMetricV1(w, r, name, status)
+}
+
+// putCounterV1 creates a counter for PutMetricV1. The creation is atomic, so of concurrent requests
+// creating a counter one succeeds and the others are answered with 409 Conflict.
+func (h *Handler) putCounterV1(w http.ResponseWriter, r *http.Request, name string, delta int64) {
+	err := h.writer.CreateCounterMetricWithRetry(r.Context(), name, delta)
+	if errors.Is(err, repositories.ErrMetricExists) {
+		if existing, getErr := h.reader.GetMetricWithRetry(r.Context(), name); getErr == nil && existing.Type != constants.MetricTypeCounter {
+			writeError(w, r, newAPIError(http.StatusConflict, CodeMetricTypeConflict,
+				fmt.Sprintf("metric %s has type %s, not %s", name, existing.Type, constants.MetricTypeCounter)))
+			return
+		}
+		writeError(w, r, newAPIError(http.StatusConflict, CodeCounterExists,
+			fmt.Sprintf("counter %s already exists; use PATCH to increment it", name)))
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.writeMetricV1(w, r, name, http.StatusCreated)
+}
+
+// PatchMetricV1 handles PATCH requests incrementing a counter by the delta of the body. A missing
+// counter is created.
+func (h *Handler) PatchMetricV1(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "metricName")
+
+	m, ok := decodeMetricV1(w, r, name)
+	if !ok {
+		return
+	}
+	if m.MType != "" && m.MType != constants.MetricTypeCounter {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidMetricType, "only counters can be incremented"))
+		return
+	}
+	if m.Delta == nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidMetricValue, "missing counter delta"))
+		return
+	}
+
+	if err := h.writer.UpdateCounterMetricWithRetry(r.Context(), name, *m.Delta); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	h.writeMetricV1(w, r, name, http.StatusOK)
+}
+
+// DeleteMetricV1 handles DELETE requests removing a metric. Like the /admin/metrics endpoints, it
+// requires the admin scope.
+func (h *Handler) DeleteMetricV1(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "metricName")
+
+	if err := h.writer.DeleteMetricWithRetry(r.Context(), name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger.Log.Info("Metric deleted", zap.String("metricName", name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeMetricV1 decodes the metric in a request body. The id of the body, when set, must match the
+// name in the path. On failure it writes the error response and returns false.
+func decodeMetricV1(w http.ResponseWriter, r *http.Request, name string) (models.Metrics, bool) {
+	var m models.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		writeError(w, r, invalidJSON(err))
+		return m, false
+	}
+	if m.ID != "" && m.ID != name {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest,
+			fmt.Sprintf("metric id %q does not match the path", m.ID)))
+		return m, false
+	}
+	return m, true
+}
+
+// writeMetricV1 responds with the stored state of a metric.
+func (h *Handler) writeMetricV1(w http.ResponseWriter, r *http.Request, name string, status int) {
+	metric, err := h.reader.GetMetricWithRetry(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, status, convertMetricToModel(name, metric))
+}
+
+// writeJSON responds with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
@@ -0,0 +1,711 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+)
+
+// newV1Router returns a router over a memory storage holding the gauge "load" and the counter "requests".
+func newV1Router(t *testing.T) (chi.Router, *services.Service) {
+	t.Helper()
+	storage := memstorage.NewMemStorage()
+	storage.EnableRollups(repositories.RollupConfig{Windows: []time.Duration{time.Hour}, Retention: 24})
+	ctx := context.Background()
+	require.NoError(t, storage.UpdateMetric(ctx, "load", repositories.Metric{Type: constants.MetricTypeGauge, Value: 0.5}))
+	require.NoError(t, storage.UpdateMetric(ctx, "requests", repositories.Metric{Type: constants.MetricTypeCounter, Value: int64(10)}))
+	service := services.NewService(repositories.NewMetricRepo(storage))
+	return NewRouter(NewHandler(service, service, nil), &config.ServerConfig{}), service
+}
+
+func serveV1(router http.Handler, method, url, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, url, reader)
+	req.Header.Set(middleware.RequestIDHeader, "test-request")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIV1(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Test #1 get gauge",
+			method:     http.MethodGet,
+			url:        "/api/v1/metrics/load",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":"load","type":"gauge","value":0.5}`,
+		},
+		{
+			name:       "Test #2 get missing metric",
+			method:     http.MethodGet,
+			url:        "/api/v1/metrics/missing",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"code":"metric_not_found","message":"metric not found","request_id":"test-request"}`,
+		},
+		{
+			name:       "Test #3 put new gauge",
+			method:     http.MethodPut,
+			url:        "/api/v1/metrics/temp",
+			body:       `{"type":"gauge","value":21.5}`,
+			wantStatus: http.StatusCreated,
+			wantBody:   `{"id":"temp","type":"gauge","value":21.5}`,
+		},
+		{
+			name:       "Test #4 put replaces gauge",
+			method:     http.MethodPut,
+			url:        "/api/v1/metrics/load",
+			body:       `{"id":"load","type":"gauge","value":2}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":"load","type":"gauge","value":2}`,
+		},
+		{
+			name:       "Test #5 put new counter",
+			method:     http.MethodPut,
+			url:        "/api/v1/metrics/errors",
+			body:       `{"type":"counter","delta":3}`,
+			wantStatus: http.StatusCreated,
+			wantBody:   `{"id":"errors","type":"counter","delta":3}`,
+		},
+		{
+			name:       "Test #6 put existing counter",
+			method:     http.MethodPut,
+			url:        "/api/v1/metrics/requests",
+			body:       `{"type":"counter","delta":3}`,
+			wantStatus: http.StatusConflict,
+			wantBody: `{"code":"counter_exists","message":"counter requests already exists; use PATCH to increment it",` +
+				`"request_id":"test-request"}`,
+		},
+		{
+			name:       "Test #7 put with another type",
+			method:     http.MethodPut,
+			url:        "/api/v1/metrics/requests",
+			body:       `{"type":"gauge","value":1}`,
+			wantStatus: http.StatusConflict,
+			wantBody:   `{"code":"metric_type_conflict","message":"metric requests has type counter, not gauge","request_id":"test-request"}`,
+		},
+		{
+			name:       "Test #8 put with mismatched id",
+			method:     http.MethodPut,
+			url:        "/api/v1/metrics/load",
+			body:       `{"id":"other","type":"gauge","value":1}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"code":"invalid_request","message":"metric id \"other\" does not match the path","request_id":"test-request"}`,
+		},
+		{
+			name:       "Test #9 put without value",
+			method:     http.MethodPut,
+			url:        "/api/v1/metrics/load",
+			body:       `{"type":"gauge"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"code":"invalid_metric_value","message":"missing gauge value","request_id":"test-request"}`,
+		},
+		{
+			name:       "Test #10 put with unknown type",
+			method:     http.MethodPut,
+			url:        "/api/v1/metrics/load",
+			body:       `{"type":"histogram","value":1}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"code":"invalid_metric_type","message":"invalid metric type \"histogram\"","request_id":"test-request"}`,
+		},
+		{
+			name:       "Test #11 put invalid JSON",
+			method:     http.MethodPut,
+			url:        "/api/v1/metrics/load",
+			body:       `{"type":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Test #12 patch increments counter",
+			method:     http.MethodPatch,
+			url:        "/api/v1/metrics/requests",
+			body:       `{"delta":5}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":"requests","type":"counter","delta":15}`,
+		},
+		{
+			name:       "Test #13 patch creates counter",
+			method:     http.MethodPatch,
+			url:        "/api/v1/metrics/hits",
+			body:       `{"type":"counter","delta":1}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":"hits","type":"counter","delta":1}`,
+		},
+		{
+			name:       "Test #14 patch gauge",
+			method:     http.MethodPatch,
+			url:        "/api/v1/metrics/load",
+			body:       `{"delta":1}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "Test #15 patch with gauge type",
+			method:     http.MethodPatch,
+			url:        "/api/v1/metrics/load",
+			body:       `{"type":"gauge","value":1}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"code":"invalid_metric_type","message":"only counters can be incremented","request_id":"test-request"}`,
+		},
+		{
+			name:       "Test #16 patch without delta",
+			method:     http.MethodPatch,
+			url:        "/api/v1/metrics/requests",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"code":"invalid_metric_value","message":"missing counter delta","request_id":"test-request"}`,
+		},
+		{
+			name:       "Test #17 delete metric",
+			method:     http.MethodDelete,
+			url:        "/api/v1/metrics/load",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Test #18 delete missing metric",
+			method:     http.MethodDelete,
+			url:        "/api/v1/metrics/missing",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Test #19 list filtered by type",
+			method:     http.MethodGet,
+			url:        "/api/v1/metrics?type=counter",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"metrics":[{"id":"requests","type":"counter","delta":10}]}`,
+		},
+		{
+			name:       "Test #20 list with invalid limit",
+			method:     http.MethodGet,
+			url:        "/api/v1/metrics?limit=0",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"code":"invalid_request","message":"limit must be an integer between 1 and 1000","request_id":"test-request"}`,
+		},
+		{
+			name:       "Test #21 list with invalid cursor",
+			method:     http.MethodGet,
+			url:        "/api/v1/metrics?cursor=not*base64",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Test #22 list with invalid type",
+			method:     http.MethodGet,
+			url:        "/api/v1/metrics?type=histogram",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newV1Router(t)
+
+			rec := serveV1(router, tt.method, tt.url, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+				assert.JSONEq(t, tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIV1_DeleteRemovesMetric(t *testing.T) {
+	router, service := newV1Router(t)
+
+	rec := serveV1(router, http.MethodDelete, "/api/v1/metrics/requests", "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	_, err := service.GetMetric(context.Background(), "requests")
+	assert.ErrorIs(t, err, repositories.ErrMetricNotFound)
+	assert.Equal(t, http.StatusNotFound, serveV1(router, http.MethodGet, "/api/v1/metrics/requests", "").Code)
+}
+
+func TestAPIV1_ConcurrentCounterPut(t *testing.T) {
+	router, service := newV1Router(t)
+	const requests = 16
+
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- serveV1(router, http.MethodPut, "/api/v1/metrics/hits", `{"type":"counter","delta":3}`).Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := make(map[int]int)
+	for status := range statuses {
+		counts[status]++
+	}
+	assert.Equal(t, map[int]int{http.StatusCreated: 1, http.StatusConflict: requests - 1}, counts)
+
+	metric, err := service.GetMetric(context.Background(), "hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), metric.Value, "only one PUT creates the counter")
+}
+
+func TestListMetricsV1_Pagination(t *testing.T) {
+	router, service := newV1Router(t)
+	for i := 0; i < 7; i++ {
+		require.NoError(t, service.UpdateGaugeMetric(context.Background(), "g"+strconv.Itoa(i), float64(i)))
+	}
+
+	var names []string
+	url := "/api/v1/metrics?limit=4"
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 5, "pagination does not terminate")
+
+		rec := serveV1(router, http.MethodGet, url, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var page models.MetricList
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+		assert.LessOrEqual(t, len(page.Metrics), 4)
+		for _, m := range page.Metrics {
+			names = append(names, m.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		url = "/api/v1/metrics?limit=4&cursor=" + page.NextCursor
+	}
+
+	assert.Equal(t, []string{"g0", "g1", "g2", "g3", "g4", "g5", "g6", "load", "requests"}, names)
+}
+
+// openAPIDocument is the part of an OpenAPI document the tests check responses against.
+type openAPIDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]*jsonSchema      `json:"schemas"`
+		Responses map[string]*openAPIResponse `json:"responses"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Responses map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema *jsonSchema `json:"schema"`
+	} `json:"content"`
+}
+
+type jsonSchema struct {
+	Ref        string                 `json:"$ref"`
+	Type       string                 `json:"type"`
+	Required   []string               `json:"required"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Items      *jsonSchema            `json:"items"`
+	Enum       []interface{}          `json:"enum"`
+}
+
+func loadOpenAPIDocument(t *testing.T) *openAPIDocument {
+	t.Helper()
+	var doc openAPIDocument
+	require.NoError(t, json.Unmarshal(openAPISpec, &doc))
+	return &doc
+}
+
+// operation returns the operation of the document for a method and a route of the /api/v1 router.
+func (d *openAPIDocument) operation(t *testing.T, method, route string) *openAPIOperation {
+	t.Helper()
+	item, ok := d.Paths[route]
+	require.True(t, ok, "path %s is not documented", route)
+	raw, ok := item[strings.ToLower(method)]
+	require.True(t, ok, "%s %s is not documented", method, route)
+	var op openAPIOperation
+	require.NoError(t, json.Unmarshal(raw, &op))
+	return &op
+}
+
+// validate checks v, a decoded JSON value, against schema and returns the first violation.
+func (d *openAPIDocument) validate(schema *jsonSchema, v interface{}, path string) error {
+	if schema.Ref != "" {
+		resolved, ok := d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("%s: unresolved reference %s", path, schema.Ref)
+		}
+		return d.validate(resolved, v, path)
+	}
+
+	if len(schema.Enum) > 0 {
+		found := false
+		for _, e := range schema.Enum {
+			found = found || e == v
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, v, schema.Enum)
+		}
+	}
+
+	switch schema.Type {
+	case "":
+		return nil
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %v is not an object", path, v)
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %s", path, name)
+			}
+		}
+		for name, value := range obj {
+			if prop, ok := schema.Properties[name]; ok {
+				if err := d.validate(prop, value, path+"."+name); err != nil {
+					return err
+				}
+			} else if schema.Properties != nil {
+				return fmt.Errorf("%s: undocumented property %s", path, name)
+			}
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %v is not an array", path, v)
+		}
+		for i, item := range arr {
+			if err := d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%s: %v is not a string", path, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: %v is not a boolean", path, v)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: %v is not a number", path, v)
+		}
+	case "integer":
+		if f, ok := v.(float64); !ok || f != float64(int64(f)) {
+			return fmt.Errorf("%s: %v is not an integer", path, v)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %s", path, schema.Type)
+	}
+	return nil
+}
+
+func TestOpenAPISpec_DocumentsRoutes(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	router, _ := newV1Router(t)
+
+	var routed []string
+	require.NoError(t, chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if strings.HasPrefix(route, "/api/v1/") {
+			routed = append(routed, method+" "+strings.TrimPrefix(route, "/api/v1"))
+		}
+		return nil
+	}))
+
+	var documented []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method != "parameters" {
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+
+	sort.Strings(routed)
+	sort.Strings(documented)
+	assert.Equal(t, documented, routed)
+}
+
+func TestOpenAPISpec_ValidatesResponses(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+
+	tests := []struct {
+		name   string
+		method string
+		route  string
+		url    string
+		body   string
+	}{
+		{name: "Test #1 list", method: http.MethodGet, route: "/metrics", url: "/api/v1/metrics"},
+		{name: "Test #2 list page", method: http.MethodGet, route: "/metrics", url: "/api/v1/metrics?limit=1"},
+		{name: "Test #3 list bad limit", method: http.MethodGet, route: "/metrics", url: "/api/v1/metrics?limit=x"},
+		{name: "Test #4 get", method: http.MethodGet, route: "/metrics/{metricName}", url: "/api/v1/metrics/requests"},
+		{name: "Test #5 get missing", method: http.MethodGet, route: "/metrics/{metricName}", url: "/api/v1/metrics/nope"},
+		{name: "Test #6 put create", method: http.MethodPut, route: "/metrics/{metricName}", url: "/api/v1/metrics/temp", body: `{"type":"gauge","value":1}`},
+		{name: "Test #7 put replace", method: http.MethodPut, route: "/metrics/{metricName}", url: "/api/v1/metrics/load", body: `{"type":"gauge","value":1}`},
+		{name: "Test #8 put counter", method: http.MethodPut, route: "/metrics/{metricName}", url: "/api/v1/metrics/requests", body: `{"type":"counter","delta":1}`},
+		{name: "Test #9 put bad body", method: http.MethodPut, route: "/metrics/{metricName}", url: "/api/v1/metrics/load", body: `[]`},
+		{name: "Test #10 patch", method: http.MethodPatch, route: "/metrics/{metricName}", url: "/api/v1/metrics/requests", body: `{"delta":1}`},
+		{name: "Test #11 patch gauge", method: http.MethodPatch, route: "/metrics/{metricName}", url: "/api/v1/metrics/load", body: `{"delta":1}`},
+		{name: "Test #12 delete", method: http.MethodDelete, route: "/metrics/{metricName}", url: "/api/v1/metrics/load"},
+		{name: "Test #13 delete missing", method: http.MethodDelete, route: "/metrics/{metricName}", url: "/api/v1/metrics/nope"},
+		{name: "Test #14 document", method: http.MethodGet, route: "/openapi.json", url: "/api/v1/openapi.json"},
+		{name: "Test #15 rate", method: http.MethodGet, route: "/metrics/{metricName}/rate", url: "/api/v1/metrics/requests/rate?window=5m"},
+		{name: "Test #16 rate bad window", method: http.MethodGet, route: "/metrics/{metricName}/rate", url: "/api/v1/metrics/requests/rate?window=x"},
+		{name: "Test #17 rate of gauge", method: http.MethodGet, route: "/metrics/{metricName}/rate", url: "/api/v1/metrics/load/rate"},
+		{name: "Test #18 rate missing", method: http.MethodGet, route: "/metrics/{metricName}/rate", url: "/api/v1/metrics/nope/rate"},
+		{name: "Test #19 rollups", method: http.MethodGet, route: "/metrics/{metricName}/rollups", url: "/api/v1/metrics/load/rollups?window=1h"},
+		{name: "Test #20 rollups unknown window", method: http.MethodGet, route: "/metrics/{metricName}/rollups", url: "/api/v1/metrics/load/rollups?window=5m"},
+		{name: "Test #21 rollups of counter", method: http.MethodGet, route: "/metrics/{metricName}/rollups", url: "/api/v1/metrics/requests/rollups?window=1h"},
+		{name: "Test #22 rollups missing", method: http.MethodGet, route: "/metrics/{metricName}/rollups", url: "/api/v1/metrics/nope/rollups?window=1h"},
+		{name: "Test #23 stream disabled", method: http.MethodGet, route: "/stream", url: "/api/v1/stream?prefix=lo"},
+		{name: "Test #24 websocket stream disabled", method: http.MethodGet, route: "/stream/ws", url: "/api/v1/stream/ws?name=load"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, service := newV1Router(t)
+			require.NoError(t, service.UpdateMetadata(context.Background(), map[string]repositories.Metadata{
+				"requests": {Type: constants.MetricTypeCounter, Help: "Number of requests.", Owner: "web"},
+			}))
+			op := doc.operation(t, tt.method, tt.route)
+
+			rec := serveV1(router, tt.method, tt.url, tt.body)
+
+			resp, ok := op.Responses[strconv.Itoa(rec.Code)]
+			require.True(t, ok, "status %d of %s %s is not documented", rec.Code, tt.method, tt.route)
+			if resp.Ref != "" {
+				resp, ok = doc.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+				require.True(t, ok, "unresolved response reference")
+			}
+
+			if len(resp.Content) == 0 {
+				assert.Empty(t, rec.Body.String())
+				return
+			}
+			media, ok := resp.Content[rec.Header().Get("Content-Type")]
+			require.True(t, ok, "content type %q is not documented", rec.Header().Get("Content-Type"))
+
+			var body interface{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.NoError(t, doc.validate(media.Schema, body, "body"))
+		})
+	}
+}
+
+// staleReader marks a metric of the wrapped service stale.
+type staleReader struct {
+	*services.Service
+	stale string
+}
+
+func (r staleReader) GetMetricWithRetry(ctx context.Context, name string) (repositories.Metric, error) {
+	metric, err := r.Service.GetMetricWithRetry(ctx, name)
+	metric.Stale = name == r.stale
+	return metric, err
+}
+
+func (r staleReader) GetMetricsWithRetry(ctx context.Context) (map[string]repositories.Metric, error) {
+	metrics, err := r.Service.GetMetricsWithRetry(ctx)
+	if metric, ok := metrics[r.stale]; ok {
+		metric.Stale = true
+		metrics[r.stale] = metric
+	}
+	return metrics, err
+}
+
+func TestAPIV1_StaleMetrics(t *testing.T) {
+	_, service := newV1Router(t)
+	router := NewRouter(NewHandler(staleReader{Service: service, stale: "load"}, service, nil), &config.ServerConfig{})
+
+	rec := serveV1(router, http.MethodGet, "/api/v1/metrics", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"metrics":[{"id":"requests","type":"counter","delta":10}]}`, rec.Body.String())
+
+	rec = serveV1(router, http.MethodGet, "/api/v1/metrics?include_stale=true", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"metrics":[
+		{"id":"load","type":"gauge","value":0.5,"stale":true},
+		{"id":"requests","type":"counter","delta":10}
+	]}`, rec.Body.String())
+
+	rec = serveV1(router, http.MethodGet, "/api/v1/metrics/load", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"load","type":"gauge","value":0.5,"stale":true}`, rec.Body.String())
+
+	rec = serveV1(router, http.MethodGet, "/", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "load")
+	assert.Contains(t, rec.Body.String(), "requests")
+}
+
+func TestCounterRateV1(t *testing.T) {
+	router, service := newV1Router(t)
+	require.NoError(t, service.UpdateCounterMetric(context.Background(), "requests", 30))
+
+	tests := []struct {
+		name           string
+		url            string
+		wantStatusCode int
+		wantBody       string
+		wantCode       string
+	}{
+		{
+			name:           "Test #1 default window",
+			url:            "/api/v1/metrics/requests/rate",
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"id":"requests","window":60,"increase":30,"rate":0.5,"resets":0}`,
+		},
+		{
+			name:           "Test #2 window",
+			url:            "/api/v1/metrics/requests/rate?window=5m",
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"id":"requests","window":300,"increase":30,"rate":0.1,"resets":0}`,
+		},
+		{name: "Test #3 invalid window", url: "/api/v1/metrics/requests/rate?window=soon", wantStatusCode: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "Test #4 window too long", url: "/api/v1/metrics/requests/rate?window=2h", wantStatusCode: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "Test #5 gauge", url: "/api/v1/metrics/load/rate", wantStatusCode: http.StatusBadRequest, wantCode: CodeMetricTypeMismatch},
+		{name: "Test #6 missing", url: "/api/v1/metrics/nope/rate", wantStatusCode: http.StatusNotFound, wantCode: CodeMetricNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveV1(router, http.MethodGet, tt.url, "")
+			require.Equal(t, tt.wantStatusCode, rec.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rec.Body.String())
+				return
+			}
+			var resp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantCode, resp.Code)
+		})
+	}
+}
+
+func TestRollupsV1(t *testing.T) {
+	router, service := newV1Router(t)
+	for _, v := range []float64{2, 1.5} {
+		require.NoError(t, service.UpdateGaugeMetric(context.Background(), "load", v))
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		wantStatusCode int
+		wantCode       string
+	}{
+		{name: "Test #1 rollups", url: "/api/v1/metrics/load/rollups?window=1h", wantStatusCode: http.StatusOK},
+		{name: "Test #2 missing window", url: "/api/v1/metrics/load/rollups", wantStatusCode: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "Test #3 invalid window", url: "/api/v1/metrics/load/rollups?window=hourly", wantStatusCode: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "Test #4 unconfigured window", url: "/api/v1/metrics/load/rollups?window=5m", wantStatusCode: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "Test #5 counter", url: "/api/v1/metrics/requests/rollups?window=1h", wantStatusCode: http.StatusBadRequest, wantCode: CodeMetricTypeMismatch},
+		{name: "Test #6 missing", url: "/api/v1/metrics/nope/rollups?window=1h", wantStatusCode: http.StatusNotFound, wantCode: CodeMetricNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveV1(router, http.MethodGet, tt.url, "")
+			require.Equal(t, tt.wantStatusCode, rec.Code)
+			if tt.wantCode != "" {
+				var resp models.ErrorResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+				return
+			}
+
+			var list models.RollupList
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+			assert.Equal(t, "load", list.ID)
+			require.NotEmpty(t, list.Rollups)
+
+			// The values may span two windows when the test runs at the turn of an hour.
+			var count int64
+			minValue, maxValue := list.Rollups[0].Min, list.Rollups[0].Max
+			for _, rollup := range list.Rollups {
+				assert.Equal(t, float64(3600), rollup.Window)
+				assert.Equal(t, rollup.Start, rollup.Start.Truncate(time.Hour))
+				count += rollup.Count
+				minValue = min(minValue, rollup.Min)
+				maxValue = max(maxValue, rollup.Max)
+			}
+			assert.Equal(t, int64(3), count)
+			assert.Equal(t, 0.5, minValue)
+			assert.Equal(t, float64(2), maxValue)
+			assert.Equal(t, 1.5, list.Rollups[len(list.Rollups)-1].Last)
+		})
+	}
+}
+
+func TestGetMetric_Rollup(t *testing.T) {
+	router, service := newV1Router(t)
+	require.NoError(t, service.UpdateGaugeMetric(context.Background(), "load", 2))
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		wantStatusCode int
+		wantBody       string
+		wantCode       string
+	}{
+		{name: "Test #1 last", method: http.MethodGet, url: "/value/gauge/load?rollup=1h&stat=last", wantStatusCode: http.StatusOK, wantBody: "2\n"},
+		{name: "Test #2 bad stat", method: http.MethodGet, url: "/value/gauge/load?rollup=1h&stat=median", wantStatusCode: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "Test #3 unconfigured window", method: http.MethodGet, url: "/value/gauge/load?rollup=1m", wantStatusCode: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "Test #4 counter", method: http.MethodGet, url: "/value/counter/requests?rollup=1h", wantStatusCode: http.StatusBadRequest, wantCode: CodeMetricTypeMismatch},
+		{name: "Test #5 without rollup", method: http.MethodGet, url: "/value/gauge/load", wantStatusCode: http.StatusOK, wantBody: "2\n"},
+		{
+			name:           "Test #6 json",
+			method:         http.MethodPost,
+			url:            "/value/?rollup=1h",
+			body:           `{"id":"load","type":"gauge"}`,
+			wantStatusCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveV1(router, tt.method, tt.url, tt.body)
+			require.Equal(t, tt.wantStatusCode, rec.Code)
+			switch {
+			case tt.wantCode != "":
+				var resp models.ErrorResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+			case tt.wantBody != "":
+				assert.Equal(t, tt.wantBody, rec.Body.String())
+			default:
+				var m models.Metrics
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &m))
+				require.NotNil(t, m.Rollup)
+				assert.Equal(t, float64(3600), m.Rollup.Window)
+				assert.Equal(t, float64(2), m.Rollup.Last)
+			}
+		})
+	}
+}
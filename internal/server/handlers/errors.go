@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/server/query"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+	"github.com/a2sh3r/sysmetrics/internal/server/stream"
+)
+
+// Error codes of the models.ErrorResponse bodies sent by the /value/, /update/, /updates/, /metadata/, /api/query, /api/v1 and /admin endpoints.
+//
+//	Code                        Status  Cause
+//	invalid_request             400     missing or malformed request parameters, an invalid tenant, services.ErrInvalidWindow or repositories.ErrRollupWindowNotConfigured
+//	invalid_json                400     a body that is not valid JSON
+//	invalid_batch               400     a binary batch that cannot be decoded
+//	invalid_metric_name         400     a metric name the storage does not accept
+//	invalid_metric_type         400     an unknown metric type in a URL path
+//	invalid_metric_value        400     a missing value or delta, one that cannot be parsed, or services.ErrNegativeCounter
+//	metric_type_mismatch        400     a metric read with another type than it is stored with, services.ErrNotCounter or services.ErrNotGauge
+//	invalid_metadata            400     services.ErrInvalidMetadata: malformed metric metadata
+//	invalid_query               400     query.ErrInvalidQuery: a query of /api/query that cannot be parsed or evaluated
+//	forbidden                   403     an admin operation on another tenant, or on all tenants, with a token bound to a tenant
+//	not_found                   404     an unknown route
+//	metric_not_found            404     repositories.ErrMetricNotFound, or a gauge without values in the rollup window queried
+//	method_not_allowed          405     an unsupported method on a known route
+//	metric_type_conflict        409     repositories.ErrMetricInvalidType: a write with another type than stored
+//	counter_exists              409     a PUT of an existing counter, which can only be incremented with PATCH
+//	payload_too_large           413     a request body over the configured size limits
+//	cardinality_limit_exceeded  422     services.ErrCardinalityLimitExceeded
+//	metadata_limit_exceeded     422     services.ErrMetadataLimitExceeded
+//	series_quota_exceeded       429     services.ErrSeriesQuotaExceeded, sent with a Retry-After header
+//	internal_error              500     any other error; its message is logged but not sent
+//	unsupported_metric_type     501     an unknown metric type in a JSON body
+//	not_implemented             501     an admin operation on a server without administration support
+//	streaming_disabled          501     a metric stream opened on a server without a stream.Hub
+//	slow_consumer               503     stream.ErrSlowConsumer, sent last on a stream that fell behind
+//	stream_closed               503     stream.ErrHubClosed, sent last on the streams of a server shutting down
+//	too_many_subscribers        503     stream.ErrTooManySubscribers: a stream opened while the server has as many as it accepts
+//	batch_rejected              varies  a batch with invalid items; Details holds the models.BatchResult
+//
+// Errors of the middleware, such as failed authentication or signature checks, use the same envelope
+// with the codes of the middleware package.
+const (
+	CodeInvalidRequest           = middleware.CodeInvalidRequest
+	CodeInvalidJSON              = "invalid_json"
+	CodeInvalidBatch             = "invalid_batch"
+	CodeInvalidMetricName        = "invalid_metric_name"
+	CodeInvalidMetricType        = "invalid_metric_type"
+	CodeInvalidMetricValue       = "invalid_metric_value"
+	CodeMetricTypeMismatch       = "metric_type_mismatch"
+	CodeInvalidMetadata          = "invalid_metadata"
+	CodeInvalidQuery             = "invalid_query"
+	CodeForbidden                = middleware.CodeForbidden
+	CodeNotFound                 = "not_found"
+	CodeMetricNotFound           = "metric_not_found"
+	CodeMethodNotAllowed         = "method_not_allowed"
+	CodeMetricTypeConflict       = "metric_type_conflict"
+	CodeCounterExists            = "counter_exists"
+	CodePayloadTooLarge          = middleware.CodePayloadTooLarge
+	CodeCardinalityLimitExceeded = "cardinality_limit_exceeded"
+	CodeMetadataLimitExceeded    = "metadata_limit_exceeded"
+	CodeSeriesQuotaExceeded      = "series_quota_exceeded"
+	CodeInternal                 = "internal_error"
+	CodeUnsupportedMetricType    = "unsupported_metric_type"
+	CodeNotImplemented           = "not_implemented"
+	CodeStreamingDisabled        = "streaming_disabled"
+	CodeSlowConsumer             = "slow_consumer"
+	CodeStreamClosed             = "stream_closed"
+	CodeTooManySubscribers       = "too_many_subscribers"
+	CodeBatchRejected            = "batch_rejected"
+)
+
+// quotaRetryAfter is the Retry-After value, in seconds, sent when a tenant exceeds its series quota.
+const quotaRetryAfter = "60"
+
+// APIError is an error with the status and body of its HTTP response.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+	Err     error
+}
+
+// Error returns the message of the error.
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the cause of the error.
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func newAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+// errorStatuses maps sentinel errors of the storage and service layers to their responses.
+var errorStatuses = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{repositories.ErrMetricNotFound, http.StatusNotFound, CodeMetricNotFound},
+	{repositories.ErrMetricInvalidType, http.StatusConflict, CodeMetricTypeConflict},
+	{repositories.ErrMetricInvalidName, http.StatusBadRequest, CodeInvalidMetricName},
+	{services.ErrSeriesQuotaExceeded, http.StatusTooManyRequests, CodeSeriesQuotaExceeded},
+	{services.ErrCardinalityLimitExceeded, http.StatusUnprocessableEntity, CodeCardinalityLimitExceeded},
+	{services.ErrInvalidMetadata, http.StatusBadRequest, CodeInvalidMetadata},
+	{services.ErrMetadataLimitExceeded, http.StatusUnprocessableEntity, CodeMetadataLimitExceeded},
+	{services.ErrNegativeCounter, http.StatusBadRequest, CodeInvalidMetricValue},
+	{services.ErrNotCounter, http.StatusBadRequest, CodeMetricTypeMismatch},
+	{services.ErrInvalidWindow, http.StatusBadRequest, CodeInvalidRequest},
+	{services.ErrNotGauge, http.StatusBadRequest, CodeMetricTypeMismatch},
+	{repositories.ErrRollupWindowNotConfigured, http.StatusBadRequest, CodeInvalidRequest},
+	{query.ErrInvalidQuery, http.StatusBadRequest, CodeInvalidQuery},
+	{stream.ErrSlowConsumer, http.StatusServiceUnavailable, CodeSlowConsumer},
+	{stream.ErrHubClosed, http.StatusServiceUnavailable, CodeStreamClosed},
+	{stream.ErrTooManySubscribers, http.StatusServiceUnavailable, CodeTooManySubscribers},
+}
+
+// toAPIError converts err to the APIError it is responded with. Unknown errors become internal errors
+// whose message is not exposed.
+func toAPIError(err error) *APIError {
+	if tooLarge, ok := middleware.AsBodyTooLarge(err); ok {
+		return &APIError{Status: http.StatusRequestEntityTooLarge, Code: CodePayloadTooLarge, Message: tooLarge.Error(), Err: err}
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	for _, s := range errorStatuses {
+		if errors.Is(err, s.err) {
+			return &APIError{Status: s.status, Code: s.code, Message: err.Error(), Err: err}
+		}
+	}
+
+	return &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal server error", Err: err}
+}
+
+// writeError responds with the models.ErrorResponse of err.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toAPIError(err)
+	requestID := middleware.RequestID(r.Context())
+
+	fields := []zap.Field{
+		zap.String("request_id", requestID),
+		zap.String("path", r.URL.Path),
+		zap.String("code", apiErr.Code),
+		zap.Error(err),
+	}
+	if apiErr.Status >= http.StatusInternalServerError {
+		logger.Log.Error("Request failed", fields...)
+	} else {
+		logger.Log.Warn("Request rejected", fields...)
+	}
+
+	if apiErr.Status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", quotaRetryAfter)
+	}
+	middleware.WriteError(w, r, apiErr.Status, apiErr.Code, apiErr.Message, apiErr.Details)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		{
+			name:        "Test #1 metric not found",
+			err:         fmt.Errorf("lookup failed: %w", memstorage.ErrMetricNotFound),
+			wantStatus:  http.StatusNotFound,
+			wantCode:    CodeMetricNotFound,
+			wantMessage: "lookup failed: metric not found",
+		},
+		{
+			name:        "Test #2 type conflict",
+			err:         memstorage.ErrMetricInvalidType,
+			wantStatus:  http.StatusConflict,
+			wantCode:    CodeMetricTypeConflict,
+			wantMessage: "invalid value type for metric",
+		},
+		{
+			name:        "Test #3 quota exceeded",
+			err:         services.ErrSeriesQuotaExceeded,
+			wantStatus:  http.StatusTooManyRequests,
+			wantCode:    CodeSeriesQuotaExceeded,
+			wantMessage: "series quota exceeded",
+		},
+		{
+			name:        "Test #4 body too large",
+			err:         fmt.Errorf("decode: %w", &http.MaxBytesError{Limit: 10}),
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    CodePayloadTooLarge,
+			wantMessage: "request body exceeds the limit of 10 bytes",
+		},
+		{
+			name:        "Test #5 API error",
+			err:         newAPIError(http.StatusBadRequest, CodeInvalidRequest, "missing metric id or type"),
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeInvalidRequest,
+			wantMessage: "missing metric id or type",
+		},
+		{
+			name:        "Test #6 internal error is not exposed",
+			err:         errors.New("connection refused: 10.0.0.1:5432"),
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    CodeInternal,
+			wantMessage: "internal server error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := middleware.NewRequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, r, tt.err)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/value/gauge/x", nil)
+			req.Header.Set(middleware.RequestIDHeader, "req-1")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			var resp models.ErrorResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			assert.Equal(t, models.ErrorResponse{Code: tt.wantCode, Message: tt.wantMessage, RequestID: "req-1"}, resp)
+		})
+	}
+}
@@ -9,21 +9,24 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	"github.com/a2sh3r/sysmetrics/internal/config"
 	"github.com/a2sh3r/sysmetrics/internal/constants"
 	"github.com/a2sh3r/sysmetrics/internal/server/handlers"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
 )
 
 type mockService struct {
-	metrics map[string]repositories.Metric
+	metrics  map[string]repositories.Metric
+	metadata map[string]repositories.Metadata
 }
 
 func (m *mockService) GetMetricWithRetry(_ context.Context, name string) (repositories.Metric, error) {
 	metric, ok := m.metrics[name]
 	if !ok {
-		return repositories.Metric{}, http.ErrNoLocation
+		return repositories.Metric{}, repositories.ErrMetricNotFound
 	}
 	return metric, nil
 }
@@ -38,15 +41,51 @@ func (m *mockService) UpdateCounterMetricWithRetry(_ context.Context, name strin
 	m.metrics[name] = repositories.Metric{Type: constants.MetricTypeCounter, Value: value}
 	return nil
 }
+func (m *mockService) CreateCounterMetricWithRetry(_ context.Context, name string, value int64) error {
+	if _, ok := m.metrics[name]; ok {
+		return repositories.ErrMetricExists
+	}
+	m.metrics[name] = repositories.Metric{Type: constants.MetricTypeCounter, Value: value}
+	return nil
+}
 func (m *mockService) UpdateMetricsBatchWithRetry(_ context.Context, metrics map[string]repositories.Metric) error {
 	for k, v := range metrics {
 		m.metrics[k] = v
 	}
 	return nil
 }
+func (m *mockService) DeleteMetricWithRetry(_ context.Context, name string) error {
+	if _, ok := m.metrics[name]; !ok {
+		return repositories.ErrMetricNotFound
+	}
+	delete(m.metrics, name)
+	return nil
+}
+func (m *mockService) UpdateMetadataWithRetry(_ context.Context, metadata map[string]repositories.Metadata) error {
+	for k, v := range metadata {
+		m.metadata[k] = v
+	}
+	return nil
+}
+func (m *mockService) GetMetadataWithRetry(_ context.Context) (map[string]repositories.Metadata, error) {
+	return m.metadata, nil
+}
+func (m *mockService) CounterRateWithRetry(_ context.Context, name string, _ time.Duration) (services.CounterRate, error) {
+	if _, ok := m.metrics[name]; !ok {
+		return services.CounterRate{}, repositories.ErrMetricNotFound
+	}
+	return services.CounterRate{}, nil
+}
+
+func (m *mockService) GetRollupsWithRetry(_ context.Context, name string, _ time.Duration) ([]repositories.Rollup, error) {
+	if _, ok := m.metrics[name]; !ok {
+		return nil, repositories.ErrMetricNotFound
+	}
+	return nil, nil
+}
 
 func newTestServer() (*mockService, *httptest.Server) {
-	svc := &mockService{metrics: make(map[string]repositories.Metric)}
+	svc := &mockService{metrics: make(map[string]repositories.Metric), metadata: make(map[string]repositories.Metadata)}
 	h := handlers.NewHandler(svc, svc, nil)
 	r := handlers.NewRouter(h, &config.ServerConfig{})
 	ts := httptest.NewServer(r)
@@ -192,7 +231,7 @@ func ExampleHandler_UpdateSerializedMetrics() {
 	fmt.Println(string(respBody))
 	// Output:
 	// 200
-	//
+	// {"mode":"strict","accepted":2,"rejected_total":0,"rejected":[]}
 }
 
 func ExampleHandler_Ping() {
@@ -4,21 +4,41 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"time"
 
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+	"github.com/a2sh3r/sysmetrics/internal/server/stream"
 )
 
 // ReaderServiceInterface defines methods for reading metrics with retry logic.
 type ReaderServiceInterface interface {
 	GetMetricWithRetry(ctx context.Context, metricName string) (repositories.Metric, error)
 	GetMetricsWithRetry(ctx context.Context) (map[string]repositories.Metric, error)
+	GetMetadataWithRetry(ctx context.Context) (map[string]repositories.Metadata, error)
+	CounterRateWithRetry(ctx context.Context, name string, window time.Duration) (services.CounterRate, error)
+	GetRollupsWithRetry(ctx context.Context, name string, window time.Duration) ([]repositories.Rollup, error)
 }
 
 // WriterServiceInterface defines methods for updating metrics with retry logic.
 type WriterServiceInterface interface {
 	UpdateGaugeMetricWithRetry(ctx context.Context, name string, value float64) error
 	UpdateCounterMetricWithRetry(ctx context.Context, name string, value int64) error
+	CreateCounterMetricWithRetry(ctx context.Context, name string, value int64) error
 	UpdateMetricsBatchWithRetry(ctx context.Context, metrics map[string]repositories.Metric) error
+	DeleteMetricWithRetry(ctx context.Context, name string) error
+	UpdateMetadataWithRetry(ctx context.Context, metadata map[string]repositories.Metadata) error
+}
+
+// AdminServiceInterface defines tenant administration methods with retry logic.
+type AdminServiceInterface interface {
+	ListTenantsWithRetry(ctx context.Context) ([]string, error)
+	DeleteTenantWithRetry(ctx context.Context, tenant string) error
+	UsageWithRetry(ctx context.Context) ([]services.TenantUsage, error)
+	CardinalityWithRetry(ctx context.Context) (services.CardinalityReport, error)
+	RetentionStatusWithRetry(ctx context.Context) (services.RetentionStatus, error)
+	DeleteMetricsWithRetry(ctx context.Context, selector repositories.Selector, dryRun bool) ([]string, error)
 }
 
 // Handler handles HTTP requests for metrics.
@@ -26,6 +46,12 @@ type Handler struct {
 	reader ReaderServiceInterface
 	writer WriterServiceInterface
 	DB     *sql.DB
+	Admin  AdminServiceInterface
+	// Hub streams metric updates to the subscribers of /api/v1/stream. Streaming is disabled when nil.
+	Hub *stream.Hub
+	// Limiter rate limits clients and reports their usage on /admin/usage. NewRouter creates one from the
+	// configuration when nil; it is shared with the gRPC server otherwise.
+	Limiter *middleware.RateLimiter
 }
 
 // NewHandler creates a new Handler instance.
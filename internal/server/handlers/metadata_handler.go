@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+)
+
+// UpdateMetadata handles POST requests registering the metadata of metrics with a JSON array of
+// models.MetadataUpdate. Registered metadata is replaced; when an id repeats, the last entry wins.
+func (h *Handler) UpdateMetadata(w http.ResponseWriter, r *http.Request) {
+	var updates []models.MetadataUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		writeError(w, r, invalidJSON(err))
+		return
+	}
+
+	metadata := make(map[string]repositories.Metadata, len(updates))
+	for _, u := range updates {
+		metadata[u.ID] = repositories.Metadata{Type: u.MType, Unit: u.Unit, Help: u.Help, Owner: u.Owner}
+	}
+
+	if err := h.writer.UpdateMetadataWithRetry(r.Context(), metadata); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger.Log.Info("Registered metric metadata", zap.Int("count", len(metadata)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMetadata handles GET requests listing the registered metadata as a JSON array of
+// models.MetadataUpdate ordered by id.
+func (h *Handler) GetMetadata(w http.ResponseWriter, r *http.Request) {
+	metadata, err := h.reader.GetMetadataWithRetry(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := make([]models.MetadataUpdate, 0, len(metadata))
+	for name, meta := range metadata {
+		response = append(response, models.MetadataUpdate{
+			ID:             name,
+			MType:          meta.Type,
+			MetricMetadata: models.MetricMetadata{Unit: meta.Unit, Help: meta.Help, Owner: meta.Owner},
+		})
+	}
+	sort.Slice(response, func(i, j int) bool { return response[i].ID < response[j].ID })
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+)
+
+func TestUpdateMetadata(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Test #1 register metadata",
+			body:       `[{"id":"load","type":"gauge","unit":"ratio","help":"Load average."},{"id":"requests","type":"counter","owner":"web"}]`,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Test #2 invalid json",
+			body:       `{"id":"load"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `"code":"invalid_json"`,
+		},
+		{
+			name:       "Test #3 unknown type",
+			body:       `[{"id":"load","type":"histogram"}]`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `"code":"invalid_metadata"`,
+		},
+		{
+			name:       "Test #4 missing id",
+			body:       `[{"unit":"bytes"}]`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `"code":"invalid_metadata"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newV1Router(t)
+			rec := serveV1(router, http.MethodPost, "/metadata/", tt.body)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestMetadata_Responses(t *testing.T) {
+	router, service := newV1Router(t)
+	require.NoError(t, service.UpdateMetadata(context.Background(), map[string]repositories.Metadata{
+		"load":   {Type: "gauge", Unit: "ratio", Help: `Load average \ 1m.`},
+		"absent": {Type: "gauge", Unit: "bytes"},
+	}))
+
+	rec := serveV1(router, http.MethodGet, "/metadata/", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[
+		{"id":"absent","type":"gauge","unit":"bytes"},
+		{"id":"load","type":"gauge","unit":"ratio","help":"Load average \\ 1m."}
+	]`, rec.Body.String())
+
+	rec = serveV1(router, http.MethodGet, "/", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "# HELP load Load average \\\\ 1m.\n# UNIT load ratio\nload 0.5\nrequests 10\n", rec.Body.String())
+
+	rec = serveV1(router, http.MethodPost, "/value/", `{"id":"load","type":"gauge"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"load","type":"gauge","value":0.5,"metadata":{"unit":"ratio","help":"Load average \\ 1m."}}`, rec.Body.String())
+
+	rec = serveV1(router, http.MethodGet, "/api/v1/metrics/requests", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"requests","type":"counter","delta":10}`, rec.Body.String())
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	"github.com/a2sh3r/sysmetrics/internal/server/query"
+)
+
+// maxQueryLength is the length in bytes of the longest query accepted by /api/query.
+const maxQueryLength = 4096
+
+// Query returns a handler of GET and POST requests evaluating the query parameter with engine over
+// the metrics of the tenant and responding with a models.QueryResult. POST requests may send the
+// query form-encoded in the body.
+func (h *Handler) Query(engine *query.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.FormValue("query")
+		if strings.TrimSpace(q) == "" {
+			writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "query parameter is required"))
+			return
+		}
+		if len(q) > maxQueryLength {
+			writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidQuery,
+				fmt.Sprintf("query must be at most %d bytes", maxQueryLength)))
+			return
+		}
+
+		value, err := engine.Query(r.Context(), q)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toQueryResult(value))
+	}
+}
+
+// toQueryResult converts the value of a query to its response.
+func toQueryResult(value query.Value) models.QueryResult {
+	var samples query.Vector
+	switch v := value.(type) {
+	case query.Scalar:
+		samples = query.Vector{{Value: float64(v)}}
+	case query.Vector:
+		samples = v
+	}
+
+	result := models.QueryResult{Type: string(value.Type()), Samples: make([]models.QuerySample, len(samples))}
+	for i, s := range samples {
+		result.Samples[i] = models.QuerySample{Name: s.Name}
+		if !math.IsNaN(s.Value) && !math.IsInf(s.Value, 0) {
+			result.Samples[i].Value = &s.Value
+		}
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+)
+
+func TestHandler_Query(t *testing.T) {
+	router, service := newV1Router(t)
+	require.NoError(t, service.UpdateGaugeMetric(identity.WithTenant(context.Background(), "team-a"), "load", 9))
+
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		tenant     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "Test #1 vector", method: http.MethodGet, query: "load * 100", wantStatus: http.StatusOK,
+			wantBody: `{"type":"vector","samples":[{"name":"load","value":50}]}`},
+		{name: "Test #2 scalar", method: http.MethodGet, query: "1 + 1", wantStatus: http.StatusOK,
+			wantBody: `{"type":"scalar","samples":[{"value":2}]}`},
+		{name: "Test #3 aggregation", method: http.MethodGet, query: "sum(*) / count(*)", wantStatus: http.StatusOK,
+			wantBody: `{"type":"vector","samples":[{"value":5.25}]}`},
+		{name: "Test #4 post form", method: http.MethodPost, query: "requests - load", wantStatus: http.StatusOK,
+			wantBody: `{"type":"vector","samples":[{"name":"requests","value":9.5}]}`},
+		{name: "Test #5 not finite", method: http.MethodGet, query: "load / 0", wantStatus: http.StatusOK,
+			wantBody: `{"type":"vector","samples":[{"name":"load","value":null}]}`},
+		{name: "Test #6 empty result", method: http.MethodGet, query: "nope*", wantStatus: http.StatusOK,
+			wantBody: `{"type":"vector","samples":[]}`},
+		{name: "Test #7 gauge history without rollups", method: http.MethodGet, query: "max_over_time(load[1h])", wantStatus: http.StatusBadRequest,
+			wantBody: `{"code":"invalid_query","message":"invalid query: max_over_time needs gauge rollups, which are disabled","request_id":"test-request"}`},
+		{name: "Test #8 tenant", method: http.MethodGet, query: "load", tenant: "team-a", wantStatus: http.StatusOK,
+			wantBody: `{"type":"vector","samples":[{"name":"load","value":9}]}`},
+		{name: "Test #9 missing query", method: http.MethodGet, wantStatus: http.StatusBadRequest,
+			wantBody: `{"code":"invalid_request","message":"query parameter is required","request_id":"test-request"}`},
+		{name: "Test #10 syntax error", method: http.MethodGet, query: "sum(load", wantStatus: http.StatusBadRequest,
+			wantBody: `{"code":"invalid_query","message":"invalid query: expected \")\", found end of query at position 9","request_id":"test-request"}`},
+		{name: "Test #11 query too long", method: http.MethodGet, query: strings.Repeat("1+", maxQueryLength) + "1", wantStatus: http.StatusBadRequest,
+			wantBody: `{"code":"invalid_query","message":"query must be at most 4096 bytes","request_id":"test-request"}`},
+		{name: "Test #12 counter window too long", method: http.MethodGet, query: "rate(requests[2h])", wantStatus: http.StatusBadRequest,
+			wantBody: `{"code":"invalid_request","message":"invalid window: 2h0m0s must be positive and at most 1h0m0s","request_id":"test-request"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			if tt.query != "" {
+				form.Set("query", tt.query)
+			}
+			var req *http.Request
+			if tt.method == http.MethodPost {
+				req = httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(http.MethodGet, "/api/query?"+form.Encode(), nil)
+			}
+			req.Header.Set(middleware.RequestIDHeader, "test-request")
+			if tt.tenant != "" {
+				req.Header.Set(middleware.TenantHeader, tt.tenant)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.wantBody, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+)
+
+// Statistics of a rollup selected by the stat parameter of GET /value/.
+const (
+	rollupStatMin   = "min"
+	rollupStatMax   = "max"
+	rollupStatAvg   = "avg"
+	rollupStatSum   = "sum"
+	rollupStatCount = "count"
+	rollupStatLast  = "last"
+)
+
+// RollupsV1 handles GET requests for the retained rollups of a gauge, oldest first, for windows of
+// the length set by the window query parameter, a Go duration such as 5m.
+func (h *Handler) RollupsV1(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "metricName")
+
+	window, err := parseRollupWindow(r.URL.Query().Get("window"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	rollups, err := h.reader.GetRollupsWithRetry(r.Context(), name, window)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	list := models.RollupList{ID: name, Rollups: make([]models.Rollup, 0, len(rollups))}
+	for _, rollup := range rollups {
+		list.Rollups = append(list.Rollups, toModelRollup(rollup))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// latestRollup returns the rollup of the window of a gauge being filled.
+func (h *Handler) latestRollup(ctx context.Context, name, rawWindow string) (models.Rollup, error) {
+	window, err := parseRollupWindow(rawWindow)
+	if err != nil {
+		return models.Rollup{}, err
+	}
+
+	rollups, err := h.reader.GetRollupsWithRetry(ctx, name, window)
+	if err != nil {
+		return models.Rollup{}, err
+	}
+	if len(rollups) == 0 {
+		return models.Rollup{}, newAPIError(http.StatusNotFound, CodeMetricNotFound,
+			fmt.Sprintf("metric %s has no values within %s windows", name, window))
+	}
+	return toModelRollup(rollups[len(rollups)-1]), nil
+}
+
+// parseRollupWindow parses the window length of a rollup query.
+func parseRollupWindow(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "missing rollup window")
+	}
+	window, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, newAPIError(http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid rollup window %q", raw))
+	}
+	return window, nil
+}
+
+// rollupStat returns the statistic of a rollup named by stat, the average when stat is empty.
+// Counts are returned as int64, the other statistics as float64.
+func rollupStat(rollup models.Rollup, stat string) (interface{}, error) {
+	switch stat {
+	case rollupStatMin:
+		return rollup.Min, nil
+	case rollupStatMax:
+		return rollup.Max, nil
+	case rollupStatAvg, "":
+		return rollup.Avg, nil
+	case rollupStatSum:
+		return rollup.Sum, nil
+	case rollupStatCount:
+		return rollup.Count, nil
+	case rollupStatLast:
+		return rollup.Last, nil
+	default:
+		return nil, newAPIError(http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid rollup stat %q", stat))
+	}
+}
+
+func toModelRollup(rollup repositories.Rollup) models.Rollup {
+	return models.Rollup{
+		Start:  rollup.Start,
+		Window: rollup.Window.Seconds(),
+		Min:    rollup.Min,
+		Max:    rollup.Max,
+		Avg:    rollup.Avg(),
+		Sum:    rollup.Sum,
+		Count:  rollup.Count,
+		Last:   rollup.Last,
+	}
+}
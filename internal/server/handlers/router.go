@@ -2,37 +2,139 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/server/auth"
+	"github.com/a2sh3r/sysmetrics/internal/server/dashboard"
 	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/server/query"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 )
 
 // NewRouter creates a new chi.Router with all routes and middleware for the metrics server.
 func NewRouter(handler *Handler, cfg *config.ServerConfig) chi.Router {
 	r := chi.NewRouter()
+	limiter := handler.Limiter
+	if limiter == nil {
+		limiter = middleware.NewRateLimiter(cfg)
+	}
+	engine := query.NewEngine(handler.reader, query.Config{Rollups: rollupTiers(cfg)})
 
+	r.Use(middleware.NewRequestIDMiddleware())
 	r.Use(middleware.NewLoggingMiddleware())
-	r.Use(middleware.NewGzipMiddleware())
+	r.Use(middleware.NewClientCertMiddleware())
+	r.Use(middleware.NewAuthMiddleware(cfg))
+	r.Use(middleware.NewTenantMiddleware())
+	r.Use(middleware.NewInstanceMiddleware())
+	r.Use(limiter.Middleware())
+	r.Use(middleware.NewBodyLimitMiddleware(cfg))
+	r.Use(middleware.NewDecryptMiddleware(cfg))
+	r.Use(middleware.NewCompressMiddleware(cfg))
 	r.Use(middleware.NewHashMiddleware(cfg))
 
 	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed"))
 	})
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Invalid URL format", http.StatusNotFound)
+		writeError(w, r, newAPIError(http.StatusNotFound, CodeNotFound, "invalid URL format"))
 	})
 
 	r.Route("/", func(r chi.Router) {
-		r.Get("/", handler.GetMetrics)
-		r.Post("/update/{metricType}/{metricName}/{metricValue}", handler.UpdateMetric)
-		r.Post("/update/", handler.UpdateSerializedMetric)
-		r.Get("/value/{metricType}/{metricName}", handler.GetMetric)
-		r.Post("/value/", handler.GetSerializedMetric)
-		r.Post("/updates/", handler.UpdateSerializedMetrics)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.NewTrustedSubnetMiddleware(cfg.ReadTrustedSubnet, cfg.TrustedProxies))
+			r.Use(middleware.NewScopeMiddleware(cfg, auth.ScopeRead))
+			r.Get("/", handler.GetMetrics)
+			r.Get("/value/{metricType}/{metricName}", handler.GetMetric)
+			r.Post("/value/", handler.GetSerializedMetric)
+			r.Get("/metadata/", handler.GetMetadata)
+			r.Get("/api/query", handler.Query(engine))
+			r.Post("/api/query", handler.Query(engine))
+		})
+		// The dashboard pages hold no metrics and are served without a token, which browsers cannot
+		// send when opening a page; the pages send the token entered by the user to /api/v1.
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.NewTrustedSubnetMiddleware(cfg.ReadTrustedSubnet, cfg.TrustedProxies))
+			r.Method(http.MethodGet, strings.TrimSuffix(dashboardPath, "/"), http.RedirectHandler(dashboardPath, http.StatusMovedPermanently))
+			r.Method(http.MethodGet, dashboardPath+"*", http.StripPrefix(strings.TrimSuffix(dashboardPath, "/"),
+				dashboard.New(dashboard.Config{RollupWindow: shortestRollupWindow(cfg)})))
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.NewTrustedSubnetMiddleware(cfg.TrustedSubnet, cfg.TrustedProxies))
+			r.Use(middleware.NewScopeMiddleware(cfg, auth.ScopeWrite))
+			r.Post("/update/{metricType}/{metricName}/{metricValue}", handler.UpdateMetric)
+			r.Post("/update/", handler.UpdateSerializedMetric)
+			r.Post("/updates/", handler.UpdateSerializedMetrics)
+			r.Post("/metadata/", handler.UpdateMetadata)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.NewTrustedSubnetMiddleware(cfg.TrustedSubnet, cfg.TrustedProxies))
+			r.Use(middleware.NewScopeMiddleware(cfg, auth.ScopeAdmin))
+			r.Get("/admin/tenants", handler.ListTenants)
+			r.Delete("/admin/tenants/{tenant}", handler.DeleteTenant)
+			r.Get("/admin/usage", handler.Usage(limiter))
+			r.Get("/admin/cardinality", handler.Cardinality)
+			r.Get("/admin/retention", handler.Retention)
+			r.Delete("/admin/metrics", handler.DeleteMetrics)
+			r.Delete("/admin/metrics/{metricName}", handler.DeleteMetric)
+		})
 		r.Get("/ping", handler.Ping)
 	})
 
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Get("/openapi.json", handler.OpenAPI)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.NewTrustedSubnetMiddleware(cfg.ReadTrustedSubnet, cfg.TrustedProxies))
+			r.Use(middleware.NewScopeMiddleware(cfg, auth.ScopeRead))
+			r.Get("/metrics", handler.ListMetricsV1)
+			r.Get("/metrics/{metricName}", handler.GetMetricV1)
+			r.Get("/metrics/{metricName}/rate", handler.CounterRateV1)
+			r.Get("/metrics/{metricName}/rollups", handler.RollupsV1)
+			r.Get("/stream", handler.StreamV1)
+			r.Get("/stream/ws", handler.StreamWebSocketV1)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.NewTrustedSubnetMiddleware(cfg.TrustedSubnet, cfg.TrustedProxies))
+			r.Use(middleware.NewScopeMiddleware(cfg, auth.ScopeWrite))
+			r.Put("/metrics/{metricName}", handler.PutMetricV1)
+			r.Patch("/metrics/{metricName}", handler.PatchMetricV1)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.NewTrustedSubnetMiddleware(cfg.TrustedSubnet, cfg.TrustedProxies))
+			r.Use(middleware.NewScopeMiddleware(cfg, auth.ScopeAdmin))
+			r.Delete("/metrics/{metricName}", handler.DeleteMetricV1)
+		})
+	})
+
 	return r
 }
+
+// shortestRollupWindow returns the shortest gauge rollup window kept by the server, zero when rollups
+// are disabled.
+func shortestRollupWindow(cfg *config.ServerConfig) time.Duration {
+	if tiers := rollupTiers(cfg); len(tiers) > 0 {
+		return tiers[0].Window
+	}
+	return 0
+}
+
+// rollupTiers returns the gauge rollup windows kept by the server, shortest first, with the period each
+// is kept for: that of its retention tier, or the rollup retention times the window. The configuration
+// is validated on startup, so parse errors disable the history read by the dashboard and queries.
+func rollupTiers(cfg *config.ServerConfig) []repositories.RetentionTier {
+	if tiers, err := repositories.ParseRetentionTiers(cfg.RetentionTiers); err == nil && len(tiers) > 0 {
+		return tiers
+	}
+	windows, err := repositories.ParseRollupWindows(cfg.RollupWindows)
+	if err != nil {
+		return nil
+	}
+	tiers := make([]repositories.RetentionTier, 0, len(windows))
+	for _, window := range windows {
+		tiers = append(tiers, repositories.RetentionTier{Window: window, Period: window * time.Duration(cfg.RollupRetention)})
+	}
+	return tiers
+}
@@ -0,0 +1,579 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	"github.com/a2sh3r/sysmetrics/internal/server/auth"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+)
+
+func TestNewRouter_TrustedSubnets(t *testing.T) {
+	cfg := &config.ServerConfig{
+		TrustedSubnet:     "192.168.1.0/24",
+		ReadTrustedSubnet: "",
+	}
+	repo := &mockRepo{metrics: map[string]repositories.Metric{}}
+	service := services.NewService(repo)
+	router := NewRouter(NewHandler(service, service, nil), cfg)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		remoteAddr     string
+		expectedStatus int
+	}{
+		{"write from trusted subnet", http.MethodPost, "/update/gauge/g/1", "192.168.1.5:1000", http.StatusOK},
+		{"write from outside", http.MethodPost, "/update/gauge/g/1", "203.0.113.5:1000", http.StatusForbidden},
+		{"batch write from outside", http.MethodPost, "/updates/", "203.0.113.5:1000", http.StatusForbidden},
+		{"read from outside", http.MethodGet, "/value/gauge/g", "203.0.113.5:1000", http.StatusOK},
+		{"ping from outside", http.MethodGet, "/ping", "203.0.113.5:1000", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			req.RemoteAddr = tt.remoteAddr
+			rw := httptest.NewRecorder()
+
+			router.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+		})
+	}
+}
+
+func TestNewRouter_TokenScopes(t *testing.T) {
+	cfg := &config.ServerConfig{
+		APITokens: "agent:" + auth.HashToken("agent-secret") + ":write;" +
+			"grafana:" + auth.HashToken("grafana-secret") + ":read;" +
+			"ops:" + auth.HashToken("ops-secret") + ":admin",
+	}
+	repo := &mockRepo{metrics: map[string]repositories.Metric{}}
+	service := services.NewService(repo)
+	router := NewRouter(NewHandler(service, service, nil), cfg)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		token          string
+		expectedStatus int
+	}{
+		{"write with write token", http.MethodPost, "/update/gauge/g/1", "agent-secret", http.StatusOK},
+		{"write with read token", http.MethodPost, "/update/gauge/g/1", "grafana-secret", http.StatusForbidden},
+		{"write without token", http.MethodPost, "/update/gauge/g/1", "", http.StatusUnauthorized},
+		{"write with unknown token", http.MethodPost, "/update/gauge/g/1", "nope", http.StatusUnauthorized},
+		{"read with read token", http.MethodGet, "/value/gauge/g", "grafana-secret", http.StatusOK},
+		{"read with write token", http.MethodGet, "/", "agent-secret", http.StatusForbidden},
+		{"read without token", http.MethodGet, "/", "", http.StatusUnauthorized},
+		{"admin can write", http.MethodPost, "/update/gauge/g/2", "ops-secret", http.StatusOK},
+		{"admin can read", http.MethodGet, "/", "ops-secret", http.StatusOK},
+		{"ping is public", http.MethodGet, "/ping", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rw := httptest.NewRecorder()
+
+			router.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.NotEmpty(t, rw.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestNewRouter_Tenants(t *testing.T) {
+	cfg := &config.ServerConfig{
+		APITokens: "team-a:" + auth.HashToken("a-secret") + ":read,write:team-a;" +
+			"shared:" + auth.HashToken("shared-secret") + ":read,write;" +
+			"ops:" + auth.HashToken("ops-secret") + ":admin",
+	}
+	service := services.NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+	handler := NewHandler(service, service, nil)
+	handler.Admin = service
+	router := NewRouter(handler, cfg)
+
+	do := func(method, url, token, tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if tenant != "" {
+			req.Header.Set(middleware.TenantHeader, tenant)
+		}
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, req)
+		return rw
+	}
+
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/update/gauge/HeapAlloc/1", "a-secret", "").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/update/gauge/HeapAlloc/2", "shared-secret", "team-b").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/update/gauge/HeapAlloc/3", "shared-secret", "").Code)
+
+	assert.Equal(t, "1", strings.TrimSpace(do(http.MethodGet, "/value/gauge/HeapAlloc", "a-secret", "").Body.String()))
+	assert.Equal(t, "2", strings.TrimSpace(do(http.MethodGet, "/value/gauge/HeapAlloc", "shared-secret", "team-b").Body.String()))
+	assert.Equal(t, "3", strings.TrimSpace(do(http.MethodGet, "/value/gauge/HeapAlloc", "shared-secret", "").Body.String()))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/value/gauge/HeapAlloc", "a-secret", "team-b").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/value/gauge/HeapAlloc", "shared-secret", "bad/tenant").Code)
+
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/admin/tenants", "shared-secret", "").Code)
+	rw := do(http.MethodGet, "/admin/tenants", "ops-secret", "")
+	require.Equal(t, http.StatusOK, rw.Code)
+	assert.JSONEq(t, `["", "team-a", "team-b"]`, rw.Body.String())
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/admin/tenants/team-b", "ops-secret", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/value/gauge/HeapAlloc", "shared-secret", "team-b").Code)
+	assert.Equal(t, "1", strings.TrimSpace(do(http.MethodGet, "/value/gauge/HeapAlloc", "a-secret", "").Body.String()))
+}
+
+func TestNewRouter_RateLimitAndQuota(t *testing.T) {
+	cfg := &config.ServerConfig{RateLimit: 1, RateBurst: 3}
+	service := services.NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()), services.WithSeriesQuota(1))
+	handler := NewHandler(service, service, nil)
+	handler.Admin = service
+	router := NewRouter(handler, cfg)
+
+	do := func(method, url, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.RemoteAddr = remoteAddr
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, req)
+		return rw
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/update/gauge/g1/1", "192.0.2.1:1000").Code)
+
+	rw := do(http.MethodPost, "/update/gauge/g2/1", "192.0.2.1:1000")
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code, "second series exceeds the quota")
+	assert.Equal(t, quotaRetryAfter, rw.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/update/gauge/g1/2", "192.0.2.1:1000").Code)
+
+	rw = do(http.MethodPost, "/update/gauge/g1/3", "192.0.2.1:1000")
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code, "burst is used up")
+	assert.NotEmpty(t, rw.Header().Get("Retry-After"))
+
+	rw = do(http.MethodGet, "/admin/usage", "192.0.2.2:1000")
+	require.Equal(t, http.StatusOK, rw.Code)
+	assert.JSONEq(t, `{
+		"clients": [
+			{"client": "ip:192.0.2.1", "tokens": 0, "allowed": 3, "rejected": 1},
+			{"client": "ip:192.0.2.2", "tokens": 2, "allowed": 1, "rejected": 0}
+		],
+		"tenants": [{"tenant": "", "series": 1, "quota": 1}]
+	}`, roundTokens(rw.Body.String()))
+}
+
+func TestNewRouter_MiddlewareErrors(t *testing.T) {
+	tokens := "agent:" + auth.HashToken("agent-secret") + ":write;grafana:" + auth.HashToken("grafana-secret") + ":read"
+	service := services.NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+
+	tests := []struct {
+		name       string
+		cfg        *config.ServerConfig
+		url        string
+		token      string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"Test #1 missing token", &config.ServerConfig{APITokens: tokens}, "/update/", "", "{}", http.StatusUnauthorized, middleware.CodeUnauthorized},
+		{"Test #2 read token", &config.ServerConfig{APITokens: tokens}, "/updates/", "grafana-secret", "[]", http.StatusForbidden, middleware.CodeForbidden},
+		{"Test #3 body too large", &config.ServerConfig{MaxBodySize: 16}, "/updates/", "", strings.Repeat("x", 17), http.StatusRequestEntityTooLarge, middleware.CodePayloadTooLarge},
+		{"Test #4 missing hash", &config.ServerConfig{SecretKey: "key"}, "/update/", "", "{}", http.StatusBadRequest, middleware.CodeInvalidSignature},
+		{"Test #5 rate limited", &config.ServerConfig{RateLimit: 1, RateBurst: 1}, "/updates/", "", "[]", http.StatusTooManyRequests, middleware.CodeRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter(NewHandler(service, service, nil), tt.cfg)
+			do := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+				req.Header.Set(middleware.RequestIDHeader, "req-1")
+				if tt.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				rw := httptest.NewRecorder()
+				router.ServeHTTP(rw, req)
+				return rw
+			}
+
+			rw := do()
+			if tt.wantStatus == http.StatusTooManyRequests {
+				rw = do()
+			}
+
+			require.Equal(t, tt.wantStatus, rw.Code)
+			assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+			var resp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, "req-1", resp.RequestID)
+		})
+	}
+}
+
+// roundTokens truncates the refilled token counts in a usage response so it can be compared exactly.
+func roundTokens(body string) string {
+	var usage usageResponse
+	if err := json.Unmarshal([]byte(body), &usage); err != nil {
+		return body
+	}
+	for i := range usage.Clients {
+		usage.Clients[i].Tokens = math.Floor(usage.Clients[i].Tokens)
+	}
+	out, err := json.Marshal(usage)
+	if err != nil {
+		return body
+	}
+	return string(out)
+}
+
+func TestNewRouter_Cardinality(t *testing.T) {
+	service := services.NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()),
+		services.WithCardinalityLimit(1, services.CardinalityModeReject))
+	handler := NewHandler(service, service, nil)
+	handler.Admin = service
+	router := NewRouter(handler, &config.ServerConfig{})
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, req)
+		return rw
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/updates/", `[{"id":"req_1","type":"gauge","value":1}]`).Code)
+	rw := do(http.MethodPost, "/updates/", `[{"id":"req_2","type":"gauge","value":1}]`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), "cardinality limit exceeded")
+
+	rw = do(http.MethodGet, "/admin/cardinality", "")
+	require.Equal(t, http.StatusOK, rw.Code)
+	assert.JSONEq(t, `{
+		"limit": 1,
+		"mode": "reject",
+		"series": 1,
+		"rejected": 1,
+		"top_prefixes": [{"prefix": "req", "series": 1, "rejected": 1}]
+	}`, rw.Body.String())
+}
+
+func TestNewRouter_Retention(t *testing.T) {
+	storage := memstorage.NewMemStorage()
+	storage.EnableRollups(repositories.RollupConfig{Windows: []time.Duration{time.Minute}, Compacted: []time.Duration{time.Hour}})
+	service := services.NewService(repositories.NewMetricRepo(storage),
+		services.WithRetentionTiers([]repositories.RetentionTier{
+			{Window: time.Minute, Period: 24 * time.Hour},
+			{Window: time.Hour, Period: 30 * 24 * time.Hour},
+		}))
+	handler := NewHandler(service, service, nil)
+	handler.Admin = service
+	router := NewRouter(handler, &config.ServerConfig{})
+
+	require.NoError(t, service.UpdateGaugeMetric(context.Background(), "load", 1))
+	_, err := service.Compact(context.Background())
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/retention", nil)
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, req)
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	var status services.RetentionStatus
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &status))
+	assert.Equal(t, []services.TierStatus{
+		{Window: 60, Period: 86400, Windows: 1},
+		{Window: 3600, Period: 2592000, Windows: 0},
+	}, status.Tiers)
+	require.NotNil(t, status.LastCompaction)
+	assert.Zero(t, status.LastCompaction.Compacted)
+	assert.Empty(t, status.LastCompaction.Error)
+}
+
+// failingAdmin is an AdminServiceInterface failing every operation.
+type failingAdmin struct{}
+
+func (failingAdmin) ListTenantsWithRetry(context.Context) ([]string, error) {
+	return nil, assert.AnError
+}
+
+func (failingAdmin) DeleteTenantWithRetry(context.Context, string) error {
+	return assert.AnError
+}
+
+func (failingAdmin) UsageWithRetry(context.Context) ([]services.TenantUsage, error) {
+	return nil, assert.AnError
+}
+
+func (failingAdmin) CardinalityWithRetry(context.Context) (services.CardinalityReport, error) {
+	return services.CardinalityReport{}, assert.AnError
+}
+
+func (failingAdmin) RetentionStatusWithRetry(context.Context) (services.RetentionStatus, error) {
+	return services.RetentionStatus{}, assert.AnError
+}
+
+func (failingAdmin) DeleteMetricsWithRetry(context.Context, repositories.Selector, bool) ([]string, error) {
+	return nil, assert.AnError
+}
+
+func TestHandler_AdminErrors(t *testing.T) {
+	disabled := NewHandler(nil, nil, nil)
+	failing := NewHandler(nil, nil, nil)
+	failing.Admin = failingAdmin{}
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		tenant     string
+		param      string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "Test #1 retention not implemented", handler: disabled.Retention, wantStatus: http.StatusNotImplemented, wantCode: CodeNotImplemented},
+		{name: "Test #2 retention of a tenant token", handler: failing.Retention, tenant: "team-a", wantStatus: http.StatusForbidden, wantCode: CodeForbidden},
+		{name: "Test #3 retention failure", handler: failing.Retention, wantStatus: http.StatusInternalServerError, wantCode: CodeInternal},
+		{name: "Test #4 tenants not implemented", handler: disabled.ListTenants, wantStatus: http.StatusNotImplemented, wantCode: CodeNotImplemented},
+		{name: "Test #5 tenants failure", handler: failing.ListTenants, wantStatus: http.StatusInternalServerError, wantCode: CodeInternal},
+		{name: "Test #6 tenant deletion not implemented", handler: disabled.DeleteTenant, param: "team-b", wantStatus: http.StatusNotImplemented, wantCode: CodeNotImplemented},
+		{name: "Test #7 invalid tenant", handler: failing.DeleteTenant, param: "bad/tenant", wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "Test #8 deletion of another tenant", handler: failing.DeleteTenant, tenant: "team-a", param: "team-b", wantStatus: http.StatusForbidden, wantCode: CodeForbidden},
+		{name: "Test #9 tenant deletion failure", handler: failing.DeleteTenant, param: "team-b", wantStatus: http.StatusInternalServerError, wantCode: CodeInternal},
+		{name: "Test #10 usage not implemented", handler: disabled.Usage(nil), wantStatus: http.StatusNotImplemented, wantCode: CodeNotImplemented},
+		{name: "Test #11 usage failure", handler: failing.Usage(nil), wantStatus: http.StatusInternalServerError, wantCode: CodeInternal},
+		{name: "Test #12 cardinality not implemented", handler: disabled.Cardinality, wantStatus: http.StatusNotImplemented, wantCode: CodeNotImplemented},
+		{name: "Test #13 cardinality of a tenant token", handler: failing.Cardinality, tenant: "team-a", wantStatus: http.StatusForbidden, wantCode: CodeForbidden},
+		{name: "Test #14 cardinality failure", handler: failing.Cardinality, wantStatus: http.StatusInternalServerError, wantCode: CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/", nil)
+			req.Header.Set(middleware.RequestIDHeader, "req-1")
+			if tt.tenant != "" {
+				req = req.WithContext(identity.WithTenant(req.Context(), tt.tenant))
+			}
+			if tt.param != "" {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("tenant", tt.param)
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			}
+			rw := httptest.NewRecorder()
+			middleware.NewRequestIDMiddleware()(tt.handler).ServeHTTP(rw, req)
+
+			require.Equal(t, tt.wantStatus, rw.Code)
+			var resp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, "req-1", resp.RequestID)
+		})
+	}
+}
+
+func TestNewRouter_Dashboard(t *testing.T) {
+	service := services.NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+	require.NoError(t, service.UpdateGaugeMetric(context.Background(), "load", 0.5))
+	router := NewRouter(NewHandler(service, service, nil), &config.ServerConfig{RollupWindows: "5m,1m"})
+
+	tests := []struct {
+		name         string
+		url          string
+		accept       string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{name: "Test #1 browser", url: "/", accept: "text/html,application/xhtml+xml,*/*;q=0.8", wantStatus: http.StatusOK, wantBody: "load 0.5\n"},
+		{name: "Test #2 text client", url: "/", wantStatus: http.StatusOK, wantBody: "load 0.5\n"},
+		{name: "Test #3 without slash", url: "/dashboard", wantStatus: http.StatusMovedPermanently, wantLocation: "/dashboard/"},
+		{name: "Test #4 index", url: "/dashboard/", wantStatus: http.StatusOK, wantBody: "<title>Metrics</title>"},
+		{name: "Test #5 config", url: "/dashboard/config.json", wantStatus: http.StatusOK, wantBody: `{"rollup_window":"1m","refresh":5}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rw := httptest.NewRecorder()
+			router.ServeHTTP(rw, req)
+
+			require.Equal(t, tt.wantStatus, rw.Code)
+			assert.Equal(t, tt.wantLocation, rw.Header().Get("Location"))
+			assert.Contains(t, rw.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestNewRouter_DashboardWithTokens(t *testing.T) {
+	service := services.NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+	require.NoError(t, service.UpdateGaugeMetric(context.Background(), "load", 0.5))
+	router := NewRouter(NewHandler(service, service, nil), &config.ServerConfig{
+		APITokens: "reader:" + auth.HashToken("reader-secret") + ":read",
+	})
+
+	tests := []struct {
+		name       string
+		url        string
+		token      string
+		wantStatus int
+	}{
+		{name: "Test #1 page without token", url: "/dashboard/", wantStatus: http.StatusOK},
+		{name: "Test #2 script without token", url: "/dashboard/dashboard.js", wantStatus: http.StatusOK},
+		{name: "Test #3 API without token", url: "/api/v1/metrics", wantStatus: http.StatusUnauthorized},
+		{name: "Test #4 API with the token entered in the page", url: "/api/v1/metrics", token: "reader-secret", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rw := httptest.NewRecorder()
+			router.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.wantStatus, rw.Code)
+		})
+	}
+}
+
+func TestNewRouter_DeleteMetrics(t *testing.T) {
+	cfg := &config.ServerConfig{
+		APITokens: "agent:" + auth.HashToken("agent-secret") + ":write;" +
+			"ops:" + auth.HashToken("ops-secret") + ":admin",
+	}
+	service := services.NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+	handler := NewHandler(service, service, nil)
+	handler.Admin = service
+	router := NewRouter(handler, cfg)
+
+	do := func(method, url, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(middleware.RequestIDHeader, "test-request")
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, req)
+		return rw
+	}
+
+	for _, url := range []string{"/update/gauge/http_latency/1", "/update/counter/http_requests/1", "/update/gauge/HeapAlloc/1"} {
+		require.Equal(t, http.StatusOK, do(http.MethodPost, url, "agent-secret").Code)
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Test #1 write token is refused",
+			url:        "/admin/metrics?prefix=http_",
+			token:      "agent-secret",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Test #2 empty selector",
+			url:        "/admin/metrics",
+			token:      "ops-secret",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"code":"invalid_request","message":"a prefix or type is required","request_id":"test-request"}`,
+		},
+		{
+			name:       "Test #3 invalid dry run",
+			url:        "/admin/metrics?prefix=http_&dry_run=maybe",
+			token:      "ops-secret",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"code":"invalid_request","message":"dry_run must be a boolean","request_id":"test-request"}`,
+		},
+		{
+			name:       "Test #4 dry run by prefix",
+			url:        "/admin/metrics?prefix=http_&dry_run=true",
+			token:      "ops-secret",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"dry_run":true,"deleted":["http_latency","http_requests"]}`,
+		},
+		{
+			name:       "Test #5 delete by prefix and type",
+			url:        "/admin/metrics?prefix=http_&type=gauge",
+			token:      "ops-secret",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"dry_run":false,"deleted":["http_latency"]}`,
+		},
+		{
+			name:       "Test #6 dry run of single metric",
+			url:        "/admin/metrics/HeapAlloc?dry_run=1",
+			token:      "ops-secret",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"dry_run":true,"deleted":["HeapAlloc"]}`,
+		},
+		{
+			name:       "Test #7 delete single metric",
+			url:        "/admin/metrics/HeapAlloc",
+			token:      "ops-secret",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"dry_run":false,"deleted":["HeapAlloc"]}`,
+		},
+		{
+			name:       "Test #8 delete missing metric",
+			url:        "/admin/metrics/HeapAlloc",
+			token:      "ops-secret",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Test #9 versioned delete with write token is refused",
+			url:        "/api/v1/metrics/http_requests",
+			token:      "agent-secret",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Test #10 versioned delete with admin token",
+			url:        "/api/v1/metrics/HeapAlloc",
+			token:      "ops-secret",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := do(http.MethodDelete, tt.url, tt.token)
+
+			assert.Equal(t, tt.wantStatus, rw.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rw.Body.String())
+			}
+		})
+	}
+
+	metrics, err := service.GetMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]repositories.Metric{
+		"http_requests": {Type: "counter", Value: int64(1)},
+	}, metrics)
+
+	handler.Admin = nil
+	router = NewRouter(handler, cfg)
+	rw := do(http.MethodDelete, "/admin/metrics?prefix=http_", "ops-secret")
+	assert.Equal(t, http.StatusNotImplemented, rw.Code)
+	assert.JSONEq(t, `{"code":"not_implemented","message":"bulk deletion is not supported","request_id":"test-request"}`, rw.Body.String())
+}
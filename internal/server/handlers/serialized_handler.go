@@ -1,23 +1,31 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"sort"
 
 	"go.uber.org/zap"
 
 	"github.com/a2sh3r/sysmetrics/internal/constants"
 	"github.com/a2sh3r/sysmetrics/internal/logger"
 	"github.com/a2sh3r/sysmetrics/internal/models"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+	"github.com/a2sh3r/sysmetrics/internal/wire"
 )
 
 // UpdateSerializedMetric handles POST requests to update a metric using a JSON body.
 func (h *Handler) UpdateSerializedMetric(w http.ResponseWriter, r *http.Request) {
 	var m models.Metrics
 	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
-		logger.Log.Warn("Failed to decode JSON", zap.Error(err))
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, invalidJSON(err))
 		return
 	}
 	logger.Log.Info("Received metric update request", zap.Any("metric", m))
@@ -25,36 +33,41 @@ func (h *Handler) UpdateSerializedMetric(w http.ResponseWriter, r *http.Request)
 	switch m.MType {
 	case constants.MetricTypeGauge:
 		if m.Value == nil {
-			logger.Log.Warn("Missing value for gauge", zap.String("metric_id", m.ID))
-			http.Error(w, "Missing gauge value", http.StatusBadRequest)
+			writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidMetricValue, "missing gauge value"))
 			return
 		}
 		if err := h.writer.UpdateGaugeMetricWithRetry(r.Context(), m.ID, *m.Value); err != nil {
-			logger.Log.Error("Failed to update gauge", zap.String("metric_id", m.ID), zap.Error(err))
-			http.Error(w, "Failed to update gauge", http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 	case constants.MetricTypeCounter:
 		if m.Delta == nil {
-			logger.Log.Warn("Missing delta for counter", zap.String("metric_id", m.ID))
-			http.Error(w, "Missing counter delta", http.StatusBadRequest)
+			writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidMetricValue, "missing counter delta"))
 			return
 		}
-		if err := h.writer.UpdateCounterMetricWithRetry(r.Context(), m.ID, *m.Delta); err != nil {
-			logger.Log.Error("Failed to update counter", zap.String("metric_id", m.ID), zap.Error(err))
-			http.Error(w, "Failed to update counter", http.StatusInternalServerError)
+		var err error
+		switch m.Mode {
+		case "", models.CounterModeDelta:
+			err = h.writer.UpdateCounterMetricWithRetry(r.Context(), m.ID, *m.Delta)
+		case models.CounterModeCumulative:
+			err = h.writer.UpdateMetricsBatchWithRetry(r.Context(), map[string]repositories.Metric{
+				m.ID: {Type: constants.MetricTypeCounter, Value: *m.Delta, Cumulative: true},
+			})
+		default:
+			err = newAPIError(http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("unknown counter mode %q", m.Mode))
+		}
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
 	default:
-		logger.Log.Warn("Unsupported metric type", zap.String("type", m.MType))
-		http.Error(w, "Unknown metric type", http.StatusNotImplemented)
+		writeError(w, r, newAPIError(http.StatusNotImplemented, CodeUnsupportedMetricType, fmt.Sprintf("unsupported metric type %q", m.MType)))
 		return
 	}
 
 	updated, err := h.reader.GetMetricWithRetry(r.Context(), m.ID)
 	if err != nil {
-		logger.Log.Error("Metric not found after update", zap.String("metric_id", m.ID), zap.Error(err))
-		http.Error(w, "Metric not found after update", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
@@ -66,29 +79,35 @@ func (h *Handler) UpdateSerializedMetric(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// GetSerializedMetric handles POST requests to get a metric value using a JSON body.
+// GetSerializedMetric handles POST requests to get a metric value using a JSON body. With the rollup
+// parameter set to a window length such as 5m, the response of a gauge carries its current window.
 func (h *Handler) GetSerializedMetric(w http.ResponseWriter, r *http.Request) {
 	var m models.Metrics
 	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
-		logger.Log.Warn("Failed to decode JSON for value request", zap.Error(err))
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, invalidJSON(err))
 		return
 	}
 
 	if m.ID == "" || m.MType == "" {
-		logger.Log.Warn("Missing fields in value request", zap.Any("metric", m))
-		http.Error(w, "Missing metric ID or type", http.StatusBadRequest)
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "missing metric id or type"))
 		return
 	}
 
 	stored, err := h.reader.GetMetricWithRetry(r.Context(), m.ID)
 	if err != nil {
-		logger.Log.Warn("Metric not found", zap.String("metric_id", m.ID), zap.Error(err))
-		http.Error(w, "Metric not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
 	response := convertMetricToModel(m.ID, stored)
+	if window := r.URL.Query().Get("rollup"); window != "" {
+		rollup, err := h.latestRollup(r.Context(), m.ID, window)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		response.Rollup = &rollup
+	}
 
 	logger.Log.Info("Sending metric value", zap.Any("response", response))
 
@@ -98,62 +117,249 @@ func (h *Handler) GetSerializedMetric(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// UpdateSerializedMetrics handles POST requests to update multiple metrics using a JSON array.
+// invalidJSON wraps a request body decoding error. Errors caused by the body size limits are kept
+// so that they are responded with 413.
+func invalidJSON(err error) error {
+	if middleware.IsBodyTooLarge(err) {
+		return err
+	}
+	return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidJSON, Message: "invalid JSON: " + err.Error(), Err: err}
+}
+
+// maxRejectedReported caps the rejected items listed in a batch update response.
+const maxRejectedReported = 100
+
+// UpdateSerializedMetrics handles POST requests to update multiple metrics using a JSON array,
+// or a binary batch when the request Content-Type is wire.ContentType.
+// JSON arrays are decoded element by element, so memory use does not depend on the body size.
+//
+// The response is a models.BatchResult listing the rejected items with their reasons. By default
+// a batch with any invalid item is rejected as a whole; with the models.BatchModeHeader set to
+// models.BatchModeBestEffort the valid items are stored and the response status is 200.
 func (h *Handler) UpdateSerializedMetrics(w http.ResponseWriter, r *http.Request) {
-	var metrics []models.Metrics
-	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
-		logger.Log.Warn("Failed to decode JSON for batch update", zap.Error(err))
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	batch := newBatchCollector(r.Header.Get(models.BatchModeHeader))
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == wire.ContentType {
+		metrics, err := wire.Decode(r.Body)
+		if err != nil {
+			if !middleware.IsBodyTooLarge(err) {
+				err = &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBatch, Message: "invalid binary batch: " + err.Error(), Err: err}
+			}
+			writeError(w, r, err)
+			return
+		}
+		for _, m := range metrics {
+			batch.add(m)
+		}
+	} else if err := decodeJSONBatch(r.Body, batch); err != nil {
+		writeError(w, r, invalidJSON(err))
 		return
 	}
 
-	if len(metrics) == 0 {
-		w.WriteHeader(http.StatusOK)
+	if batch.result.RejectedTotal > 0 && !batch.bestEffort() {
+		writeError(w, r, batch.rejected())
 		return
 	}
 
-	repoMetrics := make(map[string]repositories.Metric)
-	for _, m := range metrics {
-		switch m.MType {
-		case constants.MetricTypeGauge:
-			if m.Value == nil {
-				logger.Log.Warn("Missing value for gauge", zap.String("metric_id", m.ID))
-				http.Error(w, "Missing gauge value", http.StatusBadRequest)
-				return
-			}
-			repoMetrics[m.ID] = repositories.Metric{
-				Type:  constants.MetricTypeGauge,
-				Value: *m.Value,
-			}
-		case constants.MetricTypeCounter:
-			if m.Delta == nil {
-				logger.Log.Warn("Missing delta for counter", zap.String("metric_id", m.ID))
-				http.Error(w, "Missing counter delta", http.StatusBadRequest)
-				return
-			}
-			if existing, ok := repoMetrics[m.ID]; ok && existing.Type == constants.MetricTypeCounter {
-				repoMetrics[m.ID] = repositories.Metric{
-					Type:  constants.MetricTypeCounter,
-					Value: existing.Value.(int64) + *m.Delta,
-				}
-			} else {
-				repoMetrics[m.ID] = repositories.Metric{
-					Type:  constants.MetricTypeCounter,
-					Value: *m.Delta,
-				}
-			}
-		default:
-			logger.Log.Warn("Unsupported metric type", zap.String("type", m.MType))
-			http.Error(w, "Unknown metric type", http.StatusNotImplemented)
+	if err := h.storeBatch(r.Context(), batch); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if batch.result.RejectedTotal > 0 && !batch.bestEffort() {
+		writeError(w, r, batch.rejected())
+		return
+	}
+
+	batch.result.Accepted = batch.items - batch.result.RejectedTotal
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(batch.result); err != nil {
+		logger.Log.Error("Failed to write batch result", zap.Error(err))
+	}
+}
+
+// storeBatch writes the valid items of a batch. When the write fails, it checks the batch for
+// series stored with a different type, rejects them and, in best-effort mode, writes the rest again.
+func (h *Handler) storeBatch(ctx context.Context, batch *batchCollector) error {
+	if len(batch.metrics) == 0 {
+		return nil
+	}
+
+	err := h.writer.UpdateMetricsBatchWithRetry(ctx, batch.metrics)
+	if err == nil || errors.Is(err, services.ErrSeriesQuotaExceeded) || errors.Is(err, services.ErrCardinalityLimitExceeded) {
+		return err
+	}
+
+	stored, getErr := h.reader.GetMetricsWithRetry(ctx)
+	if getErr != nil {
+		return err
+	}
+	if !batch.rejectConflicts(stored) {
+		return err
+	}
+	if !batch.bestEffort() || len(batch.metrics) == 0 {
+		return nil
+	}
+	return h.writer.UpdateMetricsBatchWithRetry(ctx, batch.metrics)
+}
+
+// decodeJSONBatch stream-decodes a JSON array of metrics into batch.
+func decodeJSONBatch(body io.Reader, batch *batchCollector) error {
+	dec := json.NewDecoder(body)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected JSON array, got %v", tok)
+	}
+
+	for dec.More() {
+		var m models.Metrics
+		if err := dec.Decode(&m); err != nil {
+			return err
+		}
+		batch.add(m)
+	}
+
+	_, err = dec.Token()
+	return err
+}
+
+// batchSeries tracks the items of a batch that update the same series.
+type batchSeries struct {
+	first int
+	count int
+}
+
+// batchCollector validates the items of a batch update and accumulates the valid ones,
+// summing the deltas of repeated counters. Repeated cumulative counters keep the last total.
+type batchCollector struct {
+	metrics map[string]repositories.Metric
+	series  map[string]batchSeries
+	result  models.BatchResult
+	items   int
+	status  int
+}
+
+func newBatchCollector(mode string) *batchCollector {
+	if mode != models.BatchModeBestEffort {
+		mode = models.BatchModeStrict
+	}
+	return &batchCollector{
+		metrics: make(map[string]repositories.Metric),
+		series:  make(map[string]batchSeries),
+		result:  models.BatchResult{Mode: mode, Rejected: []models.RejectedMetric{}},
+	}
+}
+
+func (c *batchCollector) bestEffort() bool {
+	return c.result.Mode == models.BatchModeBestEffort
+}
+
+// add validates the next item of the batch and either accumulates or rejects it.
+func (c *batchCollector) add(m models.Metrics) {
+	index := c.items
+	c.items++
+
+	var value interface{}
+	switch m.MType {
+	case constants.MetricTypeGauge:
+		if m.Value == nil {
+			c.reject(index, m, "missing gauge value", http.StatusBadRequest)
+			return
+		}
+		value = *m.Value
+	case constants.MetricTypeCounter:
+		if m.Delta == nil {
+			c.reject(index, m, "missing counter delta", http.StatusBadRequest)
+			return
+		}
+		if *m.Delta < 0 {
+			c.reject(index, m, "negative counter delta", http.StatusBadRequest)
+			return
+		}
+		if m.Mode != "" && m.Mode != models.CounterModeDelta && m.Mode != models.CounterModeCumulative {
+			c.reject(index, m, "unknown counter mode", http.StatusBadRequest)
 			return
 		}
+		value = *m.Delta
+	default:
+		c.reject(index, m, "unknown metric type", http.StatusNotImplemented)
+		return
+	}
+	if m.ID == "" {
+		c.reject(index, m, "missing metric id", http.StatusBadRequest)
+		return
 	}
 
-	if err := h.writer.UpdateMetricsBatchWithRetry(r.Context(), repoMetrics); err != nil {
-		logger.Log.Error("Failed to update metrics batch", zap.Error(err))
-		http.Error(w, "Failed to update metrics", http.StatusInternalServerError)
+	cumulative := m.MType == constants.MetricTypeCounter && m.Mode == models.CounterModeCumulative
+	existing, ok := c.metrics[m.ID]
+	switch {
+	case !ok:
+		c.metrics[m.ID] = repositories.Metric{Type: m.MType, Value: value, Cumulative: cumulative}
+		c.series[m.ID] = batchSeries{first: index, count: 1}
+		return
+	case existing.Type != m.MType:
+		c.reject(index, m, "conflicting metric type within batch", http.StatusConflict)
+		return
+	case existing.Cumulative != cumulative:
+		c.reject(index, m, "conflicting counter mode within batch", http.StatusConflict)
 		return
+	case m.MType == constants.MetricTypeCounter && !cumulative:
+		existing.Value = existing.Value.(int64) + value.(int64)
+	default:
+		existing.Value = value
+	}
+	c.metrics[m.ID] = existing
+	s := c.series[m.ID]
+	s.count++
+	c.series[m.ID] = s
+}
+
+// reject records a rejected item. The status of the first rejection is used in strict mode.
+func (c *batchCollector) reject(index int, m models.Metrics, reason string, status int) {
+	logger.Log.Warn("Rejected batch item",
+		zap.Int("index", index), zap.String("metric_id", m.ID), zap.String("type", m.MType), zap.String("reason", reason))
+	c.result.RejectedTotal++
+	if len(c.result.Rejected) < maxRejectedReported {
+		c.result.Rejected = append(c.result.Rejected, models.RejectedMetric{Index: index, ID: m.ID, MType: m.MType, Reason: reason})
+	}
+	if c.status == 0 {
+		c.status = status
 	}
+}
 
-	w.WriteHeader(http.StatusOK)
+// rejectConflicts rejects the series of the batch stored with a different type, reporting the first
+// item of each. It reports whether any series was rejected.
+func (c *batchCollector) rejectConflicts(stored map[string]repositories.Metric) bool {
+	names := make([]string, 0)
+	for name, metric := range c.metrics {
+		if s, ok := stored[name]; ok && s.Type != metric.Type {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return c.series[names[i]].first < c.series[names[j]].first })
+
+	for _, name := range names {
+		s := c.series[name]
+		c.reject(s.first, models.Metrics{ID: name, MType: c.metrics[name].Type}, "metric stored with type "+stored[name].Type, http.StatusConflict)
+		c.result.RejectedTotal += s.count - 1
+		delete(c.metrics, name)
+		delete(c.series, name)
+	}
+	return len(names) > 0
+}
+
+// rejected returns the error responded with when a batch is rejected in strict mode.
+func (c *batchCollector) rejected() error {
+	return &APIError{
+		Status:  c.status,
+		Code:    CodeBatchRejected,
+		Message: fmt.Sprintf("batch rejected: %d of %d items are invalid", c.result.RejectedTotal, c.items),
+		Details: c.result,
+	}
 }
@@ -9,18 +9,24 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/a2sh3r/sysmetrics/internal/config"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/a2sh3r/sysmetrics/internal/compression"
 	"github.com/a2sh3r/sysmetrics/internal/constants"
 	"github.com/a2sh3r/sysmetrics/internal/models"
 	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 	"github.com/a2sh3r/sysmetrics/internal/server/services"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+	"github.com/a2sh3r/sysmetrics/internal/wire"
 )
 
 func TestHandler_UpdateSerializedMetric(t *testing.T) {
@@ -69,7 +75,7 @@ func TestHandler_UpdateSerializedMetric(t *testing.T) {
 				},
 			},
 			wantStatusCode: http.StatusBadRequest,
-			wantContent:    "Missing gauge value",
+			wantContent:    `{"code":"invalid_metric_value","message":"missing gauge value","request_id":"test-request"}`,
 		},
 		{
 			name:              "Test #3 unsupported metric type",
@@ -84,14 +90,15 @@ func TestHandler_UpdateSerializedMetric(t *testing.T) {
 				},
 			},
 			wantStatusCode: http.StatusNotImplemented,
-			wantContent:    "Unknown metric type",
+			wantContent:    `{"code":"unsupported_metric_type","message":"unsupported metric type \"unknown\"","request_id":"test-request"}`,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := &Handler{reader: tt.mockReaderService, writer: tt.mockWriterService}
 			cfg := &config.ServerConfig{
-				SecretKey: "test key",
+				SecretKey:     "test key",
+				AllowUnsigned: true,
 			}
 			ts := httptest.NewServer(middleware.NewGzipMiddleware()(NewRouter(h, cfg)))
 			defer ts.Close()
@@ -102,6 +109,7 @@ func TestHandler_UpdateSerializedMetric(t *testing.T) {
 				req, err := http.NewRequest(tt.args.method, ts.URL+tt.args.url, bytes.NewBuffer(bodyBytes))
 				require.NoError(t, err)
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set(middleware.RequestIDHeader, "test-request")
 				req.Header.Set("Accept-Encoding", "")
 
 				res, err := ts.Client().Do(req)
@@ -123,6 +131,7 @@ func TestHandler_UpdateSerializedMetric(t *testing.T) {
 				req, err := http.NewRequest(tt.args.method, ts.URL+tt.args.url, bytes.NewBuffer(bodyBytes))
 				require.NoError(t, err)
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set(middleware.RequestIDHeader, "test-request")
 				req.Header.Set("Accept-Encoding", "gzip")
 
 				res, err := ts.Client().Do(req)
@@ -138,7 +147,7 @@ func TestHandler_UpdateSerializedMetric(t *testing.T) {
 					t.Errorf("Expected 'gzip' in Content-Encoding header, but got '%s'", contentEncoding)
 				}
 
-				respBody, err := io.ReadAll(res.Body)
+				respBody, err := readBody(res)
 				require.NoError(t, err)
 
 				expectedBody := tt.wantContent + "\n"
@@ -210,7 +219,7 @@ func TestHandler_GetSerializedMetric(t *testing.T) {
 				},
 			},
 			wantStatusCode: http.StatusNotFound,
-			wantContent:    "Metric not found",
+			wantContent:    `{"code":"metric_not_found","message":"metric not found: missing_metric","request_id":"test-request"}`,
 		},
 		{
 			name: "Test #3 invalid JSON input",
@@ -226,14 +235,15 @@ func TestHandler_GetSerializedMetric(t *testing.T) {
 				body:   models.Metrics{},
 			},
 			wantStatusCode: http.StatusBadRequest,
-			wantContent:    "Invalid JSON",
+			wantContent:    `{"code":"invalid_json","message":"invalid JSON: invalid character 'i' looking for beginning of object key string","request_id":"test-request"}`,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := &Handler{reader: tt.mockReaderService, writer: tt.mockWriterService}
 			cfg := &config.ServerConfig{
-				SecretKey: "test key",
+				SecretKey:     "test key",
+				AllowUnsigned: true,
 			}
 			ts := httptest.NewServer(middleware.NewGzipMiddleware()(NewRouter(h, cfg)))
 			defer ts.Close()
@@ -251,6 +261,7 @@ func TestHandler_GetSerializedMetric(t *testing.T) {
 				}
 				require.NoError(t, err)
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set(middleware.RequestIDHeader, "test-request")
 				req.Header.Set("Accept-Encoding", "")
 
 				res, err := ts.Client().Do(req)
@@ -279,6 +290,7 @@ func TestHandler_GetSerializedMetric(t *testing.T) {
 				}
 				require.NoError(t, err)
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set(middleware.RequestIDHeader, "test-request")
 				req.Header.Set("Accept-Encoding", "gzip")
 
 				res, err := ts.Client().Do(req)
@@ -294,7 +306,7 @@ func TestHandler_GetSerializedMetric(t *testing.T) {
 					t.Errorf("Expected 'gzip' in Content-Encoding header, but got '%s'", contentEncoding)
 				}
 
-				respBody, err := io.ReadAll(res.Body)
+				respBody, err := readBody(res)
 				require.NoError(t, err)
 
 				assert.Equal(t, tt.wantStatusCode, res.StatusCode)
@@ -375,6 +387,250 @@ func TestUpdateSerializedMetrics(t *testing.T) {
 	}
 }
 
+func TestUpdateSerializedMetrics_Binary(t *testing.T) {
+	repo := &mockRepo{
+		metrics: make(map[string]repositories.Metric),
+	}
+	service := services.NewService(repo)
+	handler := NewHandler(service, service, nil)
+
+	valid, err := wire.Encode([]*models.Metrics{
+		{ID: "test1", MType: constants.MetricTypeGauge, Value: float64Ptr(123.45)},
+		{ID: "test2", MType: constants.MetricTypeCounter, Delta: int64Ptr(2)},
+		{ID: "test2", MType: constants.MetricTypeCounter, Delta: int64Ptr(3)},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		body           []byte
+		contentType    string
+		wantStatusCode int
+	}{
+		{
+			name:           "Test #1 binary batch",
+			body:           valid,
+			contentType:    wire.ContentType,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "Test #2 binary batch with parameters",
+			body:           valid,
+			contentType:    wire.ContentType + "; version=1",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "Test #3 malformed binary batch",
+			body:           valid[:len(valid)-2],
+			contentType:    wire.ContentType,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Test #4 binary batch sent as JSON",
+			body:           valid,
+			contentType:    "application/json",
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo.metrics = make(map[string]repositories.Metric)
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			handler.UpdateSerializedMetrics(recorder, req)
+			assert.Equal(t, tt.wantStatusCode, recorder.Code)
+			if tt.wantStatusCode == http.StatusOK {
+				assert.Equal(t, int64(5), repo.metrics["test2"].Value)
+			}
+		})
+	}
+}
+
+func TestUpdateSerializedMetrics_Streaming(t *testing.T) {
+	repo := &mockRepo{
+		metrics: make(map[string]repositories.Metric),
+	}
+	service := services.NewService(repo)
+	handler := NewHandler(service, service, nil)
+
+	large := "[" + strings.Repeat(`{"id":"c","type":"counter","delta":1},`, 1000) + `{"id":"c","type":"counter","delta":1}]`
+
+	tests := []struct {
+		name           string
+		body           string
+		limit          int64
+		wantStatusCode int
+		wantCounter    int64
+	}{
+		{
+			name:           "Test #1 large array",
+			body:           large,
+			wantStatusCode: http.StatusOK,
+			wantCounter:    1001,
+		},
+		{
+			name:           "Test #2 null body",
+			body:           "null",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "Test #3 not an array",
+			body:           `{"id":"c","type":"counter","delta":1}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Test #4 unterminated array",
+			body:           `[{"id":"c","type":"counter","delta":1}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Test #5 body over limit",
+			body:           large,
+			limit:          1024,
+			wantStatusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo.metrics = make(map[string]repositories.Metric)
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.limit > 0 {
+				req.Body = http.MaxBytesReader(recorder, req.Body, tt.limit)
+			}
+
+			handler.UpdateSerializedMetrics(recorder, req)
+			assert.Equal(t, tt.wantStatusCode, recorder.Code)
+			if tt.wantCounter != 0 {
+				assert.Equal(t, tt.wantCounter, repo.metrics["c"].Value)
+			}
+		})
+	}
+}
+
+func TestUpdateSerializedMetrics_PartialSuccess(t *testing.T) {
+	body := `[
+		{"id":"ok_gauge","type":"gauge","value":1.5},
+		{"id":"no_value","type":"gauge"},
+		{"id":"ok_counter","type":"counter","delta":2},
+		{"id":"bad","type":"histogram","value":1},
+		{"id":"ok_counter","type":"counter","delta":3},
+		{"id":"ok_counter","type":"gauge","value":1},
+		{"id":"stored_gauge","type":"counter","delta":1}
+	]`
+
+	wantRejected := []models.RejectedMetric{
+		{Index: 1, ID: "no_value", MType: constants.MetricTypeGauge, Reason: "missing gauge value"},
+		{Index: 3, ID: "bad", MType: "histogram", Reason: "unknown metric type"},
+		{Index: 5, ID: "ok_counter", MType: constants.MetricTypeGauge, Reason: "conflicting metric type within batch"},
+		{Index: 6, ID: "stored_gauge", MType: constants.MetricTypeCounter, Reason: "metric stored with type gauge"},
+	}
+
+	tests := []struct {
+		name           string
+		mode           string
+		wantStatusCode int
+		wantAccepted   int
+		wantRejected   []models.RejectedMetric
+		wantStored     bool
+	}{
+		{
+			name:           "Test #1 strict mode rejects the batch",
+			wantStatusCode: http.StatusBadRequest,
+			wantRejected:   wantRejected[:3],
+		},
+		{
+			name:           "Test #2 best-effort mode stores valid items",
+			mode:           models.BatchModeBestEffort,
+			wantStatusCode: http.StatusOK,
+			wantAccepted:   3,
+			wantRejected:   wantRejected,
+			wantStored:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := memstorage.NewMemStorage()
+			require.NoError(t, storage.UpdateMetric(context.Background(), "stored_gauge", repositories.Metric{Type: constants.MetricTypeGauge, Value: 1.0}))
+			service := services.NewService(repositories.NewMetricRepo(storage))
+			handler := NewHandler(service, service, nil)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.mode != "" {
+				req.Header.Set(models.BatchModeHeader, tt.mode)
+			}
+
+			handler.UpdateSerializedMetrics(recorder, req)
+			require.Equal(t, tt.wantStatusCode, recorder.Code)
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+			result := decodeBatchResult(t, recorder)
+			assert.Equal(t, tt.wantAccepted, result.Accepted)
+			assert.Equal(t, len(tt.wantRejected), result.RejectedTotal)
+			assert.Equal(t, tt.wantRejected, result.Rejected)
+
+			metrics, err := service.GetMetrics(context.Background())
+			require.NoError(t, err)
+			if tt.wantStored {
+				assert.Equal(t, int64(5), metrics["ok_counter"].Value)
+				assert.Equal(t, 1.5, metrics["ok_gauge"].Value)
+			} else {
+				assert.NotContains(t, metrics, "ok_counter")
+			}
+			assert.Equal(t, 1.0, metrics["stored_gauge"].Value)
+		})
+	}
+}
+
+func TestUpdateSerializedMetrics_StoredTypeConflict(t *testing.T) {
+	storage := memstorage.NewMemStorage()
+	require.NoError(t, storage.UpdateMetric(context.Background(), "requests", repositories.Metric{Type: constants.MetricTypeCounter, Value: int64(1)}))
+	service := services.NewService(repositories.NewMetricRepo(storage))
+	handler := NewHandler(service, service, nil)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/updates/",
+		strings.NewReader(`[{"id":"load","type":"gauge","value":1},{"id":"requests","type":"gauge","value":2}]`))
+	handler.UpdateSerializedMetrics(recorder, req)
+
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	result := decodeBatchResult(t, recorder)
+	assert.Equal(t, models.BatchModeStrict, result.Mode)
+	assert.Equal(t, 0, result.Accepted)
+	assert.Equal(t, []models.RejectedMetric{
+		{Index: 1, ID: "requests", MType: constants.MetricTypeGauge, Reason: "metric stored with type counter"},
+	}, result.Rejected)
+
+	metrics, err := service.GetMetrics(context.Background())
+	require.NoError(t, err)
+	assert.NotContains(t, metrics, "load")
+	assert.Equal(t, int64(1), metrics["requests"].Value)
+}
+
+// decodeBatchResult decodes the result of a batch update, which is wrapped in an error response
+// when the batch is rejected.
+func decodeBatchResult(t *testing.T, recorder *httptest.ResponseRecorder) models.BatchResult {
+	t.Helper()
+	var result models.BatchResult
+	if recorder.Code == http.StatusOK {
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&result))
+		return result
+	}
+
+	resp := models.ErrorResponse{Details: &result}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+	assert.Equal(t, CodeBatchRejected, resp.Code)
+	return result
+}
+
 func BenchmarkUpdateSerializedMetric(b *testing.B) {
 	repo := &mockRepo{}
 	service := services.NewService(repo)
@@ -407,6 +663,38 @@ func BenchmarkUpdateSerializedMetrics(b *testing.B) {
 	}
 }
 
+func BenchmarkUpdateSerializedMetrics_Binary(b *testing.B) {
+	repo := &mockRepo{}
+	service := services.NewService(repo)
+	h := &Handler{reader: service, writer: service}
+	body, err := wire.Encode([]*models.Metrics{
+		{ID: "test", MType: constants.MetricTypeGauge, Value: float64Ptr(123.45)},
+	})
+	require.NoError(b, err)
+	for i := 0; i < b.N; i++ {
+		r := httptest.NewRequest("POST", "/updates/", bytes.NewReader(body))
+		r.Header.Set("Content-Type", wire.ContentType)
+		w := httptest.NewRecorder()
+		h.UpdateSerializedMetrics(w, r)
+	}
+}
+
+// readBody reads a response body, decompressing it when the server compressed it.
+func readBody(res *http.Response) ([]byte, error) {
+	codec, ok := compression.Lookup(res.Header.Get("Content-Encoding"))
+	if !ok {
+		return nil, fmt.Errorf("unsupported content encoding %q", res.Header.Get("Content-Encoding"))
+	}
+	r, err := codec.NewReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	return io.ReadAll(r)
+}
+
 func float64Ptr(f float64) *float64 {
 	return &f
 }
@@ -417,6 +705,8 @@ func int64Ptr(i int64) *int64 {
 
 type mockRepo struct {
 	metrics     map[string]repositories.Metric
+	metadata    map[string]repositories.Metadata
+	rollups     map[string][]repositories.Rollup
 	errOnUpdate bool
 	errOnGet    bool
 }
@@ -441,7 +731,7 @@ func (m *mockRepo) GetMetric(_ context.Context, name string) (repositories.Metri
 	}
 	metric, ok := m.metrics[name]
 	if !ok {
-		return repositories.Metric{}, fmt.Errorf("metric %s not found", name)
+		return repositories.Metric{}, fmt.Errorf("%w: %s", repositories.ErrMetricNotFound, name)
 	}
 	return metric, nil
 }
@@ -466,6 +756,20 @@ func (m *mockRepo) UpdateMetricsBatch(_ context.Context, metrics map[string]repo
 	return nil
 }
 
+func (m *mockRepo) CreateCounter(_ context.Context, name string, delta int64) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	if m.metrics == nil {
+		m.metrics = make(map[string]repositories.Metric)
+	}
+	if _, ok := m.metrics[name]; ok {
+		return repositories.ErrMetricExists
+	}
+	m.metrics[name] = repositories.Metric{Type: constants.MetricTypeCounter, Value: delta}
+	return nil
+}
+
 func (m *mockRepo) UpdateGaugeMetric(ctx context.Context, id string, value float64) error {
 	return m.SaveMetric(ctx, id, value, constants.MetricTypeGauge)
 }
@@ -473,3 +777,225 @@ func (m *mockRepo) UpdateGaugeMetric(ctx context.Context, id string, value float
 func (m *mockRepo) UpdateCounterMetric(ctx context.Context, id string, delta int64) error {
 	return m.SaveMetric(ctx, id, delta, constants.MetricTypeCounter)
 }
+
+func (m *mockRepo) ListTenants(_ context.Context) ([]string, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	return []string{""}, nil
+}
+
+func (m *mockRepo) DeleteTenant(_ context.Context, _ string) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	m.metrics = nil
+	return nil
+}
+
+func (m *mockRepo) DeleteMetric(_ context.Context, name string) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	if _, ok := m.metrics[name]; !ok {
+		return repositories.ErrMetricNotFound
+	}
+	delete(m.metrics, name)
+	return nil
+}
+
+func (m *mockRepo) DeleteBySelector(_ context.Context, selector repositories.Selector) ([]string, error) {
+	if m.errOnUpdate {
+		return nil, fmt.Errorf("mock update error")
+	}
+	deleted := make([]string, 0)
+	for name, metric := range m.metrics {
+		if selector.Matches(name, metric) {
+			delete(m.metrics, name)
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(deleted)
+	return deleted, nil
+}
+
+func (m *mockRepo) GetUpdateTimes(_ context.Context) (map[string]time.Time, error) {
+	return map[string]time.Time{}, nil
+}
+
+func (m *mockRepo) DeleteExpired(_ context.Context, _ []repositories.ExpiringSeries) ([]repositories.ExpiringSeries, error) {
+	return []repositories.ExpiringSeries{}, nil
+}
+
+func (m *mockRepo) UpdateMetadata(_ context.Context, metadata map[string]repositories.Metadata) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	if m.metadata == nil {
+		m.metadata = make(map[string]repositories.Metadata)
+	}
+	for name, meta := range metadata {
+		m.metadata[name] = meta
+	}
+	return nil
+}
+
+func (m *mockRepo) GetMetadata(_ context.Context) (map[string]repositories.Metadata, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	metadata := make(map[string]repositories.Metadata, len(m.metadata))
+	for name, meta := range m.metadata {
+		metadata[name] = meta
+	}
+	return metadata, nil
+}
+
+func (m *mockRepo) GetRollups(_ context.Context, name string, window time.Duration) ([]repositories.Rollup, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	var rollups []repositories.Rollup
+	for _, rollup := range m.rollups[name] {
+		if rollup.Window == window {
+			rollups = append(rollups, rollup)
+		}
+	}
+	return rollups, nil
+}
+
+func (m *mockRepo) CompactRollups(_ context.Context, window, into time.Duration, before time.Time) (int, error) {
+	if m.errOnUpdate {
+		return 0, fmt.Errorf("mock update error")
+	}
+	removed := 0
+	for name, rollups := range m.rollups {
+		var kept, compacted []repositories.Rollup
+		for _, rollup := range rollups {
+			if rollup.Window == window && rollup.Start.Before(before) {
+				compacted = append(compacted, rollup)
+				continue
+			}
+			kept = append(kept, rollup)
+		}
+		if into > 0 {
+			kept = append(kept, repositories.FoldRollups(compacted, into)...)
+		}
+		m.rollups[name] = kept
+		removed += len(compacted)
+	}
+	return removed, nil
+}
+
+func (m *mockRepo) RollupSizes(_ context.Context) (map[time.Duration]int, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	sizes := make(map[time.Duration]int)
+	for _, rollups := range m.rollups {
+		for _, rollup := range rollups {
+			sizes[rollup.Window]++
+		}
+	}
+	return sizes, nil
+}
+
+func TestUpdateSerializedMetrics_CounterModes(t *testing.T) {
+	service := services.NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+	handler := NewHandler(service, service, nil)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+		req.Header.Set(models.BatchModeHeader, models.BatchModeBestEffort)
+		handler.UpdateSerializedMetrics(recorder, req)
+		return recorder
+	}
+
+	recorder := post(`[
+		{"id":"polls","type":"counter","delta":4,"mode":"cumulative"},
+		{"id":"polls","type":"counter","delta":6,"mode":"cumulative"},
+		{"id":"polls","type":"counter","delta":1},
+		{"id":"requests","type":"counter","delta":-1},
+		{"id":"requests","type":"counter","delta":1,"mode":"absolute"},
+		{"id":"requests","type":"counter","delta":2,"mode":"delta"}
+	]`)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	result := decodeBatchResult(t, recorder)
+	assert.Equal(t, 3, result.Accepted)
+	assert.Equal(t, []models.RejectedMetric{
+		{Index: 2, ID: "polls", MType: constants.MetricTypeCounter, Reason: "conflicting counter mode within batch"},
+		{Index: 3, ID: "requests", MType: constants.MetricTypeCounter, Reason: "negative counter delta"},
+		{Index: 4, ID: "requests", MType: constants.MetricTypeCounter, Reason: "unknown counter mode"},
+	}, result.Rejected)
+
+	require.Equal(t, http.StatusOK, post(`[{"id":"polls","type":"counter","delta":2,"mode":"cumulative"}]`).Code)
+
+	metrics, err := service.GetMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), metrics["polls"].Value, "the last total of a batch wins and a lower total is a reset")
+	assert.Equal(t, int64(2), metrics["requests"].Value)
+}
+
+func TestHandler_UpdateSerializedMetric_CounterModes(t *testing.T) {
+	service := services.NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+	handler := NewHandler(service, service, nil)
+
+	tests := []struct {
+		name           string
+		body           string
+		wantStatusCode int
+		wantCode       string
+		wantDelta      int64
+	}{
+		{
+			name:           "Test #1 first total",
+			body:           `{"id":"polls","type":"counter","delta":5,"mode":"cumulative"}`,
+			wantStatusCode: http.StatusOK,
+			wantDelta:      5,
+		},
+		{
+			name:           "Test #2 next total",
+			body:           `{"id":"polls","type":"counter","delta":7,"mode":"cumulative"}`,
+			wantStatusCode: http.StatusOK,
+			wantDelta:      7,
+		},
+		{
+			name:           "Test #3 delta",
+			body:           `{"id":"polls","type":"counter","delta":1,"mode":"delta"}`,
+			wantStatusCode: http.StatusOK,
+			wantDelta:      8,
+		},
+		{
+			name:           "Test #4 negative delta",
+			body:           `{"id":"polls","type":"counter","delta":-1}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantCode:       CodeInvalidMetricValue,
+		},
+		{
+			name:           "Test #5 unknown mode",
+			body:           `{"id":"polls","type":"counter","delta":1,"mode":"absolute"}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantCode:       CodeInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/update/", strings.NewReader(tt.body))
+			handler.UpdateSerializedMetric(recorder, req)
+			require.Equal(t, tt.wantStatusCode, recorder.Code)
+
+			if tt.wantCode != "" {
+				var resp models.ErrorResponse
+				require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+				return
+			}
+			var m models.Metrics
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&m))
+			require.NotNil(t, m.Delta)
+			assert.Equal(t, tt.wantDelta, *m.Delta)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -15,52 +16,61 @@ import (
 	"github.com/a2sh3r/sysmetrics/internal/logger"
 )
 
-// GetMetric handles GET requests for a single metric value.
+// GetMetric handles GET requests for a single metric value. With the rollup parameter set to a window
+// length such as 5m, a gauge is answered with a statistic of its current window, selected by the stat
+// parameter: min, max, avg (the default), sum, count or last.
 func (h *Handler) GetMetric(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed"))
 		return
 	}
 
-	setHeaders(w)
-
 	metricType := chi.URLParam(r, "metricType")
 	metricName := chi.URLParam(r, "metricName")
 
 	if err := validateParams(metricType, metricName); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update metric: %s", err), http.StatusBadRequest)
-		logger.Log.Warn("Failed to validate params", zap.Error(err), zap.String("metricType", metricType), zap.String("metricName", metricName))
+		writeError(w, r, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error(), Err: err})
 		return
 	}
 
 	responseMetric, err := h.reader.GetMetricWithRetry(r.Context(), metricName)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get metric: %s", err), http.StatusNotFound)
-		logger.Log.Warn("Metric not found", zap.Error(err), zap.String("metricName", metricName))
+		writeError(w, r, err)
 		return
 	}
 
 	if responseMetric.Type != metricType {
-		http.Error(w, fmt.Sprintf("Got metric, but its type differs from the requested one: %s", metricName), http.StatusBadRequest)
-		logger.Log.Warn("Metric type mismatch", zap.String("requestedType", metricType), zap.String("actualType", responseMetric.Type), zap.String("metricName", metricName))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeMetricTypeMismatch,
+			fmt.Sprintf("metric %s has type %s, not %s", metricName, responseMetric.Type, metricType)))
 		return
 	}
 
 	if responseMetric.Value == nil {
-		http.Error(w, "Metric value is nil", http.StatusInternalServerError)
-		logger.Log.Error("Metric value is nil", zap.String("metricName", metricName))
+		writeError(w, r, fmt.Errorf("metric %s has no value", metricName))
 		return
 	}
 
-	metricString, err := formatMetric(nil, responseMetric.Value)
+	value := responseMetric.Value
+	if window := r.URL.Query().Get("rollup"); window != "" {
+		rollup, err := h.latestRollup(r.Context(), metricName, window)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if value, err = rollupStat(rollup, r.URL.Query().Get("stat")); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	metricString, err := formatMetric(nil, value)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		logger.Log.Error("Failed to format metric", zap.Error(err), zap.String("metricName", metricName))
+		writeError(w, r, fmt.Errorf("failed to format metric %s: %w", metricName, err))
 		return
 	}
 
+	setHeaders(w)
 	if _, err := io.WriteString(w, metricString); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to write body: %s\n", err), http.StatusInternalServerError)
 		logger.Log.Error("Failed to write response body", zap.Error(err), zap.String("metricName", metricName))
 		return
 	}
@@ -71,41 +81,47 @@ func (h *Handler) GetMetric(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
-// GetMetrics handles GET requests for all metrics.
+// GetMetrics handles GET requests for all metrics except stale ones, ordered by name. Metrics with
+// registered metadata are preceded by # HELP and # UNIT lines.
 func (h *Handler) GetMetrics(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed"))
 		return
 	}
 
-	setHeaders(w)
-
 	responseMetrics, err := h.reader.GetMetricsWithRetry(r.Context())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get metrics: %s", err), http.StatusInternalServerError)
-		logger.Log.Error("Failed to get metrics", zap.Error(err))
+		writeError(w, r, fmt.Errorf("failed to get metrics: %w", err))
 		return
 	}
 
+	names := make([]string, 0, len(responseMetrics))
+	for metricName := range responseMetrics {
+		names = append(names, metricName)
+	}
+	sort.Strings(names)
+
 	var metricsBuffer bytes.Buffer
-	for metricName, responseMetric := range responseMetrics {
+	for _, metricName := range names {
+		responseMetric := responseMetrics[metricName]
+		if responseMetric.Stale {
+			continue
+		}
 		metricString, err := formatMetric(&metricName, responseMetric.Value)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			logger.Log.Error("Failed to format metric", zap.Error(err), zap.String("metricName", metricName))
+			writeError(w, r, fmt.Errorf("failed to format metric %s: %w", metricName, err))
 			return
 		}
+		metricsBuffer.WriteString(formatMetadata(metricName, responseMetric.Metadata))
 		metricsBuffer.WriteString(metricString)
 	}
 
+	setHeaders(w)
 	if _, err := io.Copy(w, &metricsBuffer); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to write body: %s", err), http.StatusInternalServerError)
 		logger.Log.Error("Failed to write response body", zap.Error(err))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-
 	logger.Log.Info("Sending all metrics",
 		zap.Int("metrics_count", len(responseMetrics)),
 		zap.String("response_body", metricsBuffer.String()),
@@ -115,16 +131,13 @@ func (h *Handler) GetMetrics(w http.ResponseWriter, r *http.Request) {
 // UpdateMetric handles POST requests to update a metric by URL parameters.
 func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed"))
 		return
 	}
 
-	setHeaders(w)
-
 	parts := strings.Split(r.URL.Path, "/")
 	if len(parts) != 5 {
-		http.Error(w, "Invalid URL format", http.StatusNotFound)
-		logger.Log.Warn("Invalid URL format", zap.String("path", r.URL.Path))
+		writeError(w, r, newAPIError(http.StatusNotFound, CodeNotFound, "invalid URL format"))
 		return
 	}
 
@@ -133,8 +146,7 @@ func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 	metricValue := chi.URLParam(r, "metricValue")
 
 	if err := validateParams(metricType, metricName, metricValue); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update metric: %s", err), http.StatusBadRequest)
-		logger.Log.Warn("Failed to validate params", zap.Error(err), zap.String("metricType", metricType), zap.String("metricName", metricName), zap.String("metricValue", metricValue))
+		writeError(w, r, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error(), Err: err})
 		return
 	}
 
@@ -142,36 +154,33 @@ func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 	case constants.MetricTypeGauge:
 		value, err := strconv.ParseFloat(metricValue, 64)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to update metric: %s", err), http.StatusBadRequest)
-			logger.Log.Warn("Failed to parse gauge value", zap.Error(err), zap.String("metricValue", metricValue))
+			writeError(w, r, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidMetricValue,
+				Message: fmt.Sprintf("invalid gauge value %q", metricValue), Err: err})
 			return
 		}
 		if err := h.writer.UpdateGaugeMetricWithRetry(r.Context(), metricName, value); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to update metric: %s", err), http.StatusInternalServerError)
-			logger.Log.Error("Failed to update gauge metric", zap.Error(err), zap.String("metricName", metricName))
+			writeError(w, r, err)
 			return
 		}
 	case constants.MetricTypeCounter:
 		value, err := strconv.ParseInt(metricValue, 10, 64)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to update metric: %s", err), http.StatusBadRequest)
-			logger.Log.Warn("Failed to parse counter value", zap.Error(err), zap.String("metricValue", metricValue))
+			writeError(w, r, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidMetricValue,
+				Message: fmt.Sprintf("invalid counter value %q", metricValue), Err: err})
 			return
 		}
 		if err := h.writer.UpdateCounterMetricWithRetry(r.Context(), metricName, value); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to update metric: %s", err), http.StatusInternalServerError)
-			logger.Log.Error("Failed to update counter metric", zap.Error(err), zap.String("metricName", metricName))
+			writeError(w, r, err)
 			return
 		}
 	default:
-		http.Error(w, fmt.Sprintf("Failed to update metric: invalid metric type: %v", metricType), http.StatusBadRequest)
-		logger.Log.Warn("Invalid metric type", zap.String("metricType", metricType))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidMetricType, fmt.Sprintf("invalid metric type %q", metricType)))
 		return
 	}
 
+	setHeaders(w)
 	msg := fmt.Sprintf("Metric %v is updated successfully with value %v", metricName, metricValue)
 	if _, err := io.WriteString(w, msg); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to write body: %s", err), http.StatusInternalServerError)
 		logger.Log.Error("Failed to write response body", zap.Error(err), zap.String("metricName", metricName))
 		return
 	}
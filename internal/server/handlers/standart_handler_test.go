@@ -13,6 +13,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 	"github.com/a2sh3r/sysmetrics/internal/server/services"
 )
@@ -98,8 +99,8 @@ func TestHandler_GetMetric(t *testing.T) {
 			},
 			want: want{
 				code:        http.StatusBadRequest,
-				response:    "Got metric, but its type differs from the requested one: test_counter\n",
-				contentType: "text/plain; charset=utf-8",
+				response:    `{"code":"metric_type_mismatch","message":"metric test_counter has type counter, not gauge","request_id":"test-request"}` + "\n",
+				contentType: "application/json",
 			},
 		},
 		{
@@ -120,8 +121,8 @@ func TestHandler_GetMetric(t *testing.T) {
 			},
 			want: want{
 				code:        http.StatusBadRequest,
-				response:    "Got metric, but its type differs from the requested one: test_counter\n",
-				contentType: "text/plain; charset=utf-8",
+				response:    `{"code":"metric_type_mismatch","message":"metric test_counter has type counter, not gauge","request_id":"test-request"}` + "\n",
+				contentType: "application/json",
 			},
 		},
 		{
@@ -135,8 +136,8 @@ func TestHandler_GetMetric(t *testing.T) {
 			},
 			want: want{
 				code:        http.StatusNotFound,
-				response:    "Failed to get metric: metric test_counter not found\n",
-				contentType: "text/plain; charset=utf-8",
+				response:    `{"code":"metric_not_found","message":"metric not found: test_counter","request_id":"test-request"}` + "\n",
+				contentType: "application/json",
 			},
 		},
 		{
@@ -157,8 +158,8 @@ func TestHandler_GetMetric(t *testing.T) {
 			},
 			want: want{
 				code:        http.StatusInternalServerError,
-				response:    "Metric value is nil\n",
-				contentType: "text/plain; charset=utf-8",
+				response:    `{"code":"internal_error","message":"internal server error","request_id":"test-request"}` + "\n",
+				contentType: "application/json",
 			},
 		},
 	}
@@ -170,13 +171,15 @@ func TestHandler_GetMetric(t *testing.T) {
 			}
 
 			cfg := &config.ServerConfig{
-				SecretKey: "test key",
+				SecretKey:     "test key",
+				AllowUnsigned: true,
 			}
 			ts := httptest.NewServer(NewRouter(h, cfg))
 			defer ts.Close()
 
 			req, err := http.NewRequest(tt.args.method, ts.URL+tt.args.url, nil)
 			require.NoError(t, err)
+			req.Header.Set(middleware.RequestIDHeader, "test-request")
 
 			res, err := ts.Client().Do(req)
 			require.NoError(t, err)
@@ -264,9 +267,9 @@ func TestHandler_GetMetrics(t *testing.T) {
 			want: want{
 				code: http.StatusInternalServerError,
 				response: []string{
-					"unsupported metric value type",
+					`{"code":"internal_error","message":"internal server error","request_id":"test-request"}`,
 				},
-				contentType: "text/plain; charset=utf-8",
+				contentType: "application/json",
 			},
 		},
 	}
@@ -278,13 +281,15 @@ func TestHandler_GetMetrics(t *testing.T) {
 			}
 
 			cfg := &config.ServerConfig{
-				SecretKey: "test key",
+				SecretKey:     "test key",
+				AllowUnsigned: true,
 			}
 			ts := httptest.NewServer(NewRouter(h, cfg))
 			defer ts.Close()
 
 			req, err := http.NewRequest(tt.args.method, ts.URL+tt.args.url, nil)
 			require.NoError(t, err)
+			req.Header.Set(middleware.RequestIDHeader, "test-request")
 
 			res, err := ts.Client().Do(req)
 			require.NoError(t, err)
@@ -370,8 +375,8 @@ func TestHandler_UpdateMetric(t *testing.T) {
 			},
 			want: want{
 				code:        http.StatusMethodNotAllowed,
-				response:    "Method not allowed\n",
-				contentType: "text/plain; charset=utf-8",
+				response:    `{"code":"method_not_allowed","message":"method not allowed","request_id":"test-request"}` + "\n",
+				contentType: "application/json",
 			},
 		},
 		{
@@ -385,8 +390,8 @@ func TestHandler_UpdateMetric(t *testing.T) {
 			},
 			want: want{
 				code:        http.StatusNotFound,
-				response:    "Invalid URL format\n",
-				contentType: "text/plain; charset=utf-8",
+				response:    `{"code":"not_found","message":"invalid URL format","request_id":"test-request"}` + "\n",
+				contentType: "application/json",
 			},
 		},
 		{
@@ -400,8 +405,8 @@ func TestHandler_UpdateMetric(t *testing.T) {
 			},
 			want: want{
 				code:        http.StatusBadRequest,
-				response:    "Failed to update metric: invalid metric type: invalid\n",
-				contentType: "text/plain; charset=utf-8",
+				response:    `{"code":"invalid_metric_type","message":"invalid metric type \"invalid\"","request_id":"test-request"}` + "\n",
+				contentType: "application/json",
 			},
 		},
 		{
@@ -415,8 +420,8 @@ func TestHandler_UpdateMetric(t *testing.T) {
 			},
 			want: want{
 				code:        http.StatusBadRequest,
-				response:    "Failed to update metric: strconv.ParseFloat: parsing \"invalid\": invalid syntax\n",
-				contentType: "text/plain; charset=utf-8",
+				response:    `{"code":"invalid_metric_value","message":"invalid gauge value \"invalid\"","request_id":"test-request"}` + "\n",
+				contentType: "application/json",
 			},
 		},
 	}
@@ -428,13 +433,15 @@ func TestHandler_UpdateMetric(t *testing.T) {
 			}
 
 			cfg := &config.ServerConfig{
-				SecretKey: "test key",
+				SecretKey:     "test key",
+				AllowUnsigned: true,
 			}
 			ts := httptest.NewServer(NewRouter(h, cfg))
 			defer ts.Close()
 
 			req, err := http.NewRequest(tt.args.method, ts.URL+tt.args.url, nil)
 			require.NoError(t, err)
+			req.Header.Set(middleware.RequestIDHeader, "test-request")
 
 			res, err := ts.Client().Do(req)
 			require.NoError(t, err)
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
+	"github.com/a2sh3r/sysmetrics/internal/server/stream"
+)
+
+// Timing of metric streams.
+const (
+	// streamHeartbeat is the interval of the comments keeping idle Server-Sent Events streams open.
+	streamHeartbeat = 15 * time.Second
+	// streamWriteTimeout bounds each write to a subscriber, so that a stalled connection is dropped.
+	streamWriteTimeout = 10 * time.Second
+)
+
+// StreamV1 handles GET requests streaming the updates of metrics as Server-Sent Events. Every update is
+// a metric event whose data is the models.Metrics written; a stream ended by the server sends an error
+// event with a models.ErrorResponse last. The name and prefix parameters, both repeatable, select the
+// metrics streamed; without them every metric of the tenant is streamed.
+func (h *Handler) StreamV1(w http.ResponseWriter, r *http.Request) {
+	if h.Hub == nil {
+		writeError(w, r, newAPIError(http.StatusNotImplemented, CodeStreamingDisabled, "metric streaming is disabled"))
+		return
+	}
+
+	sub := h.Hub.Subscribe(identity.Tenant(r.Context()), streamFilter(r.URL.Query()))
+	defer sub.Close()
+	if err := sub.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logger.Log.Error("Failed to open metric stream", zap.Error(err))
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			err = writeStreamEvent(w, rc, ": heartbeat\n\n")
+		case update, ok := <-sub.Updates():
+			if !ok {
+				if subErr := sub.Err(); subErr != nil {
+					body, _ := json.Marshal(streamError(r, subErr))
+					_ = writeStreamEvent(w, rc, fmt.Sprintf("event: error\ndata: %s\n\n", body))
+				}
+				return
+			}
+			body, marshalErr := json.Marshal(update)
+			if marshalErr != nil {
+				logger.Log.Error("Failed to encode metric update", zap.Error(marshalErr))
+				continue
+			}
+			err = writeStreamEvent(w, rc, fmt.Sprintf("event: metric\ndata: %s\n\n", body))
+		}
+		if err != nil {
+			logger.Log.Info("Metric stream closed", zap.String("request_id", middleware.RequestID(r.Context())), zap.Error(err))
+			return
+		}
+	}
+}
+
+// StreamWebSocketV1 handles GET requests streaming the updates of metrics over a WebSocket. Every
+// update is a text message with the models.Metrics written; a stream ended by the server sends a
+// models.ErrorResponse last. Messages from the client are ignored. Metrics are selected as by StreamV1.
+func (h *Handler) StreamWebSocketV1(w http.ResponseWriter, r *http.Request) {
+	if h.Hub == nil {
+		writeError(w, r, newAPIError(http.StatusNotImplemented, CodeStreamingDisabled, "metric streaming is disabled"))
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "websocket upgrade required"))
+		return
+	}
+	hijacker, ok := findHijacker(w)
+	if !ok {
+		writeError(w, r, errors.New("response writer does not support hijacking"))
+		return
+	}
+
+	sub := h.Hub.Subscribe(identity.Tenant(r.Context()), streamFilter(r.URL.Query()))
+	defer sub.Close()
+	if err := sub.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: checkStreamOrigin,
+		Handler: func(ws *websocket.Conn) {
+			h.serveWebSocket(ws, r, sub)
+		},
+	}
+	server.ServeHTTP(hijackableWriter{ResponseWriter: w, Hijacker: hijacker}, r)
+}
+
+// serveWebSocket sends the updates of sub to ws until either ends.
+func (h *Handler) serveWebSocket(ws *websocket.Conn, r *http.Request, sub *stream.Subscription) {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		_, _ = io.Copy(io.Discard, ws)
+	}()
+
+	send := func(v interface{}) error {
+		if err := ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+			return err
+		}
+		return websocket.JSON.Send(ws, v)
+	}
+
+	for {
+		select {
+		case <-closed:
+			return
+		case update, ok := <-sub.Updates():
+			if !ok {
+				if err := sub.Err(); err != nil {
+					_ = send(streamError(r, err))
+				}
+				return
+			}
+			if err := send(update); err != nil {
+				logger.Log.Info("Metric stream closed", zap.String("request_id", middleware.RequestID(r.Context())), zap.Error(err))
+				return
+			}
+		}
+	}
+}
+
+// streamFilter returns the filter selected by the name and prefix parameters.
+func streamFilter(query url.Values) stream.Filter {
+	var filter stream.Filter
+	for _, name := range query["name"] {
+		if name != "" {
+			filter.Names = append(filter.Names, name)
+		}
+	}
+	for _, prefix := range query["prefix"] {
+		if prefix != "" {
+			filter.Prefixes = append(filter.Prefixes, prefix)
+		}
+	}
+	return filter
+}
+
+// streamError returns the models.ErrorResponse sent last on a stream ended by err.
+func streamError(r *http.Request, err error) models.ErrorResponse {
+	apiErr := toAPIError(err)
+	return models.ErrorResponse{Code: apiErr.Code, Message: apiErr.Message, RequestID: middleware.RequestID(r.Context())}
+}
+
+// writeStreamEvent writes a Server-Sent Events frame and flushes it to the client.
+func writeStreamEvent(w io.Writer, rc *http.ResponseController, frame string) error {
+	if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := io.WriteString(w, frame); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// checkStreamOrigin accepts WebSocket handshakes from clients that are not browsers, which send no
+// Origin, and from pages of the server itself, so that other sites cannot read metrics in the
+// browser of a user.
+func checkStreamOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	if origin != nil && !strings.EqualFold(origin.Host, r.Host) {
+		return fmt.Errorf("origin %s not allowed", origin)
+	}
+	config.Origin = origin
+	return nil
+}
+
+// hijackableWriter is a ResponseWriter whose Hijack method reaches the connection under the writers
+// wrapping it in the middleware.
+type hijackableWriter struct {
+	http.ResponseWriter
+	http.Hijacker
+}
+
+// findHijacker returns the first writer in the Unwrap chain of w able to hijack the connection.
+func findHijacker(w http.ResponseWriter) (http.Hijacker, bool) {
+	for {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			return hijacker, true
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil, false
+		}
+		w = unwrapper.Unwrap()
+	}
+}
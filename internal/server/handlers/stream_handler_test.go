@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+	"github.com/a2sh3r/sysmetrics/internal/server/stream"
+)
+
+// newStreamServer starts a server streaming the metrics written through its handlers to at most
+// maxSubscribers subscribers.
+func newStreamServer(t *testing.T, maxSubscribers int, opts ...services.Option) (*httptest.Server, *stream.Hub, *StreamingWriter) {
+	t.Helper()
+	storage := memstorage.NewMemStorage()
+	require.NoError(t, storage.UpdateMetric(context.Background(), "requests", repositories.Metric{Type: constants.MetricTypeCounter, Value: int64(10)}))
+	service := services.NewService(repositories.NewMetricRepo(storage), opts...)
+	hub := stream.NewHub(16, maxSubscribers)
+	writer := NewStreamingWriter(service, service, hub)
+	t.Cleanup(writer.Close)
+	handler := NewHandler(service, writer, nil)
+	handler.Hub = hub
+
+	srv := httptest.NewServer(NewRouter(handler, &config.ServerConfig{}))
+	t.Cleanup(srv.Close)
+	return srv, hub, writer
+}
+
+func waitForSubscribers(t *testing.T, hub *stream.Hub, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return hub.Subscribers() == n }, 2*time.Second, 5*time.Millisecond)
+}
+
+// readEvent reads the next Server-Sent Event, skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) (event, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStreamV1(t *testing.T) {
+	srv, hub, _ := newStreamServer(t, 0)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/stream?prefix=req", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	waitForSubscribers(t, hub, 1)
+
+	for _, url := range []string{"/update/gauge/load/0.5", "/update/counter/requests/5"} {
+		update, err := srv.Client().Post(srv.URL+url, "text/plain", nil)
+		require.NoError(t, err)
+		require.NoError(t, update.Body.Close())
+		require.Equal(t, http.StatusOK, update.StatusCode)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	event, data := readEvent(t, body)
+	assert.Equal(t, "metric", event)
+	assert.JSONEq(t, `{"id":"requests","type":"counter","delta":15}`, data)
+
+	hub.Close()
+	event, data = readEvent(t, body)
+	assert.Equal(t, "error", event)
+	var errResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(data), &errResp))
+	assert.Equal(t, CodeStreamClosed, errResp.Code)
+}
+
+func TestStreamWebSocketV1(t *testing.T) {
+	srv, hub, writer := newStreamServer(t, 0)
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/stream/ws?name=load"
+
+	ws, err := websocket.Dial(wsURL, "", srv.URL)
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+	waitForSubscribers(t, hub, 1)
+
+	ctx := context.Background()
+	require.NoError(t, writer.UpdateCounterMetricWithRetry(ctx, "requests", 1))
+	require.NoError(t, writer.UpdateMetricsBatchWithRetry(ctx, map[string]repositories.Metric{
+		"load": {Type: constants.MetricTypeGauge, Value: 0.75},
+	}))
+
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var update models.Metrics
+	require.NoError(t, websocket.JSON.Receive(ws, &update))
+	assert.Equal(t, "load", update.ID)
+	require.NotNil(t, update.Value)
+	assert.Equal(t, 0.75, *update.Value)
+
+	hub.Close()
+	var errResp models.ErrorResponse
+	require.NoError(t, websocket.JSON.Receive(ws, &errResp))
+	assert.Equal(t, CodeStreamClosed, errResp.Code)
+
+	_, err = websocket.Dial(wsURL, "", "http://other.example")
+	assert.Error(t, err)
+}
+
+func TestStream_Errors(t *testing.T) {
+	srv, hub, _ := newStreamServer(t, 1)
+	sub := hub.Subscribe("", stream.Filter{})
+	defer sub.Close()
+	disabled := httptest.NewServer(NewRouter(NewHandler(nil, nil, nil), &config.ServerConfig{}))
+	defer disabled.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "Test #1 stream disabled", url: disabled.URL + "/api/v1/stream", wantStatus: http.StatusNotImplemented, wantCode: CodeStreamingDisabled},
+		{name: "Test #2 websocket disabled", url: disabled.URL + "/api/v1/stream/ws", wantStatus: http.StatusNotImplemented, wantCode: CodeStreamingDisabled},
+		{name: "Test #3 websocket without upgrade", url: srv.URL + "/api/v1/stream/ws", wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "Test #4 too many subscribers", url: srv.URL + "/api/v1/stream", wantStatus: http.StatusServiceUnavailable, wantCode: CodeTooManySubscribers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(tt.url)
+			require.NoError(t, err)
+			defer func() { _ = resp.Body.Close() }()
+
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+			var errResp models.ErrorResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+			assert.Equal(t, tt.wantCode, errResp.Code)
+		})
+	}
+}
+
+func TestStreamingWriter(t *testing.T) {
+	_, hub, writer := newStreamServer(t, 0, services.WithCardinalityLimit(2, services.CardinalityModeDrop))
+	sub := hub.Subscribe("", stream.Filter{})
+	defer sub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, writer.UpdateMetricsBatchWithRetry(ctx, map[string]repositories.Metric{
+		"requests": {Type: constants.MetricTypeCounter, Value: int64(5)},
+		"a_load":   {Type: constants.MetricTypeGauge, Value: 0.5},
+		"b_load":   {Type: constants.MetricTypeGauge, Value: 0.75},
+	}))
+	cancel()
+
+	updates := make(map[string]models.Metrics)
+	require.Eventually(t, func() bool {
+		for {
+			select {
+			case update := <-sub.Updates():
+				updates[update.ID] = update
+			default:
+				return len(updates) == 2
+			}
+		}
+	}, 2*time.Second, 5*time.Millisecond, "counters are read back after the request ends")
+
+	require.Contains(t, updates, "requests")
+	require.NotNil(t, updates["requests"].Delta)
+	assert.Equal(t, int64(15), *updates["requests"].Delta)
+	require.Contains(t, updates, "a_load")
+	assert.NotContains(t, updates, "b_load", "series dropped by the cardinality guard are not published")
+
+	writer.Close()
+	require.NoError(t, writer.UpdateGaugeMetricWithRetry(context.Background(), "a_load", 1))
+	assert.Equal(t, 1, hub.Subscribers())
+}
+
+func TestStreamingWriter_QueueFull(t *testing.T) {
+	service := services.NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+	hub := stream.NewHub(16, 0)
+	writer := NewStreamingWriter(service, service, hub)
+	writer.Close()
+
+	loads := hub.Subscribe("", stream.Filter{Names: []string{"load"}})
+	others := hub.Subscribe("", stream.Filter{Names: []string{"other"}})
+	defer others.Close()
+
+	for i := 0; i < publishQueueSize; i++ {
+		require.NoError(t, writer.UpdateGaugeMetricWithRetry(context.Background(), "load", float64(i)))
+	}
+	assert.NoError(t, loads.Err())
+
+	require.NoError(t, writer.UpdateGaugeMetricWithRetry(context.Background(), "load", 1))
+	assert.ErrorIs(t, loads.Err(), stream.ErrSlowConsumer, "subscribers missing an update are disconnected")
+	assert.NoError(t, others.Err())
+	assert.Equal(t, 1, hub.Subscribers())
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/stream"
+)
+
+// publishQueueSize is the number of writes queued for publishing. Writes beyond it end the
+// subscriptions that would have received them.
+const publishQueueSize = 1024
+
+// AcceptingWriterServiceInterface is a WriterServiceInterface returning the metrics of a batch it stored.
+type AcceptingWriterServiceInterface interface {
+	WriterServiceInterface
+	UpdateMetricsBatchAcceptedWithRetry(ctx context.Context, metrics map[string]repositories.Metric) (map[string]repositories.Metric, error)
+}
+
+// publication is a write queued for publishing.
+type publication struct {
+	ctx     context.Context
+	tenant  string
+	metrics map[string]repositories.Metric
+}
+
+// StreamingWriter is a WriterServiceInterface publishing the metrics written through it to the
+// subscribers of a stream.Hub.
+//
+// Only the metrics stored are published, so series dropped by the cardinality guard are not. Writes
+// selected by a subscriber are queued and published in order by a goroutine of the writer: gauges
+// with the written value, counters with their stored total read back then. Publishing never blocks
+// the write; a write finding the queue full ends the subscriptions selecting its metrics with
+// stream.ErrSlowConsumer instead, so that subscribers never silently miss an update.
+type StreamingWriter struct {
+	AcceptingWriterServiceInterface
+	reader ReaderServiceInterface
+	hub    *stream.Hub
+
+	queue     chan publication
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewStreamingWriter creates a StreamingWriter writing with writer, reading counter totals with reader
+// and publishing to hub. Close stops it.
+func NewStreamingWriter(writer AcceptingWriterServiceInterface, reader ReaderServiceInterface, hub *stream.Hub) *StreamingWriter {
+	s := &StreamingWriter{
+		AcceptingWriterServiceInterface: writer,
+		reader:                          reader,
+		hub:                             hub,
+		queue:                           make(chan publication, publishQueueSize),
+		stop:                            make(chan struct{}),
+		done:                            make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// UpdateGaugeMetricWithRetry updates a gauge and publishes its value.
+func (s *StreamingWriter) UpdateGaugeMetricWithRetry(ctx context.Context, name string, value float64) error {
+	if err := s.AcceptingWriterServiceInterface.UpdateGaugeMetricWithRetry(ctx, name, value); err != nil {
+		return err
+	}
+	s.publish(ctx, map[string]repositories.Metric{name: {Type: constants.MetricTypeGauge, Value: value}})
+	return nil
+}
+
+// UpdateCounterMetricWithRetry increments a counter and publishes its total.
+func (s *StreamingWriter) UpdateCounterMetricWithRetry(ctx context.Context, name string, value int64) error {
+	if err := s.AcceptingWriterServiceInterface.UpdateCounterMetricWithRetry(ctx, name, value); err != nil {
+		return err
+	}
+	s.publish(ctx, map[string]repositories.Metric{name: {Type: constants.MetricTypeCounter, Value: value}})
+	return nil
+}
+
+// CreateCounterMetricWithRetry creates a counter and publishes its total.
+func (s *StreamingWriter) CreateCounterMetricWithRetry(ctx context.Context, name string, value int64) error {
+	if err := s.AcceptingWriterServiceInterface.CreateCounterMetricWithRetry(ctx, name, value); err != nil {
+		return err
+	}
+	s.publish(ctx, map[string]repositories.Metric{name: {Type: constants.MetricTypeCounter, Value: value}})
+	return nil
+}
+
+// UpdateMetricsBatchWithRetry updates a batch of metrics and publishes those stored.
+func (s *StreamingWriter) UpdateMetricsBatchWithRetry(ctx context.Context, metrics map[string]repositories.Metric) error {
+	accepted, err := s.AcceptingWriterServiceInterface.UpdateMetricsBatchAcceptedWithRetry(ctx, metrics)
+	if err != nil {
+		return err
+	}
+	s.publish(ctx, accepted)
+	return nil
+}
+
+// Close stops publishing and waits for the publication in progress. Writes remain possible.
+func (s *StreamingWriter) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+// publish queues the written metrics selected by a subscriber of the tenant of ctx.
+func (s *StreamingWriter) publish(ctx context.Context, metrics map[string]repositories.Metric) {
+	tenant := identity.Tenant(ctx)
+	wanted := make(map[string]repositories.Metric)
+	for name, metric := range metrics {
+		if s.hub.Wants(tenant, name) {
+			wanted[name] = metric
+		}
+	}
+	if len(wanted) == 0 {
+		return
+	}
+
+	select {
+	case s.queue <- publication{ctx: context.WithoutCancel(ctx), tenant: tenant, metrics: wanted}:
+	default:
+		logger.Log.Warn("Dropped metric updates for stream subscribers: publish queue full",
+			zap.String("tenant", tenant), zap.Int("metrics", len(wanted)))
+		names := make([]string, 0, len(wanted))
+		for name := range wanted {
+			names = append(names, name)
+		}
+		s.hub.Drop(tenant, names...)
+	}
+}
+
+// run publishes the queued writes until the writer is closed.
+func (s *StreamingWriter) run() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case p := <-s.queue:
+			s.deliver(p)
+		}
+	}
+}
+
+// deliver publishes a queued write, reading the totals of its counters.
+func (s *StreamingWriter) deliver(p publication) {
+	updates := make([]models.Metrics, 0, len(p.metrics))
+	for name, metric := range p.metrics {
+		if metric.Type == constants.MetricTypeCounter {
+			stored, err := s.reader.GetMetricWithRetry(p.ctx, name)
+			if err != nil {
+				logger.Log.Warn("Failed to read counter for stream subscribers", zap.String("metric", name), zap.Error(err))
+				continue
+			}
+			metric = stored
+		}
+		updates = append(updates, convertMetricToModel(name, metric))
+	}
+	if len(updates) > 0 {
+		s.hub.Publish(p.tenant, updates...)
+	}
+}
@@ -12,6 +12,9 @@ import (
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 )
 
+// dashboardPath is the path the dashboard is served at.
+const dashboardPath = "/dashboard/"
+
 func validateParams(params ...string) error {
 	for _, p := range params {
 		if strings.TrimSpace(p) == "" {
@@ -26,6 +29,24 @@ func setHeaders(w http.ResponseWriter) {
 	w.Header().Set("Date", time.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT"))
 }
 
+// helpEscaper escapes the text of a # HELP line.
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// formatMetadata renders the # HELP and # UNIT lines preceding a metric in text exports.
+func formatMetadata(metricName string, meta *repositories.Metadata) string {
+	if meta == nil {
+		return ""
+	}
+	var b strings.Builder
+	if meta.Help != "" {
+		fmt.Fprintf(&b, "# HELP %s %s\n", metricName, helpEscaper.Replace(meta.Help))
+	}
+	if meta.Unit != "" {
+		fmt.Fprintf(&b, "# UNIT %s %s\n", metricName, meta.Unit)
+	}
+	return b.String()
+}
+
 func formatMetric(metricName *string, value interface{}) (string, error) {
 	switch v := value.(type) {
 	case int64:
@@ -49,6 +70,10 @@ func convertMetricToModel(id string, metric interface{}) models.Metrics {
 		result := models.Metrics{
 			ID:    id,
 			MType: m.Type,
+			Stale: m.Stale,
+		}
+		if m.Metadata != nil {
+			result.Metadata = &models.MetricMetadata{Unit: m.Metadata.Unit, Help: m.Metadata.Help, Owner: m.Metadata.Owner}
 		}
 		switch m.Type {
 		case constants.MetricTypeGauge:
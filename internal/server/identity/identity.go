@@ -0,0 +1,64 @@
+// Package identity carries the identity of the client making a request through the request context.
+package identity
+
+import (
+	"context"
+	"regexp"
+)
+
+var (
+	tenantPattern   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+	instancePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,252}$`)
+)
+
+type contextKey struct{}
+
+// Identity describes who is making a request.
+type Identity struct {
+	// Agent is the agent name taken from a verified client certificate.
+	Agent string
+	// Token is the name of the API token the request was authenticated with.
+	Token string
+	// Scopes are the scopes granted by the API token.
+	Scopes []string
+	// Tenant is the metric namespace the request operates on. The empty string is the default tenant.
+	Tenant string
+	// Instance is the agent instance ID announced by the client. It is not authenticated and only tells
+	// apart the senders sharing a token or certificate.
+	Instance string
+}
+
+// WithIdentity returns a copy of ctx carrying id.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx, or the zero Identity if there is none.
+func FromContext(ctx context.Context) Identity {
+	id, _ := ctx.Value(contextKey{}).(Identity)
+	return id
+}
+
+// Tenant returns the tenant of the identity stored in ctx.
+func Tenant(ctx context.Context) string {
+	return FromContext(ctx).Tenant
+}
+
+// WithTenant returns a copy of ctx whose identity operates on tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	id := FromContext(ctx)
+	id.Tenant = tenant
+	return WithIdentity(ctx, id)
+}
+
+// ValidTenant reports whether tenant is a valid tenant name: up to 64 letters, digits, '.', '_' or '-',
+// starting with a letter or digit. The empty default tenant is valid as well.
+func ValidTenant(tenant string) bool {
+	return tenant == "" || tenantPattern.MatchString(tenant)
+}
+
+// ValidInstance reports whether instance is a valid agent instance ID: up to 253 letters, digits, '.',
+// '_', ':' or '-', starting with a letter or digit, which covers host names. The empty ID is valid as well.
+func ValidInstance(instance string) bool {
+	return instance == "" || instancePattern.MatchString(instance)
+}
@@ -0,0 +1,109 @@
+// Package middleware provides HTTP middleware for the server, including API token authentication.
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/server/auth"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+// NewAuthMiddleware returns a middleware that authenticates bearer tokens against cfg.APITokens and stores
+// the token name, scopes and tenant in the request identity. Requests with an invalid token are rejected with 401;
+// requests without a token continue anonymously and are handled by NewScopeMiddleware.
+func NewAuthMiddleware(cfg *config.ServerConfig) func(next http.Handler) http.Handler {
+	store := parseTokenStore(cfg)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !store.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			secret, ok := bearerToken(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, err := store.Authenticate(secret)
+			if err != nil {
+				logger.Log.Warn("API token authentication failed", zap.String("path", r.URL.Path))
+				unauthorized(w, r)
+				return
+			}
+
+			id := identity.FromContext(r.Context())
+			id.Token = token.Name
+			id.Scopes = token.Scopes
+			id.Tenant = token.Tenant
+
+			next.ServeHTTP(w, r.WithContext(identity.WithIdentity(r.Context(), id)))
+		})
+	}
+}
+
+// NewScopeMiddleware returns a middleware that requires the authenticated token to grant scope.
+// It does nothing when no API tokens are configured.
+func NewScopeMiddleware(cfg *config.ServerConfig, scope string) func(next http.Handler) http.Handler {
+	store := parseTokenStore(cfg)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !store.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id := identity.FromContext(r.Context())
+			if id.Token == "" {
+				unauthorized(w, r)
+				return
+			}
+
+			if !auth.HasScope(id.Scopes, scope) {
+				logger.Log.Warn("API token lacks scope",
+					zap.String("token", id.Token),
+					zap.String("scope", scope),
+					zap.String("path", r.URL.Path))
+				WriteError(w, r, http.StatusForbidden, CodeForbidden, "forbidden", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func parseTokenStore(cfg *config.ServerConfig) *auth.Store {
+	store, err := auth.ParseTokens(cfg.APITokens)
+	if err != nil {
+		logger.Log.Error("Failed to parse API tokens, rejecting all requests", zap.Error(err))
+		// An unparsable token list must not silently disable authentication.
+		return auth.DenyAll()
+	}
+	return store
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", false
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", true
+	}
+	return strings.TrimSpace(token), true
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="sysmetrics"`)
+	WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "unauthorized", nil)
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/server/auth"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+func TestNewAuthMiddleware(t *testing.T) {
+	tokens := "agent:" + auth.HashToken("secret") + ":write"
+
+	tests := []struct {
+		name           string
+		tokens         string
+		header         string
+		expectedStatus int
+		wantToken      string
+	}{
+		{"Test #1 auth disabled", "", "Bearer anything", http.StatusOK, ""},
+		{"Test #2 valid token", tokens, "Bearer secret", http.StatusOK, "agent"},
+		{"Test #3 lowercase scheme", tokens, "bearer secret", http.StatusOK, "agent"},
+		{"Test #4 invalid token", tokens, "Bearer wrong", http.StatusUnauthorized, ""},
+		{"Test #5 basic auth", tokens, "Basic c2VjcmV0", http.StatusUnauthorized, ""},
+		{"Test #6 anonymous", tokens, "", http.StatusOK, ""},
+		{"Test #7 broken token config", "broken", "Bearer secret", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotToken string
+			cfg := &config.ServerConfig{APITokens: tt.tokens}
+			handler := NewAuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotToken = identity.FromContext(r.Context()).Token
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+			assert.Equal(t, tt.wantToken, gotToken)
+		})
+	}
+}
+
+func TestNewScopeMiddleware(t *testing.T) {
+	cfg := &config.ServerConfig{APITokens: "agent:" + auth.HashToken("secret") + ":write"}
+
+	tests := []struct {
+		name           string
+		cfg            *config.ServerConfig
+		id             identity.Identity
+		scope          string
+		expectedStatus int
+	}{
+		{"Test #1 auth disabled", &config.ServerConfig{}, identity.Identity{}, auth.ScopeAdmin, http.StatusOK},
+		{"Test #2 scope granted", cfg, identity.Identity{Token: "agent", Scopes: []string{auth.ScopeWrite}}, auth.ScopeWrite, http.StatusOK},
+		{"Test #3 scope missing", cfg, identity.Identity{Token: "agent", Scopes: []string{auth.ScopeWrite}}, auth.ScopeAdmin, http.StatusForbidden},
+		{"Test #4 anonymous", cfg, identity.Identity{}, auth.ScopeRead, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewScopeMiddleware(tt.cfg, tt.scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req = req.WithContext(identity.WithIdentity(req.Context(), tt.id))
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+		})
+	}
+}
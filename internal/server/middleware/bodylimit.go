@@ -0,0 +1,120 @@
+// Package middleware provides HTTP middleware for the server, including request body size limits.
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/compression"
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+)
+
+// BodyTooLargeError is returned when reading a request body beyond a configured limit.
+type BodyTooLargeError struct {
+	Limit        int64
+	Decompressed bool
+}
+
+// Error describes the exceeded limit.
+func (e *BodyTooLargeError) Error() string {
+	if e.Decompressed {
+		return fmt.Sprintf("decompressed request body exceeds the limit of %d bytes", e.Limit)
+	}
+	return fmt.Sprintf("request body exceeds the limit of %d bytes", e.Limit)
+}
+
+// IsBodyTooLarge reports whether err was caused by a request body over a configured limit.
+func IsBodyTooLarge(err error) bool {
+	_, ok := AsBodyTooLarge(err)
+	return ok
+}
+
+// AsBodyTooLarge returns the exceeded limit when err was caused by a request body over a configured limit.
+func AsBodyTooLarge(err error) (*BodyTooLargeError, bool) {
+	var tooLarge *BodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		return tooLarge, true
+	}
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return &BodyTooLargeError{Limit: maxBytes.Limit}, true
+	}
+	return nil, false
+}
+
+// WriteBodyTooLarge responds with 413 and the exceeded limit when err was caused by a request body over
+// a configured limit. It reports whether a response was written.
+func WriteBodyTooLarge(w http.ResponseWriter, r *http.Request, err error) bool {
+	tooLarge, ok := AsBodyTooLarge(err)
+	if !ok {
+		return false
+	}
+
+	logger.Log.Warn("Request body too large", zap.Error(tooLarge))
+	WriteError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, tooLarge.Error(), nil)
+	return true
+}
+
+// limitedReader fails with a BodyTooLargeError once more than limit bytes are read.
+type limitedReader struct {
+	r            io.Reader
+	remaining    int64
+	limit        int64
+	decompressed bool
+}
+
+// Read reads from the underlying reader until the limit is exceeded.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, &BodyTooLargeError{Limit: l.limit, Decompressed: l.decompressed}
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), &BodyTooLargeError{Limit: l.limit, Decompressed: l.decompressed}
+	}
+	if errors.Is(err, compression.ErrDecodedSizeExceeded) {
+		return n, &BodyTooLargeError{Limit: l.limit, Decompressed: l.decompressed}
+	}
+	return n, err
+}
+
+// limitDecompressed limits the size of a decompressed request body. A non-positive limit disables it.
+func limitDecompressed(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, remaining: limit, limit: limit, decompressed: true}
+}
+
+// NewBodyLimitMiddleware returns a middleware rejecting request bodies over cfg.MaxBodySize bytes with 413.
+// Bodies with a declared Content-Length over the limit are rejected before they are read; others fail
+// once the limit is reached while reading. A non-positive limit disables the check.
+func NewBodyLimitMiddleware(cfg *config.ServerConfig) func(next http.Handler) http.Handler {
+	limit := cfg.MaxBodySize
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limit <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > limit {
+				WriteBodyTooLarge(w, r, &BodyTooLargeError{Limit: limit})
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/compression"
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+)
+
+func TestNewBodyLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int64
+		body          string
+		unknownLength bool
+		wantStatus    int
+	}{
+		{name: "Test #1 within limit", limit: 10, body: "0123456789", wantStatus: http.StatusOK},
+		{name: "Test #2 declared length over limit", limit: 10, body: "0123456789x", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "Test #3 streamed body over limit", limit: 10, body: "0123456789x", unknownLength: true, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "Test #4 disabled", limit: 0, body: strings.Repeat("x", 100), wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewBodyLimitMiddleware(&config.ServerConfig{MaxBodySize: tt.limit})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, err := io.ReadAll(r.Body); err != nil {
+					WriteBodyTooLarge(w, r, err)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(tt.body))
+			if tt.unknownLength {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusRequestEntityTooLarge {
+				var resp models.ErrorResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, CodePayloadTooLarge, resp.Code)
+				assert.Contains(t, resp.Message, "limit of 10 bytes")
+			}
+		})
+	}
+}
+
+func TestDecompressedLimit_GzipBomb(t *testing.T) {
+	bomb, err := compression.Compress(compression.Gzip, bytes.Repeat([]byte{'0'}, 10<<20))
+	require.NoError(t, err)
+	require.Less(t, len(bomb), 64<<10)
+
+	cfg := &config.ServerConfig{MaxBodySize: 64 << 10, MaxDecompressedSize: 1 << 20, SecretKey: "test key"}
+	reached := false
+	h := NewBodyLimitMiddleware(cfg)(NewCompressMiddleware(cfg)(NewHashMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))))
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(bomb))
+	req.Header.Set("Content-Encoding", compression.Gzip)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "decompressed request body exceeds the limit of 1048576 bytes")
+	assert.False(t, reached)
+}
+
+func TestDecompressedLimit_ZstdBomb(t *testing.T) {
+	bomb, err := compression.Compress(compression.Zstd, bytes.Repeat([]byte{'0'}, 10<<20))
+	require.NoError(t, err)
+	require.Less(t, len(bomb), 64<<10)
+
+	cfg := &config.ServerConfig{MaxBodySize: 64 << 10, MaxDecompressedSize: 1 << 20}
+	h := NewCompressMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		assert.True(t, IsBodyTooLarge(err), "the decoder refuses the frame before decoding it")
+		WriteBodyTooLarge(w, r, err)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(bomb))
+	req.Header.Set("Content-Encoding", compression.Zstd)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "decompressed request body exceeds the limit of 1048576 bytes")
+}
+
+func TestLimitedReader(t *testing.T) {
+	r := limitDecompressed(strings.NewReader("0123456789"), 10)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+
+	r = limitDecompressed(strings.NewReader("0123456789x"), 10)
+	data, err = io.ReadAll(r)
+	assert.True(t, IsBodyTooLarge(err))
+	assert.Equal(t, "0123456789", string(data))
+}
@@ -0,0 +1,28 @@
+// Package middleware provides HTTP middleware for the server, including client certificate identification.
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/tlsconfig"
+)
+
+// NewClientCertMiddleware returns a middleware that maps the subject of a verified client certificate
+// to the agent identity stored in the request context.
+func NewClientCertMiddleware() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			agent := tlsconfig.PeerIdentity(r.TLS)
+			if agent == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id := identity.FromContext(r.Context())
+			id.Agent = agent
+
+			next.ServeHTTP(w, r.WithContext(identity.WithIdentity(r.Context(), id)))
+		})
+	}
+}
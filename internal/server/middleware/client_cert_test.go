@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+func TestNewClientCertMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     *tls.ConnectionState
+		wantAgent string
+	}{
+		{
+			name:      "Test #1 plain HTTP",
+			state:     nil,
+			wantAgent: "",
+		},
+		{
+			name: "Test #2 verified certificate",
+			state: &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "agent-1"}}}},
+			},
+			wantAgent: "agent-1",
+		},
+		{
+			name: "Test #3 DNS name fallback",
+			state: &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{{DNSNames: []string{"host.example"}}}},
+			},
+			wantAgent: "host.example",
+		},
+		{
+			name: "Test #4 unverified certificate is ignored",
+			state: &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "spoofed"}}},
+			},
+			wantAgent: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := NewClientCertMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = identity.FromContext(r.Context()).Agent
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			req.TLS = tt.state
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.wantAgent, got)
+		})
+	}
+}
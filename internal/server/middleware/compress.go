@@ -0,0 +1,192 @@
+// Package middleware provides HTTP middleware for the server, including request and response compression.
+package middleware
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/compression"
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+)
+
+// defaultCompressCodecs are the response codecs offered when none are configured, in order of preference.
+var defaultCompressCodecs = []string{compression.Zstd, compression.Gzip, compression.Deflate}
+
+// compressWriter wraps http.ResponseWriter and compresses the response with the negotiated codec once
+// it reaches the minimum size. Smaller responses are sent as they are.
+type compressWriter struct {
+	http.ResponseWriter
+	codec   compression.Codec
+	minSize int
+	status  int
+	buf     []byte
+	writer  io.WriteCloser
+	plain   bool
+}
+
+// WriteHeader records the status code until the response encoding is decided.
+func (w *compressWriter) WriteHeader(status int) {
+	if w.writer != nil || w.plain {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write buffers data until the minimum size is reached, then writes compressed data to the response.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	switch {
+	case w.writer != nil:
+		return w.writer.Write(b)
+	case w.plain:
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) < w.minSize {
+		return len(b), nil
+	}
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// start decides the encoding of the response and writes the buffered data.
+func (w *compressWriter) start() error {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	header := w.Header()
+	compress := header.Get("Content-Encoding") == "" &&
+		status != http.StatusNoContent && status != http.StatusNotModified &&
+		len(w.buf) > 0 && len(w.buf) >= w.minSize
+
+	if !compress {
+		w.plain = true
+		w.ResponseWriter.WriteHeader(status)
+		_, err := w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+		return err
+	}
+
+	header.Set("Content-Encoding", w.codec.Name())
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+	w.writer = w.codec.NewWriter(w.ResponseWriter)
+	_, err := w.writer.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// Close flushes the response, sending buffered data uncompressed when it never reached the minimum size.
+func (w *compressWriter) Close() error {
+	if w.writer == nil && !w.plain {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	if w.writer != nil {
+		return w.writer.Close()
+	}
+	return nil
+}
+
+// NewCompressMiddleware returns a middleware that decompresses request bodies in any registered encoding,
+// up to cfg.MaxDecompressedSize bytes, and compresses responses of at least cfg.CompressMinSize bytes
+// with the codec from cfg.CompressCodecs the client prefers in its Accept-Encoding header.
+func NewCompressMiddleware(cfg *config.ServerConfig) func(next http.Handler) http.Handler {
+	codecs, err := compression.ParseCodecs(cfg.CompressCodecs)
+	if err != nil {
+		logger.Log.Error("Failed to parse compression codecs, using defaults", zap.Error(err))
+		codecs = nil
+	}
+	if len(codecs) == 0 {
+		codecs = defaultCompressCodecs
+	}
+	return newCompressMiddleware(codecs, cfg.CompressMinSize, cfg.MaxDecompressedSize)
+}
+
+// NewGzipMiddleware returns a middleware that transparently compresses and decompresses HTTP requests and responses using gzip.
+func NewGzipMiddleware() func(next http.Handler) http.Handler {
+	return newCompressMiddleware([]string{compression.Gzip}, 0, 0)
+}
+
+func newCompressMiddleware(codecs []string, minSize int, maxDecompressed int64) func(next http.Handler) http.Handler {
+	// zstd frames declare the memory their decoder allocates, so zstd bodies are decoded by a codec
+	// refusing frames larger than the decompressed size limit before allocating for them.
+	zstdCodec := compression.NewZstdCodec(maxDecompressed)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if encoding := r.Header.Get("Content-Encoding"); encoding != "" {
+				codec, ok := compression.Lookup(encoding)
+				if ok && codec.Name() == compression.Zstd {
+					codec = zstdCodec
+				}
+				if !ok {
+					logger.Log.Warn("Unsupported request encoding", zap.String("encoding", encoding))
+					WriteError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedEncoding, "unsupported content encoding", nil)
+					return
+				}
+
+				reader, err := codec.NewReader(r.Body)
+				if errors.Is(err, compression.ErrDecodedSizeExceeded) && maxDecompressed > 0 {
+					WriteBodyTooLarge(w, r, &BodyTooLargeError{Limit: maxDecompressed, Decompressed: true})
+					return
+				}
+				if err != nil {
+					WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "failed to read "+codec.Name()+" body", nil)
+					logger.Log.Error("Failed to read compressed body", zap.String("encoding", codec.Name()), zap.Error(err))
+					return
+				}
+				defer func() {
+					if err := reader.Close(); err != nil {
+						log.Printf("failed to close %s reader: %v", codec.Name(), err)
+					}
+				}()
+
+				r.Body = io.NopCloser(limitDecompressed(reader, maxDecompressed))
+				r.Header.Del("Content-Encoding")
+			}
+
+			name := compression.Negotiate(r.Header.Get("Accept-Encoding"), codecs)
+			w.Header().Add("Vary", "Accept-Encoding")
+			if name == compression.Identity || isStreamRequest(r) || strings.TrimSpace(r.Header.Get("Accept-Encoding")) == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			codec, _ := compression.Lookup(name)
+			cw := &compressWriter{
+				ResponseWriter: w,
+				codec:          codec,
+				minSize:        minSize,
+			}
+			defer func() {
+				if err := cw.Close(); err != nil {
+					log.Printf("failed to close %s writer: %v", codec.Name(), err)
+				}
+			}()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// isStreamRequest reports whether r opens a Server-Sent Events or WebSocket stream. Streams are not
+// compressed, as buffered compression would hold back their updates.
+func isStreamRequest(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/compression"
+	"github.com/a2sh3r/sysmetrics/internal/config"
+)
+
+func TestCompressWriter_Write(t *testing.T) {
+	codec, ok := compression.Lookup(compression.Gzip)
+	require.True(t, ok)
+	rec := httptest.NewRecorder()
+	w := &compressWriter{codec: codec, ResponseWriter: rec}
+
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	assert.Positive(t, rec.Body.Len())
+	assert.Equal(t, compression.Gzip, rec.Header().Get("Content-Encoding"))
+}
+
+func TestNewCompressMiddleware_Response(t *testing.T) {
+	large := strings.Repeat("metric ", 200)
+
+	tests := []struct {
+		name           string
+		cfg            *config.ServerConfig
+		acceptEncoding string
+		accept         string
+		upgrade        string
+		body           string
+		status         int
+		wantEncoding   string
+	}{
+		{
+			name:           "Test #1 preferred codec",
+			cfg:            &config.ServerConfig{},
+			acceptEncoding: "gzip, zstd",
+			body:           large,
+			wantEncoding:   compression.Zstd,
+		},
+		{
+			name:           "Test #2 client q-values",
+			cfg:            &config.ServerConfig{},
+			acceptEncoding: "zstd;q=0.2, deflate;q=0.9",
+			body:           large,
+			wantEncoding:   compression.Deflate,
+		},
+		{
+			name:           "Test #3 configured codecs",
+			cfg:            &config.ServerConfig{CompressCodecs: "gzip"},
+			acceptEncoding: "zstd, gzip;q=0.1",
+			body:           large,
+			wantEncoding:   compression.Gzip,
+		},
+		{
+			name:           "Test #4 below minimum size",
+			cfg:            &config.ServerConfig{CompressMinSize: 1024},
+			acceptEncoding: "gzip",
+			body:           "small",
+			status:         http.StatusCreated,
+		},
+		{
+			name:           "Test #5 above minimum size",
+			cfg:            &config.ServerConfig{CompressMinSize: 1024},
+			acceptEncoding: "gzip",
+			body:           large,
+			status:         http.StatusCreated,
+			wantEncoding:   compression.Gzip,
+		},
+		{
+			name:           "Test #6 nothing acceptable",
+			cfg:            &config.ServerConfig{},
+			acceptEncoding: "br",
+			body:           large,
+		},
+		{
+			name:           "Test #7 event stream",
+			cfg:            &config.ServerConfig{},
+			acceptEncoding: "gzip",
+			accept:         "text/event-stream",
+			body:           large,
+		},
+		{
+			name:           "Test #8 websocket upgrade",
+			cfg:            &config.ServerConfig{},
+			acceptEncoding: "gzip",
+			upgrade:        "websocket",
+			body:           large,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCompressMiddleware(tt.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				_, _ = io.WriteString(w, tt.body[:len(tt.body)/2])
+				_, _ = io.WriteString(w, tt.body[len(tt.body)/2:])
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			req.Header.Set("Accept", tt.accept)
+			req.Header.Set("Upgrade", tt.upgrade)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			wantStatus := tt.status
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			assert.Equal(t, wantStatus, rec.Code)
+			assert.Equal(t, tt.wantEncoding, rec.Header().Get("Content-Encoding"))
+			assert.Contains(t, rec.Header().Values("Vary"), "Accept-Encoding")
+
+			body := rec.Body.Bytes()
+			if tt.wantEncoding != "" {
+				codec, _ := compression.Lookup(tt.wantEncoding)
+				r, err := codec.NewReader(bytes.NewReader(body))
+				require.NoError(t, err)
+				body, err = io.ReadAll(r)
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.body, string(body))
+		})
+	}
+}
+
+func TestNewCompressMiddleware_Request(t *testing.T) {
+	payload := `[{"id":"Alloc","type":"gauge","value":1}]`
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       func(t *testing.T) []byte
+		wantStatus int
+	}{
+		{
+			name:     "Test #1 zstd request",
+			encoding: compression.Zstd,
+			body: func(t *testing.T) []byte {
+				data, err := compression.Compress(compression.Zstd, []byte(payload))
+				require.NoError(t, err)
+				return data
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:     "Test #2 deflate request",
+			encoding: compression.Deflate,
+			body: func(t *testing.T) []byte {
+				data, err := compression.Compress(compression.Deflate, []byte(payload))
+				require.NoError(t, err)
+				return data
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Test #3 identity request",
+			encoding:   compression.Identity,
+			body:       func(t *testing.T) []byte { return []byte(payload) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Test #4 unsupported encoding",
+			encoding:   "br",
+			body:       func(t *testing.T) []byte { return []byte(payload) },
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "Test #5 corrupt gzip body",
+			encoding:   compression.Gzip,
+			body:       func(t *testing.T) []byte { return []byte(payload) },
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := NewCompressMiddleware(&config.ServerConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				got = string(data)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(tt.body(t)))
+			req.Header.Set("Content-Encoding", tt.encoding)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, payload, got)
+			}
+		})
+	}
+}
+
+func TestNewGzipMiddleware(t *testing.T) {
+	tests := []struct {
+		name            string
+		acceptEncoding  string
+		contentEncoding string
+		wantGzip        bool
+	}{
+		{name: "Test #1 gzip response", acceptEncoding: compression.Gzip, wantGzip: true},
+		{name: "Test #2 no accepted encoding"},
+		{name: "Test #3 gzip request", contentEncoding: compression.Gzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte("hello")
+			if tt.contentEncoding != "" {
+				var err error
+				body, err = compression.Compress(tt.contentEncoding, body)
+				require.NoError(t, err)
+			}
+
+			var got string
+			h := NewGzipMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				got = string(data)
+				_, _ = w.Write([]byte("ok"))
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			req.Header.Set("Content-Encoding", tt.contentEncoding)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "hello", got)
+			if tt.wantGzip {
+				assert.Equal(t, compression.Gzip, rec.Header().Get("Content-Encoding"))
+			} else {
+				assert.Empty(t, rec.Header().Get("Content-Encoding"))
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Package middleware provides HTTP middleware for the server, including payload decryption.
+package middleware
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/encryption"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+)
+
+const EncryptionHeader = "Content-Encryption"
+
+// NewDecryptMiddleware returns a middleware that decrypts request bodies encrypted by the agent with the
+// server public key. It must run before the gzip and hash middlewares, which expect the plain body.
+func NewDecryptMiddleware(cfg *config.ServerConfig) func(next http.Handler) http.Handler {
+	var privateKey *rsa.PrivateKey
+	if cfg.CryptoKey != "" {
+		key, err := encryption.LoadPrivateKey(cfg.CryptoKey)
+		if err != nil {
+			logger.Log.Error("Failed to load private key", zap.String("path", cfg.CryptoKey), zap.Error(err))
+		}
+		privateKey = key
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme := r.Header.Get(EncryptionHeader)
+			if scheme == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if scheme != encryption.Scheme {
+				logger.Log.Warn("Unsupported encryption scheme", zap.String("scheme", scheme))
+				WriteError(w, r, http.StatusBadRequest, CodeInvalidEncryption, "unsupported encryption scheme", nil)
+				return
+			}
+
+			if privateKey == nil {
+				logger.Log.Warn("Received encrypted request but no private key is configured")
+				WriteError(w, r, http.StatusBadRequest, CodeInvalidEncryption, "encrypted payloads are not accepted", nil)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if WriteBodyTooLarge(w, r, err) {
+				return
+			}
+			if err != nil {
+				logger.Log.Error("Failed to read request body", zap.Error(err))
+				WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "failed to read request body", nil)
+				return
+			}
+
+			if err := r.Body.Close(); err != nil {
+				logger.Log.Error("Failed to close request body", zap.Error(err))
+				WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "failed to close request body", nil)
+				return
+			}
+
+			plain, err := encryption.Decrypt(privateKey, body)
+			if err != nil {
+				logger.Log.Error("Failed to decrypt request body", zap.Error(err))
+				WriteError(w, r, http.StatusBadRequest, CodeInvalidEncryption, "failed to decrypt request body", nil)
+				return
+			}
+
+			r.Header.Del(EncryptionHeader)
+			r.Header.Set("Content-Length", strconv.Itoa(len(plain)))
+			r.ContentLength = int64(len(plain))
+			r.Body = io.NopCloser(bytes.NewReader(plain))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/encryption"
+)
+
+func writePrivateKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "private.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	require.NoError(t, err)
+
+	return key, path
+}
+
+func TestNewDecryptMiddleware(t *testing.T) {
+	key, path := writePrivateKey(t)
+
+	encrypted, err := encryption.Encrypt(&key.PublicKey, []byte("secret body"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		cryptoKey      string
+		scheme         string
+		body           []byte
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Test #1 plain request passes through",
+			cryptoKey:      path,
+			body:           []byte("plain body"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "plain body",
+		},
+		{
+			name:           "Test #2 encrypted request is decrypted",
+			cryptoKey:      path,
+			scheme:         encryption.Scheme,
+			body:           encrypted,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "secret body",
+		},
+		{
+			name:           "Test #3 encrypted request without configured key",
+			scheme:         encryption.Scheme,
+			body:           encrypted,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Test #4 unknown scheme",
+			cryptoKey:      path,
+			scheme:         "rot13",
+			body:           encrypted,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Test #5 corrupted payload",
+			cryptoKey:      path,
+			scheme:         encryption.Scheme,
+			body:           []byte("garbage"),
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody []byte
+			handler := NewDecryptMiddleware(&config.ServerConfig{CryptoKey: tt.cryptoKey})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotBody, _ = io.ReadAll(r.Body)
+				assert.Empty(t, r.Header.Get(EncryptionHeader))
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(tt.body))
+			if tt.scheme != "" {
+				req.Header.Set(EncryptionHeader, tt.scheme)
+			}
+			rw := httptest.NewRecorder()
+
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedBody, string(gotBody))
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Package middleware provides HTTP middleware for the server, including the error responses it sends.
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+)
+
+// Error codes of the models.ErrorResponse bodies sent by the middleware.
+//
+//	Code                  Status  Cause
+//	invalid_request       400     a request body that cannot be read or decompressed
+//	invalid_signature     400     a missing or wrong request hash, or a replayed request
+//	invalid_encryption    400     an encrypted body that cannot be decrypted
+//	invalid_tenant        400     a malformed tenant header
+//	unauthorized          401     a missing or unknown API token
+//	forbidden             403     an untrusted address, a token without the route scope or another tenant
+//	payload_too_large     413     a request body over the configured size limits
+//	unsupported_encoding  415     an unknown Content-Encoding
+//	rate_limited          429     a client over its request rate, sent with a Retry-After header
+//	replay_cache_full     503     a signed request while the nonce cache is full of nonces within the replay window
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeInvalidSignature    = "invalid_signature"
+	CodeInvalidEncryption   = "invalid_encryption"
+	CodeInvalidTenant       = "invalid_tenant"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodePayloadTooLarge     = "payload_too_large"
+	CodeUnsupportedEncoding = "unsupported_encoding"
+	CodeRateLimited         = "rate_limited"
+	CodeReplayCacheFull     = "replay_cache_full"
+)
+
+// WriteError responds with a models.ErrorResponse carrying the request ID of r. It is shared by the
+// middleware and the handlers, so that every error of the API has the same envelope.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	requestID := RequestID(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(models.ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestID,
+	}); err != nil {
+		logger.Log.Error("Failed to write error response", zap.Error(err))
+	}
+}
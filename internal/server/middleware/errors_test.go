@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/models"
+)
+
+func TestWriteError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/update/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, "req-1"))
+	rec := httptest.NewRecorder()
+
+	WriteError(rec, req, http.StatusForbidden, CodeForbidden, "forbidden", nil)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var resp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, models.ErrorResponse{Code: CodeForbidden, Message: "forbidden", RequestID: "req-1"}, resp)
+}
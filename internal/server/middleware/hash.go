@@ -3,8 +3,11 @@ package middleware
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -13,44 +16,174 @@ import (
 	"github.com/a2sh3r/sysmetrics/internal/logger"
 )
 
-const HashHeader = "HashSHA256"
+const (
+	HashHeader      = "HashSHA256"
+	HashKeyIDHeader = "HashKeyID"
+	TimestampHeader = "X-Request-Timestamp"
+	NonceHeader     = "X-Request-Nonce"
+)
+
+var (
+	errMissingHash          = errors.New("missing request hash")
+	errMissingReplayHeaders = errors.New("missing request timestamp or nonce")
+	errInvalidTimestamp     = errors.New("invalid request timestamp")
+	errTimestampOutOfWindow = errors.New("request timestamp outside allowed window")
+	errNonceReused          = errors.New("request nonce already used")
+)
+
+// RequestVerifier verifies request signatures with the configured keys and rejects replayed requests.
+// It is shared by the HTTP and gRPC transports.
+type RequestVerifier struct {
+	keyring       *hash.Keyring
+	window        time.Duration
+	nonces        *nonceCache
+	allowUnsigned bool
+}
+
+// NewRequestVerifier creates a RequestVerifier from the server key and replay protection settings.
+func NewRequestVerifier(cfg *config.ServerConfig) *RequestVerifier {
+	keys, err := hash.ParseKeys(cfg.SecretKeys)
+	if err != nil {
+		logger.Log.Error("Failed to parse secret keys", zap.Error(err))
+	}
+
+	window := time.Duration(cfg.ReplayWindow) * time.Second
+	return &RequestVerifier{
+		keyring:       hash.NewKeyring(cfg.SecretKey, keys, cfg.LegacyHash),
+		window:        window,
+		nonces:        newNonceCache(cfg.NonceCacheSize, 2*window),
+		allowUnsigned: cfg.AllowUnsigned,
+	}
+}
+
+// Enabled reports whether any key is configured.
+func (v *RequestVerifier) Enabled() bool {
+	return v.keyring.Enabled()
+}
+
+// Verify checks gotHash over body, bound to timestamp and nonce when they are set, with the key
+// registered under keyID. When a replay window is configured the timestamp and nonce are checked as well.
+// Requests with a legacy hash are checked only when they carry a timestamp or nonce, since legacy
+// clients send neither; in compatibility mode requests without them can therefore be replayed.
+// Requests without a hash are rejected unless unsigned requests are allowed.
+func (v *RequestVerifier) Verify(body []byte, keyID, gotHash, timestamp, nonce string) error {
+	if gotHash == "" {
+		if v.allowUnsigned {
+			return nil
+		}
+		logger.Log.Warn("Unsigned request rejected")
+		return errMissingHash
+	}
+
+	data := string(body)
+	if timestamp != "" || nonce != "" {
+		data = hash.SignedPayload(timestamp, nonce, data)
+	}
+
+	legacy, err := v.keyring.Verify(data, keyID, gotHash)
+	if err != nil {
+		logger.Log.Error("Hash verification failed", zap.String("key_id", keyID), zap.Error(err))
+		return err
+	}
+	if legacy {
+		logger.Log.Warn("Request signed with legacy hash", zap.String("key_id", keyID))
+	}
+
+	if v.window <= 0 {
+		return nil
+	}
+	if legacy && timestamp == "" && nonce == "" {
+		logger.Log.Warn("Legacy request without timestamp and nonce accepted without replay protection", zap.String("key_id", keyID))
+		return nil
+	}
+	if err := checkReplay(timestamp, nonce, v.window, v.nonces); err != nil {
+		logger.Log.Warn("Replay protection rejected request", zap.String("key_id", keyID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// AllowsUnsigned reports whether unsigned requests are accepted while keys are configured.
+func (v *RequestVerifier) AllowsUnsigned() bool {
+	return v.allowUnsigned
+}
+
+// VerifyKeyed checks gotHash over data with the key registered under keyID without replay protection.
+// It is used for messages bound to an already verified request, such as the messages of a stream.
+func (v *RequestVerifier) VerifyKeyed(data string, keyID, gotHash string) error {
+	_, err := v.keyring.Verify(data, keyID, gotHash)
+	return err
+}
+
+// CheckReplay checks the timestamp and nonce of a request when a replay window is configured.
+func (v *RequestVerifier) CheckReplay(timestamp, nonce string) error {
+	if v.window <= 0 {
+		return nil
+	}
+	return checkReplay(timestamp, nonce, v.window, v.nonces)
+}
+
+// Sign signs data with the key registered under keyID.
+func (v *RequestVerifier) Sign(data string, keyID string) (string, error) {
+	return v.keyring.Sign(data, keyID)
+}
 
 // NewHashMiddleware returns a middleware that verifies and sets a hash header for requests and responses.
+// Requests are verified with the key selected by the HashKeyID header, so several keys can be active during rotation.
+// When keys are configured, requests other than GET and HEAD must be signed unless cfg.AllowUnsigned is set.
+// When cfg.ReplayWindow is set, signed requests must also carry a signed timestamp within the window
+// and a nonce that has not been seen during it; while the nonces seen fill cfg.NonceCacheSize,
+// requests are refused with 503 Service Unavailable.
 func NewHashMiddleware(cfg *config.ServerConfig) func(next http.Handler) http.Handler {
+	verifier := NewRequestVerifier(cfg)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-			if cfg.SecretKey == "" {
+			if !verifier.Enabled() {
 				next.ServeHTTP(w, r)
 				return
 			}
 
 			body, err := io.ReadAll(r.Body)
+			if WriteBodyTooLarge(w, r, err) {
+				return
+			}
 			if err != nil {
 				logger.Log.Error("Failed to read request body", zap.Error(err))
-				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "failed to read request body", nil)
 				return
 			}
 
 			err = r.Body.Close()
 			if err != nil {
 				logger.Log.Error("Failed to close request body", zap.Error(err))
-				http.Error(w, "Failed to close request body", http.StatusBadRequest)
+				WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "failed to close request body", nil)
 				return
 			}
 
+			keyID := r.Header.Get(HashKeyIDHeader)
 			gotHash := r.Header.Get(HashHeader)
-			if gotHash != "" {
-				if err := hash.VerifyHash(string(body), cfg.SecretKey, gotHash); err != nil {
-					logger.Log.Error("Hash verification failed", zap.Error(err))
-					http.Error(w, "Hash verification failed", http.StatusBadRequest)
+			if gotHash != "" || !isSafeMethod(r.Method) {
+				err := verifier.Verify(body, keyID, gotHash, r.Header.Get(TimestampHeader), r.Header.Get(NonceHeader))
+				switch {
+				case errors.Is(err, ErrNonceCacheFull):
+					WriteError(w, r, http.StatusServiceUnavailable, CodeReplayCacheFull, err.Error(), nil)
+					return
+				case errors.Is(err, hash.ErrHashMismatch), errors.Is(err, hash.ErrUnknownKeyID):
+					WriteError(w, r, http.StatusBadRequest, CodeInvalidSignature, "hash verification failed", nil)
+					return
+				case err != nil:
+					WriteError(w, r, http.StatusBadRequest, CodeInvalidSignature, err.Error(), nil)
 					return
 				}
 			}
 
 			rw := &hashResponseWriter{
 				ResponseWriter: w,
-				secretKey:      cfg.SecretKey,
+				keyring:        verifier.keyring,
+				keyID:          keyID,
 			}
 
 			r.Body = io.NopCloser(io.Reader(bytes.NewReader(body)))
@@ -60,21 +193,49 @@ func NewHashMiddleware(cfg *config.ServerConfig) func(next http.Handler) http.Ha
 	}
 }
 
+// isSafeMethod reports whether a request method only reads, so that it may be sent unsigned.
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// checkReplay rejects requests whose signed timestamp is outside the allowed skew window
+// or whose nonce was already used, and refuses them while the nonce cache is full.
+func checkReplay(timestamp string, nonce string, window time.Duration, nonces *nonceCache) error {
+	if timestamp == "" || nonce == "" {
+		return errMissingReplayHeaders
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errInvalidTimestamp
+	}
+
+	skew := time.Since(time.Unix(unix, 0))
+	if skew > window || skew < -window {
+		return errTimestampOutOfWindow
+	}
+
+	return nonces.Add(nonce)
+}
+
 // hashResponseWriter wraps http.ResponseWriter and adds hash header logic.
 type hashResponseWriter struct {
 	http.ResponseWriter
-	secretKey     string
+	keyring       *hash.Keyring
+	keyID         string
 	body          []byte
 	headerWritten bool
 	statusCode    int
 }
 
-// Write writes the response and sets the hash header if a secret key is provided.
+// Write writes the response and sets the hash header signed with the key the request was verified with.
 func (rw *hashResponseWriter) Write(b []byte) (int, error) {
 	rw.body = b
-	if rw.secretKey != "" {
-		calculateHash := hash.CalculateHash(string(b), rw.secretKey)
+	if calculateHash, err := rw.keyring.Sign(string(b), rw.keyID); err == nil {
 		rw.Header().Set(HashHeader, calculateHash)
+		if rw.keyID != "" {
+			rw.Header().Set(HashKeyIDHeader, rw.keyID)
+		}
 	}
 	return rw.ResponseWriter.Write(b)
 }
@@ -87,3 +248,8 @@ func (rw *hashResponseWriter) WriteHeader(statusCode int) {
 		rw.ResponseWriter.WriteHeader(statusCode)
 	}
 }
+
+// Unwrap returns the wrapped writer, so that http.ResponseController reaches its Flush and Hijack methods.
+func (rw *hashResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/a2sh3r/sysmetrics/internal/config"
 	"github.com/a2sh3r/sysmetrics/internal/hash"
@@ -15,6 +17,8 @@ func TestHashMiddleware(t *testing.T) {
 	tests := []struct {
 		name               string
 		secretKey          string
+		allowUnsigned      bool
+		method             string
 		requestBody        string
 		requestHash        string
 		expectedStatus     int
@@ -49,6 +53,23 @@ func TestHashMiddleware(t *testing.T) {
 			secretKey:          "test key",
 			requestBody:        "test data",
 			requestHash:        "",
+			expectedStatus:     http.StatusBadRequest,
+			expectResponseHash: false,
+		},
+		{
+			name:               "Test #5 missing hash allowed",
+			secretKey:          "test key",
+			allowUnsigned:      true,
+			requestBody:        "test data",
+			requestHash:        "",
+			expectedStatus:     http.StatusOK,
+			expectResponseHash: true,
+		},
+		{
+			name:               "Test #6 unsigned read",
+			secretKey:          "test key",
+			method:             http.MethodGet,
+			requestHash:        "",
 			expectedStatus:     http.StatusOK,
 			expectResponseHash: true,
 		},
@@ -57,7 +78,8 @@ func TestHashMiddleware(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &config.ServerConfig{
-				SecretKey: tt.secretKey,
+				SecretKey:     tt.secretKey,
+				AllowUnsigned: tt.allowUnsigned,
 			}
 
 			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -68,7 +90,11 @@ func TestHashMiddleware(t *testing.T) {
 			server := httptest.NewServer(middleware(handler))
 			defer server.Close()
 
-			req, err := http.NewRequest("POST", server.URL, bytes.NewBufferString(tt.requestBody))
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req, err := http.NewRequest(method, server.URL, bytes.NewBufferString(tt.requestBody))
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -134,3 +160,231 @@ func TestNewHashMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestHashMiddleware_KeyRotation(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            *config.ServerConfig
+		keyID          string
+		requestHash    string
+		expectedStatus int
+		responseKey    string
+	}{
+		{
+			name:           "Test #1 rotated key",
+			cfg:            &config.ServerConfig{SecretKey: "old", SecretKeys: "v2:new"},
+			keyID:          "v2",
+			requestHash:    hash.CalculateHash("test data", "new"),
+			expectedStatus: http.StatusOK,
+			responseKey:    "new",
+		},
+		{
+			name:           "Test #2 rotated key only",
+			cfg:            &config.ServerConfig{SecretKeys: "v2:new"},
+			keyID:          "v2",
+			requestHash:    hash.CalculateHash("test data", "new"),
+			expectedStatus: http.StatusOK,
+			responseKey:    "new",
+		},
+		{
+			name:           "Test #3 unknown key id",
+			cfg:            &config.ServerConfig{SecretKey: "old", SecretKeys: "v2:new"},
+			keyID:          "v3",
+			requestHash:    hash.CalculateHash("test data", "new"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Test #4 legacy hash rejected",
+			cfg:            &config.ServerConfig{SecretKey: "old"},
+			requestHash:    hash.CalculateLegacyHash("test data", "old"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Test #5 legacy hash accepted in compatibility mode",
+			cfg:            &config.ServerConfig{SecretKey: "old", LegacyHash: true},
+			requestHash:    hash.CalculateLegacyHash("test data", "old"),
+			expectedStatus: http.StatusOK,
+			responseKey:    "old",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHashMiddleware(tt.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("response"))
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("test data"))
+			req.Header.Set(HashHeader, tt.requestHash)
+			if tt.keyID != "" {
+				req.Header.Set(HashKeyIDHeader, tt.keyID)
+			}
+			rw := httptest.NewRecorder()
+
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+			if tt.responseKey != "" {
+				assert.Equal(t, hash.CalculateHash("response", tt.responseKey), rw.Header().Get(HashHeader))
+				assert.Equal(t, tt.keyID, rw.Header().Get(HashKeyIDHeader))
+			}
+		})
+	}
+}
+
+func TestHashMiddleware_ReplayProtection(t *testing.T) {
+	cfg := &config.ServerConfig{SecretKey: "key", ReplayWindow: 60, NonceCacheSize: 100}
+	handler := NewHashMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name           string
+		timestamp      string
+		nonce          string
+		signedAs       string
+		expectedStatus int
+	}{
+		{
+			name:           "Test #1 fresh request",
+			timestamp:      now,
+			nonce:          "n1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Test #2 replayed nonce",
+			timestamp:      now,
+			nonce:          "n1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Test #3 timestamp outside window",
+			timestamp:      old,
+			nonce:          "n2",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Test #4 missing nonce and timestamp",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Test #5 timestamp not covered by signature",
+			timestamp:      now,
+			nonce:          "n3",
+			signedAs:       hash.SignedPayload(old, "n3", "body"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Test #6 invalid timestamp",
+			timestamp:      "yesterday",
+			nonce:          "n4",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := tt.signedAs
+			if signed == "" {
+				signed = "body"
+				if tt.timestamp != "" || tt.nonce != "" {
+					signed = hash.SignedPayload(tt.timestamp, tt.nonce, "body")
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("body"))
+			req.Header.Set(HashHeader, hash.CalculateHash(signed, "key"))
+			if tt.timestamp != "" {
+				req.Header.Set(TimestampHeader, tt.timestamp)
+			}
+			if tt.nonce != "" {
+				req.Header.Set(NonceHeader, tt.nonce)
+			}
+			rw := httptest.NewRecorder()
+
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+		})
+	}
+}
+
+func TestHashMiddleware_ReplayProtection_Legacy(t *testing.T) {
+	cfg := &config.ServerConfig{SecretKey: "key", LegacyHash: true, ReplayWindow: 60, NonceCacheSize: 100}
+	handler := NewHashMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	tests := []struct {
+		name           string
+		timestamp      string
+		nonce          string
+		expectedStatus int
+	}{
+		{name: "Test #1 fresh request", timestamp: now, nonce: "n1", expectedStatus: http.StatusOK},
+		{name: "Test #2 replayed nonce", timestamp: now, nonce: "n1", expectedStatus: http.StatusBadRequest},
+		{name: "Test #3 nonce without timestamp", nonce: "n2", expectedStatus: http.StatusBadRequest},
+		{name: "Test #4 without timestamp and nonce", expectedStatus: http.StatusOK},
+		{name: "Test #5 without timestamp and nonce replayed", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := "body"
+			if tt.timestamp != "" || tt.nonce != "" {
+				signed = hash.SignedPayload(tt.timestamp, tt.nonce, "body")
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("body"))
+			req.Header.Set(HashHeader, hash.CalculateLegacyHash(signed, "key"))
+			if tt.timestamp != "" {
+				req.Header.Set(TimestampHeader, tt.timestamp)
+			}
+			if tt.nonce != "" {
+				req.Header.Set(NonceHeader, tt.nonce)
+			}
+			rw := httptest.NewRecorder()
+
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+		})
+	}
+}
+
+func TestHashMiddleware_ReplayProtection_CacheFull(t *testing.T) {
+	cfg := &config.ServerConfig{SecretKey: "key", ReplayWindow: 60, NonceCacheSize: 2}
+	handler := NewHashMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	tests := []struct {
+		name           string
+		nonce          string
+		expectedStatus int
+	}{
+		{name: "Test #1 first nonce", nonce: "n1", expectedStatus: http.StatusOK},
+		{name: "Test #2 second nonce", nonce: "n2", expectedStatus: http.StatusOK},
+		{name: "Test #3 cache full", nonce: "n3", expectedStatus: http.StatusServiceUnavailable},
+		{name: "Test #4 live nonce replayed", nonce: "n1", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("body"))
+			req.Header.Set(HashHeader, hash.CalculateHash(hash.SignedPayload(now, tt.nonce, "body"), "key"))
+			req.Header.Set(TimestampHeader, now)
+			req.Header.Set(NonceHeader, tt.nonce)
+			rw := httptest.NewRecorder()
+
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+// InstanceHeader is the HTTP header agents announce their instance ID with.
+const InstanceHeader = "X-Agent-Instance"
+
+// NewInstanceMiddleware returns a middleware that records the agent instance ID of the X-Agent-Instance
+// header in the request identity. Invalid IDs are rejected with 400.
+func NewInstanceMiddleware() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			instance := r.Header.Get(InstanceHeader)
+			if instance == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !identity.ValidInstance(instance) {
+				WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid agent instance", nil)
+				return
+			}
+
+			id := identity.FromContext(r.Context())
+			id.Instance = instance
+			next.ServeHTTP(w, r.WithContext(identity.WithIdentity(r.Context(), id)))
+		})
+	}
+}
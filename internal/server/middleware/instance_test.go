@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+func TestNewInstanceMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       string
+		wantStatus   int
+		wantInstance string
+	}{
+		{name: "Test #1 no header", wantStatus: http.StatusOK},
+		{name: "Test #2 host name", header: "node-1.example.com", wantStatus: http.StatusOK, wantInstance: "node-1.example.com"},
+		{name: "Test #3 invalid characters", header: "node 1", wantStatus: http.StatusBadRequest},
+		{name: "Test #4 too long", header: strings.Repeat("a", 254), wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := NewInstanceMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = identity.FromContext(r.Context()).Instance
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			if tt.header != "" {
+				req.Header.Set(InstanceHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantInstance, got)
+		})
+	}
+}
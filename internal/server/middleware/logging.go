@@ -30,7 +30,13 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseStatus = statusCode
 }
 
+// Unwrap returns the wrapped writer, so that http.ResponseController reaches its Flush and Hijack methods.
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 type logEntry struct {
+	id       string
 	method   string
 	path     string
 	status   int
@@ -44,6 +50,7 @@ func init() {
 	go func() {
 		for entry := range logChan {
 			logger.Log.Info("HTTP request",
+				zap.String("request_id", entry.id),
 				zap.String("method", entry.method),
 				zap.String("path", entry.path),
 				zap.Int("status", entry.status),
@@ -71,6 +78,7 @@ func NewLoggingMiddleware() func(next http.Handler) http.Handler {
 
 			select {
 			case logChan <- logEntry{
+				id:       RequestID(r.Context()),
 				method:   r.Method,
 				path:     r.URL.Path,
 				status:   lw.responseStatus,
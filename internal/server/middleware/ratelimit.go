@@ -0,0 +1,222 @@
+// Package middleware provides HTTP middleware for the server, including per-client rate limiting.
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+// Client identities the rate limiter can key buckets by.
+const (
+	RateLimitKeyAuto   = "auto"
+	RateLimitKeyIP     = "ip"
+	RateLimitKeyToken  = "token"
+	RateLimitKeyTenant = "tenant"
+)
+
+// maxRateLimitBuckets bounds the number of tracked clients. Idle buckets are dropped once it is reached.
+const maxRateLimitBuckets = 10000
+
+// bucket is the token bucket of a single client.
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	allowed  uint64
+	rejected uint64
+}
+
+// ClientUsage describes the rate limiter state of a single client.
+type ClientUsage struct {
+	Client   string  `json:"client"`
+	Tokens   float64 `json:"tokens"`
+	Allowed  uint64  `json:"allowed"`
+	Rejected uint64  `json:"rejected"`
+}
+
+// RateLimiter limits the request rate of every client with a token bucket.
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	key     string
+	proxies []*net.IPNet
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+// ParseRateLimitKey validates a rate limiter key mode. The empty string selects RateLimitKeyAuto.
+func ParseRateLimitKey(key string) (string, error) {
+	switch key {
+	case "":
+		return RateLimitKeyAuto, nil
+	case RateLimitKeyAuto, RateLimitKeyIP, RateLimitKeyToken, RateLimitKeyTenant:
+		return key, nil
+	default:
+		return "", fmt.Errorf("unknown rate limit key %q", key)
+	}
+}
+
+// NewRateLimiter creates a RateLimiter allowing cfg.RateLimit requests per second with bursts of
+// cfg.RateBurst requests per client. Rate limiting is disabled when cfg.RateLimit is not positive.
+func NewRateLimiter(cfg *config.ServerConfig) *RateLimiter {
+	key, err := ParseRateLimitKey(cfg.RateLimitKey)
+	if err != nil {
+		logger.Log.Error("Invalid rate limit key, limiting by IP", zap.Error(err))
+		key = RateLimitKeyIP
+	}
+
+	proxies, err := ParseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		proxies = nil
+	}
+
+	burst := float64(cfg.RateBurst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(cfg.RateLimit))
+	}
+
+	return &RateLimiter{
+		rate:    cfg.RateLimit,
+		burst:   burst,
+		key:     key,
+		proxies: proxies,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Enabled reports whether the limiter restricts requests.
+func (l *RateLimiter) Enabled() bool {
+	return l != nil && l.rate > 0
+}
+
+// Middleware returns a middleware rejecting requests over the client's rate with 429 and a Retry-After header.
+func (l *RateLimiter) Middleware() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := l.ClientKey(identity.FromContext(r.Context()), RealIP(r, l.proxies))
+			ok, retryAfter := l.Allow(client)
+			if !ok {
+				logger.Log.Warn("Rate limit exceeded", zap.String("client", client), zap.String("path", r.URL.Path))
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				WriteError(w, r, http.StatusTooManyRequests, CodeRateLimited, "too many requests", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Allow takes a token from the client's bucket. When the bucket is empty it returns false and the time
+// until the next token is available.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.evictIdle(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	l.refill(b, now)
+
+	if b.tokens < 1 {
+		b.rejected++
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		if wait < time.Second {
+			wait = time.Second
+		}
+		return false, wait
+	}
+
+	b.tokens--
+	b.allowed++
+	return true, 0
+}
+
+// Usage returns the state of every tracked client ordered by client key.
+func (l *RateLimiter) Usage() []ClientUsage {
+	if !l.Enabled() {
+		return []ClientUsage{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	usage := make([]ClientUsage, 0, len(l.buckets))
+	for client, b := range l.buckets {
+		l.refill(b, now)
+		usage = append(usage, ClientUsage{
+			Client:   client,
+			Tokens:   b.tokens,
+			Allowed:  b.allowed,
+			Rejected: b.rejected,
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Client < usage[j].Client })
+	return usage
+}
+
+func (l *RateLimiter) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+}
+
+// evictIdle drops the buckets that have refilled completely: they hold no state worth keeping.
+func (l *RateLimiter) evictIdle(now time.Time) {
+	for client, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// ClientKey identifies the client of a request with the given identity and IP. In auto mode the most
+// specific identity available is used: the API token, then the client certificate, then the client IP.
+func (l *RateLimiter) ClientKey(id identity.Identity, ip net.IP) string {
+	switch l.key {
+	case RateLimitKeyTenant:
+		return "tenant:" + id.Tenant
+	case RateLimitKeyToken:
+		if id.Token != "" {
+			return "token:" + id.Token
+		}
+	case RateLimitKeyAuto:
+		if id.Token != "" {
+			return "token:" + id.Token
+		}
+		if id.Agent != "" {
+			return "agent:" + id.Agent
+		}
+	}
+
+	return "ip:" + ip.String()
+}
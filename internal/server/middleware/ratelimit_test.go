@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewRateLimiter(&config.ServerConfig{RateLimit: 2, RateBurst: 3})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("ip:10.0.0.1")
+		assert.True(t, ok, "request %d within burst", i+1)
+	}
+
+	ok, retryAfter := l.Allow("ip:10.0.0.1")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, retryAfter)
+
+	ok, _ = l.Allow("ip:10.0.0.2")
+	assert.True(t, ok, "clients have separate buckets")
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("ip:10.0.0.1")
+	assert.True(t, ok, "bucket refills at the configured rate")
+
+	usage := l.Usage()
+	require.Len(t, usage, 2)
+	assert.Equal(t, "ip:10.0.0.1", usage[0].Client)
+	assert.Equal(t, uint64(4), usage[0].Allowed)
+	assert.Equal(t, uint64(1), usage[0].Rejected)
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        *config.ServerConfig
+		id         identity.Identity
+		wantStatus []int
+		wantClient string
+	}{
+		{
+			name:       "Test #1 disabled",
+			cfg:        &config.ServerConfig{},
+			wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+		{
+			name:       "Test #2 limited by IP",
+			cfg:        &config.ServerConfig{RateLimit: 1},
+			wantStatus: []int{http.StatusOK, http.StatusTooManyRequests},
+			wantClient: "ip:192.0.2.1",
+		},
+		{
+			name:       "Test #3 auto prefers token",
+			cfg:        &config.ServerConfig{RateLimit: 1, RateBurst: 2},
+			id:         identity.Identity{Token: "agent", Agent: "host-1"},
+			wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+			wantClient: "token:agent",
+		},
+		{
+			name:       "Test #4 auto falls back to client certificate",
+			cfg:        &config.ServerConfig{RateLimit: 1},
+			id:         identity.Identity{Agent: "host-1"},
+			wantStatus: []int{http.StatusOK, http.StatusTooManyRequests},
+			wantClient: "agent:host-1",
+		},
+		{
+			name:       "Test #5 limited by tenant",
+			cfg:        &config.ServerConfig{RateLimit: 1, RateLimitKey: RateLimitKeyTenant},
+			id:         identity.Identity{Token: "agent", Tenant: "team-a"},
+			wantStatus: []int{http.StatusOK, http.StatusTooManyRequests},
+			wantClient: "tenant:team-a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(tt.cfg)
+			handler := l.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			for i, want := range tt.wantStatus {
+				req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+				req.RemoteAddr = "192.0.2.1:1234"
+				req = req.WithContext(identity.WithIdentity(req.Context(), tt.id))
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				assert.Equal(t, want, rec.Code, "request %d", i+1)
+				if want == http.StatusTooManyRequests {
+					assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+				}
+			}
+
+			if tt.wantClient != "" {
+				usage := l.Usage()
+				require.Len(t, usage, 1)
+				assert.Equal(t, tt.wantClient, usage[0].Client)
+			}
+		})
+	}
+}
+
+func TestParseRateLimitKey(t *testing.T) {
+	key, err := ParseRateLimitKey("")
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitKeyAuto, key)
+
+	key, err = ParseRateLimitKey(RateLimitKeyTenant)
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitKeyTenant, key)
+
+	_, err = ParseRateLimitKey("user")
+	assert.Error(t, err)
+}
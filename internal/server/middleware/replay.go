@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNonceCacheFull is returned for a request arriving while the nonce cache is full of nonces
+// seen within the replay window. Evicting them would let their requests be replayed.
+var ErrNonceCacheFull = errors.New("request nonce cache full")
+
+// nonceEntry is a nonce remembered by nonceCache together with the time it was seen.
+type nonceEntry struct {
+	nonce  string
+	seenAt time.Time
+}
+
+// nonceCache remembers recently seen request nonces. Entries expire after ttl; once the cache holds
+// size live nonces new ones are refused until some expire, so memory stays bounded.
+type nonceCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+// newNonceCache creates a nonceCache holding at most size nonces for ttl.
+func newNonceCache(size int, ttl time.Duration) *nonceCache {
+	return &nonceCache{
+		ttl:     ttl,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Add records the nonce. It returns errNonceReused when the nonce was seen before and
+// ErrNonceCacheFull when the cache holds size nonces that have not expired.
+func (c *nonceCache) Add(nonce string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.evictExpired(now)
+
+	if _, seen := c.entries[nonce]; seen {
+		return errNonceReused
+	}
+
+	if c.size > 0 && c.order.Len() >= c.size {
+		return ErrNonceCacheFull
+	}
+
+	c.entries[nonce] = c.order.PushBack(nonceEntry{nonce: nonce, seenAt: now})
+	return nil
+}
+
+// Len returns the number of remembered nonces.
+func (c *nonceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *nonceCache) evictExpired(now time.Time) {
+	for front := c.order.Front(); front != nil; front = c.order.Front() {
+		if now.Sub(front.Value.(nonceEntry).seenAt) <= c.ttl {
+			return
+		}
+		c.removeOldest()
+	}
+}
+
+func (c *nonceCache) removeOldest() {
+	front := c.order.Front()
+	if front == nil {
+		return
+	}
+	c.order.Remove(front)
+	delete(c.entries, front.Value.(nonceEntry).nonce)
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNonceCache_Add(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newNonceCache(10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	assert.NoError(t, c.Add("a"))
+	assert.ErrorIs(t, c.Add("a"), errNonceReused)
+	assert.NoError(t, c.Add("b"))
+
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, c.Add("a"), "expired nonce must be forgotten")
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestNonceCache_Bounded(t *testing.T) {
+	c := newNonceCache(3, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.Add(fmt.Sprintf("nonce-%d", i)))
+	}
+
+	assert.Equal(t, 3, c.Len())
+	assert.ErrorIs(t, c.Add("nonce-3"), ErrNonceCacheFull, "live nonces must not be evicted")
+	assert.ErrorIs(t, c.Add("nonce-0"), errNonceReused, "a live nonce must not be accepted twice")
+	assert.Equal(t, 3, c.Len())
+}
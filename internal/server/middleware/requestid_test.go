@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		wantKept  bool
+		wantGenID bool
+	}{
+		{name: "Test #1 client ID is kept", header: "abc-123", wantKept: true},
+		{name: "Test #2 missing ID is generated", header: "", wantGenID: true},
+		{name: "Test #3 ID with spaces is replaced", header: "abc 123", wantGenID: true},
+		{name: "Test #4 overlong ID is replaced", header: strings.Repeat("a", 129), wantGenID: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := NewRequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = RequestID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, got, rec.Header().Get(RequestIDHeader))
+			if tt.wantKept {
+				assert.Equal(t, tt.header, got)
+			}
+			if tt.wantGenID {
+				assert.Len(t, got, 32)
+			}
+		})
+	}
+}
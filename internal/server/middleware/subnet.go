@@ -0,0 +1,112 @@
+// Package middleware provides HTTP middleware for the server, including trusted subnet checks.
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+)
+
+const RealIPHeader = "X-Real-IP"
+
+// ParseCIDRs parses a comma-separated list of CIDR subnets.
+func ParseCIDRs(s string) ([]*net.IPNet, error) {
+	var subnets []*net.IPNet
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet %q: %w", part, err)
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+// NewTrustedSubnetMiddleware returns a middleware that rejects requests whose client IP is outside the
+// given comma-separated CIDR list with 403. An empty list allows every client. Forwarded headers are only
+// trusted when the request comes directly from one of the proxies subnets.
+func NewTrustedSubnetMiddleware(subnets string, proxies string) func(next http.Handler) http.Handler {
+	allowed, err := ParseCIDRs(subnets)
+	if err != nil {
+		logger.Log.Error("Failed to parse trusted subnets, rejecting all requests", zap.Error(err))
+		allowed = []*net.IPNet{}
+	}
+	trustedProxies, err := ParseCIDRs(proxies)
+	if err != nil {
+		logger.Log.Error("Failed to parse trusted proxies, ignoring forwarded headers", zap.Error(err))
+		trustedProxies = nil
+	}
+	enabled := subnets != ""
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ip := RealIP(r, trustedProxies)
+			if ip == nil || !ContainsIP(allowed, ip) {
+				logger.Log.Warn("Request from untrusted address", zap.Stringer("ip", ip), zap.String("path", r.URL.Path))
+				WriteError(w, r, http.StatusForbidden, CodeForbidden, "forbidden", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RealIP returns the client IP of the request. The X-Real-IP and X-Forwarded-For headers are honored only
+// when the direct peer is a trusted proxy; otherwise the peer address is used.
+func RealIP(r *http.Request, trustedProxies []*net.IPNet) net.IP {
+	peer := parseHostIP(r.RemoteAddr)
+	if peer == nil || !ContainsIP(trustedProxies, peer) {
+		return peer
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get(RealIPHeader))); realIP != nil {
+		return realIP
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		if !ContainsIP(trustedProxies, hop) {
+			return hop
+		}
+		peer = hop
+	}
+
+	return peer
+}
+
+func parseHostIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(host)
+}
+
+// ContainsIP reports whether ip belongs to any of subnets.
+func ContainsIP(subnets []*net.IPNet, ip net.IP) bool {
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"empty", "", 0, false},
+		{"single", "192.168.1.0/24", 1, false},
+		{"list with spaces", "10.0.0.0/8, fd00::/8", 2, false},
+		{"invalid", "10.0.0.1", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCIDRs(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, got, tt.want)
+		})
+	}
+}
+
+func TestNewTrustedSubnetMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		subnets        string
+		proxies        string
+		remoteAddr     string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "Test #1 no subnet configured",
+			remoteAddr:     "203.0.113.5:1234",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Test #2 peer inside subnet",
+			subnets:        "192.168.1.0/24",
+			remoteAddr:     "192.168.1.10:1234",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Test #3 peer outside subnet",
+			subnets:        "192.168.1.0/24",
+			remoteAddr:     "203.0.113.5:1234",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Test #4 X-Real-IP ignored from untrusted peer",
+			subnets:        "192.168.1.0/24",
+			remoteAddr:     "203.0.113.5:1234",
+			headers:        map[string]string{RealIPHeader: "192.168.1.10"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Test #5 X-Real-IP honored from trusted proxy",
+			subnets:        "192.168.1.0/24",
+			proxies:        "10.0.0.0/8",
+			remoteAddr:     "10.0.0.2:1234",
+			headers:        map[string]string{RealIPHeader: "192.168.1.10"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Test #6 X-Forwarded-For honored from trusted proxy",
+			subnets:        "192.168.1.0/24",
+			proxies:        "10.0.0.0/8",
+			remoteAddr:     "10.0.0.2:1234",
+			headers:        map[string]string{"X-Forwarded-For": "203.0.113.5, 192.168.1.10, 10.0.0.3"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Test #7 spoofed X-Forwarded-For prefix is not trusted",
+			subnets:        "192.168.1.0/24",
+			proxies:        "10.0.0.0/8",
+			remoteAddr:     "10.0.0.2:1234",
+			headers:        map[string]string{"X-Forwarded-For": "192.168.1.10, 203.0.113.5"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Test #8 invalid subnet rejects everything",
+			subnets:        "not-a-subnet",
+			remoteAddr:     "192.168.1.10:1234",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewTrustedSubnetMiddleware(tt.subnets, tt.proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rw := httptest.NewRecorder()
+
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+		})
+	}
+}
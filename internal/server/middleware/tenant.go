@@ -0,0 +1,50 @@
+// Package middleware provides HTTP middleware for the server, including tenant selection.
+package middleware
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+// TenantHeader is the HTTP header used to select the tenant of a request.
+const TenantHeader = "X-Tenant-ID"
+
+// NewTenantMiddleware returns a middleware that selects the tenant the request operates on.
+// The tenant of an API token takes precedence: a request whose header names another tenant is
+// rejected with 403. Otherwise the tenant is taken from the X-Tenant-ID header; invalid tenant
+// names are rejected with 400 and requests without the header use the default tenant.
+func NewTenantMiddleware() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant := r.Header.Get(TenantHeader)
+			if tenant == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id := identity.FromContext(r.Context())
+			if id.Tenant != "" {
+				if tenant != id.Tenant {
+					logger.Log.Warn("Tenant header does not match API token tenant",
+						zap.String("token", id.Token),
+						zap.String("tenant", tenant))
+					WriteError(w, r, http.StatusForbidden, CodeForbidden, "forbidden", nil)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !identity.ValidTenant(tenant) {
+				WriteError(w, r, http.StatusBadRequest, CodeInvalidTenant, "invalid tenant", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(identity.WithTenant(r.Context(), tenant)))
+		})
+	}
+}
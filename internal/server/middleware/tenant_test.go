@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+func TestNewTenantMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		tokenTenant string
+		header      string
+		wantStatus  int
+		wantTenant  string
+	}{
+		{
+			name:       "Test #1 no header uses default tenant",
+			wantStatus: http.StatusOK,
+			wantTenant: "",
+		},
+		{
+			name:       "Test #2 tenant from header",
+			header:     "team-a",
+			wantStatus: http.StatusOK,
+			wantTenant: "team-a",
+		},
+		{
+			name:       "Test #3 invalid tenant",
+			header:     "../team",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "Test #4 token tenant without header",
+			tokenTenant: "team-b",
+			wantStatus:  http.StatusOK,
+			wantTenant:  "team-b",
+		},
+		{
+			name:        "Test #5 header matching token tenant",
+			tokenTenant: "team-b",
+			header:      "team-b",
+			wantStatus:  http.StatusOK,
+			wantTenant:  "team-b",
+		},
+		{
+			name:        "Test #6 header overriding token tenant",
+			tokenTenant: "team-b",
+			header:      "team-a",
+			wantStatus:  http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := NewTenantMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = identity.Tenant(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			if tt.header != "" {
+				req.Header.Set(TenantHeader, tt.header)
+			}
+			req = req.WithContext(identity.WithTenant(req.Context(), tt.tokenTenant))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantTenant, got)
+		})
+	}
+}
@@ -0,0 +1,349 @@
+// Package query implements the expression language of /api/query over the current values of metrics
+// and the history kept for them.
+//
+// A query combines metric selectors with arithmetic and functions, e.g.
+//
+//	sum(CPUutilization*) / count(CPUutilization*)
+//	TotalMemory - FreeMemory
+//	max_over_time(Heap*{unit="bytes"}[1h])
+//	rate(PollCount[5m])
+//
+// Queries are parsed once by Parse and evaluated by an Engine as often as needed, so that rules
+// evaluated periodically do not parse them again.
+package query
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+)
+
+// Source provides the metrics queries are evaluated over. All reads are scoped to the tenant of ctx.
+type Source interface {
+	GetMetricsWithRetry(ctx context.Context) (map[string]repositories.Metric, error)
+	CounterRateWithRetry(ctx context.Context, name string, window time.Duration) (services.CounterRate, error)
+	GetRollupsWithRetry(ctx context.Context, name string, window time.Duration) ([]repositories.Rollup, error)
+}
+
+// Value is the result of an expression: a Scalar or a Vector.
+type Value interface {
+	Type() ValueType
+}
+
+// Scalar is a single number.
+type Scalar float64
+
+// Type returns TypeScalar.
+func (Scalar) Type() ValueType { return TypeScalar }
+
+// Sample is a value of a vector. Name is the name of the metric it was computed from, empty for the
+// results of aggregations.
+type Sample struct {
+	Name  string
+	Value float64
+}
+
+// Vector is a list of samples, ordered by metric name unless reordered by topk or bottomk.
+type Vector []Sample
+
+// Type returns TypeVector.
+func (Vector) Type() ValueType { return TypeVector }
+
+// Config configures an Engine.
+type Config struct {
+	// Rollups are the gauge rollup windows kept by the server, finest first, each with the period its
+	// rollups are kept for. The *_over_time functions read the finest window kept for their whole range;
+	// they are rejected when there are none, and so are ranges longer than every period.
+	Rollups []repositories.RetentionTier
+}
+
+// Engine evaluates queries over the metrics of a Source.
+type Engine struct {
+	source  Source
+	rollups []repositories.RetentionTier
+	now     func() time.Time
+}
+
+// NewEngine creates an Engine evaluating queries over the metrics of source.
+func NewEngine(source Source, cfg Config) *Engine {
+	return &Engine{source: source, rollups: cfg.Rollups, now: time.Now}
+}
+
+// Query parses and evaluates a query.
+func (e *Engine) Query(ctx context.Context, input string) (Value, error) {
+	expr, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return e.Eval(ctx, expr)
+}
+
+// Eval evaluates a parsed query. Stale metrics are not selected.
+func (e *Engine) Eval(ctx context.Context, expr Expr) (Value, error) {
+	ev := &evaluator{ctx: ctx, engine: e, now: e.now()}
+	return ev.eval(expr)
+}
+
+// evaluator evaluates one query. The metrics are read once, so that every selector of the query sees
+// the same values.
+type evaluator struct {
+	ctx     context.Context
+	engine  *Engine
+	now     time.Time
+	metrics map[string]repositories.Metric
+	names   []string
+}
+
+func (ev *evaluator) eval(expr Expr) (Value, error) {
+	switch e := expr.(type) {
+	case *numberExpr:
+		return Scalar(e.value), nil
+	case *selectorExpr:
+		return ev.selectVector(e)
+	case *unaryExpr:
+		v, err := ev.eval(e.expr)
+		if err != nil {
+			return nil, err
+		}
+		return mapValue(v, func(f float64) float64 { return -f }), nil
+	case *binaryExpr:
+		return ev.evalBinary(e)
+	case *callExpr:
+		return e.fn.call(ev, e.args)
+	default:
+		return nil, fmt.Errorf("%w: unsupported expression %s", ErrInvalidQuery, expr)
+	}
+}
+
+// selected is a metric chosen by a selector.
+type selected struct {
+	name   string
+	metric repositories.Metric
+}
+
+// selectMetrics returns the metrics chosen by sel ordered by name.
+func (ev *evaluator) selectMetrics(sel *selectorExpr) ([]selected, error) {
+	if ev.metrics == nil {
+		metrics, err := ev.engine.source.GetMetricsWithRetry(ev.ctx)
+		if err != nil {
+			return nil, err
+		}
+		ev.metrics = metrics
+		ev.names = make([]string, 0, len(metrics))
+		for name := range metrics {
+			ev.names = append(ev.names, name)
+		}
+		sort.Strings(ev.names)
+	}
+
+	var result []selected
+	for _, name := range ev.names {
+		metric := ev.metrics[name]
+		if !metric.Stale && sel.matches(name, metric) {
+			result = append(result, selected{name: name, metric: metric})
+		}
+	}
+	return result, nil
+}
+
+// matches reports whether a metric is chosen by the selector.
+func (e *selectorExpr) matches(name string, metric repositories.Metric) bool {
+	if e.pattern != nil && !e.pattern.MatchString(name) {
+		return false
+	}
+	for _, m := range e.matchers {
+		if !m.matches(attribute(name, metric, m.attr)) {
+			return false
+		}
+	}
+	return true
+}
+
+// attribute returns the value of an attribute of a metric, empty for metadata it does not have.
+func attribute(name string, metric repositories.Metric, attr string) string {
+	switch attr {
+	case attrName:
+		return name
+	case attrType:
+		return metric.Type
+	}
+	if metric.Metadata == nil {
+		return ""
+	}
+	if attr == attrUnit {
+		return metric.Metadata.Unit
+	}
+	return metric.Metadata.Owner
+}
+
+func (ev *evaluator) selectVector(sel *selectorExpr) (Value, error) {
+	metrics, err := ev.selectMetrics(sel)
+	if err != nil {
+		return nil, err
+	}
+	vector := make(Vector, 0, len(metrics))
+	for _, s := range metrics {
+		switch v := s.metric.Value.(type) {
+		case float64:
+			vector = append(vector, Sample{Name: s.name, Value: v})
+		case int64:
+			vector = append(vector, Sample{Name: s.name, Value: float64(v)})
+		}
+	}
+	return vector, nil
+}
+
+// evalBinary applies an arithmetic operator. Scalars apply to every sample of a vector, and so do
+// vectors of one sample, such as the results of aggregations or single metrics: TotalMemory - FreeMemory
+// subtracts the values of two metrics. Other vectors are matched by metric name. Samples keep the name
+// of the metric of the vector with more samples, or of the left operand.
+func (ev *evaluator) evalBinary(e *binaryExpr) (Value, error) {
+	lhs, err := ev.eval(e.lhs)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := ev.eval(e.rhs)
+	if err != nil {
+		return nil, err
+	}
+	apply := func(a, b float64) float64 { return arithmetic(e.op, a, b) }
+
+	l, lok := lhs.(Vector)
+	r, rok := rhs.(Vector)
+	switch {
+	case !lok && !rok:
+		return Scalar(apply(float64(lhs.(Scalar)), float64(rhs.(Scalar)))), nil
+	case !rok:
+		return mapValue(l, func(a float64) float64 { return apply(a, float64(rhs.(Scalar))) }), nil
+	case !lok:
+		return mapValue(r, func(b float64) float64 { return apply(float64(lhs.(Scalar)), b) }), nil
+	case len(r) == 1:
+		return mapValue(l, func(a float64) float64 { return apply(a, r[0].Value) }), nil
+	case len(l) == 1:
+		return mapValue(r, func(b float64) float64 { return apply(l[0].Value, b) }), nil
+	}
+
+	byName := make(map[string]float64, len(r))
+	for _, s := range r {
+		byName[s.Name] = s.Value
+	}
+	result := make(Vector, 0, len(l))
+	for _, s := range l {
+		if b, ok := byName[s.Name]; ok {
+			result = append(result, Sample{Name: s.Name, Value: apply(s.Value, b)})
+		}
+	}
+	return result, nil
+}
+
+// arithmetic applies an operator to two numbers. Division by zero yields an infinity or NaN.
+func arithmetic(op tokenKind, a, b float64) float64 {
+	switch op {
+	case tokAdd:
+		return a + b
+	case tokSub:
+		return a - b
+	case tokMul:
+		return a * b
+	case tokDiv:
+		return a / b
+	default:
+		return math.Mod(a, b)
+	}
+}
+
+// mapValue applies f to a scalar or to every sample of a vector.
+func mapValue(v Value, f func(float64) float64) Value {
+	if s, ok := v.(Scalar); ok {
+		return Scalar(f(float64(s)))
+	}
+	vector := v.(Vector)
+	result := make(Vector, len(vector))
+	for i, s := range vector {
+		result[i] = Sample{Name: s.Name, Value: f(s.Value)}
+	}
+	return result
+}
+
+// counterRates returns the rate or increase of the counters chosen by sel within its range. Other
+// metrics are skipped.
+func (ev *evaluator) counterRates(sel *selectorExpr, stat func(services.CounterRate) float64) (Value, error) {
+	metrics, err := ev.selectMetrics(sel)
+	if err != nil {
+		return nil, err
+	}
+	result := Vector{}
+	for _, s := range metrics {
+		if s.metric.Type != constants.MetricTypeCounter {
+			continue
+		}
+		rate, err := ev.engine.source.CounterRateWithRetry(ev.ctx, s.name, sel.rng)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, Sample{Name: s.name, Value: stat(rate)})
+	}
+	return result, nil
+}
+
+// overTime returns a statistic of the values of the gauges chosen by sel within its range, computed
+// from the rollups of the windows overlapping the range. Other metrics, and gauges without values in
+// the range, are skipped.
+func (ev *evaluator) overTime(fn string, sel *selectorExpr, stat func(repositories.Rollup) float64) (Value, error) {
+	window, err := ev.engine.rollupWindow(fn, sel.rng)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := ev.selectMetrics(sel)
+	if err != nil {
+		return nil, err
+	}
+
+	from := ev.now.Add(-sel.rng)
+	result := Vector{}
+	for _, s := range metrics {
+		if s.metric.Type != constants.MetricTypeGauge {
+			continue
+		}
+		rollups, err := ev.engine.source.GetRollupsWithRetry(ev.ctx, s.name, window)
+		if err != nil {
+			return nil, err
+		}
+		var total repositories.Rollup
+		for _, r := range rollups {
+			if !r.Start.Add(r.Window).After(from) || r.Start.After(ev.now) || r.Count == 0 {
+				continue
+			}
+			if total.Count == 0 {
+				total = r
+			} else {
+				total = repositories.MergeRollup(total, r)
+			}
+		}
+		if total.Count > 0 {
+			result = append(result, Sample{Name: s.name, Value: stat(total)})
+		}
+	}
+	return result, nil
+}
+
+// rollupWindow returns the finest rollup window kept for the whole of rng. The rollups of a compacted
+// tier are completed with those of the finer tiers when read, so the window covers the recent values too.
+func (e *Engine) rollupWindow(fn string, rng time.Duration) (time.Duration, error) {
+	if len(e.rollups) == 0 {
+		return 0, fmt.Errorf("%w: %s needs gauge rollups, which are disabled", ErrInvalidQuery, fn)
+	}
+	for _, tier := range e.rollups {
+		if tier.Period >= rng {
+			return tier.Window, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s range %s is longer than the %s of gauge rollups kept",
+		ErrInvalidQuery, fn, rng, e.rollups[len(e.rollups)-1].Period)
+}
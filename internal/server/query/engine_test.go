@@ -0,0 +1,212 @@
+package query
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+)
+
+// minuteRollups are the rollups of newTestEngine: a minute window kept for an hour.
+var minuteRollups = []repositories.RetentionTier{{Window: time.Minute, Period: time.Hour}}
+
+// newTestEngine returns an engine over a service with CPU, memory and counter metrics written.
+func newTestEngine(t *testing.T, cfg Config) *Engine {
+	t.Helper()
+	storage := memstorage.NewMemStorage()
+	storage.EnableRollups(repositories.RollupConfig{Windows: []time.Duration{time.Minute}, Retention: 60})
+	service := services.NewService(repositories.NewMetricRepo(storage))
+	ctx := context.Background()
+
+	for name, value := range map[string]float64{
+		"CPUutilization1": 20,
+		"CPUutilization2": 40,
+		"TotalMemory":     1000,
+		"FreeMemory":      250,
+	} {
+		require.NoError(t, service.UpdateGaugeMetric(ctx, name, value))
+	}
+	require.NoError(t, service.UpdateGaugeMetric(ctx, "CPUutilization1", 30))
+	require.NoError(t, service.UpdateCounterMetric(ctx, "PollCount", 5))
+	require.NoError(t, service.UpdateCounterMetric(ctx, "PollCount", 7))
+	require.NoError(t, service.UpdateMetadata(ctx, map[string]repositories.Metadata{
+		"TotalMemory": {Type: constants.MetricTypeGauge, Unit: "bytes", Owner: "runtime"},
+		"FreeMemory":  {Type: constants.MetricTypeGauge, Unit: "bytes", Owner: "os"},
+	}))
+	return NewEngine(service, cfg)
+}
+
+func TestEngine_Query(t *testing.T) {
+	engine := newTestEngine(t, Config{Rollups: minuteRollups})
+
+	tests := []struct {
+		name  string
+		query string
+		want  Value
+	}{
+		{name: "Test #1 scalar arithmetic", query: "1 + 2 * 3 - 10 % 4", want: Scalar(5)},
+		{name: "Test #2 glob", query: "CPUutilization*", want: Vector{{Name: "CPUutilization1", Value: 30}, {Name: "CPUutilization2", Value: 40}}},
+		{name: "Test #3 average by aggregation", query: "sum(CPUutilization*) / count(CPUutilization*)", want: Vector{{Value: 35}}},
+		{name: "Test #4 difference of metrics", query: "TotalMemory - FreeMemory", want: Vector{{Name: "TotalMemory", Value: 750}}},
+		{name: "Test #5 vector and scalar", query: "100 - CPUutilization?", want: Vector{{Name: "CPUutilization1", Value: 70}, {Name: "CPUutilization2", Value: 60}}},
+		{name: "Test #6 vectors matched by name", query: "CPUutilization* - CPUutilization*", want: Vector{{Name: "CPUutilization1", Value: 0}, {Name: "CPUutilization2", Value: 0}}},
+		{name: "Test #7 unit matcher", query: `sum({unit="bytes"})`, want: Vector{{Value: 1250}}},
+		{name: "Test #8 regex matcher", query: `*Memory{owner=~"run.*"}`, want: Vector{{Name: "TotalMemory", Value: 1000}}},
+		{name: "Test #9 negative matcher", query: `{type!="gauge"}`, want: Vector{{Name: "PollCount", Value: 12}}},
+		{name: "Test #10 no match", query: "Missing*", want: Vector{}},
+		{name: "Test #11 aggregation of nothing", query: "max(Missing*)", want: Vector{}},
+		{name: "Test #12 topk", query: "topk(1, CPUutilization*)", want: Vector{{Name: "CPUutilization2", Value: 40}}},
+		{name: "Test #13 bottomk", query: "bottomk(5, CPUutilization*)", want: Vector{{Name: "CPUutilization1", Value: 30}, {Name: "CPUutilization2", Value: 40}}},
+		{name: "Test #14 elementwise", query: "floor(FreeMemory / 3)", want: Vector{{Name: "FreeMemory", Value: 83}}},
+		{name: "Test #15 negation", query: "-min(CPUutilization*)", want: Vector{{Value: -30}}},
+		{name: "Test #16 increase", query: "increase(Poll*[5m])", want: Vector{{Name: "PollCount", Value: 12}}},
+		{name: "Test #17 max over time", query: "max_over_time(CPUutilization1[1h])", want: Vector{{Name: "CPUutilization1", Value: 30}}},
+		{name: "Test #18 min over time", query: "min_over_time(CPU*[1h])", want: Vector{{Name: "CPUutilization1", Value: 20}, {Name: "CPUutilization2", Value: 40}}},
+		{name: "Test #19 count over time skips counters", query: "count_over_time({name=~\"CPU.*|Poll.*\"}[1h])", want: Vector{{Name: "CPUutilization1", Value: 2}, {Name: "CPUutilization2", Value: 1}}},
+		{name: "Test #20 avg over time", query: "avg_over_time(CPUutilization1[10m])", want: Vector{{Name: "CPUutilization1", Value: 25}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := engine.Query(context.Background(), tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEngine_Query_Rate(t *testing.T) {
+	engine := newTestEngine(t, Config{})
+
+	got, err := engine.Query(context.Background(), "rate(PollCount[1m])")
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.InDelta(t, 12.0/60, got.(Vector)[0].Value, 1e-9)
+
+	got, err = engine.Query(context.Background(), "FreeMemory / 0")
+	require.NoError(t, err)
+	assert.True(t, math.IsInf(got.(Vector)[0].Value, 1))
+}
+
+func TestEngine_Query_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		query   string
+		wantErr error
+	}{
+		{name: "Test #1 parse error", query: "sum(", wantErr: ErrInvalidQuery},
+		{name: "Test #2 rollups disabled", query: "avg_over_time(TotalMemory[1h])", wantErr: ErrInvalidQuery},
+		{name: "Test #3 rate window too long", cfg: Config{Rollups: minuteRollups}, query: "rate(PollCount[2h])", wantErr: services.ErrInvalidWindow},
+		{name: "Test #4 range longer than rollups kept", cfg: Config{Rollups: minuteRollups}, query: "max_over_time(TotalMemory[2h])", wantErr: ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestEngine(t, tt.cfg).Query(context.Background(), tt.query)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestEngine_Query_CompactedRollups(t *testing.T) {
+	now := time.Date(2024, 1, 8, 12, 0, 30, 0, time.UTC)
+	rollup := func(start time.Time, window time.Duration, min, max float64) repositories.Rollup {
+		return repositories.Rollup{Start: start, Window: window, Min: min, Max: max, Sum: min + max, Count: 2, Last: max}
+	}
+	// The minute windows of the last day are kept; older ones were compacted into hour windows, which
+	// are read completed with the recent minute windows.
+	source := rollupSource{
+		metrics: map[string]repositories.Metric{"load": {Type: constants.MetricTypeGauge, Value: 2.0}},
+		rollups: map[time.Duration][]repositories.Rollup{
+			time.Minute: {rollup(now.Truncate(time.Minute), time.Minute, 2, 3)},
+			time.Hour: {
+				rollup(now.Add(-72*time.Hour).Truncate(time.Hour), time.Hour, 1, 9),
+				rollup(now.Truncate(time.Hour), time.Hour, 2, 3),
+			},
+		},
+	}
+	engine := NewEngine(source, Config{Rollups: []repositories.RetentionTier{
+		{Window: time.Minute, Period: 24 * time.Hour},
+		{Window: time.Hour, Period: 30 * 24 * time.Hour},
+	}})
+	engine.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		query   string
+		want    Value
+		wantErr error
+	}{
+		{name: "Test #1 range within the finest tier", query: "max_over_time(load[1h])", want: Vector{{Name: "load", Value: 3}}},
+		{name: "Test #2 range of a compacted tier", query: "max_over_time(load[168h])", want: Vector{{Name: "load", Value: 9}}},
+		{name: "Test #3 range of a compacted tier", query: "min_over_time(load[168h])", want: Vector{{Name: "load", Value: 1}}},
+		{name: "Test #4 range longer than every tier", query: "max_over_time(load[1000h])", wantErr: ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := engine.Query(context.Background(), tt.query)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEngine_Eval_StaleMetrics(t *testing.T) {
+	engine := NewEngine(staticSource{
+		"Alloc": {Type: constants.MetricTypeGauge, Value: 1.0},
+		"Old":   {Type: constants.MetricTypeGauge, Value: 2.0, Stale: true},
+	}, Config{})
+
+	expr, err := Parse("sum({})")
+	require.Error(t, err)
+	assert.Nil(t, expr)
+
+	expr, err = Parse("count(*)")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		got, err := engine.Eval(context.Background(), expr)
+		require.NoError(t, err)
+		assert.Equal(t, Vector{{Value: 1}}, got)
+	}
+}
+
+// staticSource is a Source serving fixed metrics without history.
+type staticSource map[string]repositories.Metric
+
+func (s staticSource) GetMetricsWithRetry(context.Context) (map[string]repositories.Metric, error) {
+	return s, nil
+}
+
+func (s staticSource) CounterRateWithRetry(context.Context, string, time.Duration) (services.CounterRate, error) {
+	return services.CounterRate{}, nil
+}
+
+func (s staticSource) GetRollupsWithRetry(context.Context, string, time.Duration) ([]repositories.Rollup, error) {
+	return nil, nil
+}
+
+// rollupSource is a Source serving fixed metrics and the same rollups, by window, for every gauge.
+type rollupSource struct {
+	staticSource
+	metrics map[string]repositories.Metric
+	rollups map[time.Duration][]repositories.Rollup
+}
+
+func (s rollupSource) GetMetricsWithRetry(context.Context) (map[string]repositories.Metric, error) {
+	return s.metrics, nil
+}
+
+func (s rollupSource) GetRollupsWithRetry(_ context.Context, _ string, window time.Duration) ([]repositories.Rollup, error) {
+	return s.rollups[window], nil
+}
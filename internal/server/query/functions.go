@@ -0,0 +1,176 @@
+package query
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/services"
+)
+
+// argType is the set of value types an argument accepts.
+type argType []ValueType
+
+func (a argType) accepts(t ValueType) bool {
+	for _, want := range a {
+		if want == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (a argType) String() string {
+	names := make([]string, len(a))
+	for i, t := range a {
+		names[i] = string(t)
+	}
+	return strings.Join(names, " or ")
+}
+
+// Argument types of functions.
+var (
+	scalarArg  = argType{TypeScalar}
+	vectorArg  = argType{TypeVector}
+	rangeArg   = argType{TypeRange}
+	numericArg = argType{TypeScalar, TypeVector}
+)
+
+// function is a function of the query language.
+type function struct {
+	name string
+	args []argType
+	// returns is the type of the result, the type of the last argument when empty.
+	returns ValueType
+	call    func(ev *evaluator, args []Expr) (Value, error)
+}
+
+// functions are the functions of the query language by name.
+var functions = map[string]*function{}
+
+func init() {
+	aggregations := map[string]func(Vector) float64{
+		"sum": func(v Vector) float64 {
+			var sum float64
+			for _, s := range v {
+				sum += s.Value
+			}
+			return sum
+		},
+		"avg": func(v Vector) float64 {
+			var sum float64
+			for _, s := range v {
+				sum += s.Value
+			}
+			return sum / float64(len(v))
+		},
+		"min": func(v Vector) float64 {
+			result := math.Inf(1)
+			for _, s := range v {
+				result = math.Min(result, s.Value)
+			}
+			return result
+		},
+		"max": func(v Vector) float64 {
+			result := math.Inf(-1)
+			for _, s := range v {
+				result = math.Max(result, s.Value)
+			}
+			return result
+		},
+		"count": func(v Vector) float64 {
+			return float64(len(v))
+		},
+	}
+	for name, aggregate := range aggregations {
+		register(name, []argType{vectorArg}, TypeVector, aggregation(aggregate))
+	}
+
+	register("topk", []argType{scalarArg, vectorArg}, TypeVector, ranking(func(a, b float64) bool { return a > b }))
+	register("bottomk", []argType{scalarArg, vectorArg}, TypeVector, ranking(func(a, b float64) bool { return a < b }))
+
+	for name, f := range map[string]func(float64) float64{
+		"abs":   math.Abs,
+		"ceil":  math.Ceil,
+		"floor": math.Floor,
+		"round": math.Round,
+	} {
+		register(name, []argType{numericArg}, "", elementwise(f))
+	}
+
+	register("rate", []argType{rangeArg}, TypeVector, func(ev *evaluator, args []Expr) (Value, error) {
+		return ev.counterRates(args[0].(*selectorExpr), func(r services.CounterRate) float64 { return r.Rate })
+	})
+	register("increase", []argType{rangeArg}, TypeVector, func(ev *evaluator, args []Expr) (Value, error) {
+		return ev.counterRates(args[0].(*selectorExpr), func(r services.CounterRate) float64 { return float64(r.Increase) })
+	})
+
+	for name, stat := range map[string]func(repositories.Rollup) float64{
+		"avg_over_time":   repositories.Rollup.Avg,
+		"min_over_time":   func(r repositories.Rollup) float64 { return r.Min },
+		"max_over_time":   func(r repositories.Rollup) float64 { return r.Max },
+		"sum_over_time":   func(r repositories.Rollup) float64 { return r.Sum },
+		"count_over_time": func(r repositories.Rollup) float64 { return float64(r.Count) },
+		"last_over_time":  func(r repositories.Rollup) float64 { return r.Last },
+	} {
+		register(name, []argType{rangeArg}, TypeVector, func(ev *evaluator, args []Expr) (Value, error) {
+			return ev.overTime(name, args[0].(*selectorExpr), stat)
+		})
+	}
+}
+
+func register(name string, args []argType, returns ValueType, call func(ev *evaluator, args []Expr) (Value, error)) {
+	functions[name] = &function{name: name, args: args, returns: returns, call: call}
+}
+
+// aggregation returns a function aggregating the samples of a vector into one unnamed sample. The
+// aggregation of an empty vector is empty.
+func aggregation(aggregate func(Vector) float64) func(ev *evaluator, args []Expr) (Value, error) {
+	return func(ev *evaluator, args []Expr) (Value, error) {
+		v, err := ev.eval(args[0])
+		if err != nil {
+			return nil, err
+		}
+		vector := v.(Vector)
+		if len(vector) == 0 {
+			return Vector{}, nil
+		}
+		return Vector{{Value: aggregate(vector)}}, nil
+	}
+}
+
+// ranking returns a function keeping the k samples of a vector ranked first by before.
+func ranking(before func(a, b float64) bool) func(ev *evaluator, args []Expr) (Value, error) {
+	return func(ev *evaluator, args []Expr) (Value, error) {
+		k, err := ev.eval(args[0])
+		if err != nil {
+			return nil, err
+		}
+		v, err := ev.eval(args[1])
+		if err != nil {
+			return nil, err
+		}
+		vector := append(Vector(nil), v.(Vector)...)
+		sort.SliceStable(vector, func(i, j int) bool { return before(vector[i].Value, vector[j].Value) })
+		n := int(float64(k.(Scalar)))
+		if n < 0 {
+			n = 0
+		}
+		if n < len(vector) {
+			vector = vector[:n]
+		}
+		return vector, nil
+	}
+}
+
+// elementwise returns a function applying f to a scalar or to every sample of a vector.
+func elementwise(f func(float64) float64) func(ev *evaluator, args []Expr) (Value, error) {
+	return func(ev *evaluator, args []Expr) (Value, error) {
+		v, err := ev.eval(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return mapValue(v, f), nil
+	}
+}
@@ -0,0 +1,228 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind is the kind of a lexical token.
+type tokenKind int
+
+// Kinds of tokens.
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokDuration
+	tokString
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+	tokLBracket
+	tokRBracket
+	tokComma
+	tokAdd
+	tokSub
+	tokMul
+	tokDiv
+	tokMod
+	tokEq
+	tokNeq
+	tokRegex
+	tokNotRegex
+)
+
+var tokenNames = map[tokenKind]string{
+	tokEOF:      "end of query",
+	tokIdent:    "name",
+	tokNumber:   "number",
+	tokDuration: "duration",
+	tokString:   "string",
+	tokLParen:   `"("`,
+	tokRParen:   `")"`,
+	tokLBrace:   `"{"`,
+	tokRBrace:   `"}"`,
+	tokLBracket: `"["`,
+	tokRBracket: `"]"`,
+	tokComma:    `","`,
+	tokAdd:      `"+"`,
+	tokSub:      `"-"`,
+	tokMul:      `"*"`,
+	tokDiv:      `"/"`,
+	tokMod:      `"%"`,
+	tokEq:       `"="`,
+	tokNeq:      `"!="`,
+	tokRegex:    `"=~"`,
+	tokNotRegex: `"!~"`,
+}
+
+// String returns the name of the kind used in error messages.
+func (k tokenKind) String() string {
+	return tokenNames[k]
+}
+
+// symbol returns the text of an operator.
+func (k tokenKind) symbol() string {
+	return strings.Trim(tokenNames[k], `"`)
+}
+
+// token is a lexical token of a query. The text of strings is unquoted.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// String describes the token in error messages.
+func (t token) String() string {
+	switch t.kind {
+	case tokIdent, tokNumber, tokDuration:
+		return fmt.Sprintf("%s %q", t.kind, t.text)
+	default:
+		return t.kind.String()
+	}
+}
+
+// isOperand reports whether a token of the kind ends an operand, so that a following "*" is a
+// multiplication rather than the start of a name glob.
+func (k tokenKind) isOperand() bool {
+	switch k {
+	case tokIdent, tokNumber, tokString, tokRParen, tokRBrace, tokRBracket:
+		return true
+	default:
+		return false
+	}
+}
+
+// isNameStart reports whether a metric name may start with r.
+func isNameStart(r rune) bool {
+	return r == '_' || r == ':' || unicode.IsLetter(r)
+}
+
+// isNameChar reports whether r may appear in a metric name.
+func isNameChar(r rune) bool {
+	return isNameStart(r) || r == '.' || unicode.IsDigit(r)
+}
+
+// isGlobChar reports whether r is a wildcard of a name glob.
+func isGlobChar(r rune) bool {
+	return r == '*' || r == '?'
+}
+
+// lex splits a query into tokens ending with a tokEOF token.
+//
+// A "*" or "?" directly attached to a name is part of the name glob, and a "*" starts a glob where an
+// operand is expected; so Heap* is a glob and Heap * 2 a multiplication.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	prev := tokEOF
+	for pos := 0; pos < len(input); {
+		r, size := utf8.DecodeRuneInString(input[pos:])
+		if unicode.IsSpace(r) {
+			pos += size
+			continue
+		}
+
+		start := pos
+		var t token
+		switch {
+		case isNameStart(r), isGlobChar(r) && !prev.isOperand():
+			pos = scanWhile(input, pos, func(r rune) bool { return isNameChar(r) || isGlobChar(r) })
+			t = token{kind: tokIdent, text: input[start:pos]}
+		case unicode.IsDigit(r) || r == '.' && pos+1 < len(input) && unicode.IsDigit(rune(input[pos+1])):
+			pos = scanWhile(input, pos, func(r rune) bool { return unicode.IsDigit(r) || r == '.' })
+			if pos < len(input) && (input[pos] == 'e' || input[pos] == 'E') {
+				exp := pos + 1
+				if exp < len(input) && (input[exp] == '+' || input[exp] == '-') {
+					exp++
+				}
+				if exp < len(input) && unicode.IsDigit(rune(input[exp])) {
+					pos = scanWhile(input, exp, unicode.IsDigit)
+				}
+			}
+			t = token{kind: tokNumber, text: input[start:pos]}
+			if pos < len(input) && unicode.IsLetter(rune(input[pos])) {
+				pos = scanWhile(input, pos, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) })
+				t = token{kind: tokDuration, text: input[start:pos]}
+			}
+		case r == '"' || r == '\'':
+			end, text, err := scanString(input, pos)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+			t = token{kind: tokString, text: text}
+		default:
+			kind, width, ok := operator(input[pos:])
+			if !ok {
+				return nil, errorAt(pos, "unexpected character %q", r)
+			}
+			pos += width
+			t = token{kind: kind}
+		}
+		t.pos = start
+		tokens = append(tokens, t)
+		prev = t.kind
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(input)}), nil
+}
+
+// operator returns the operator or punctuation token at the start of s and its width.
+func operator(s string) (tokenKind, int, bool) {
+	switch {
+	case strings.HasPrefix(s, "=~"):
+		return tokRegex, 2, true
+	case strings.HasPrefix(s, "!="):
+		return tokNeq, 2, true
+	case strings.HasPrefix(s, "!~"):
+		return tokNotRegex, 2, true
+	}
+	kind, ok := punctuation[s[0]]
+	return kind, 1, ok
+}
+
+// punctuation maps the single-character operators and punctuation to their tokens.
+var punctuation = map[byte]tokenKind{
+	'(': tokLParen, ')': tokRParen, '{': tokLBrace, '}': tokRBrace, '[': tokLBracket, ']': tokRBracket,
+	',': tokComma, '+': tokAdd, '-': tokSub, '*': tokMul, '/': tokDiv, '%': tokMod, '=': tokEq,
+}
+
+// scanWhile returns the position of the first rune at or after pos not accepted by accept.
+func scanWhile(input string, pos int, accept func(rune) bool) int {
+	for pos < len(input) {
+		r, size := utf8.DecodeRuneInString(input[pos:])
+		if !accept(r) {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
+
+// scanString scans the string literal starting at pos and returns the position after it and its
+// unquoted text. Double-quoted strings take Go escapes; single-quoted strings are taken literally.
+func scanString(input string, pos int) (int, string, error) {
+	quote := input[pos]
+	for end := pos + 1; end < len(input); end++ {
+		switch input[end] {
+		case '\\':
+			if quote == '"' {
+				end++
+			}
+		case quote:
+			if quote == '\'' {
+				return end + 1, input[pos+1 : end], nil
+			}
+			text, err := strconv.Unquote(input[pos : end+1])
+			if err != nil {
+				return 0, "", errorAt(pos, "invalid string %s", input[pos:end+1])
+			}
+			return end + 1, text, nil
+		}
+	}
+	return 0, "", errorAt(pos, "unterminated string")
+}
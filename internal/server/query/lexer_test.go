@@ -0,0 +1,44 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "Test #1 glob", input: "sum(CPUutilization*)", want: []string{`name "sum"`, `"("`, `name "CPUutilization*"`, `")"`}},
+		{name: "Test #2 multiplication", input: "Heap * 2", want: []string{`name "Heap"`, `"*"`, `number "2"`}},
+		{name: "Test #3 leading glob", input: "2 * *Memory", want: []string{`number "2"`, `"*"`, `name "*Memory"`}},
+		{name: "Test #4 multiplication after call", input: "sum(a*)*2", want: []string{`name "sum"`, `"("`, `name "a*"`, `")"`, `"*"`, `number "2"`}},
+		{name: "Test #5 matchers", input: `{unit=~"b.*", owner!='web'}`, want: []string{`"{"`, `name "unit"`, `"=~"`, "string", `","`, `name "owner"`, `"!="`, "string", `"}"`}},
+		{name: "Test #6 range", input: "x[1h30m]", want: []string{`name "x"`, `"["`, `duration "1h30m"`, `"]"`}},
+		{name: "Test #7 numbers", input: "1.5e3 - .5", want: []string{`number "1.5e3"`, `"-"`, `number ".5"`}},
+		{name: "Test #8 unexpected character", input: "a & b", wantErr: true},
+		{name: "Test #9 unterminated string", input: `{name="a}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lex(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidQuery)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tokEOF, tokens[len(tokens)-1].kind)
+
+			var got []string
+			for _, tok := range tokens[:len(tokens)-1] {
+				got = append(got, tok.String())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
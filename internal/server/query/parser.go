@@ -0,0 +1,437 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidQuery is wrapped by the errors of queries that cannot be parsed or evaluated as written.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// errorAt returns an ErrInvalidQuery error for the query text at byte offset pos.
+func errorAt(pos int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at position %d", ErrInvalidQuery, fmt.Sprintf(format, args...), pos+1)
+}
+
+// ValueType is the type of the value of an expression.
+type ValueType string
+
+// Types of values. Range vectors are only accepted as arguments of range functions.
+const (
+	TypeScalar ValueType = "scalar"
+	TypeVector ValueType = "vector"
+	TypeRange  ValueType = "range"
+)
+
+// Expr is a parsed query expression. Its String method returns the expression in canonical form.
+type Expr interface {
+	fmt.Stringer
+	// Type returns the type of the value of the expression.
+	Type() ValueType
+}
+
+// numberExpr is a number literal.
+type numberExpr struct {
+	value float64
+}
+
+func (e *numberExpr) Type() ValueType { return TypeScalar }
+
+func (e *numberExpr) String() string {
+	return strconv.FormatFloat(e.value, 'g', -1, 64)
+}
+
+// Attributes of metrics matchers select on.
+const (
+	attrName  = "name"
+	attrType  = "type"
+	attrUnit  = "unit"
+	attrOwner = "owner"
+)
+
+// matcher selects metrics by an attribute: their name, type, or the unit or owner of their metadata.
+type matcher struct {
+	attr  string
+	op    tokenKind
+	value string
+	re    *regexp.Regexp
+}
+
+func (m matcher) matches(value string) bool {
+	switch m.op {
+	case tokEq:
+		return value == m.value
+	case tokNeq:
+		return value != m.value
+	case tokRegex:
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+func (m matcher) String() string {
+	return m.attr + m.op.symbol() + strconv.Quote(m.value)
+}
+
+// selectorExpr selects the current values of the metrics whose name matches a glob and which satisfy
+// its matchers, or, with a range, their history within the range ending now.
+type selectorExpr struct {
+	glob     string
+	pattern  *regexp.Regexp
+	matchers []matcher
+	rng      time.Duration
+}
+
+func (e *selectorExpr) Type() ValueType {
+	if e.rng > 0 {
+		return TypeRange
+	}
+	return TypeVector
+}
+
+func (e *selectorExpr) String() string {
+	var b strings.Builder
+	b.WriteString(e.glob)
+	if len(e.matchers) > 0 {
+		parts := make([]string, len(e.matchers))
+		for i, m := range e.matchers {
+			parts[i] = m.String()
+		}
+		fmt.Fprintf(&b, "{%s}", strings.Join(parts, ", "))
+	}
+	if e.rng > 0 {
+		fmt.Fprintf(&b, "[%s]", e.rng)
+	}
+	return b.String()
+}
+
+// unaryExpr negates its operand.
+type unaryExpr struct {
+	expr Expr
+}
+
+func (e *unaryExpr) Type() ValueType { return e.expr.Type() }
+
+func (e *unaryExpr) String() string {
+	return "-" + e.expr.String()
+}
+
+// binaryExpr applies an arithmetic operator to two operands.
+type binaryExpr struct {
+	op       tokenKind
+	lhs, rhs Expr
+}
+
+func (e *binaryExpr) Type() ValueType {
+	if e.lhs.Type() == TypeScalar && e.rhs.Type() == TypeScalar {
+		return TypeScalar
+	}
+	return TypeVector
+}
+
+func (e *binaryExpr) String() string {
+	return fmt.Sprintf("(%s %s %s)", e.lhs, e.op.symbol(), e.rhs)
+}
+
+// callExpr calls a function.
+type callExpr struct {
+	fn   *function
+	args []Expr
+}
+
+func (e *callExpr) Type() ValueType {
+	if e.fn.returns == "" {
+		return e.args[len(e.args)-1].Type()
+	}
+	return e.fn.returns
+}
+
+func (e *callExpr) String() string {
+	args := make([]string, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", e.fn.name, strings.Join(args, ", "))
+}
+
+// Parse parses a query. The grammar, in order of increasing precedence:
+//
+//	expr      = term { ("+" | "-") term }
+//	term      = unary { ("*" | "/" | "%") unary }
+//	unary     = "-" unary | primary
+//	primary   = number | "(" expr ")" | call | selector
+//	call      = function "(" [ expr { "," expr } ] ")"
+//	selector  = glob [ "{" matcher { "," matcher } "}" ] [ "[" duration "]" ] | "{" matcher { "," matcher } "}" [ "[" duration "]" ]
+//	matcher   = ("name" | "type" | "unit" | "owner") ("=" | "!=" | "=~" | "!~") string
+//
+// Globs are metric names in which "*" matches any run of characters and "?" any one character;
+// put spaces around "*" to multiply. Regular expressions of matchers must match the whole value.
+func Parse(input string) (Expr, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorAt(t.pos, "unexpected %s", t)
+	}
+	if expr.Type() == TypeRange {
+		return nil, fmt.Errorf("%w: range selector %s must be the argument of a range function", ErrInvalidQuery, expr)
+	}
+	return expr, nil
+}
+
+// parser is a recursive descent parser of the tokens of a query.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, errorAt(t.pos, "expected %s, found %s", kind, t)
+	}
+	return t, nil
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	return p.parseBinary(p.parseTerm, tokAdd, tokSub)
+}
+
+func (p *parser) parseTerm() (Expr, error) {
+	return p.parseBinary(p.parseUnary, tokMul, tokDiv, tokMod)
+}
+
+// parseBinary parses a left-associative chain of operands parsed by operand joined by operators.
+func (p *parser) parseBinary(operand func() (Expr, error), operators ...tokenKind) (Expr, error) {
+	lhs, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if !containsKind(operators, op.kind) {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range []Expr{lhs, rhs} {
+			if e.Type() == TypeRange {
+				return nil, errorAt(op.pos, "range selector %s cannot be an operand of %s", e, op.kind)
+			}
+		}
+		lhs = &binaryExpr{op: op.kind, lhs: lhs, rhs: rhs}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if t := p.peek(); t.kind == tokSub {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if expr.Type() == TypeRange {
+			return nil, errorAt(t.pos, "range selector %s cannot be negated", expr)
+		}
+		if n, ok := expr.(*numberExpr); ok {
+			return &numberExpr{value: -n.value}, nil
+		}
+		return &unaryExpr{expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.next()
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errorAt(t.pos, "invalid number %q", t.text)
+		}
+		return &numberExpr{value: value}, nil
+	case tokLParen:
+		p.next()
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case tokIdent:
+		if p.tokens[p.pos+1].kind == tokLParen {
+			return p.parseCall()
+		}
+		return p.parseSelector()
+	case tokLBrace:
+		return p.parseSelector()
+	default:
+		return nil, errorAt(t.pos, "unexpected %s", t)
+	}
+}
+
+func (p *parser) parseCall() (Expr, error) {
+	name := p.next()
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, errorAt(name.pos, "unknown function %q", name.text)
+	}
+	p.next()
+
+	var args []Expr
+	if p.peek().kind != tokRParen {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if _, err := p.expect(tokRParen); err != nil {
+		return nil, err
+	}
+
+	if len(args) != len(fn.args) {
+		return nil, errorAt(name.pos, "%s expects %d arguments, got %d", fn.name, len(fn.args), len(args))
+	}
+	for i, arg := range args {
+		if want := fn.args[i]; !want.accepts(arg.Type()) {
+			return nil, errorAt(name.pos, "argument %d of %s must be a %s, got %s %s", i+1, fn.name, want, arg.Type(), arg)
+		}
+	}
+	return &callExpr{fn: fn, args: args}, nil
+}
+
+func (p *parser) parseSelector() (Expr, error) {
+	sel := &selectorExpr{}
+	if t := p.peek(); t.kind == tokIdent {
+		p.next()
+		sel.glob = t.text
+		sel.pattern = globPattern(t.text)
+	}
+
+	if t := p.peek(); t.kind == tokLBrace {
+		p.next()
+		for {
+			m, err := p.parseMatcher()
+			if err != nil {
+				return nil, err
+			}
+			sel.matchers = append(sel.matchers, m)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(tokRBrace); err != nil {
+			return nil, err
+		}
+	}
+
+	if t := p.peek(); t.kind == tokLBracket {
+		p.next()
+		d, err := p.expect(tokDuration)
+		if err != nil {
+			return nil, err
+		}
+		sel.rng, err = time.ParseDuration(d.text)
+		if err != nil || sel.rng <= 0 {
+			return nil, errorAt(d.pos, "invalid range %q", d.text)
+		}
+		if _, err := p.expect(tokRBracket); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+func (p *parser) parseMatcher() (matcher, error) {
+	attr, err := p.expect(tokIdent)
+	if err != nil {
+		return matcher{}, err
+	}
+	switch attr.text {
+	case attrName, attrType, attrUnit, attrOwner:
+	default:
+		return matcher{}, errorAt(attr.pos, "unknown attribute %q, expected name, type, unit or owner", attr.text)
+	}
+
+	op := p.next()
+	if !containsKind([]tokenKind{tokEq, tokNeq, tokRegex, tokNotRegex}, op.kind) {
+		return matcher{}, errorAt(op.pos, "expected matcher operator, found %s", op)
+	}
+	value, err := p.expect(tokString)
+	if err != nil {
+		return matcher{}, err
+	}
+
+	m := matcher{attr: attr.text, op: op.kind, value: value.text}
+	if op.kind == tokRegex || op.kind == tokNotRegex {
+		m.re, err = regexp.Compile("^(?:" + value.text + ")$")
+		if err != nil {
+			return matcher{}, errorAt(value.pos, "invalid regular expression %q", value.text)
+		}
+	}
+	return m, nil
+}
+
+// globPattern compiles a name glob to a regular expression matching whole names.
+func globPattern(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func containsKind(kinds []tokenKind, kind tokenKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     string
+		wantType ValueType
+	}{
+		{name: "Test #1 aggregation ratio", input: "sum(CPUutilization*) / count(CPUutilization*)", want: "(sum(CPUutilization*) / count(CPUutilization*))", wantType: TypeVector},
+		{name: "Test #2 difference", input: "TotalMemory - FreeMemory", want: "(TotalMemory - FreeMemory)", wantType: TypeVector},
+		{name: "Test #3 precedence", input: "1 + 2 * 3 % 4", want: "(1 + ((2 * 3) % 4))", wantType: TypeScalar},
+		{name: "Test #4 parentheses", input: "(1 + 2) * -x", want: "((1 + 2) * -x)", wantType: TypeVector},
+		{name: "Test #5 negative number", input: "-2.5", want: "-2.5", wantType: TypeScalar},
+		{name: "Test #6 matchers", input: `Heap*{unit="bytes",owner=~"run.*"}`, want: `Heap*{unit="bytes", owner=~"run.*"}`, wantType: TypeVector},
+		{name: "Test #7 matchers only", input: `{type!="counter"}`, want: `{type!="counter"}`, wantType: TypeVector},
+		{name: "Test #8 range function", input: "max_over_time(Alloc[1h])", want: "max_over_time(Alloc[1h0m0s])", wantType: TypeVector},
+		{name: "Test #9 ranking", input: "topk(3, rate(Poll*[5m]))", want: "topk(3, rate(Poll*[5m0s]))", wantType: TypeVector},
+		{name: "Test #10 elementwise scalar", input: "round(2.5)", want: "round(2.5)", wantType: TypeScalar},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, expr.String())
+			assert.Equal(t, tt.wantType, expr.Type())
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantMsg string
+	}{
+		{name: "Test #1 empty", input: "", wantMsg: "unexpected end of query at position 1"},
+		{name: "Test #2 trailing token", input: "a b", wantMsg: `unexpected name "b" at position 3`},
+		{name: "Test #3 missing parenthesis", input: "(1 + 2", wantMsg: `expected ")", found end of query`},
+		{name: "Test #4 unknown function", input: "median(a)", wantMsg: `unknown function "median"`},
+		{name: "Test #5 argument count", input: "sum(a, b)", wantMsg: "sum expects 1 arguments, got 2"},
+		{name: "Test #6 argument type", input: "sum(a[5m])", wantMsg: "argument 1 of sum must be a vector, got range"},
+		{name: "Test #7 range outside function", input: "a[5m]", wantMsg: "must be the argument of a range function"},
+		{name: "Test #8 range in arithmetic", input: "a[5m] * 2", wantMsg: "cannot be an operand"},
+		{name: "Test #9 range function of vector", input: "rate(a)", wantMsg: "argument 1 of rate must be a range"},
+		{name: "Test #10 unknown attribute", input: `a{host="x"}`, wantMsg: `unknown attribute "host"`},
+		{name: "Test #11 invalid regular expression", input: `a{name=~"("}`, wantMsg: "invalid regular expression"},
+		{name: "Test #12 invalid range", input: "rate(a[5x])", wantMsg: `invalid range "5x"`},
+		{name: "Test #13 matcher without string", input: "a{name=b}", wantMsg: `expected string, found name "b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			require.ErrorIs(t, err, ErrInvalidQuery)
+			assert.Contains(t, err.Error(), tt.wantMsg)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 // Package repositories provides repository implementations for metrics storage.
 package repositories
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // MetricRepo implements the MetricRepository interface using a Storage backend.
 type MetricRepo struct {
@@ -32,3 +35,63 @@ func (r *MetricRepo) GetMetrics(ctx context.Context) (map[string]Metric, error)
 func (r *MetricRepo) UpdateMetricsBatch(ctx context.Context, metrics map[string]Metric) error {
 	return r.storage.UpdateMetricsBatch(ctx, metrics)
 }
+
+// CreateCounter stores a new counter unless a metric of that name is stored.
+func (r *MetricRepo) CreateCounter(ctx context.Context, metricName string, delta int64) error {
+	return r.storage.CreateCounter(ctx, metricName, delta)
+}
+
+// ListTenants lists the tenants that have metrics in the storage.
+func (r *MetricRepo) ListTenants(ctx context.Context) ([]string, error) {
+	return r.storage.ListTenants(ctx)
+}
+
+// DeleteTenant removes all metrics of a tenant from the storage.
+func (r *MetricRepo) DeleteTenant(ctx context.Context, tenant string) error {
+	return r.storage.DeleteTenant(ctx, tenant)
+}
+
+// DeleteMetric removes a metric from the storage.
+func (r *MetricRepo) DeleteMetric(ctx context.Context, metricName string) error {
+	return r.storage.DeleteMetric(ctx, metricName)
+}
+
+// DeleteBySelector removes the metrics matched by selector from the storage and returns their names.
+func (r *MetricRepo) DeleteBySelector(ctx context.Context, selector Selector) ([]string, error) {
+	return r.storage.DeleteBySelector(ctx, selector)
+}
+
+// GetUpdateTimes retrieves the time of the last write of every metric from the storage.
+func (r *MetricRepo) GetUpdateTimes(ctx context.Context) (map[string]time.Time, error) {
+	return r.storage.GetUpdateTimes(ctx)
+}
+
+// DeleteExpired removes the series not written within their TTL from the storage and returns them.
+func (r *MetricRepo) DeleteExpired(ctx context.Context, series []ExpiringSeries) ([]ExpiringSeries, error) {
+	return r.storage.DeleteExpired(ctx, series)
+}
+
+// UpdateMetadata registers the metadata of metrics in the storage, replacing previously registered metadata.
+func (r *MetricRepo) UpdateMetadata(ctx context.Context, metadata map[string]Metadata) error {
+	return r.storage.UpdateMetadata(ctx, metadata)
+}
+
+// GetMetadata retrieves the metadata of all metrics from the storage.
+func (r *MetricRepo) GetMetadata(ctx context.Context) (map[string]Metadata, error) {
+	return r.storage.GetMetadata(ctx)
+}
+
+// GetRollups retrieves the rollups of a gauge for windows of the given length from the storage.
+func (r *MetricRepo) GetRollups(ctx context.Context, metricName string, window time.Duration) ([]Rollup, error) {
+	return r.storage.GetRollups(ctx, metricName, window)
+}
+
+// CompactRollups folds the rollups of windows of one length starting before the given time into longer windows.
+func (r *MetricRepo) CompactRollups(ctx context.Context, window, into time.Duration, before time.Time) (int, error) {
+	return r.storage.CompactRollups(ctx, window, into, before)
+}
+
+// RollupSizes retrieves the number of rollup windows kept per window length from the storage.
+func (r *MetricRepo) RollupSizes(ctx context.Context) (map[time.Duration]int, error) {
+	return r.storage.RollupSizes(ctx)
+}
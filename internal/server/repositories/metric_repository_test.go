@@ -3,7 +3,9 @@ package repositories
 import (
 	"context"
 	"fmt"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -12,6 +14,7 @@ import (
 
 type mockStorage struct {
 	metrics     map[string]Metric
+	metadata    map[string]Metadata
 	errOnUpdate bool
 	errOnGet    bool
 }
@@ -72,6 +75,20 @@ func (m *mockStorage) UpdateMetricsBatch(_ context.Context, metrics map[string]M
 	return nil
 }
 
+func (m *mockStorage) CreateCounter(_ context.Context, name string, delta int64) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	if m.metrics == nil {
+		m.metrics = make(map[string]Metric)
+	}
+	if _, ok := m.metrics[name]; ok {
+		return ErrMetricExists
+	}
+	m.metrics[name] = Metric{Type: constants.MetricTypeCounter, Value: delta}
+	return nil
+}
+
 func TestMetricRepo_GetMetric(t *testing.T) {
 	ctx := context.Background()
 	tests := []struct {
@@ -274,6 +291,7 @@ func TestNewMetricRepo(t *testing.T) {
 
 type MockStorage struct {
 	metrics     map[string]Metric
+	metadata    map[string]Metadata
 	errOnUpdate bool
 	errOnGet    bool
 }
@@ -323,3 +341,205 @@ func (m *MockStorage) UpdateMetricsBatch(_ context.Context, metrics map[string]M
 	}
 	return nil
 }
+
+func (m *MockStorage) CreateCounter(_ context.Context, name string, delta int64) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	if m.metrics == nil {
+		m.metrics = make(map[string]Metric)
+	}
+	if _, ok := m.metrics[name]; ok {
+		return ErrMetricExists
+	}
+	m.metrics[name] = Metric{Type: constants.MetricTypeCounter, Value: delta}
+	return nil
+}
+
+func (m *mockStorage) ListTenants(_ context.Context) ([]string, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	return []string{""}, nil
+}
+
+func (m *mockStorage) DeleteTenant(_ context.Context, _ string) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	m.metrics = nil
+	return nil
+}
+
+func (m *MockStorage) ListTenants(_ context.Context) ([]string, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	return []string{""}, nil
+}
+
+func (m *MockStorage) DeleteTenant(_ context.Context, _ string) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	m.metrics = nil
+	return nil
+}
+
+func (m *mockStorage) DeleteMetric(_ context.Context, name string) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	if _, ok := m.metrics[name]; !ok {
+		return ErrMetricNotFound
+	}
+	delete(m.metrics, name)
+	return nil
+}
+
+func (m *mockStorage) DeleteBySelector(_ context.Context, selector Selector) ([]string, error) {
+	if m.errOnUpdate {
+		return nil, fmt.Errorf("mock update error")
+	}
+	deleted := make([]string, 0)
+	for name, metric := range m.metrics {
+		if selector.Matches(name, metric) {
+			delete(m.metrics, name)
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(deleted)
+	return deleted, nil
+}
+
+func (m *mockStorage) GetUpdateTimes(_ context.Context) (map[string]time.Time, error) {
+	return map[string]time.Time{}, nil
+}
+
+func (m *mockStorage) DeleteExpired(_ context.Context, _ []ExpiringSeries) ([]ExpiringSeries, error) {
+	return []ExpiringSeries{}, nil
+}
+
+func (m *MockStorage) DeleteMetric(_ context.Context, name string) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	if _, ok := m.metrics[name]; !ok {
+		return ErrMetricNotFound
+	}
+	delete(m.metrics, name)
+	return nil
+}
+
+func (m *MockStorage) DeleteBySelector(_ context.Context, selector Selector) ([]string, error) {
+	if m.errOnUpdate {
+		return nil, fmt.Errorf("mock update error")
+	}
+	deleted := make([]string, 0)
+	for name, metric := range m.metrics {
+		if selector.Matches(name, metric) {
+			delete(m.metrics, name)
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(deleted)
+	return deleted, nil
+}
+
+func (m *MockStorage) GetUpdateTimes(_ context.Context) (map[string]time.Time, error) {
+	return map[string]time.Time{}, nil
+}
+
+func (m *MockStorage) DeleteExpired(_ context.Context, _ []ExpiringSeries) ([]ExpiringSeries, error) {
+	return []ExpiringSeries{}, nil
+}
+
+func (m *mockStorage) UpdateMetadata(_ context.Context, metadata map[string]Metadata) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	if m.metadata == nil {
+		m.metadata = make(map[string]Metadata)
+	}
+	for name, meta := range metadata {
+		m.metadata[name] = meta
+	}
+	return nil
+}
+
+func (m *mockStorage) GetMetadata(_ context.Context) (map[string]Metadata, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	metadata := make(map[string]Metadata, len(m.metadata))
+	for name, meta := range m.metadata {
+		metadata[name] = meta
+	}
+	return metadata, nil
+}
+
+func (m *MockStorage) UpdateMetadata(_ context.Context, metadata map[string]Metadata) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	if m.metadata == nil {
+		m.metadata = make(map[string]Metadata)
+	}
+	for name, meta := range metadata {
+		m.metadata[name] = meta
+	}
+	return nil
+}
+
+func (m *MockStorage) GetMetadata(_ context.Context) (map[string]Metadata, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	metadata := make(map[string]Metadata, len(m.metadata))
+	for name, meta := range m.metadata {
+		metadata[name] = meta
+	}
+	return metadata, nil
+}
+
+func (m *mockStorage) GetRollups(_ context.Context, _ string, window time.Duration) ([]Rollup, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	return []Rollup{{Window: window}}, nil
+}
+
+func (m *mockStorage) CompactRollups(_ context.Context, _, _ time.Duration, _ time.Time) (int, error) {
+	if m.errOnUpdate {
+		return 0, fmt.Errorf("mock update error")
+	}
+	return 1, nil
+}
+
+func (m *mockStorage) RollupSizes(_ context.Context) (map[time.Duration]int, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	return map[time.Duration]int{time.Minute: 1}, nil
+}
+
+func (m *MockStorage) GetRollups(_ context.Context, _ string, window time.Duration) ([]Rollup, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	return []Rollup{{Window: window}}, nil
+}
+
+func (m *MockStorage) CompactRollups(_ context.Context, _, _ time.Duration, _ time.Time) (int, error) {
+	if m.errOnUpdate {
+		return 0, fmt.Errorf("mock update error")
+	}
+	return 1, nil
+}
+
+func (m *MockStorage) RollupSizes(_ context.Context) (map[time.Duration]int, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	return map[time.Duration]int{time.Minute: 1}, nil
+}
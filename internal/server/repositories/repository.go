@@ -1,18 +1,91 @@
 // Package repositories provides interfaces for metric storage.
 package repositories
 
-import "context"
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Errors returned by Storage implementations.
+var (
+	ErrMetricNotFound    = errors.New("metric not found")
+	ErrMetricInvalidType = errors.New("invalid value type for metric")
+	ErrMetricInvalidName = errors.New("invalid metric error")
+	ErrMetricExists      = errors.New("metric already exists")
+)
 
 // Storage defines the interface for metric storage backends.
+// Every operation is scoped to the tenant carried by ctx (see identity.Tenant).
 type Storage interface {
 	UpdateMetric(ctx context.Context, metricName string, metric Metric) error
 	GetMetric(ctx context.Context, metricName string) (Metric, error)
 	GetMetrics(ctx context.Context) (map[string]Metric, error)
 	UpdateMetricsBatch(ctx context.Context, metrics map[string]Metric) error
+	// CreateCounter stores a new counter with the value delta and returns ErrMetricExists when a metric
+	// of that name is stored. The check and the write are atomic, so concurrent creations store one counter.
+	CreateCounter(ctx context.Context, metricName string, delta int64) error
+	ListTenants(ctx context.Context) ([]string, error)
+	DeleteTenant(ctx context.Context, tenant string) error
+	DeleteMetric(ctx context.Context, metricName string) error
+	DeleteBySelector(ctx context.Context, selector Selector) ([]string, error)
+	// GetUpdateTimes returns the time of the last write of every metric of the tenant of ctx.
+	GetUpdateTimes(ctx context.Context) (map[string]time.Time, error)
+	// DeleteExpired removes the series, of any tenant, that were not written within their TTL and returns
+	// the removed ones. The check and the removal are atomic, so series written meanwhile are kept.
+	DeleteExpired(ctx context.Context, series []ExpiringSeries) ([]ExpiringSeries, error)
+	UpdateMetadata(ctx context.Context, metadata map[string]Metadata) error
+	GetMetadata(ctx context.Context) (map[string]Metadata, error)
+	GetRollups(ctx context.Context, metricName string, window time.Duration) ([]Rollup, error)
+	// CompactRollups folds the rollups of windows of length window starting before the given time into
+	// windows of length into, or drops them when into is zero, and returns the number of windows removed.
+	CompactRollups(ctx context.Context, window, into time.Duration, before time.Time) (int, error)
+	// RollupSizes returns the number of rollup windows kept per window length.
+	RollupSizes(ctx context.Context) (map[time.Duration]int, error)
+}
+
+// Selector selects metrics for bulk operations by name prefix and type. Empty fields match every metric.
+type Selector struct {
+	Prefix string
+	Type   string
+}
+
+// IsEmpty reports whether the selector matches every metric.
+func (s Selector) IsEmpty() bool {
+	return s.Prefix == "" && s.Type == ""
+}
+
+// Matches reports whether a metric is selected.
+func (s Selector) Matches(metricName string, metric Metric) bool {
+	return strings.HasPrefix(metricName, s.Prefix) && (s.Type == "" || metric.Type == s.Type)
+}
+
+// ExpiringSeries selects a metric of a tenant for removal unless it was written within TTL.
+type ExpiringSeries struct {
+	Tenant string
+	Name   string
+	TTL    time.Duration
+}
+
+// Metadata describes what a metric measures. It is stored apart from the metric value, so it survives
+// the deletion of the metric and can be registered before the first value is written.
+type Metadata struct {
+	Type  string
+	Unit  string
+	Help  string
+	Owner string
 }
 
 // Metric represents a single metric with type and value.
 type Metric struct {
 	Type  string
 	Value interface{}
+	// Stale is set by the service layer on metrics not updated within their TTL. Storages ignore it.
+	Stale bool
+	// Metadata is set by the service layer on metrics with registered metadata. Storages ignore it.
+	Metadata *Metadata
+	// Cumulative marks a counter Value written as the running total of its sender rather than an
+	// increment. The service layer converts it to an increment before the metric reaches a storage.
+	Cumulative bool
 }
@@ -0,0 +1,219 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRollupWindowNotConfigured is returned for rollups of a window length the storage does not keep.
+var ErrRollupWindowNotConfigured = errors.New("rollup window not configured")
+
+// RollupConfig configures the rollups of gauge values kept by storages.
+type RollupConfig struct {
+	// Windows are the lengths of the windows rollups are kept for. Rollups are disabled when empty.
+	Windows []time.Duration
+	// Retention is the number of windows of every length of Windows kept per gauge. All windows are
+	// kept when it is zero, leaving their removal to compaction.
+	Retention int
+	// Compacted are the lengths of windows that are not updated on writes but filled by compaction,
+	// see Storage.CompactRollups.
+	Compacted []time.Duration
+}
+
+// Enabled reports whether rollups are kept.
+func (c RollupConfig) Enabled() bool {
+	return len(c.Windows) > 0
+}
+
+// Has reports whether rollups are kept for windows of the given length.
+func (c RollupConfig) Has(window time.Duration) bool {
+	for _, w := range c.Windows {
+		if w == window {
+			return true
+		}
+	}
+	for _, w := range c.Compacted {
+		if w == window {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRollupWindows parses comma-separated window lengths, e.g. "1m,5m,1h". Windows must be whole
+// seconds, so that they can be stored as such, and are returned sorted without duplicates.
+func ParseRollupWindows(s string) ([]time.Duration, error) {
+	var windows []time.Duration
+	seen := make(map[time.Duration]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		window, err := time.ParseDuration(item)
+		if err != nil || window < time.Second || window%time.Second != 0 {
+			return nil, fmt.Errorf("invalid rollup window %q", item)
+		}
+		if !seen[window] {
+			seen[window] = true
+			windows = append(windows, window)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+	return windows, nil
+}
+
+// Rollup holds statistics of the values written to a gauge within a window. Windows are aligned to
+// multiples of their length since the Unix epoch.
+type Rollup struct {
+	Start  time.Time
+	Window time.Duration
+	Min    float64
+	Max    float64
+	Sum    float64
+	Count  int64
+	Last   float64
+}
+
+// Avg returns the average of the values written within the window.
+func (r Rollup) Avg() float64 {
+	if r.Count == 0 {
+		return 0
+	}
+	return r.Sum / float64(r.Count)
+}
+
+// RollupStart returns the start of the window of the given length that contains at.
+func RollupStart(at time.Time, window time.Duration) time.Time {
+	since := at.Sub(time.Unix(0, 0))
+	return time.Unix(0, 0).Add(since - since%window).UTC()
+}
+
+// AddRollup adds a value written at the given time to rollups, the windows of one length ordered by
+// their start, and returns them keeping the latest retention windows, or all of them when retention
+// is zero.
+func AddRollup(rollups []Rollup, window time.Duration, retention int, at time.Time, value float64) []Rollup {
+	start := RollupStart(at, window)
+	if n := len(rollups); n > 0 && rollups[n-1].Start.Equal(start) {
+		r := &rollups[n-1]
+		r.Min = min(r.Min, value)
+		r.Max = max(r.Max, value)
+		r.Sum += value
+		r.Count++
+		r.Last = value
+		return rollups
+	}
+
+	rollups = append(rollups, Rollup{Start: start, Window: window, Min: value, Max: value, Sum: value, Count: 1, Last: value})
+	if retention > 0 && len(rollups) > retention {
+		rollups = append(rollups[:0], rollups[len(rollups)-retention:]...)
+	}
+	return rollups
+}
+
+// MergeRollup returns the statistics of the values of two rollups of the same window, the values of
+// later following those of earlier.
+func MergeRollup(earlier, later Rollup) Rollup {
+	earlier.Min = min(earlier.Min, later.Min)
+	earlier.Max = max(earlier.Max, later.Max)
+	earlier.Sum += later.Sum
+	earlier.Count += later.Count
+	earlier.Last = later.Last
+	return earlier
+}
+
+// FoldRollups aggregates rollups ordered by their start into the windows of the given length, which
+// must be a multiple of their own.
+func FoldRollups(rollups []Rollup, window time.Duration) []Rollup {
+	var folded []Rollup
+	for _, r := range rollups {
+		r.Start, r.Window = RollupStart(r.Start, window), window
+		if n := len(folded); n > 0 && folded[n-1].Start.Equal(r.Start) {
+			folded[n-1] = MergeRollup(folded[n-1], r)
+			continue
+		}
+		folded = append(folded, r)
+	}
+	return folded
+}
+
+// CombineRollups merges two lists of rollups of the same window ordered by their start, the values of
+// later following those of earlier within every window.
+func CombineRollups(earlier, later []Rollup) []Rollup {
+	combined := make([]Rollup, 0, len(earlier)+len(later))
+	i, j := 0, 0
+	for i < len(earlier) && j < len(later) {
+		switch {
+		case earlier[i].Start.Before(later[j].Start):
+			combined = append(combined, earlier[i])
+			i++
+		case later[j].Start.Before(earlier[i].Start):
+			combined = append(combined, later[j])
+			j++
+		default:
+			combined = append(combined, MergeRollup(earlier[i], later[j]))
+			i++
+			j++
+		}
+	}
+	combined = append(combined, earlier[i:]...)
+	return append(combined, later[j:]...)
+}
+
+// RetentionTier keeps the rollups of windows of one length for a period.
+type RetentionTier struct {
+	Window time.Duration
+	Period time.Duration
+}
+
+// ParseRetentionTiers parses comma-separated retention tiers in format window:period, e.g.
+// "1m:24h,1h:30d", where periods may be given in days with the d suffix. Tiers must be ordered by
+// window, each window a multiple of the previous one and each period at least as long as the
+// previous one, so that compaction can fold the windows of a tier into those of the next.
+func ParseRetentionTiers(s string) ([]RetentionTier, error) {
+	var tiers []RetentionTier
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		rawWindow, rawPeriod, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid retention tier %q: expected window:period", item)
+		}
+		windows, err := ParseRollupWindows(rawWindow)
+		if err != nil || len(windows) != 1 {
+			return nil, fmt.Errorf("invalid retention tier %q: invalid window", item)
+		}
+		period, err := parsePeriod(strings.TrimSpace(rawPeriod))
+		if err != nil || period < windows[0] {
+			return nil, fmt.Errorf("invalid retention tier %q: invalid period", item)
+		}
+
+		tier := RetentionTier{Window: windows[0], Period: period}
+		if n := len(tiers); n > 0 {
+			prev := tiers[n-1]
+			if tier.Window <= prev.Window || tier.Window%prev.Window != 0 || tier.Period < prev.Period {
+				return nil, fmt.Errorf("invalid retention tier %q: windows must be increasing multiples and periods not decreasing", item)
+			}
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, nil
+}
+
+// parsePeriod parses a Go duration or a whole number of days such as 30d.
+func parsePeriod(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid period %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRollupWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []time.Duration
+		wantErr bool
+	}{
+		{name: "Test #1 empty", input: ""},
+		{name: "Test #2 sorted without duplicates", input: "1h, 1m,5m,60s", want: []time.Duration{time.Minute, 5 * time.Minute, time.Hour}},
+		{name: "Test #3 not a duration", input: "5", wantErr: true},
+		{name: "Test #4 fractional seconds", input: "1500ms", wantErr: true},
+		{name: "Test #5 negative", input: "-1m", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRollupWindows(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAddRollup(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var rollups []Rollup
+	for i, value := range []float64{5, 1, 9, 3} {
+		rollups = AddRollup(rollups, time.Minute, 2, base.Add(time.Duration(i)*10*time.Second), value)
+	}
+	require.Len(t, rollups, 1)
+	assert.Equal(t, Rollup{Start: base, Window: time.Minute, Min: 1, Max: 9, Sum: 18, Count: 4, Last: 3}, rollups[0])
+	assert.Equal(t, 4.5, rollups[0].Avg())
+
+	rollups = AddRollup(rollups, time.Minute, 2, base.Add(70*time.Second), 2)
+	rollups = AddRollup(rollups, time.Minute, 2, base.Add(150*time.Second), 4)
+	require.Len(t, rollups, 2, "windows beyond the retention are dropped")
+	assert.Equal(t, base.Add(time.Minute), rollups[0].Start)
+	assert.Equal(t, Rollup{Start: base.Add(2 * time.Minute), Window: time.Minute, Min: 4, Max: 4, Sum: 4, Count: 1, Last: 4}, rollups[1])
+}
+
+func TestRollupStart(t *testing.T) {
+	at := time.Date(2024, 1, 1, 10, 17, 42, 0, time.FixedZone("UTC+2", 2*60*60))
+	assert.Equal(t, time.Date(2024, 1, 1, 8, 15, 0, 0, time.UTC), RollupStart(at, 5*time.Minute))
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), RollupStart(at, 24*time.Hour))
+	assert.Equal(t, time.Unix(1704097059, 0).UTC(), RollupStart(at, 7*time.Second), "windows are aligned to the Unix epoch")
+}
+
+func TestFoldRollups(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rollups := []Rollup{
+		{Start: base, Window: time.Minute, Min: 5, Max: 9, Sum: 14, Count: 2, Last: 9},
+		{Start: base.Add(time.Minute), Window: time.Minute, Min: 1, Max: 1, Sum: 1, Count: 1, Last: 1},
+		{Start: base.Add(time.Hour), Window: time.Minute, Min: 3, Max: 3, Sum: 3, Count: 1, Last: 3},
+	}
+
+	folded := FoldRollups(rollups, time.Hour)
+	assert.Equal(t, []Rollup{
+		{Start: base, Window: time.Hour, Min: 1, Max: 9, Sum: 15, Count: 3, Last: 1},
+		{Start: base.Add(time.Hour), Window: time.Hour, Min: 3, Max: 3, Sum: 3, Count: 1, Last: 3},
+	}, folded)
+
+	combined := CombineRollups(folded[:1], []Rollup{
+		{Start: base, Window: time.Hour, Min: 0, Max: 2, Sum: 2, Count: 2, Last: 2},
+		{Start: base.Add(2 * time.Hour), Window: time.Hour, Min: 4, Max: 4, Sum: 4, Count: 1, Last: 4},
+	})
+	assert.Equal(t, []Rollup{
+		{Start: base, Window: time.Hour, Min: 0, Max: 9, Sum: 17, Count: 5, Last: 2},
+		{Start: base.Add(2 * time.Hour), Window: time.Hour, Min: 4, Max: 4, Sum: 4, Count: 1, Last: 4},
+	}, combined)
+}
+
+func TestParseRetentionTiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []RetentionTier
+		wantErr bool
+	}{
+		{name: "Test #1 empty", input: ""},
+		{
+			name:  "Test #2 tiers",
+			input: "1m:24h, 1h:30d,24h:365d",
+			want: []RetentionTier{
+				{Window: time.Minute, Period: 24 * time.Hour},
+				{Window: time.Hour, Period: 30 * 24 * time.Hour},
+				{Window: 24 * time.Hour, Period: 365 * 24 * time.Hour},
+			},
+		},
+		{name: "Test #3 missing period", input: "1m", wantErr: true},
+		{name: "Test #4 invalid period", input: "1m:forever", wantErr: true},
+		{name: "Test #5 period shorter than window", input: "1h:30m", wantErr: true},
+		{name: "Test #6 decreasing windows", input: "1h:24h,1m:30d", wantErr: true},
+		{name: "Test #7 window not a multiple", input: "1m:24h,90s:30d", wantErr: true},
+		{name: "Test #8 decreasing periods", input: "1m:30d,1h:24h", wantErr: true},
+		{name: "Test #9 days in window", input: "1d:30d", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetentionTiers(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMetricRepo_GetRollups(t *testing.T) {
+	repo := NewMetricRepo(&mockStorage{})
+	rollups, err := repo.GetRollups(context.Background(), "load", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []Rollup{{Window: time.Minute}}, rollups)
+
+	repo = NewMetricRepo(&mockStorage{errOnGet: true})
+	_, err = repo.GetRollups(context.Background(), "load", time.Minute)
+	assert.Error(t, err)
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 
 	"go.uber.org/zap"
@@ -29,11 +30,30 @@ type RConfig struct {
 }
 
 // metricData represents the serialized form of a metric for file storage.
+// Metrics of the default tenant are keyed by their name; metrics of other
+// tenants are keyed by tenant and name joined by tenantSeparator, which
+// metric names cannot contain, and carry the tenant and name explicitly.
+// The metadata registered for a metric is saved with it; metadata registered
+// before the first value is saved in an entry without type and value.
 type metricData struct {
-	Type  string      `json:"type"`
-	Value interface{} `json:"value"`
+	Type     string        `json:"type"`
+	Value    interface{}   `json:"value"`
+	Tenant   string        `json:"tenant,omitempty"`
+	Name     string        `json:"name,omitempty"`
+	Metadata *metadataData `json:"metadata,omitempty"`
 }
 
+// metadataData represents the serialized form of the metadata of a metric.
+type metadataData struct {
+	Type  string `json:"type,omitempty"`
+	Unit  string `json:"unit,omitempty"`
+	Help  string `json:"help,omitempty"`
+	Owner string `json:"owner,omitempty"`
+}
+
+// tenantSeparator joins the tenant and name in the keys of tenant metrics.
+const tenantSeparator = "\x00"
+
 // ErrRestoreFromFile is returned when restoring from file fails.
 var ErrRestoreFromFile = errors.New("error restoring from file")
 
@@ -70,7 +90,8 @@ func (b *RConfig) StartRestore(ctx context.Context) error {
 	}
 }
 
-// SaveToFile saves all metrics to the configured file.
+// SaveToFile saves all metrics and the metadata registered for them to the configured file. Metadata
+// is saved for the tenants with metrics.
 func (b *RConfig) SaveToFile() error {
 	ctx := context.Background()
 	b.mu.Lock()
@@ -83,16 +104,52 @@ func (b *RConfig) SaveToFile() error {
 		return err
 	}
 
-	metrics, err := b.Storage.GetMetrics(ctx)
+	tenants, err := b.Storage.ListTenants(ctx)
 	if err != nil {
 		return err
 	}
+	if len(tenants) == 0 {
+		tenants = []string{""}
+	}
 
 	serializedMetrics := make(map[string]metricData)
-	for name, metric := range metrics {
-		serializedMetrics[name] = metricData{
-			Type:  metric.Type,
-			Value: metric.Value,
+	for _, tenant := range tenants {
+		tenantCtx := identity.WithTenant(ctx, tenant)
+		metrics, err := b.Storage.GetMetrics(tenantCtx)
+		if err != nil {
+			return err
+		}
+		metadata, err := b.Storage.GetMetadata(tenantCtx)
+		if err != nil {
+			return err
+		}
+
+		key := func(name string) string {
+			if tenant == "" {
+				return name
+			}
+			return tenant + tenantSeparator + name
+		}
+		entry := func(name string) metricData {
+			if tenant == "" {
+				return metricData{}
+			}
+			return metricData{Tenant: tenant, Name: name}
+		}
+
+		for name, metric := range metrics {
+			data := entry(name)
+			data.Type = metric.Type
+			data.Value = metric.Value
+			serializedMetrics[key(name)] = data
+		}
+		for name, meta := range metadata {
+			data, ok := serializedMetrics[key(name)]
+			if !ok {
+				data = entry(name)
+			}
+			data.Metadata = &metadataData{Type: meta.Type, Unit: meta.Unit, Help: meta.Help, Owner: meta.Owner}
+			serializedMetrics[key(name)] = data
 		}
 	}
 
@@ -113,7 +170,54 @@ func (b *RConfig) SaveToFile() error {
 	return nil
 }
 
-// RestoreFromFile loads metrics from the specified file into a new MemStorage.
+// SnapshotStorage is a repositories.Storage that saves the snapshot file of an RConfig right after
+// metrics are deleted, so that they do not reappear when the server restarts before the next periodic save.
+type SnapshotStorage struct {
+	repositories.Storage
+	snapshot *RConfig
+}
+
+// NewSnapshotStorage wraps the storage of cfg.
+func NewSnapshotStorage(cfg *RConfig) *SnapshotStorage {
+	return &SnapshotStorage{Storage: cfg.Storage, snapshot: cfg}
+}
+
+// DeleteMetric removes a metric and saves the snapshot.
+func (s *SnapshotStorage) DeleteMetric(ctx context.Context, metricName string) error {
+	if err := s.Storage.DeleteMetric(ctx, metricName); err != nil {
+		return err
+	}
+	return s.snapshot.SaveToFile()
+}
+
+// DeleteBySelector removes the metrics matched by selector and saves the snapshot when any were removed.
+func (s *SnapshotStorage) DeleteBySelector(ctx context.Context, selector repositories.Selector) ([]string, error) {
+	deleted, err := s.Storage.DeleteBySelector(ctx, selector)
+	if err != nil || len(deleted) == 0 {
+		return deleted, err
+	}
+	return deleted, s.snapshot.SaveToFile()
+}
+
+// DeleteExpired removes the series not written within their TTL and saves the snapshot once when any
+// were removed, so that a collection run rewrites the file a single time.
+func (s *SnapshotStorage) DeleteExpired(ctx context.Context, series []repositories.ExpiringSeries) ([]repositories.ExpiringSeries, error) {
+	removed, err := s.Storage.DeleteExpired(ctx, series)
+	if err != nil || len(removed) == 0 {
+		return removed, err
+	}
+	return removed, s.snapshot.SaveToFile()
+}
+
+// DeleteTenant removes every metric of a tenant and saves the snapshot.
+func (s *SnapshotStorage) DeleteTenant(ctx context.Context, tenant string) error {
+	if err := s.Storage.DeleteTenant(ctx, tenant); err != nil {
+		return err
+	}
+	return s.snapshot.SaveToFile()
+}
+
+// RestoreFromFile loads metrics and their metadata from the specified file into a new MemStorage.
 func RestoreFromFile(filename string) (*memstorage.MemStorage, error) {
 	ctx := context.Background()
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
@@ -140,7 +244,27 @@ func RestoreFromFile(filename string) (*memstorage.MemStorage, error) {
 
 	ms := memstorage.NewMemStorage()
 
-	for name, data := range serializedMetrics {
+	metadata := make(map[string]map[string]repositories.Metadata)
+	for key, data := range serializedMetrics {
+		name := key
+		if data.Name != "" {
+			name = data.Name
+		}
+		if !identity.ValidTenant(data.Tenant) {
+			logger.Log.Warn("Invalid tenant", zap.String("name", name), zap.String("tenant", data.Tenant))
+			continue
+		}
+
+		if meta := data.Metadata; meta != nil {
+			if metadata[data.Tenant] == nil {
+				metadata[data.Tenant] = make(map[string]repositories.Metadata)
+			}
+			metadata[data.Tenant][name] = repositories.Metadata{Type: meta.Type, Unit: meta.Unit, Help: meta.Help, Owner: meta.Owner}
+			if data.Type == "" && data.Value == nil {
+				continue
+			}
+		}
+
 		var value interface{}
 		switch data.Type {
 		case constants.MetricTypeCounter:
@@ -162,7 +286,7 @@ func RestoreFromFile(filename string) (*memstorage.MemStorage, error) {
 			continue
 		}
 
-		err := ms.UpdateMetric(ctx, name, repositories.Metric{
+		err := ms.UpdateMetric(identity.WithTenant(ctx, data.Tenant), name, repositories.Metric{
 			Type:  data.Type,
 			Value: value,
 		})
@@ -171,5 +295,11 @@ func RestoreFromFile(filename string) (*memstorage.MemStorage, error) {
 		}
 	}
 
+	for tenant, tenantMetadata := range metadata {
+		if err := ms.UpdateMetadata(identity.WithTenant(ctx, tenant), tenantMetadata); err != nil {
+			logger.Log.Warn("Failed to restore metadata", zap.String("tenant", tenant), zap.Error(err))
+		}
+	}
+
 	return ms, nil
 }
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
 	"github.com/stretchr/testify/assert"
@@ -90,6 +91,66 @@ func (m *mockStorage) UpdateMetricsBatch(ctx context.Context, metrics map[string
 	return args.Error(0)
 }
 
+func (m *mockStorage) CreateCounter(ctx context.Context, name string, delta int64) error {
+	args := m.Called(ctx, name, delta)
+	return args.Error(0)
+}
+
+func (m *mockStorage) ListTenants(ctx context.Context) ([]string, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockStorage) DeleteTenant(ctx context.Context, tenant string) error {
+	args := m.Called(ctx, tenant)
+	return args.Error(0)
+}
+
+func (m *mockStorage) DeleteMetric(ctx context.Context, name string) error {
+	args := m.Called(ctx, name)
+	return args.Error(0)
+}
+
+func (m *mockStorage) DeleteBySelector(ctx context.Context, selector repositories.Selector) ([]string, error) {
+	args := m.Called(ctx, selector)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockStorage) GetUpdateTimes(ctx context.Context) (map[string]time.Time, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(map[string]time.Time), args.Error(1)
+}
+
+func (m *mockStorage) DeleteExpired(ctx context.Context, series []repositories.ExpiringSeries) ([]repositories.ExpiringSeries, error) {
+	args := m.Called(ctx, series)
+	return args.Get(0).([]repositories.ExpiringSeries), args.Error(1)
+}
+
+func (m *mockStorage) UpdateMetadata(ctx context.Context, metadata map[string]repositories.Metadata) error {
+	args := m.Called(ctx, metadata)
+	return args.Error(0)
+}
+
+func (m *mockStorage) GetMetadata(ctx context.Context) (map[string]repositories.Metadata, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(map[string]repositories.Metadata), args.Error(1)
+}
+
+func (m *mockStorage) GetRollups(ctx context.Context, metricName string, window time.Duration) ([]repositories.Rollup, error) {
+	args := m.Called(ctx, metricName, window)
+	return args.Get(0).([]repositories.Rollup), args.Error(1)
+}
+
+func (m *mockStorage) CompactRollups(ctx context.Context, window, into time.Duration, before time.Time) (int, error) {
+	args := m.Called(ctx, window, into, before)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockStorage) RollupSizes(ctx context.Context) (map[time.Duration]int, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(map[time.Duration]int), args.Error(1)
+}
+
 func TestNewRestoreConfig(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -338,6 +399,8 @@ func TestStartRestore(t *testing.T) {
 			storage := new(mockStorage)
 			storage.On("GetMetrics", mock.Anything).Return(map[string]repositories.Metric{}, nil)
 			storage.On("GetMetric", mock.Anything, mock.Anything).Return(repositories.Metric{}, nil)
+			storage.On("ListTenants", mock.Anything).Return([]string{""}, nil)
+			storage.On("GetMetadata", mock.Anything).Return(map[string]repositories.Metadata{}, nil)
 			storage.On("UpdateMetricsBatch", mock.Anything, mock.Anything).Return(nil)
 
 			config := &testRConfig{
@@ -378,3 +441,131 @@ func TestStartRestore(t *testing.T) {
 		})
 	}
 }
+
+func TestSaveAndRestore_Tenants(t *testing.T) {
+	ctx := context.Background()
+	acme := identity.WithTenant(ctx, "acme")
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+
+	storage := memstorage.NewMemStorage()
+	require.NoError(t, storage.UpdateMetric(ctx, "shared", repositories.Metric{Type: constants.MetricTypeGauge, Value: 1.5}))
+	require.NoError(t, storage.UpdateMetric(acme, "shared", repositories.Metric{Type: constants.MetricTypeCounter, Value: int64(7)}))
+	require.NoError(t, storage.UpdateMetric(ctx, "acme/shared", repositories.Metric{Type: constants.MetricTypeGauge, Value: 2.5}))
+
+	require.NoError(t, NewRestoreConfig(0, filePath, storage).SaveToFile())
+
+	restored, err := RestoreFromFile(filePath)
+	require.NoError(t, err)
+
+	got, err := restored.GetMetric(ctx, "shared")
+	require.NoError(t, err)
+	assert.Equal(t, repositories.Metric{Type: constants.MetricTypeGauge, Value: 1.5}, got)
+
+	got, err = restored.GetMetric(acme, "shared")
+	require.NoError(t, err)
+	assert.Equal(t, repositories.Metric{Type: constants.MetricTypeCounter, Value: int64(7)}, got)
+
+	got, err = restored.GetMetric(ctx, "acme/shared")
+	require.NoError(t, err)
+	assert.Equal(t, repositories.Metric{Type: constants.MetricTypeGauge, Value: 2.5}, got, "names containing a slash stay in their tenant")
+
+	tenants, err := restored.ListTenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "acme"}, tenants)
+}
+
+func TestSaveAndRestore_Metadata(t *testing.T) {
+	ctx := context.Background()
+	acme := identity.WithTenant(ctx, "acme")
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+
+	heap := repositories.Metadata{Type: constants.MetricTypeGauge, Unit: "bytes", Help: "Heap in use.", Owner: "runtime"}
+	polls := repositories.Metadata{Type: constants.MetricTypeCounter, Help: "Polls of the agent."}
+	storage := memstorage.NewMemStorage()
+	require.NoError(t, storage.UpdateMetric(ctx, "HeapInuse", repositories.Metric{Type: constants.MetricTypeGauge, Value: 1.5}))
+	require.NoError(t, storage.UpdateMetric(acme, "HeapInuse", repositories.Metric{Type: constants.MetricTypeGauge, Value: 2.5}))
+	require.NoError(t, storage.UpdateMetadata(ctx, map[string]repositories.Metadata{"HeapInuse": heap, "PollCount": polls}))
+	require.NoError(t, storage.UpdateMetadata(acme, map[string]repositories.Metadata{"HeapInuse": polls}))
+
+	require.NoError(t, NewRestoreConfig(0, filePath, storage).SaveToFile())
+
+	restored, err := RestoreFromFile(filePath)
+	require.NoError(t, err)
+
+	metadata, err := restored.GetMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]repositories.Metadata{"HeapInuse": heap, "PollCount": polls}, metadata,
+		"metadata registered before the first value is restored too")
+
+	metadata, err = restored.GetMetadata(acme)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]repositories.Metadata{"HeapInuse": polls}, metadata)
+
+	metrics, err := restored.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]repositories.Metric{"HeapInuse": {Type: constants.MetricTypeGauge, Value: 1.5}}, metrics)
+}
+
+func TestSnapshotStorage_Delete(t *testing.T) {
+	ctx := context.Background()
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+
+	storage := memstorage.NewMemStorage()
+	require.NoError(t, storage.UpdateMetricsBatch(ctx, map[string]repositories.Metric{
+		"http_requests": {Type: constants.MetricTypeCounter, Value: int64(1)},
+		"http_latency":  {Type: constants.MetricTypeGauge, Value: 0.2},
+		"HeapAlloc":     {Type: constants.MetricTypeGauge, Value: 1.5},
+	}))
+	cfg := NewRestoreConfig(300, filePath, storage)
+	require.NoError(t, cfg.SaveToFile())
+	snapshot := NewSnapshotStorage(cfg)
+
+	deleted, err := snapshot.DeleteBySelector(ctx, repositories.Selector{Prefix: "http_"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http_latency", "http_requests"}, deleted)
+
+	restored, err := RestoreFromFile(filePath)
+	require.NoError(t, err)
+	metrics, err := restored.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]repositories.Metric{
+		"HeapAlloc": {Type: constants.MetricTypeGauge, Value: 1.5},
+	}, metrics, "deletions are saved without waiting for the interval")
+
+	require.NoError(t, snapshot.DeleteMetric(ctx, "HeapAlloc"))
+	restored, err = RestoreFromFile(filePath)
+	require.NoError(t, err)
+	metrics, err = restored.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	assert.ErrorIs(t, snapshot.DeleteMetric(ctx, "HeapAlloc"), memstorage.ErrMetricNotFound)
+}
+
+func TestSnapshotStorage_DeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+
+	series := []repositories.ExpiringSeries{
+		{Name: "old", TTL: time.Minute},
+		{Tenant: "acme", Name: "old", TTL: time.Minute},
+	}
+	storage := new(mockStorage)
+	storage.On("DeleteExpired", ctx, series).Return(series, nil).Once()
+	storage.On("DeleteExpired", ctx, series[:1]).Return([]repositories.ExpiringSeries{}, nil).Once()
+	storage.On("ListTenants", mock.Anything).Return([]string{""}, nil)
+	storage.On("GetMetrics", mock.Anything).Return(map[string]repositories.Metric{}, nil)
+	storage.On("GetMetadata", mock.Anything).Return(map[string]repositories.Metadata{}, nil)
+	snapshot := NewSnapshotStorage(NewRestoreConfig(300, filePath, storage))
+
+	removed, err := snapshot.DeleteExpired(ctx, series)
+	require.NoError(t, err)
+	assert.Equal(t, series, removed)
+	storage.AssertNumberOfCalls(t, "ListTenants", 1)
+
+	removed, err = snapshot.DeleteExpired(ctx, series[:1])
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+	storage.AssertNumberOfCalls(t, "ListTenants", 1)
+	storage.AssertExpectations(t)
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+// Modes of the cardinality guard for new series beyond the limit.
+const (
+	// CardinalityModeReject rejects the whole write.
+	CardinalityModeReject = "reject"
+	// CardinalityModeDrop writes a batch without the new series beyond the limit. Single updates are rejected.
+	CardinalityModeDrop = "drop"
+)
+
+const (
+	// maxSeriesPrefixLen bounds the length of a reported series prefix.
+	maxSeriesPrefixLen = 32
+	// maxTrackedPrefixes bounds the number of prefixes tracked; the rest are counted under otherPrefix.
+	maxTrackedPrefixes = 1000
+	// topPrefixesCount is the number of prefixes reported by the guard.
+	topPrefixesCount = 10
+	otherPrefix      = "(other)"
+)
+
+// ErrCardinalityLimitExceeded is returned when a write would create more distinct series than the server allows.
+var ErrCardinalityLimitExceeded = errors.New("cardinality limit exceeded")
+
+// PrefixStats describes the series admitted and rejected for a metric name prefix.
+type PrefixStats struct {
+	Prefix   string `json:"prefix"`
+	Series   int    `json:"series"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// CardinalityReport describes the state of the cardinality guard.
+type CardinalityReport struct {
+	Limit       int           `json:"limit"`
+	Mode        string        `json:"mode"`
+	Series      int           `json:"series"`
+	Rejected    uint64        `json:"rejected"`
+	TopPrefixes []PrefixStats `json:"top_prefixes"`
+}
+
+// ParseCardinalityMode validates a cardinality guard mode. The empty string selects CardinalityModeReject.
+func ParseCardinalityMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return CardinalityModeReject, nil
+	case CardinalityModeReject, CardinalityModeDrop:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown cardinality mode %q", mode)
+	}
+}
+
+// WithCardinalityLimit limits the number of distinct series stored across all tenants. Zero disables the guard.
+func WithCardinalityLimit(limit int, mode string) Option {
+	return func(s *Service) {
+		if limit <= 0 {
+			return
+		}
+		parsed, err := ParseCardinalityMode(mode)
+		if err != nil {
+			parsed = CardinalityModeReject
+		}
+		s.cardinality = newCardinalityGuard(limit, parsed)
+	}
+}
+
+// cardinalityGuard tracks the distinct series stored by the server exactly. The set of series is
+// bounded by the limit, so memory stays bounded as well.
+type cardinalityGuard struct {
+	mu       sync.Mutex
+	limit    int
+	mode     string
+	seeded   bool
+	series   map[string]struct{}
+	prefixes map[string]*PrefixStats
+	rejected uint64
+}
+
+func newCardinalityGuard(limit int, mode string) *cardinalityGuard {
+	return &cardinalityGuard{
+		limit:    limit,
+		mode:     mode,
+		series:   make(map[string]struct{}),
+		prefixes: make(map[string]*PrefixStats),
+	}
+}
+
+// admit registers the series of names for the tenant of ctx. It returns the newly registered series keys,
+// which must be released if the write fails, and the names dropped in drop mode. When the limit would be
+// exceeded in reject mode, or allowDrop is false, nothing is registered and an error is returned.
+func (g *cardinalityGuard) admit(ctx context.Context, repo MetricRepository, names []string, allowDrop bool) (added []string, dropped []string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.seed(ctx, repo); err != nil {
+		return nil, nil, err
+	}
+
+	tenant := identity.Tenant(ctx)
+	var fresh []string
+	for _, name := range names {
+		if _, ok := g.series[seriesKey(tenant, name)]; !ok {
+			fresh = append(fresh, name)
+		}
+	}
+
+	free := g.limit - len(g.series)
+	if free < 0 {
+		free = 0
+	}
+	if len(fresh) > free {
+		sort.Strings(fresh)
+		over := fresh[free:]
+		for _, name := range over {
+			g.prefix(seriesPrefix(name)).Rejected++
+		}
+		g.rejected += uint64(len(over))
+
+		if g.mode != CardinalityModeDrop || !allowDrop {
+			return nil, nil, fmt.Errorf("%w: %d new series would exceed the limit of %d distinct series",
+				ErrCardinalityLimitExceeded, len(fresh), g.limit)
+		}
+		dropped = over
+		fresh = fresh[:free]
+	}
+
+	for _, name := range fresh {
+		key := seriesKey(tenant, name)
+		g.series[key] = struct{}{}
+		g.prefix(seriesPrefix(name)).Series++
+		added = append(added, key)
+	}
+	return added, dropped, nil
+}
+
+// release forgets series registered by admit whose write failed.
+func (g *cardinalityGuard) release(keys []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range keys {
+		if _, ok := g.series[key]; ok {
+			delete(g.series, key)
+			_, name, _ := strings.Cut(key, "\x00")
+			g.prefix(seriesPrefix(name)).Series--
+		}
+	}
+}
+
+// forgetTenant forgets every series of a deleted tenant.
+func (g *cardinalityGuard) forgetTenant(tenant string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var keys []string
+	for key := range g.series {
+		if t, _, _ := strings.Cut(key, "\x00"); t == tenant {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		delete(g.series, key)
+		_, name, _ := strings.Cut(key, "\x00")
+		g.prefix(seriesPrefix(name)).Series--
+	}
+}
+
+// report returns the guard state with the prefixes with the most rejected, then admitted, series.
+func (g *cardinalityGuard) report(ctx context.Context, repo MetricRepository) (CardinalityReport, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.seed(ctx, repo); err != nil {
+		return CardinalityReport{}, err
+	}
+
+	top := make([]PrefixStats, 0, len(g.prefixes))
+	for _, stats := range g.prefixes {
+		if stats.Series > 0 || stats.Rejected > 0 {
+			top = append(top, *stats)
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Rejected != top[j].Rejected {
+			return top[i].Rejected > top[j].Rejected
+		}
+		if top[i].Series != top[j].Series {
+			return top[i].Series > top[j].Series
+		}
+		return top[i].Prefix < top[j].Prefix
+	})
+	if len(top) > topPrefixesCount {
+		top = top[:topPrefixesCount]
+	}
+
+	return CardinalityReport{
+		Limit:       g.limit,
+		Mode:        g.mode,
+		Series:      len(g.series),
+		Rejected:    g.rejected,
+		TopPrefixes: top,
+	}, nil
+}
+
+// seed loads the series already in the storage on first use.
+func (g *cardinalityGuard) seed(ctx context.Context, repo MetricRepository) error {
+	if g.seeded {
+		return nil
+	}
+
+	tenants, err := repo.ListTenants(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load series for cardinality guard: %w", err)
+	}
+	for _, tenant := range tenants {
+		metrics, err := repo.GetMetrics(identity.WithTenant(ctx, tenant))
+		if err != nil {
+			return fmt.Errorf("failed to load series for cardinality guard: %w", err)
+		}
+		for name := range metrics {
+			g.series[seriesKey(tenant, name)] = struct{}{}
+			g.prefix(seriesPrefix(name)).Series++
+		}
+	}
+
+	g.seeded = true
+	return nil
+}
+
+func (g *cardinalityGuard) prefix(prefix string) *PrefixStats {
+	stats, ok := g.prefixes[prefix]
+	if !ok {
+		if len(g.prefixes) >= maxTrackedPrefixes {
+			prefix = otherPrefix
+			if stats, ok = g.prefixes[prefix]; ok {
+				return stats
+			}
+		}
+		stats = &PrefixStats{Prefix: prefix}
+		g.prefixes[prefix] = stats
+	}
+	return stats
+}
+
+func seriesKey(tenant, name string) string {
+	return tenant + "\x00" + name
+}
+
+// seriesPrefix returns the part of a metric name before the first separator or digit,
+// e.g. "http" for "http_requests_total" and "CPUutilization" for "CPUutilization3".
+func seriesPrefix(name string) string {
+	end := strings.IndexAny(name, "._-:/0123456789")
+	if end <= 0 {
+		end = len(name)
+	}
+	if end > maxSeriesPrefixLen {
+		end = maxSeriesPrefixLen
+	}
+	return name[:end]
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+)
+
+func gauges(names ...string) map[string]repositories.Metric {
+	metrics := make(map[string]repositories.Metric, len(names))
+	for _, name := range names {
+		metrics[name] = repositories.Metric{Type: constants.MetricTypeGauge, Value: 1.0}
+	}
+	return metrics
+}
+
+func TestService_CardinalityReject(t *testing.T) {
+	ctx := context.Background()
+	storage := memstorage.NewMemStorage()
+	require.NoError(t, storage.UpdateMetric(ctx, "HeapAlloc", repositories.Metric{Type: constants.MetricTypeGauge, Value: 1.0}))
+
+	s := NewService(repositories.NewMetricRepo(storage), WithCardinalityLimit(3, CardinalityModeReject))
+
+	assert.NoError(t, s.UpdateMetricsBatch(ctx, gauges("HeapAlloc", "user_1", "user_2")))
+	assert.ErrorIs(t, s.UpdateMetricsBatch(ctx, gauges("HeapAlloc", "user_3")), ErrCardinalityLimitExceeded)
+	assert.ErrorIs(t, s.UpdateGaugeMetric(identity.WithTenant(ctx, "team-a"), "HeapAlloc", 1), ErrCardinalityLimitExceeded,
+		"the limit spans all tenants")
+	assert.NoError(t, s.UpdateGaugeMetric(ctx, "user_1", 2), "existing series can still be written")
+
+	_, err := s.GetMetric(ctx, "user_3")
+	assert.Error(t, err)
+
+	report, err := s.Cardinality(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Limit)
+	assert.Equal(t, CardinalityModeReject, report.Mode)
+	assert.Equal(t, 3, report.Series)
+	assert.Equal(t, uint64(2), report.Rejected)
+	assert.Equal(t, []PrefixStats{
+		{Prefix: "user", Series: 2, Rejected: 1},
+		{Prefix: "HeapAlloc", Series: 1, Rejected: 1},
+	}, report.TopPrefixes)
+}
+
+func TestService_CardinalityReleasedOnDelete(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()), WithCardinalityLimit(1, CardinalityModeReject))
+
+	assert.NoError(t, s.UpdateGaugeMetric(ctx, "a", 1))
+	assert.ErrorIs(t, s.UpdateGaugeMetric(ctx, "b", 1), ErrCardinalityLimitExceeded)
+	assert.ErrorIs(t, s.DeleteMetric(ctx, "b"), repositories.ErrMetricNotFound)
+
+	assert.NoError(t, s.DeleteMetric(ctx, "a"))
+	assert.NoError(t, s.UpdateGaugeMetric(ctx, "b", 1), "deleted series free their slot")
+}
+
+func TestService_DeleteMetrics(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()), WithCardinalityLimit(3, CardinalityModeReject))
+	require.NoError(t, s.UpdateMetricsBatch(ctx, gauges("user_1", "user_2", "HeapAlloc")))
+
+	names, err := s.DeleteMetrics(ctx, repositories.Selector{Prefix: "user_"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user_1", "user_2"}, names)
+	metrics, err := s.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 3, "a dry run removes nothing")
+
+	names, err = s.DeleteMetrics(ctx, repositories.Selector{Prefix: "user_"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user_1", "user_2"}, names)
+	metrics, err = s.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, gauges("HeapAlloc"), metrics)
+
+	assert.NoError(t, s.UpdateMetricsBatch(ctx, gauges("user_3", "user_4")), "deleted series free their slots")
+}
+
+func TestService_CardinalityDrop(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()), WithCardinalityLimit(2, CardinalityModeDrop))
+
+	accepted, err := s.UpdateMetricsBatchAccepted(ctx, gauges("a1", "b1", "c1"))
+	require.NoError(t, err)
+	assert.Equal(t, gauges("a1", "b1"), accepted)
+
+	metrics, err := s.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+	assert.Contains(t, metrics, "a1")
+	assert.Contains(t, metrics, "b1")
+
+	assert.ErrorIs(t, s.UpdateCounterMetric(ctx, "d1", 1), ErrCardinalityLimitExceeded,
+		"single updates cannot be dropped silently")
+
+	require.NoError(t, s.DeleteTenant(ctx, ""))
+	assert.NoError(t, s.UpdateMetricsBatch(ctx, gauges("c1", "d1")), "deleted series free the limit")
+
+	report, err := s.Cardinality(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Series)
+	assert.Equal(t, uint64(2), report.Rejected)
+}
+
+func TestService_CardinalityDisabled(t *testing.T) {
+	s := NewService(&mockRepo{}, WithCardinalityLimit(0, CardinalityModeReject))
+	assert.Nil(t, s.cardinality)
+
+	report, err := s.Cardinality(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, report.Limit)
+}
+
+func TestSeriesPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"http_requests_total", "http"},
+		{"CPUutilization3", "CPUutilization"},
+		{"HeapAlloc", "HeapAlloc"},
+		{"api.v1.latency", "api"},
+		{"_private", "_private"},
+		{"averyveryveryveryveryverylongmetricname", "averyveryveryveryveryverylongmet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, seriesPrefix(tt.name))
+		})
+	}
+}
+
+func TestParseCardinalityMode(t *testing.T) {
+	mode, err := ParseCardinalityMode("")
+	require.NoError(t, err)
+	assert.Equal(t, CardinalityModeReject, mode)
+
+	_, err = ParseCardinalityMode("ignore")
+	assert.Error(t, err)
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+)
+
+// MaxCounterWindow is the longest window CounterRate accepts. Counter increments are kept for this long.
+const MaxCounterWindow = time.Hour
+
+// Errors of counter writes and rates.
+var (
+	ErrNegativeCounter = errors.New("counters cannot decrease")
+	ErrNotCounter      = errors.New("metric is not a counter")
+	ErrInvalidWindow   = errors.New("invalid window")
+)
+
+// CounterRate is the increase of a counter within a window.
+type CounterRate struct {
+	Increase int64
+	// Rate is the average increase per second.
+	Rate float64
+	// Resets is the number of restarts of a cumulative sender detected within the window.
+	Resets int
+}
+
+// maxCumulativeSenders is the number of senders whose running totals are kept for a cumulative series.
+// Beyond it the sender that reported least recently is forgotten; its next total becomes its baseline.
+const maxCumulativeSenders = 64
+
+// counterEvent sums the increments of a counter, and the resets of its cumulative senders, within one
+// second, so that the history of a series holds at most one event per second of MaxCounterWindow.
+type counterEvent struct {
+	at     time.Time
+	delta  int64
+	resets int
+}
+
+// senderTotal is the running total last reported by a cumulative sender.
+type senderTotal struct {
+	total int64
+	at    time.Time
+}
+
+// seriesLock serializes the batches converting the running totals of a sender for a series.
+type seriesLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// counterTracker keeps the running totals last reported by cumulative senders and the increments of
+// every counter within MaxCounterWindow. Both live in memory only: after a restart, the first running
+// total of a stored counter becomes the baseline of its sender and rates cover the new process only.
+type counterTracker struct {
+	mu sync.Mutex
+	// totals holds the running totals of the cumulative senders of every series, by series key and sender.
+	totals  map[string]map[string]senderTotal
+	history map[string][]counterEvent
+	// locks are the locks of the baselines in use, by baselineKey.
+	locks map[string]*seriesLock
+	now   func() time.Time
+}
+
+func newCounterTracker() *counterTracker {
+	return &counterTracker{
+		totals:  make(map[string]map[string]senderTotal),
+		history: make(map[string][]counterEvent),
+		locks:   make(map[string]*seriesLock),
+		now:     time.Now,
+	}
+}
+
+// senderOf identifies the sender of running totals: the API token, the client certificate and the agent
+// instance a request is made with. Agents sharing a token keep apart baselines by their instance IDs.
+func senderOf(id identity.Identity) string {
+	return id.Token + "\x00" + id.Agent + "\x00" + id.Instance
+}
+
+// baselineKey is the key of the running total of sender for a series.
+func baselineKey(key, sender string) string {
+	return key + "\x00" + sender
+}
+
+// lockBaselines locks the baselines of keys, in order so that batches sharing baselines cannot
+// deadlock, and returns the function unlocking them. Batches of other series and senders convert
+// their running totals in parallel.
+func (t *counterTracker) lockBaselines(keys []string) func() {
+	sort.Strings(keys)
+	locks := make([]*seriesLock, len(keys))
+	t.mu.Lock()
+	for i, key := range keys {
+		l, ok := t.locks[key]
+		if !ok {
+			l = &seriesLock{}
+			t.locks[key] = l
+		}
+		l.refs++
+		locks[i] = l
+	}
+	t.mu.Unlock()
+
+	for _, l := range locks {
+		l.mu.Lock()
+	}
+	return func() {
+		for _, l := range locks {
+			l.mu.Unlock()
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for i, key := range keys {
+			if locks[i].refs--; locks[i].refs == 0 {
+				delete(t.locks, key)
+			}
+		}
+	}
+}
+
+// lastTotal returns the running total last reported by sender for a cumulative series.
+func (t *counterTracker) lastTotal(key, sender string) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, ok := t.totals[key][sender]
+	return last.total, ok
+}
+
+// commitTotal records the running total reported by sender for a cumulative series and whether it reset.
+func (t *counterTracker) commitTotal(key, sender string, total int64, reset bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	senders := t.totals[key]
+	if senders == nil {
+		senders = make(map[string]senderTotal)
+		t.totals[key] = senders
+	}
+	if _, ok := senders[sender]; !ok && len(senders) >= maxCumulativeSenders {
+		oldest := ""
+		for other, last := range senders {
+			if oldest == "" || last.at.Before(senders[oldest].at) {
+				oldest = other
+			}
+		}
+		delete(senders, oldest)
+	}
+	senders[sender] = senderTotal{total: total, at: now}
+	if reset {
+		t.appendLocked(key, now, 0, 1)
+	}
+}
+
+// record records increments of counters.
+func (t *counterTracker) record(tenant string, increments map[string]int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for name, delta := range increments {
+		t.appendLocked(seriesKey(tenant, name), now, delta, 0)
+	}
+}
+
+// appendLocked adds an increment and resets to the event of their second and drops the events of the
+// series older than MaxCounterWindow.
+func (t *counterTracker) appendLocked(key string, at time.Time, delta int64, resets int) {
+	at = at.Truncate(time.Second)
+	events := t.history[key]
+	if n := len(events); n > 0 && events[n-1].at.Equal(at) {
+		events[n-1].delta += delta
+		events[n-1].resets += resets
+		return
+	}
+
+	cutoff := at.Add(-MaxCounterWindow)
+	i := 0
+	for i < len(events) && !events[i].at.After(cutoff) {
+		i++
+	}
+	t.history[key] = append(events[i:], counterEvent{at: at, delta: delta, resets: resets})
+}
+
+// rate sums the events of a series within window.
+func (t *counterTracker) rate(key string, window time.Duration) CounterRate {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := t.now().Add(-window)
+	var rate CounterRate
+	for _, event := range t.history[key] {
+		if !event.at.After(cutoff) {
+			continue
+		}
+		rate.Increase += event.delta
+		rate.Resets += event.resets
+	}
+	rate.Rate = float64(rate.Increase) / window.Seconds()
+	return rate
+}
+
+// forget drops the state of deleted series.
+func (t *counterTracker) forget(keys []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		delete(t.totals, key)
+		delete(t.history, key)
+	}
+}
+
+// forgetTenant drops the state of every series of a deleted tenant.
+func (t *counterTracker) forgetTenant(tenant string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key := range t.history {
+		if keyTenant, _, _ := strings.Cut(key, "\x00"); keyTenant == tenant {
+			delete(t.history, key)
+		}
+	}
+	for key := range t.totals {
+		if keyTenant, _, _ := strings.Cut(key, "\x00"); keyTenant == tenant {
+			delete(t.totals, key)
+		}
+	}
+}
+
+// counterState returns the counter tracker, creating it on first use.
+func (s *Service) counterState() *counterTracker {
+	s.countersOnce.Do(func() {
+		s.counters = newCounterTracker()
+	})
+	return s.counters
+}
+
+// checkMonotonic rejects counters that would decrease: negative increments and negative running totals.
+func checkMonotonic(metrics map[string]repositories.Metric) error {
+	for name, metric := range metrics {
+		if metric.Type != constants.MetricTypeCounter {
+			continue
+		}
+		if value, ok := metric.Value.(int64); ok && value < 0 {
+			return fmt.Errorf("%w: %s has negative value %d", ErrNegativeCounter, name, value)
+		}
+	}
+	return nil
+}
+
+// hasCumulative reports whether a batch holds running totals.
+func hasCumulative(metrics map[string]repositories.Metric) bool {
+	for _, metric := range metrics {
+		if metric.Cumulative {
+			return true
+		}
+	}
+	return false
+}
+
+// cumulativeTotal is a running total to commit once its increment is stored.
+type cumulativeTotal struct {
+	total int64
+	reset bool
+}
+
+// toIncrements converts the running totals of a batch to increments against the totals last reported
+// for them by the sender of ctx. A total below the last one means the sender restarted and counted from
+// zero again, so the whole total is the increment. The first total of a new series is its initial value;
+// the first total of a sender for a series stored before is only the baseline of its later increments.
+// The caller holds the locks of the baselines of the batch.
+func (s *Service) toIncrements(ctx context.Context, metrics map[string]repositories.Metric) (map[string]repositories.Metric, map[string]cumulativeTotal, error) {
+	tenant := identity.Tenant(ctx)
+	sender := senderOf(identity.FromContext(ctx))
+	tracker := s.counterState()
+
+	increments := make(map[string]repositories.Metric, len(metrics))
+	totals := make(map[string]cumulativeTotal)
+	for name, metric := range metrics {
+		if !metric.Cumulative {
+			increments[name] = metric
+			continue
+		}
+		total, ok := metric.Value.(int64)
+		if metric.Type != constants.MetricTypeCounter || !ok {
+			return nil, nil, repositories.ErrMetricInvalidType
+		}
+
+		var delta int64
+		reset := false
+		last, seen := tracker.lastTotal(seriesKey(tenant, name), sender)
+		switch {
+		case seen && total >= last:
+			delta = total - last
+		case seen:
+			delta = total
+			reset = true
+			logger.Log.Info("Detected counter reset",
+				zap.String("tenant", tenant), zap.String("metric", name), zap.Int64("last", last), zap.Int64("total", total))
+		default:
+			_, err := s.repo.GetMetric(ctx, name)
+			switch {
+			case errors.Is(err, repositories.ErrMetricNotFound):
+				delta = total
+			case err != nil:
+				return nil, nil, err
+			}
+		}
+
+		increments[name] = repositories.Metric{Type: constants.MetricTypeCounter, Value: delta}
+		totals[name] = cumulativeTotal{total: total, reset: reset}
+	}
+	return increments, totals, nil
+}
+
+// recordWrite records the write of metrics by the tenant of ctx for counter rates.
+func (s *Service) recordWrite(ctx context.Context, metrics map[string]repositories.Metric) {
+	increments := make(map[string]int64)
+	for name, metric := range metrics {
+		if delta, ok := metric.Value.(int64); ok && metric.Type == constants.MetricTypeCounter {
+			increments[name] = delta
+		}
+	}
+	if len(increments) > 0 {
+		s.counterState().record(identity.Tenant(ctx), increments)
+	}
+}
+
+// CounterRate returns the increase of a counter of the tenant of ctx within window, its average rate per
+// second and the resets of its cumulative sender detected within window. Only increments written since
+// the server started are counted.
+func (s *Service) CounterRate(ctx context.Context, name string, window time.Duration) (CounterRate, error) {
+	if window <= 0 || window > MaxCounterWindow {
+		return CounterRate{}, fmt.Errorf("%w: %s must be positive and at most %s", ErrInvalidWindow, window, MaxCounterWindow)
+	}
+
+	metric, err := s.repo.GetMetric(ctx, name)
+	if err != nil {
+		return CounterRate{}, err
+	}
+	if metric.Type != constants.MetricTypeCounter {
+		return CounterRate{}, fmt.Errorf("%w: %s is a %s", ErrNotCounter, name, metric.Type)
+	}
+
+	return s.counterState().rate(seriesKey(identity.Tenant(ctx), name), window), nil
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+)
+
+func newCounterService() (*Service, *fakeClock) {
+	s := NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s.counterState().now = clock.Now
+	return s, clock
+}
+
+func cumulative(name string, total int64) map[string]repositories.Metric {
+	return map[string]repositories.Metric{
+		name: {Type: constants.MetricTypeCounter, Value: total, Cumulative: true},
+	}
+}
+
+func TestService_CumulativeCounter(t *testing.T) {
+	ctx := context.Background()
+	s, clock := newCounterService()
+
+	totals := []struct {
+		total int64
+		want  int64
+	}{
+		{total: 5, want: 5},
+		{total: 8, want: 8},
+		{total: 8, want: 8},
+		{total: 3, want: 11},
+		{total: 10, want: 18},
+	}
+	for _, tt := range totals {
+		clock.Advance(10 * time.Second)
+		require.NoError(t, s.UpdateMetricsBatch(ctx, cumulative("polls", tt.total)))
+		metric, err := s.GetMetric(ctx, "polls")
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, metric.Value, "after total %d", tt.total)
+	}
+
+	rate, err := s.CounterRate(ctx, "polls", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, CounterRate{Increase: 18, Rate: 0.3, Resets: 1}, rate)
+
+	rate, err = s.CounterRate(ctx, "polls", 15*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, CounterRate{Increase: 10, Rate: 10.0 / 15, Resets: 1}, rate)
+}
+
+func TestService_CumulativeCounterBaseline(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newCounterService()
+
+	require.NoError(t, s.UpdateCounterMetric(ctx, "polls", 100))
+	require.NoError(t, s.UpdateMetricsBatch(ctx, cumulative("polls", 40)))
+
+	metric, err := s.GetMetric(ctx, "polls")
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), metric.Value, "the first total of a stored series is a baseline")
+
+	require.NoError(t, s.UpdateMetricsBatch(ctx, cumulative("polls", 45)))
+	metric, err = s.GetMetric(ctx, "polls")
+	require.NoError(t, err)
+	assert.Equal(t, int64(105), metric.Value)
+
+	teamA := identity.WithTenant(ctx, "team-a")
+	require.NoError(t, s.UpdateMetricsBatch(teamA, cumulative("polls", 3)))
+	metric, err = s.GetMetric(teamA, "polls")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), metric.Value, "tenants track their own totals")
+
+	require.NoError(t, s.DeleteMetric(ctx, "polls"))
+	require.NoError(t, s.UpdateMetricsBatch(ctx, cumulative("polls", 2)))
+	metric, err = s.GetMetric(ctx, "polls")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), metric.Value, "a deleted series starts over")
+}
+
+func TestService_CumulativeCounterSenders(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newCounterService()
+	agent := func(instance string) context.Context {
+		return identity.WithIdentity(ctx, identity.Identity{Token: "agents", Instance: instance})
+	}
+
+	require.NoError(t, s.UpdateMetricsBatch(agent("node-1"), cumulative("polls", 10)))
+	require.NoError(t, s.UpdateMetricsBatch(agent("node-2"), cumulative("polls", 3)))
+	require.NoError(t, s.UpdateMetricsBatch(agent("node-1"), cumulative("polls", 12)))
+	require.NoError(t, s.UpdateMetricsBatch(agent("node-2"), cumulative("polls", 7)))
+
+	metric, err := s.GetMetric(ctx, "polls")
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), metric.Value, "senders sharing a token keep their own totals")
+
+	rate, err := s.CounterRate(ctx, "polls", time.Minute)
+	require.NoError(t, err)
+	assert.Zero(t, rate.Resets, "interleaved senders are not taken for resets")
+}
+
+func TestService_CounterHistoryBuckets(t *testing.T) {
+	ctx := context.Background()
+	s, clock := newCounterService()
+
+	for i := 0; i < 100; i++ {
+		clock.Advance(time.Millisecond)
+		require.NoError(t, s.UpdateCounterMetric(ctx, "polls", 1))
+	}
+	clock.Advance(time.Second)
+	require.NoError(t, s.UpdateCounterMetric(ctx, "polls", 1))
+
+	assert.Len(t, s.counterState().history[seriesKey("", "polls")], 2, "increments are kept per second")
+	rate, err := s.CounterRate(ctx, "polls", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(101), rate.Increase)
+}
+
+func TestService_CumulativeCounterConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newCounterService()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		instance := fmt.Sprintf("node-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sender := identity.WithIdentity(ctx, identity.Identity{Instance: instance})
+			for total := int64(1); total <= 50; total++ {
+				assert.NoError(t, s.UpdateMetricsBatch(sender, cumulative("polls", total)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	metric, err := s.GetMetric(ctx, "polls")
+	require.NoError(t, err)
+	// Every sender adds its 49 increments after its first total, which only the senders racing to create
+	// the series count.
+	initial := metric.Value.(int64) - 8*49
+	assert.True(t, initial >= 1 && initial <= 8, "initial totals counted: %d", initial)
+	assert.Empty(t, s.counterState().locks, "released locks are dropped")
+}
+
+func TestService_CounterErrors(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newCounterService()
+	require.NoError(t, s.UpdateGaugeMetric(ctx, "load", 1))
+
+	tests := []struct {
+		name    string
+		run     func() error
+		wantErr error
+	}{
+		{
+			name:    "Test #1 negative increment",
+			run:     func() error { return s.UpdateCounterMetric(ctx, "polls", -1) },
+			wantErr: ErrNegativeCounter,
+		},
+		{
+			name:    "Test #2 negative total",
+			run:     func() error { return s.UpdateMetricsBatch(ctx, cumulative("polls", -1)) },
+			wantErr: ErrNegativeCounter,
+		},
+		{
+			name: "Test #3 rate of a gauge",
+			run: func() error {
+				_, err := s.CounterRate(ctx, "load", time.Minute)
+				return err
+			},
+			wantErr: ErrNotCounter,
+		},
+		{
+			name: "Test #4 rate of a missing metric",
+			run: func() error {
+				_, err := s.CounterRate(ctx, "missing", time.Minute)
+				return err
+			},
+			wantErr: repositories.ErrMetricNotFound,
+		},
+		{
+			name: "Test #5 window too long",
+			run: func() error {
+				_, err := s.CounterRate(ctx, "load", 2*MaxCounterWindow)
+				return err
+			},
+			wantErr: ErrInvalidWindow,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.run(), tt.wantErr)
+		})
+	}
+}
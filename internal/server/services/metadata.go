@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+)
+
+// ErrInvalidMetadata is returned when registered metadata is malformed.
+var ErrInvalidMetadata = errors.New("invalid metric metadata")
+
+// ErrMetadataLimitExceeded is returned when an update would register metadata for more metrics than a
+// tenant may describe.
+var ErrMetadataLimitExceeded = errors.New("metadata limit exceeded")
+
+// maxMetadataEntries is the number of metrics every tenant can register metadata for.
+const maxMetadataEntries = 10000
+
+// Limits of the metadata fields, in bytes.
+const (
+	maxMetadataUnitLen  = 64
+	maxMetadataHelpLen  = 1024
+	maxMetadataOwnerLen = 128
+)
+
+// UpdateMetadata registers the metadata of metrics of the tenant of ctx, replacing previously registered
+// metadata. Metadata can be registered before the metrics are written and outlives their deletion.
+// Metrics described before they are written count against the series quota, and a tenant describes
+// at most maxMetadataEntries metrics. The whole update is rejected with ErrInvalidMetadata when any
+// entry is malformed, and with ErrSeriesQuotaExceeded or ErrMetadataLimitExceeded over the limits.
+func (s *Service) UpdateMetadata(ctx context.Context, metadata map[string]repositories.Metadata) error {
+	names := make([]string, 0, len(metadata))
+	for name, meta := range metadata {
+		if err := validateMetadata(name, meta); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	return s.withinQuota(ctx, names, func() ([]string, error) {
+		s.metadataMu.Lock()
+		defer s.metadataMu.Unlock()
+
+		registered, err := s.repo.GetMetadata(ctx)
+		if err != nil {
+			return nil, err
+		}
+		entries := len(registered)
+		for _, name := range names {
+			if _, ok := registered[name]; !ok {
+				entries++
+			}
+		}
+		if entries > maxMetadataEntries {
+			return nil, fmt.Errorf("%w: tenant %q would describe %d of %d metrics",
+				ErrMetadataLimitExceeded, identity.Tenant(ctx), entries, maxMetadataEntries)
+		}
+
+		return names, s.repo.UpdateMetadata(ctx, metadata)
+	})
+}
+
+// GetMetadata retrieves the registered metadata of all metrics of the tenant of ctx.
+func (s *Service) GetMetadata(ctx context.Context) (map[string]repositories.Metadata, error) {
+	return s.repo.GetMetadata(ctx)
+}
+
+// describe attaches registered metadata to a metric. Metrics without metadata are returned as is.
+func describe(metric repositories.Metric, meta repositories.Metadata) repositories.Metric {
+	if meta != (repositories.Metadata{}) {
+		metric.Metadata = &meta
+	}
+	return metric
+}
+
+func validateMetadata(name string, meta repositories.Metadata) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: empty metric name", ErrInvalidMetadata)
+	case meta.Type != "" && meta.Type != constants.MetricTypeGauge && meta.Type != constants.MetricTypeCounter:
+		return fmt.Errorf("%w: %s: unknown type %q", ErrInvalidMetadata, name, meta.Type)
+	case len(meta.Unit) > maxMetadataUnitLen || strings.IndexFunc(meta.Unit, unicode.IsSpace) >= 0:
+		return fmt.Errorf("%w: %s: unit must be at most %d bytes without spaces", ErrInvalidMetadata, name, maxMetadataUnitLen)
+	case len(meta.Help) > maxMetadataHelpLen || strings.ContainsAny(meta.Help, "\r\n"):
+		return fmt.Errorf("%w: %s: help must be a single line of at most %d bytes", ErrInvalidMetadata, name, maxMetadataHelpLen)
+	case len(meta.Owner) > maxMetadataOwnerLen || strings.ContainsAny(meta.Owner, "\r\n"):
+		return fmt.Errorf("%w: %s: owner must be a single line of at most %d bytes", ErrInvalidMetadata, name, maxMetadataOwnerLen)
+	}
+	return nil
+}
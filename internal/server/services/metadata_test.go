@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+)
+
+func TestService_Metadata(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+
+	require.NoError(t, s.UpdateMetadata(ctx, map[string]repositories.Metadata{
+		"TotalMemory": {Type: "gauge", Unit: "bytes", Help: "Total amount of RAM."},
+		"Unwritten":   {Type: "gauge", Unit: "seconds"},
+	}))
+	require.NoError(t, s.UpdateMetricsBatch(ctx, gauges("TotalMemory", "load")))
+
+	metric, err := s.GetMetric(ctx, "TotalMemory")
+	require.NoError(t, err)
+	require.NotNil(t, metric.Metadata)
+	assert.Equal(t, repositories.Metadata{Type: "gauge", Unit: "bytes", Help: "Total amount of RAM."}, *metric.Metadata)
+
+	metrics, err := s.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"TotalMemory", "load"}, keys(metrics), "metadata does not create metrics")
+	assert.Equal(t, "bytes", metrics["TotalMemory"].Metadata.Unit)
+	assert.Nil(t, metrics["load"].Metadata)
+
+	metadata, err := s.GetMetadata(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metadata, 2)
+}
+
+func TestService_UpdateMetadataValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]repositories.Metadata
+		wantErr  bool
+	}{
+		{name: "Test #1 valid", metadata: map[string]repositories.Metadata{"Alloc": {Type: "gauge", Unit: "bytes", Help: "Heap bytes."}}},
+		{name: "Test #2 no type", metadata: map[string]repositories.Metadata{"Alloc": {Unit: "bytes"}}},
+		{name: "Test #3 empty name", metadata: map[string]repositories.Metadata{"": {Unit: "bytes"}}, wantErr: true},
+		{name: "Test #4 unknown type", metadata: map[string]repositories.Metadata{"Alloc": {Type: "histogram"}}, wantErr: true},
+		{name: "Test #5 unit with spaces", metadata: map[string]repositories.Metadata{"Alloc": {Unit: "mega bytes"}}, wantErr: true},
+		{name: "Test #6 multiline help", metadata: map[string]repositories.Metadata{"Alloc": {Help: "a\nb"}}, wantErr: true},
+		{name: "Test #7 long help", metadata: map[string]repositories.Metadata{"Alloc": {Help: strings.Repeat("a", maxMetadataHelpLen+1)}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+			err := s.UpdateMetadata(context.Background(), tt.metadata)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidMetadata)
+				metadata, getErr := s.GetMetadata(context.Background())
+				require.NoError(t, getErr)
+				assert.Empty(t, metadata, "a rejected update stores nothing")
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestService_Metadata_SeriesQuota(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()), WithSeriesQuota(2))
+
+	require.NoError(t, s.UpdateMetricsBatch(ctx, gauges("a")))
+	require.NoError(t, s.UpdateMetadata(ctx, map[string]repositories.Metadata{"a": {Unit: "bytes"}, "b": {Unit: "bytes"}}))
+	assert.ErrorIs(t, s.UpdateMetadata(ctx, map[string]repositories.Metadata{"c": {Unit: "bytes"}}), ErrSeriesQuotaExceeded,
+		"metrics described before they are written take a series")
+	assert.ErrorIs(t, s.UpdateGaugeMetric(ctx, "c", 1), ErrSeriesQuotaExceeded)
+	assert.NoError(t, s.UpdateGaugeMetric(ctx, "b", 1), "described metrics can be written")
+
+	storage := memstorage.NewMemStorage()
+	require.NoError(t, repositories.NewMetricRepo(storage).UpdateMetadata(ctx, map[string]repositories.Metadata{"a": {Unit: "bytes"}}))
+	restarted := NewService(repositories.NewMetricRepo(storage), WithSeriesQuota(1))
+	assert.ErrorIs(t, restarted.UpdateGaugeMetric(ctx, "b", 1), ErrSeriesQuotaExceeded, "stored metadata is counted after a restart")
+}
+
+func TestService_Metadata_Limit(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()))
+
+	metadata := make(map[string]repositories.Metadata, maxMetadataEntries)
+	for i := 0; i < maxMetadataEntries; i++ {
+		metadata[fmt.Sprintf("m%d", i)] = repositories.Metadata{Unit: "bytes"}
+	}
+	require.NoError(t, s.UpdateMetadata(ctx, metadata))
+	assert.NoError(t, s.UpdateMetadata(ctx, map[string]repositories.Metadata{"m0": {Unit: "seconds"}}), "registered metrics can be described again")
+
+	err := s.UpdateMetadata(ctx, map[string]repositories.Metadata{"extra": {Unit: "bytes"}})
+	assert.ErrorIs(t, err, ErrMetadataLimitExceeded)
+	assert.NoError(t, s.UpdateMetadata(identity.WithTenant(ctx, "team-a"), map[string]repositories.Metadata{"extra": {Unit: "bytes"}}),
+		"the limit applies per tenant")
+}
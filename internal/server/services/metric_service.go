@@ -3,8 +3,16 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
 
 	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 	"github.com/a2sh3r/sysmetrics/internal/server/utils"
 )
@@ -15,41 +23,344 @@ type MetricRepository interface {
 	GetMetric(ctx context.Context, metricName string) (repositories.Metric, error)
 	GetMetrics(ctx context.Context) (map[string]repositories.Metric, error)
 	UpdateMetricsBatch(ctx context.Context, metrics map[string]repositories.Metric) error
+	CreateCounter(ctx context.Context, metricName string, delta int64) error
+	ListTenants(ctx context.Context) ([]string, error)
+	DeleteTenant(ctx context.Context, tenant string) error
+	DeleteMetric(ctx context.Context, metricName string) error
+	DeleteBySelector(ctx context.Context, selector repositories.Selector) ([]string, error)
+	GetUpdateTimes(ctx context.Context) (map[string]time.Time, error)
+	DeleteExpired(ctx context.Context, series []repositories.ExpiringSeries) ([]repositories.ExpiringSeries, error)
+	UpdateMetadata(ctx context.Context, metadata map[string]repositories.Metadata) error
+	GetMetadata(ctx context.Context) (map[string]repositories.Metadata, error)
+	GetRollups(ctx context.Context, metricName string, window time.Duration) ([]repositories.Rollup, error)
+	CompactRollups(ctx context.Context, window, into time.Duration, before time.Time) (int, error)
+	RollupSizes(ctx context.Context) (map[time.Duration]int, error)
 }
 
 // Service provides business logic for working with metrics.
 type Service struct {
-	repo MetricRepository
+	repo        MetricRepository
+	quota       *quotaTracker
+	cardinality *cardinalityGuard
+	staleness   *stalenessTracker
+	retention   *retentionPolicy
+
+	// metadataMu serialises metadata updates, so that they cannot overshoot maxMetadataEntries.
+	metadataMu sync.Mutex
+
+	countersOnce sync.Once
+	counters     *counterTracker
+}
+
+// Option configures optional Service settings.
+type Option func(*Service)
+
+// TenantUsage describes the number of series a tenant stores.
+type TenantUsage struct {
+	Tenant string `json:"tenant"`
+	Series int    `json:"series"`
+	Quota  int    `json:"quota,omitempty"`
 }
 
 // NewService creates a new Service instance.
-func NewService(repo MetricRepository) *Service {
-	return &Service{repo: repo}
+func NewService(repo MetricRepository, opts ...Option) *Service {
+	s := &Service{repo: repo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // UpdateGaugeMetric updates a gauge metric.
 func (s *Service) UpdateGaugeMetric(ctx context.Context, name string, value float64) error {
-	return s.repo.SaveMetric(ctx, name, value, constants.MetricTypeGauge)
+	return s.withinQuota(ctx, []string{name}, func() ([]string, error) {
+		return []string{name}, s.withinCardinality(ctx, []string{name}, false, func([]string) error {
+			return s.repo.SaveMetric(ctx, name, value, constants.MetricTypeGauge)
+		})
+	})
 }
 
-// UpdateCounterMetric updates a counter metric.
+// UpdateCounterMetric increments a counter metric. Negative increments are rejected.
 func (s *Service) UpdateCounterMetric(ctx context.Context, name string, value int64) error {
-	return s.repo.SaveMetric(ctx, name, value, constants.MetricTypeCounter)
+	if value < 0 {
+		return fmt.Errorf("%w: %s has negative value %d", ErrNegativeCounter, name, value)
+	}
+	return s.withinQuota(ctx, []string{name}, func() ([]string, error) {
+		return []string{name}, s.withinCardinality(ctx, []string{name}, false, func([]string) error {
+			if err := s.repo.SaveMetric(ctx, name, value, constants.MetricTypeCounter); err != nil {
+				return err
+			}
+			s.recordWrite(ctx, map[string]repositories.Metric{
+				name: {Type: constants.MetricTypeCounter, Value: value},
+			})
+			return nil
+		})
+	})
 }
 
-// GetMetric retrieves a metric by name.
+// CreateCounterMetric creates a counter with the value value. It returns repositories.ErrMetricExists
+// when a metric of that name is stored, so that concurrent creations of a counter store it once.
+func (s *Service) CreateCounterMetric(ctx context.Context, name string, value int64) error {
+	if value < 0 {
+		return fmt.Errorf("%w: %s has negative value %d", ErrNegativeCounter, name, value)
+	}
+	return s.withinQuota(ctx, []string{name}, func() ([]string, error) {
+		return []string{name}, s.withinCardinality(ctx, []string{name}, false, func([]string) error {
+			if err := s.repo.CreateCounter(ctx, name, value); err != nil {
+				return err
+			}
+			s.recordWrite(ctx, map[string]repositories.Metric{
+				name: {Type: constants.MetricTypeCounter, Value: value},
+			})
+			return nil
+		})
+	})
+}
+
+// GetMetric retrieves a metric by name with its registered metadata. Metrics not updated within
+// their TTL are marked stale.
 func (s *Service) GetMetric(ctx context.Context, metricName string) (repositories.Metric, error) {
-	return s.repo.GetMetric(ctx, metricName)
+	metric, err := s.repo.GetMetric(ctx, metricName)
+	if err != nil {
+		return metric, err
+	}
+	metadata, err := s.repo.GetMetadata(ctx)
+	if err != nil {
+		return repositories.Metric{}, err
+	}
+	marked := map[string]repositories.Metric{metricName: metric}
+	if err := s.markStale(ctx, marked); err != nil {
+		return repositories.Metric{}, err
+	}
+	return describe(marked[metricName], metadata[metricName]), nil
 }
 
-// GetMetrics retrieves all metrics.
+// GetMetrics retrieves all metrics with their registered metadata. Metrics not updated within their
+// TTL are marked stale; listings are expected to hide them.
 func (s *Service) GetMetrics(ctx context.Context) (map[string]repositories.Metric, error) {
-	return s.repo.GetMetrics(ctx)
+	metrics, err := s.repo.GetMetrics(ctx)
+	if err != nil {
+		return metrics, err
+	}
+	metadata, err := s.repo.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.staleness == nil && len(metadata) == 0 {
+		return metrics, nil
+	}
+	marked := make(map[string]repositories.Metric, len(metrics))
+	for name, metric := range metrics {
+		marked[name] = describe(metric, metadata[name])
+	}
+	if err := s.markStale(ctx, marked); err != nil {
+		return nil, err
+	}
+	return marked, nil
 }
 
-// UpdateMetricsBatch updates a batch of metrics.
+// UpdateMetricsBatch updates a batch of metrics. Counters marked Cumulative carry the running total of
+// their sender and are stored as the increment since the total it reported last.
 func (s *Service) UpdateMetricsBatch(ctx context.Context, metrics map[string]repositories.Metric) error {
-	return s.repo.UpdateMetricsBatch(ctx, metrics)
+	_, err := s.UpdateMetricsBatchAccepted(ctx, metrics)
+	return err
+}
+
+// UpdateMetricsBatchAccepted updates a batch of metrics like UpdateMetricsBatch and returns the metrics
+// stored, which leave out the series dropped by the cardinality guard. Cumulative counters are returned
+// with the increment stored.
+func (s *Service) UpdateMetricsBatchAccepted(ctx context.Context, metrics map[string]repositories.Metric) (map[string]repositories.Metric, error) {
+	if err := checkMonotonic(metrics); err != nil {
+		return nil, err
+	}
+	if !hasCumulative(metrics) {
+		return s.storeBatch(ctx, metrics)
+	}
+
+	tenant := identity.Tenant(ctx)
+	sender := senderOf(identity.FromContext(ctx))
+	tracker := s.counterState()
+	var baselines []string
+	for name, metric := range metrics {
+		if metric.Cumulative {
+			baselines = append(baselines, baselineKey(seriesKey(tenant, name), sender))
+		}
+	}
+	defer tracker.lockBaselines(baselines)()
+
+	increments, totals, err := s.toIncrements(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+	accepted, err := s.storeBatch(ctx, increments)
+	if err != nil {
+		return nil, err
+	}
+	for name, total := range totals {
+		if _, ok := accepted[name]; ok {
+			tracker.commitTotal(seriesKey(tenant, name), sender, total.total, total.reset)
+		}
+	}
+	return accepted, nil
+}
+
+// storeBatch writes a batch of metrics within the series quota and cardinality limit and returns the
+// metrics written, which leave out the series dropped by the cardinality guard.
+func (s *Service) storeBatch(ctx context.Context, metrics map[string]repositories.Metric) (map[string]repositories.Metric, error) {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	var accepted map[string]repositories.Metric
+	err := s.withinQuota(ctx, names, func() ([]string, error) {
+		err := s.withinCardinality(ctx, names, true, func(dropped []string) error {
+			if len(dropped) == 0 {
+				if err := s.repo.UpdateMetricsBatch(ctx, metrics); err != nil {
+					return err
+				}
+				accepted = metrics
+				s.recordWrite(ctx, accepted)
+				return nil
+			}
+
+			logger.Log.Warn("Dropped new series beyond the cardinality limit",
+				zap.String("tenant", identity.Tenant(ctx)),
+				zap.Int("dropped", len(dropped)),
+				zap.Strings("first_series", dropped[:min(len(dropped), 10)]))
+
+			kept := make(map[string]repositories.Metric, len(metrics))
+			for name, metric := range metrics {
+				kept[name] = metric
+			}
+			for _, name := range dropped {
+				delete(kept, name)
+			}
+			if len(kept) == 0 {
+				return nil
+			}
+			if err := s.repo.UpdateMetricsBatch(ctx, kept); err != nil {
+				return err
+			}
+			accepted = kept
+			s.recordWrite(ctx, accepted)
+			return nil
+		})
+		written := make([]string, 0, len(accepted))
+		for name := range accepted {
+			written = append(written, name)
+		}
+		return written, err
+	})
+	return accepted, err
+}
+
+// Cardinality reports the state of the cardinality guard. It reports a zero limit when the guard is disabled.
+func (s *Service) Cardinality(ctx context.Context) (CardinalityReport, error) {
+	if s.cardinality == nil {
+		return CardinalityReport{TopPrefixes: []PrefixStats{}}, nil
+	}
+	return s.cardinality.report(ctx, s.repo)
+}
+
+// withinCardinality runs write when the new series of names fit in the cardinality limit. In drop mode
+// write receives the names that must be left out when allowDrop is set.
+func (s *Service) withinCardinality(ctx context.Context, names []string, allowDrop bool, write func(dropped []string) error) error {
+	if s.cardinality == nil {
+		return write(nil)
+	}
+
+	added, dropped, err := s.cardinality.admit(ctx, s.repo, names, allowDrop)
+	if err != nil {
+		return err
+	}
+
+	if err := write(dropped); err != nil {
+		s.cardinality.release(added)
+		return err
+	}
+	return nil
+}
+
+// Usage returns the number of series stored by every tenant.
+func (s *Service) Usage(ctx context.Context) ([]TenantUsage, error) {
+	tenants, err := s.repo.ListTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	quota := 0
+	if s.quota != nil {
+		quota = s.quota.limit
+	}
+	usage := make([]TenantUsage, 0, len(tenants))
+	for _, tenant := range tenants {
+		metrics, err := s.repo.GetMetrics(identity.WithTenant(ctx, tenant))
+		if err != nil {
+			return nil, err
+		}
+		usage = append(usage, TenantUsage{Tenant: tenant, Series: len(metrics), Quota: quota})
+	}
+	return usage, nil
+}
+
+// ListTenants lists the tenants that have metrics.
+func (s *Service) ListTenants(ctx context.Context) ([]string, error) {
+	return s.repo.ListTenants(ctx)
+}
+
+// DeleteTenant removes all metrics of a tenant.
+func (s *Service) DeleteTenant(ctx context.Context, tenant string) error {
+	if err := s.repo.DeleteTenant(ctx, tenant); err != nil {
+		return err
+	}
+	if s.quota != nil {
+		s.quota.forgetTenant(tenant)
+	}
+	if s.cardinality != nil {
+		s.cardinality.forgetTenant(tenant)
+	}
+	s.counterState().forgetTenant(tenant)
+	return nil
+}
+
+// DeleteMetric removes a metric of the tenant of ctx.
+func (s *Service) DeleteMetric(ctx context.Context, name string) error {
+	if err := s.repo.DeleteMetric(ctx, name); err != nil {
+		return err
+	}
+	s.forget([]string{seriesKey(identity.Tenant(ctx), name)})
+	return nil
+}
+
+// DeleteMetrics removes the metrics of the tenant of ctx matched by selector and returns their sorted names.
+// With dryRun set, nothing is removed and the names of the metrics that would be are returned.
+func (s *Service) DeleteMetrics(ctx context.Context, selector repositories.Selector, dryRun bool) ([]string, error) {
+	if dryRun {
+		metrics, err := s.repo.GetMetrics(ctx)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0)
+		for name, metric := range metrics {
+			if selector.Matches(name, metric) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+
+	deleted, err := s.repo.DeleteBySelector(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	tenant := identity.Tenant(ctx)
+	keys := make([]string, len(deleted))
+	for i, name := range deleted {
+		keys[i] = seriesKey(tenant, name)
+	}
+	s.forget(keys)
+	return deleted, nil
 }
 
 // UpdateGaugeMetricWithRetry updates a gauge metric with retry logic.
@@ -66,6 +377,13 @@ func (s *Service) UpdateCounterMetricWithRetry(ctx context.Context, name string,
 	})
 }
 
+// CreateCounterMetricWithRetry creates a counter metric with retry logic.
+func (s *Service) CreateCounterMetricWithRetry(ctx context.Context, name string, value int64) error {
+	return utils.WithRetries(func() error {
+		return s.CreateCounterMetric(ctx, name, value)
+	})
+}
+
 // GetMetricWithRetry retrieves a metric by name with retry logic.
 func (s *Service) GetMetricWithRetry(ctx context.Context, name string) (repositories.Metric, error) {
 	var result repositories.Metric
@@ -94,3 +412,124 @@ func (s *Service) UpdateMetricsBatchWithRetry(ctx context.Context, metrics map[s
 		return s.UpdateMetricsBatch(ctx, metrics)
 	})
 }
+
+// UpdateMetricsBatchAcceptedWithRetry updates a batch of metrics with retry logic and returns the
+// metrics stored.
+func (s *Service) UpdateMetricsBatchAcceptedWithRetry(ctx context.Context, metrics map[string]repositories.Metric) (map[string]repositories.Metric, error) {
+	var accepted map[string]repositories.Metric
+	err := utils.WithRetries(func() error {
+		var err error
+		accepted, err = s.UpdateMetricsBatchAccepted(ctx, metrics)
+		return err
+	})
+	return accepted, err
+}
+
+// DeleteMetricWithRetry removes a metric with retry logic.
+func (s *Service) DeleteMetricWithRetry(ctx context.Context, name string) error {
+	return utils.WithRetries(func() error {
+		return s.DeleteMetric(ctx, name)
+	})
+}
+
+// DeleteMetricsWithRetry removes the metrics matched by selector with retry logic.
+func (s *Service) DeleteMetricsWithRetry(ctx context.Context, selector repositories.Selector, dryRun bool) ([]string, error) {
+	var result []string
+	err := utils.WithRetries(func() error {
+		var err error
+		result, err = s.DeleteMetrics(ctx, selector, dryRun)
+		return err
+	})
+	return result, err
+}
+
+// ListTenantsWithRetry lists the tenants that have metrics with retry logic.
+func (s *Service) ListTenantsWithRetry(ctx context.Context) ([]string, error) {
+	var result []string
+	err := utils.WithRetries(func() error {
+		var err error
+		result, err = s.ListTenants(ctx)
+		return err
+	})
+	return result, err
+}
+
+// DeleteTenantWithRetry removes all metrics of a tenant with retry logic.
+func (s *Service) DeleteTenantWithRetry(ctx context.Context, tenant string) error {
+	return utils.WithRetries(func() error {
+		return s.DeleteTenant(ctx, tenant)
+	})
+}
+
+// UsageWithRetry returns the number of series stored by every tenant with retry logic.
+func (s *Service) UsageWithRetry(ctx context.Context) ([]TenantUsage, error) {
+	var result []TenantUsage
+	err := utils.WithRetries(func() error {
+		var err error
+		result, err = s.Usage(ctx)
+		return err
+	})
+	return result, err
+}
+
+// CardinalityWithRetry reports the state of the cardinality guard with retry logic.
+func (s *Service) CardinalityWithRetry(ctx context.Context) (CardinalityReport, error) {
+	var result CardinalityReport
+	err := utils.WithRetries(func() error {
+		var err error
+		result, err = s.Cardinality(ctx)
+		return err
+	})
+	return result, err
+}
+
+// UpdateMetadataWithRetry registers the metadata of metrics with retry logic.
+func (s *Service) UpdateMetadataWithRetry(ctx context.Context, metadata map[string]repositories.Metadata) error {
+	return utils.WithRetries(func() error {
+		return s.UpdateMetadata(ctx, metadata)
+	})
+}
+
+// GetMetadataWithRetry retrieves the registered metadata of all metrics with retry logic.
+func (s *Service) GetMetadataWithRetry(ctx context.Context) (map[string]repositories.Metadata, error) {
+	var result map[string]repositories.Metadata
+	err := utils.WithRetries(func() error {
+		var err error
+		result, err = s.GetMetadata(ctx)
+		return err
+	})
+	return result, err
+}
+
+// CounterRateWithRetry returns the increase and rate of a counter within window with retry logic.
+func (s *Service) CounterRateWithRetry(ctx context.Context, name string, window time.Duration) (CounterRate, error) {
+	var result CounterRate
+	err := utils.WithRetries(func() error {
+		var err error
+		result, err = s.CounterRate(ctx, name, window)
+		return err
+	})
+	return result, err
+}
+
+// GetRollupsWithRetry returns the rollups of a gauge for windows of the given length with retry logic.
+func (s *Service) GetRollupsWithRetry(ctx context.Context, name string, window time.Duration) ([]repositories.Rollup, error) {
+	var result []repositories.Rollup
+	err := utils.WithRetries(func() error {
+		var err error
+		result, err = s.GetRollups(ctx, name, window)
+		return err
+	})
+	return result, err
+}
+
+// RetentionStatusWithRetry returns the retention tiers of gauge rollups and the last compaction with retry logic.
+func (s *Service) RetentionStatusWithRetry(ctx context.Context) (RetentionStatus, error) {
+	var result RetentionStatus
+	err := utils.WithRetries(func() error {
+		var err error
+		result, err = s.RetentionStatus(ctx)
+		return err
+	})
+	return result, err
+}
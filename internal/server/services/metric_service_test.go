@@ -3,12 +3,16 @@ package services
 import (
 	"context"
 	"fmt"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
 )
 
 func TestNewService(t *testing.T) {
@@ -477,6 +481,32 @@ func TestService_GetMetricsWithRetry(t *testing.T) {
 	}
 }
 
+func TestService_SeriesQuota(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	s := NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()), WithSeriesQuota(2))
+
+	assert.NoError(t, s.UpdateGaugeMetric(ctx, "g1", 1))
+	assert.NoError(t, s.UpdateCounterMetric(ctx, "c1", 1))
+	assert.NoError(t, s.UpdateCounterMetric(ctx, "c1", 1), "existing series do not count against the quota")
+	assert.ErrorIs(t, s.UpdateGaugeMetric(ctx, "g2", 1), ErrSeriesQuotaExceeded)
+	assert.ErrorIs(t, s.UpdateMetricsBatch(ctx, map[string]repositories.Metric{
+		"g1": {Type: constants.MetricTypeGauge, Value: 2.0},
+		"g3": {Type: constants.MetricTypeGauge, Value: 3.0},
+	}), ErrSeriesQuotaExceeded)
+	assert.NoError(t, s.UpdateMetricsBatch(teamA, map[string]repositories.Metric{
+		"g1": {Type: constants.MetricTypeGauge, Value: 2.0},
+		"g2": {Type: constants.MetricTypeGauge, Value: 3.0},
+	}), "quotas are per tenant")
+
+	usage, err := s.Usage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []TenantUsage{
+		{Tenant: "", Series: 2, Quota: 2},
+		{Tenant: "team-a", Series: 2, Quota: 2},
+	}, usage)
+}
+
 func BenchmarkServiceUpdateMetric(b *testing.B) {
 	s := NewService(&mockRepo{})
 	ctx := context.Background()
@@ -487,6 +517,8 @@ func BenchmarkServiceUpdateMetric(b *testing.B) {
 
 type mockRepo struct {
 	metrics     map[string]repositories.Metric
+	metadata    map[string]repositories.Metadata
+	rollups     map[string][]repositories.Rollup
 	errOnUpdate bool
 	errOnGet    bool
 }
@@ -522,3 +554,135 @@ func (m *mockRepo) UpdateMetricsBatch(_ context.Context, metrics map[string]repo
 	}
 	return nil
 }
+
+func (m *mockRepo) CreateCounter(_ context.Context, name string, delta int64) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error with %v, %v", name, delta)
+	}
+	if _, ok := m.metrics[name]; ok {
+		return repositories.ErrMetricExists
+	}
+	return nil
+}
+
+func (m *mockRepo) ListTenants(_ context.Context) ([]string, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	return []string{""}, nil
+}
+
+func (m *mockRepo) DeleteTenant(_ context.Context, _ string) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	m.metrics = nil
+	return nil
+}
+
+func (m *mockRepo) DeleteMetric(_ context.Context, name string) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	if _, ok := m.metrics[name]; !ok {
+		return repositories.ErrMetricNotFound
+	}
+	delete(m.metrics, name)
+	return nil
+}
+
+func (m *mockRepo) DeleteBySelector(_ context.Context, selector repositories.Selector) ([]string, error) {
+	if m.errOnUpdate {
+		return nil, fmt.Errorf("mock update error")
+	}
+	deleted := make([]string, 0)
+	for name, metric := range m.metrics {
+		if selector.Matches(name, metric) {
+			delete(m.metrics, name)
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(deleted)
+	return deleted, nil
+}
+
+func (m *mockRepo) GetUpdateTimes(_ context.Context) (map[string]time.Time, error) {
+	return map[string]time.Time{}, nil
+}
+
+func (m *mockRepo) DeleteExpired(_ context.Context, _ []repositories.ExpiringSeries) ([]repositories.ExpiringSeries, error) {
+	return []repositories.ExpiringSeries{}, nil
+}
+
+func (m *mockRepo) UpdateMetadata(_ context.Context, metadata map[string]repositories.Metadata) error {
+	if m.errOnUpdate {
+		return fmt.Errorf("mock update error")
+	}
+	if m.metadata == nil {
+		m.metadata = make(map[string]repositories.Metadata)
+	}
+	for name, meta := range metadata {
+		m.metadata[name] = meta
+	}
+	return nil
+}
+
+func (m *mockRepo) GetMetadata(_ context.Context) (map[string]repositories.Metadata, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	metadata := make(map[string]repositories.Metadata, len(m.metadata))
+	for name, meta := range m.metadata {
+		metadata[name] = meta
+	}
+	return metadata, nil
+}
+
+func (m *mockRepo) GetRollups(_ context.Context, name string, window time.Duration) ([]repositories.Rollup, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	var rollups []repositories.Rollup
+	for _, rollup := range m.rollups[name] {
+		if rollup.Window == window {
+			rollups = append(rollups, rollup)
+		}
+	}
+	return rollups, nil
+}
+
+func (m *mockRepo) CompactRollups(_ context.Context, window, into time.Duration, before time.Time) (int, error) {
+	if m.errOnUpdate {
+		return 0, fmt.Errorf("mock update error")
+	}
+	removed := 0
+	for name, rollups := range m.rollups {
+		var kept, compacted []repositories.Rollup
+		for _, rollup := range rollups {
+			if rollup.Window == window && rollup.Start.Before(before) {
+				compacted = append(compacted, rollup)
+				continue
+			}
+			kept = append(kept, rollup)
+		}
+		if into > 0 {
+			kept = append(kept, repositories.FoldRollups(compacted, into)...)
+		}
+		m.rollups[name] = kept
+		removed += len(compacted)
+	}
+	return removed, nil
+}
+
+func (m *mockRepo) RollupSizes(_ context.Context) (map[time.Duration]int, error) {
+	if m.errOnGet {
+		return nil, fmt.Errorf("mock get error")
+	}
+	sizes := make(map[time.Duration]int)
+	for _, rollups := range m.rollups {
+		for _, rollup := range rollups {
+			sizes[rollup.Window]++
+		}
+	}
+	return sizes, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+)
+
+// ErrSeriesQuotaExceeded is returned when a write would create more series than the tenant quota allows.
+var ErrSeriesQuotaExceeded = errors.New("series quota exceeded")
+
+// WithSeriesQuota limits the number of distinct series every tenant can store. Zero disables the quota.
+func WithSeriesQuota(limit int) Option {
+	return func(s *Service) {
+		if limit > 0 {
+			s.quota = newQuotaTracker(limit)
+		}
+	}
+}
+
+// quotaTracker tracks the series stored by every tenant, so that the quota is enforced without reading
+// the storage on every write. The series of a tenant are loaded from the storage on its first write and
+// bounded by the quota. Metrics with registered metadata count as series, so that metadata cannot be
+// used to grow a tenant past its quota.
+type quotaTracker struct {
+	limit   int
+	mu      sync.Mutex
+	tenants map[string]*tenantSeries
+}
+
+// tenantSeries is the set of series of a tenant. Its lock is held for the whole write, so concurrent
+// writes of the tenant cannot overshoot the quota while other tenants write in parallel.
+type tenantSeries struct {
+	mu     sync.Mutex
+	seeded bool
+	series map[string]struct{}
+}
+
+func newQuotaTracker(limit int) *quotaTracker {
+	return &quotaTracker{limit: limit, tenants: make(map[string]*tenantSeries)}
+}
+
+func (q *quotaTracker) tenant(tenant string) *tenantSeries {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ts, ok := q.tenants[tenant]
+	if !ok {
+		ts = &tenantSeries{series: make(map[string]struct{})}
+		q.tenants[tenant] = ts
+	}
+	return ts
+}
+
+// forget releases the series of deleted keys.
+func (q *quotaTracker) forget(keys []string) {
+	for _, key := range keys {
+		tenant, name, _ := strings.Cut(key, "\x00")
+		q.mu.Lock()
+		ts := q.tenants[tenant]
+		q.mu.Unlock()
+		if ts == nil {
+			continue
+		}
+		ts.mu.Lock()
+		delete(ts.series, name)
+		ts.mu.Unlock()
+	}
+}
+
+// forgetTenant forgets every series of a deleted tenant.
+func (q *quotaTracker) forgetTenant(tenant string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.tenants, tenant)
+}
+
+// withinQuota runs write when storing names keeps the tenant of ctx within its series quota. write
+// returns the names it stored, which leave out the series dropped by the cardinality guard.
+func (s *Service) withinQuota(ctx context.Context, names []string, write func() ([]string, error)) error {
+	if s.quota == nil {
+		_, err := write()
+		return err
+	}
+
+	ts := s.quota.tenant(identity.Tenant(ctx))
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if !ts.seeded {
+		existing, err := s.repo.GetMetrics(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load series for quota: %w", err)
+		}
+		for name := range existing {
+			ts.series[name] = struct{}{}
+		}
+		described, err := s.repo.GetMetadata(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load metadata for quota: %w", err)
+		}
+		for name := range described {
+			ts.series[name] = struct{}{}
+		}
+		ts.seeded = true
+	}
+
+	series := len(ts.series)
+	for _, name := range names {
+		if _, ok := ts.series[name]; !ok {
+			series++
+		}
+	}
+	if series > s.quota.limit {
+		return fmt.Errorf("%w: tenant %q would store %d of %d series",
+			ErrSeriesQuotaExceeded, identity.Tenant(ctx), series, s.quota.limit)
+	}
+
+	written, err := write()
+	if err != nil {
+		return err
+	}
+	for _, name := range written {
+		ts.series[name] = struct{}{}
+	}
+	return nil
+}
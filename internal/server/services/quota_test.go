@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+)
+
+// listingRepo counts the full listings of the storage.
+type listingRepo struct {
+	MetricRepository
+	listings int
+}
+
+func (r *listingRepo) GetMetrics(ctx context.Context) (map[string]repositories.Metric, error) {
+	r.listings++
+	return r.MetricRepository.GetMetrics(ctx)
+}
+
+func TestService_SeriesQuota_Tracked(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	storage := memstorage.NewMemStorage()
+	require.NoError(t, storage.UpdateMetricsBatch(ctx, gauges("existing")))
+	repo := &listingRepo{MetricRepository: repositories.NewMetricRepo(storage)}
+	s := NewService(repo, WithSeriesQuota(2))
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.UpdateGaugeMetric(ctx, "existing", float64(i)))
+	}
+	require.NoError(t, s.UpdateMetricsBatch(teamA, gauges("a", "b")))
+	assert.Equal(t, 2, repo.listings, "the storage is listed once per tenant")
+
+	require.NoError(t, s.UpdateGaugeMetric(ctx, "second", 1))
+	assert.ErrorIs(t, s.UpdateGaugeMetric(ctx, "third", 1), ErrSeriesQuotaExceeded)
+
+	require.NoError(t, s.DeleteMetric(ctx, "second"))
+	assert.NoError(t, s.UpdateGaugeMetric(ctx, "third", 1), "deleted series free their slot")
+
+	require.NoError(t, s.DeleteTenant(ctx, "team-a"))
+	assert.NoError(t, s.UpdateMetricsBatch(teamA, gauges("c", "d")), "deleted tenants start over")
+}
+
+func TestService_SeriesQuota_DroppedSeries(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	s := NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()),
+		WithSeriesQuota(2), WithCardinalityLimit(1, CardinalityModeDrop))
+
+	require.NoError(t, s.UpdateMetricsBatch(ctx, gauges("a")))
+	require.NoError(t, s.UpdateMetricsBatch(teamA, gauges("x", "y")))
+	metrics, err := s.GetMetrics(teamA)
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	require.NoError(t, s.DeleteMetric(ctx, "a"))
+	assert.NoError(t, s.UpdateMetricsBatch(teamA, gauges("p", "q")), "dropped series do not count against the quota")
+}
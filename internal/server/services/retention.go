@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+)
+
+// CompactionRun describes a run of Service.Compact.
+type CompactionRun struct {
+	StartedAt time.Time `json:"started_at"`
+	// Duration is the length of the run in seconds.
+	Duration float64 `json:"duration"`
+	// Compacted is the number of rollup windows folded into the next tier or dropped from the last one.
+	Compacted int    `json:"compacted"`
+	Error     string `json:"error,omitempty"`
+}
+
+// TierStatus describes a retention tier and the rollup windows it keeps across all tenants.
+type TierStatus struct {
+	// Window and Period are the window length and the retention period of the tier in seconds.
+	Window  float64 `json:"window"`
+	Period  float64 `json:"period"`
+	Windows int     `json:"windows"`
+}
+
+// RetentionStatus describes the retention tiers of gauge rollups and the last compaction.
+type RetentionStatus struct {
+	Tiers          []TierStatus   `json:"tiers"`
+	LastCompaction *CompactionRun `json:"last_compaction,omitempty"`
+}
+
+// WithRetentionTiers downsamples gauge rollups. Only the windows of the first tier are updated on
+// writes; Compact folds the windows of every tier older than its period into the windows of the next
+// tier and drops them from the last one. The storage must keep the windows of the first tier
+// without a retention and accept those of the others as compacted.
+func WithRetentionTiers(tiers []repositories.RetentionTier) Option {
+	return func(s *Service) {
+		if len(tiers) == 0 {
+			return
+		}
+		s.retention = &retentionPolicy{tiers: tiers, now: time.Now}
+	}
+}
+
+// retentionPolicy holds the retention tiers and the outcome of the last compaction.
+type retentionPolicy struct {
+	tiers []repositories.RetentionTier
+	now   func() time.Time
+
+	mu   sync.Mutex
+	last *CompactionRun
+}
+
+// tier returns the index of the tier of windows of the given length.
+func (p *retentionPolicy) tier(window time.Duration) (int, bool) {
+	for i, tier := range p.tiers {
+		if tier.Window == window {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Compact folds the rollup windows of every tenant older than the period of their tier into the next
+// tier and returns the outcome of the run. It does nothing when retention tiers are disabled.
+func (s *Service) Compact(ctx context.Context) (CompactionRun, error) {
+	if s.retention == nil {
+		return CompactionRun{}, nil
+	}
+
+	started := s.retention.now()
+	run := CompactionRun{StartedAt: started.UTC()}
+	err := s.compact(ctx, started, &run)
+	run.Duration = s.retention.now().Sub(started).Seconds()
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	s.retention.mu.Lock()
+	s.retention.last = &run
+	s.retention.mu.Unlock()
+
+	return run, err
+}
+
+func (s *Service) compact(ctx context.Context, now time.Time, run *CompactionRun) error {
+	tenants, err := s.repo.ListTenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	tiers := s.retention.tiers
+	for _, tenant := range tenants {
+		tenantCtx := identity.WithTenant(ctx, tenant)
+		for i, tier := range tiers {
+			var into time.Duration
+			if i+1 < len(tiers) {
+				into = tiers[i+1].Window
+			}
+			before := repositories.RollupStart(now.Add(-tier.Period), tier.Window)
+			compacted, err := s.repo.CompactRollups(tenantCtx, tier.Window, into, before)
+			run.Compacted += compacted
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RunCompactor runs Compact every interval until ctx is done. It returns at once when retention tiers
+// are disabled.
+func (s *Service) RunCompactor(ctx context.Context, interval time.Duration) {
+	if s.retention == nil || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			run, err := s.Compact(ctx)
+			if err != nil {
+				logger.Log.Error("Failed to compact rollups", zap.Error(err))
+			}
+			if run.Compacted > 0 {
+				logger.Log.Info("Compacted rollups", zap.Int("compacted", run.Compacted))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RetentionStatus returns the retention tiers with the number of rollup windows they keep across all
+// tenants, and the last compaction. It lists no tiers when retention tiers are disabled.
+func (s *Service) RetentionStatus(ctx context.Context) (RetentionStatus, error) {
+	status := RetentionStatus{Tiers: make([]TierStatus, 0)}
+	if s.retention == nil {
+		return status, nil
+	}
+
+	tenants, err := s.repo.ListTenants(ctx)
+	if err != nil {
+		return RetentionStatus{}, err
+	}
+	sizes := make(map[time.Duration]int)
+	for _, tenant := range tenants {
+		tenantSizes, err := s.repo.RollupSizes(identity.WithTenant(ctx, tenant))
+		if err != nil {
+			return RetentionStatus{}, err
+		}
+		for window, n := range tenantSizes {
+			sizes[window] += n
+		}
+	}
+
+	for _, tier := range s.retention.tiers {
+		status.Tiers = append(status.Tiers, TierStatus{
+			Window:  tier.Window.Seconds(),
+			Period:  tier.Period.Seconds(),
+			Windows: sizes[tier.Window],
+		})
+	}
+
+	s.retention.mu.Lock()
+	if s.retention.last != nil {
+		last := *s.retention.last
+		status.LastCompaction = &last
+	}
+	s.retention.mu.Unlock()
+
+	return status, nil
+}
+
+// tieredRollups returns the rollups of windows of a compacted tier, completing the windows it keeps
+// with those of the finer tiers not compacted yet.
+func (s *Service) tieredRollups(ctx context.Context, name string, tier int) ([]repositories.Rollup, error) {
+	window := s.retention.tiers[tier].Window
+	rollups, err := s.repo.GetRollups(ctx, name, window)
+	if err != nil {
+		return nil, err
+	}
+	// Finer tiers hold more recent values, so they are combined from the coarsest one.
+	for i := tier - 1; i >= 0; i-- {
+		finer, err := s.repo.GetRollups(ctx, name, s.retention.tiers[i].Window)
+		if err != nil {
+			return nil, err
+		}
+		rollups = repositories.CombineRollups(rollups, repositories.FoldRollups(finer, window))
+	}
+	return rollups, nil
+}
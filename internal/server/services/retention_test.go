@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+)
+
+func TestService_Compact(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	minute := func(offset time.Duration, value float64) repositories.Rollup {
+		return repositories.Rollup{Start: base.Add(offset), Window: time.Minute, Min: value, Max: value, Sum: value, Count: 1, Last: value}
+	}
+	repo := &mockRepo{
+		metrics: map[string]repositories.Metric{"load": {Type: constants.MetricTypeGauge, Value: 4.0}},
+		rollups: map[string][]repositories.Rollup{
+			"load": {minute(0, 1), minute(time.Minute, 3), minute(2*time.Hour, 2), minute(2*time.Hour+time.Minute, 4)},
+		},
+	}
+	s := NewService(repo, WithRetentionTiers([]repositories.RetentionTier{
+		{Window: time.Minute, Period: time.Hour},
+		{Window: time.Hour, Period: 24 * time.Hour},
+	}))
+	clock := &fakeClock{now: base.Add(3 * time.Hour)}
+	s.retention.now = clock.Now
+
+	run, err := s.Compact(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, CompactionRun{StartedAt: clock.now, Compacted: 2}, run)
+
+	rollups, err := s.GetRollups(ctx, "load", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{minute(2*time.Hour, 2), minute(2*time.Hour+time.Minute, 4)}, rollups)
+
+	rollups, err = s.GetRollups(ctx, "load", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{
+		{Start: base, Window: time.Hour, Min: 1, Max: 3, Sum: 4, Count: 2, Last: 3},
+		{Start: base.Add(2 * time.Hour), Window: time.Hour, Min: 2, Max: 4, Sum: 6, Count: 2, Last: 4},
+	}, rollups, "windows not compacted yet are folded on reads")
+
+	status, err := s.RetentionStatusWithRetry(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, RetentionStatus{
+		Tiers: []TierStatus{
+			{Window: 60, Period: 3600, Windows: 2},
+			{Window: 3600, Period: 86400, Windows: 1},
+		},
+		LastCompaction: &CompactionRun{StartedAt: clock.now, Compacted: 2},
+	}, status)
+
+	repo.errOnUpdate = true
+	_, err = s.Compact(ctx)
+	assert.Error(t, err)
+	status, err = s.RetentionStatus(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, status.LastCompaction)
+	assert.Equal(t, "mock update error", status.LastCompaction.Error)
+}
+
+func TestService_Compact_Disabled(t *testing.T) {
+	s := NewService(&mockRepo{})
+
+	run, err := s.Compact(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, CompactionRun{}, run)
+
+	status, err := s.RetentionStatus(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, RetentionStatus{Tiers: []TierStatus{}}, status)
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+)
+
+// ErrNotGauge is returned for rollups of metrics that are not gauges.
+var ErrNotGauge = errors.New("metric is not a gauge")
+
+// GetRollups returns the rollups of a gauge of the tenant of ctx for windows of the given length,
+// ordered by their start. The last one is the window being filled. The windows of compacted retention
+// tiers include the values of the finer tiers not compacted yet.
+func (s *Service) GetRollups(ctx context.Context, name string, window time.Duration) ([]repositories.Rollup, error) {
+	metric, err := s.repo.GetMetric(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if metric.Type != constants.MetricTypeGauge {
+		return nil, fmt.Errorf("%w: %s is a %s", ErrNotGauge, name, metric.Type)
+	}
+	if s.retention != nil {
+		if tier, ok := s.retention.tier(window); ok && tier > 0 {
+			return s.tieredRollups(ctx, name, tier)
+		}
+	}
+	return s.repo.GetRollups(ctx, name, window)
+}
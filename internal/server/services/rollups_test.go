@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+)
+
+func TestService_GetRollups(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &mockRepo{
+		metrics: map[string]repositories.Metric{
+			"load":     {Type: constants.MetricTypeGauge, Value: 2.0},
+			"requests": {Type: constants.MetricTypeCounter, Value: int64(1)},
+		},
+		rollups: map[string][]repositories.Rollup{
+			"load": {
+				{Start: start, Window: time.Minute, Min: 1, Max: 3, Sum: 4, Count: 2, Last: 3},
+				{Start: start, Window: time.Hour, Min: 1, Max: 3, Sum: 4, Count: 2, Last: 3},
+			},
+		},
+	}
+	s := NewService(repo)
+
+	tests := []struct {
+		name    string
+		metric  string
+		window  time.Duration
+		want    []repositories.Rollup
+		wantErr bool
+		errIs   error
+	}{
+		{
+			name:   "Test #1 gauge",
+			metric: "load",
+			window: time.Hour,
+			want:   []repositories.Rollup{{Start: start, Window: time.Hour, Min: 1, Max: 3, Sum: 4, Count: 2, Last: 3}},
+		},
+		{name: "Test #2 counter", metric: "requests", window: time.Hour, wantErr: true, errIs: ErrNotGauge},
+		{name: "Test #3 missing", metric: "nope", window: time.Hour, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetRollupsWithRetry(context.Background(), tt.metric, tt.window)
+			if tt.wantErr {
+				require.Error(t, err)
+				if tt.errIs != nil {
+					assert.ErrorIs(t, err, tt.errIs)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+)
+
+// staleCollectInterval is the interval between two runs of the stale series collector.
+const staleCollectInterval = time.Minute
+
+// TTLOverride sets the TTL of the metrics matched by Pattern, which is either an exact name or a prefix
+// ending with "*". A zero TTL keeps the metrics from ever becoming stale.
+type TTLOverride struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// matches reports whether the override applies to a metric name.
+func (o TTLOverride) matches(name string) bool {
+	if prefix, ok := strings.CutSuffix(o.Pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return name == o.Pattern
+}
+
+// ParseTTLOverrides parses comma-separated pattern=seconds pairs, e.g. "host_*=600,build_info=0".
+func ParseTTLOverrides(s string) ([]TTLOverride, error) {
+	var overrides []TTLOverride
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pattern, seconds, ok := strings.Cut(item, "=")
+		if !ok || pattern == "" || strings.Contains(strings.TrimSuffix(pattern, "*"), "*") {
+			return nil, fmt.Errorf("invalid TTL override %q", item)
+		}
+		ttl, err := strconv.Atoi(seconds)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid TTL in override %q", item)
+		}
+		overrides = append(overrides, TTLOverride{Pattern: pattern, TTL: time.Duration(ttl) * time.Second})
+	}
+	return overrides, nil
+}
+
+// WithMetricTTL marks series not updated for ttl as stale. Stale series are hidden from listings and
+// removed by RunStaleCollector once they stayed stale for another ttl. overrides take precedence over
+// ttl, the first match winning. Zero ttl without overrides disables expiry.
+func WithMetricTTL(ttl time.Duration, overrides []TTLOverride) Option {
+	return func(s *Service) {
+		if ttl <= 0 && len(overrides) == 0 {
+			return
+		}
+		s.staleness = newStalenessTracker(ttl, overrides)
+	}
+}
+
+// stalenessTracker decides which series are stale from the update times kept by the storage.
+type stalenessTracker struct {
+	ttl       time.Duration
+	overrides []TTLOverride
+	now       func() time.Time
+}
+
+func newStalenessTracker(ttl time.Duration, overrides []TTLOverride) *stalenessTracker {
+	return &stalenessTracker{
+		ttl:       ttl,
+		overrides: overrides,
+		now:       time.Now,
+	}
+}
+
+// ttlOf returns the TTL of a metric; zero means it never becomes stale.
+func (t *stalenessTracker) ttlOf(name string) time.Duration {
+	for _, o := range t.overrides {
+		if o.matches(name) {
+			return o.TTL
+		}
+	}
+	return t.ttl
+}
+
+// isStale reports whether a series last written at updated was not updated within its TTL. Series
+// without an update time never become stale.
+func (t *stalenessTracker) isStale(name string, updated time.Time) bool {
+	ttl := t.ttlOf(name)
+	return ttl > 0 && !updated.IsZero() && t.now().Sub(updated) >= ttl
+}
+
+// markStale sets the Stale flag of metrics of the tenant of ctx.
+func (s *Service) markStale(ctx context.Context, metrics map[string]repositories.Metric) error {
+	if s.staleness == nil {
+		return nil
+	}
+	updated, err := s.repo.GetUpdateTimes(ctx)
+	if err != nil {
+		return err
+	}
+	for name, metric := range metrics {
+		metric.Stale = s.staleness.isStale(name, updated[name])
+		metrics[name] = metric
+	}
+	return nil
+}
+
+// forget releases the tracked state of deleted series.
+func (s *Service) forget(keys []string) {
+	if s.quota != nil {
+		s.quota.forget(keys)
+	}
+	if s.cardinality != nil {
+		s.cardinality.release(keys)
+	}
+	s.counterState().forget(keys)
+}
+
+// CollectStale removes the series of every tenant that stayed stale for another TTL and returns their
+// number. The series of all tenants are removed by a single storage call, which keeps those written
+// since they were selected. It does nothing when expiry is disabled.
+func (s *Service) CollectStale(ctx context.Context) (int, error) {
+	if s.staleness == nil {
+		return 0, nil
+	}
+
+	tenants, err := s.repo.ListTenants(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := s.staleness.now()
+	var expiring []repositories.ExpiringSeries
+	for _, tenant := range tenants {
+		updated, err := s.repo.GetUpdateTimes(identity.WithTenant(ctx, tenant))
+		if err != nil {
+			return 0, err
+		}
+		for name, at := range updated {
+			ttl := s.staleness.ttlOf(name)
+			if ttl > 0 && !at.IsZero() && now.Sub(at) >= 2*ttl {
+				expiring = append(expiring, repositories.ExpiringSeries{Tenant: tenant, Name: name, TTL: 2 * ttl})
+			}
+		}
+	}
+	if len(expiring) == 0 {
+		return 0, nil
+	}
+
+	removed, err := s.repo.DeleteExpired(ctx, expiring)
+	if err != nil {
+		return 0, err
+	}
+	keys := make([]string, len(removed))
+	for i, series := range removed {
+		keys[i] = seriesKey(series.Tenant, series.Name)
+	}
+	s.forget(keys)
+	return len(removed), nil
+}
+
+// RunStaleCollector runs CollectStale periodically until ctx is done. It returns at once when expiry is disabled.
+func (s *Service) RunStaleCollector(ctx context.Context) {
+	if s.staleness == nil {
+		return
+	}
+
+	ticker := time.NewTicker(staleCollectInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			removed, err := s.CollectStale(ctx)
+			if err != nil {
+				logger.Log.Error("Failed to collect stale series", zap.Error(err))
+			}
+			if removed > 0 {
+				logger.Log.Info("Collected stale series", zap.Int("removed", removed))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
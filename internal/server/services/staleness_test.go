@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
+	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
+	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+)
+
+// fakeClock is a settable time source for the staleness tracker and the storage.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newStaleService(t *testing.T, ttl time.Duration, overrides []TTLOverride) (*Service, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	storage := memstorage.NewMemStorage()
+	storage.SetClock(clock.Now)
+	s := NewService(repositories.NewMetricRepo(storage), WithMetricTTL(ttl, overrides))
+	require.NotNil(t, s.staleness)
+	s.staleness.now = clock.Now
+	return s, clock
+}
+
+func TestService_StaleMarker(t *testing.T) {
+	ctx := context.Background()
+	s, clock := newStaleService(t, time.Minute, nil)
+
+	require.NoError(t, s.UpdateGaugeMetric(ctx, "load", 1))
+	require.NoError(t, s.UpdateCounterMetric(ctx, "requests", 1))
+
+	clock.Advance(50 * time.Second)
+	require.NoError(t, s.UpdateCounterMetric(ctx, "requests", 1))
+	clock.Advance(10 * time.Second)
+
+	metric, err := s.GetMetric(ctx, "load")
+	require.NoError(t, err)
+	assert.True(t, metric.Stale)
+
+	metrics, err := s.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.True(t, metrics["load"].Stale)
+	assert.False(t, metrics["requests"].Stale)
+
+	require.NoError(t, s.UpdateGaugeMetric(ctx, "load", 2))
+	metric, err = s.GetMetric(ctx, "load")
+	require.NoError(t, err)
+	assert.False(t, metric.Stale, "an update refreshes the series")
+}
+
+func TestService_StaleOverrides(t *testing.T) {
+	ctx := context.Background()
+	s, clock := newStaleService(t, time.Minute, []TTLOverride{
+		{Pattern: "build_info", TTL: 0},
+		{Pattern: "host_*", TTL: 10 * time.Second},
+	})
+
+	require.NoError(t, s.UpdateMetricsBatch(ctx, gauges("build_info", "host_cpu", "load")))
+	clock.Advance(30 * time.Second)
+
+	metrics, err := s.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.False(t, metrics["build_info"].Stale)
+	assert.True(t, metrics["host_cpu"].Stale)
+	assert.False(t, metrics["load"].Stale)
+
+	clock.Advance(time.Hour)
+	metrics, err = s.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.False(t, metrics["build_info"].Stale, "a zero TTL never expires")
+	assert.True(t, metrics["load"].Stale)
+}
+
+func TestService_CollectStale(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	s, clock := newStaleService(t, time.Minute, nil)
+
+	require.NoError(t, s.UpdateMetricsBatch(ctx, gauges("old", "fresh")))
+	require.NoError(t, s.UpdateMetricsBatch(teamA, gauges("old")))
+
+	clock.Advance(90 * time.Second)
+	require.NoError(t, s.UpdateGaugeMetric(ctx, "fresh", 2))
+	removed, err := s.CollectStale(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed, "stale series are kept for another TTL")
+
+	clock.Advance(30 * time.Second)
+	removed, err = s.CollectStale(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	metrics, err := s.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fresh"}, keys(metrics))
+	metrics, err = s.GetMetrics(teamA)
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
+
+// racingRepo writes a series right before the stale series are removed.
+type racingRepo struct {
+	MetricRepository
+	write func()
+}
+
+func (r *racingRepo) DeleteExpired(ctx context.Context, series []repositories.ExpiringSeries) ([]repositories.ExpiringSeries, error) {
+	r.write()
+	return r.MetricRepository.DeleteExpired(ctx, series)
+}
+
+func TestService_CollectStale_WrittenMeanwhile(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	storage := memstorage.NewMemStorage()
+	storage.SetClock(clock.Now)
+	repo := &racingRepo{MetricRepository: repositories.NewMetricRepo(storage)}
+	s := NewService(repo, WithMetricTTL(time.Minute, nil))
+	s.staleness.now = clock.Now
+
+	require.NoError(t, s.UpdateMetricsBatch(ctx, gauges("old", "racing")))
+	clock.Advance(3 * time.Minute)
+	repo.write = func() {
+		require.NoError(t, storage.UpdateMetric(ctx, "racing", repositories.Metric{Type: "gauge", Value: 2.0}))
+	}
+
+	removed, err := s.CollectStale(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	metrics, err := s.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"racing"}, keys(metrics), "series written during the collection are kept")
+}
+
+func TestService_CollectStaleDisabled(t *testing.T) {
+	s := NewService(repositories.NewMetricRepo(memstorage.NewMemStorage()), WithMetricTTL(0, nil))
+	assert.Nil(t, s.staleness)
+
+	removed, err := s.CollectStale(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+}
+
+func TestParseTTLOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []TTLOverride
+		wantErr bool
+	}{
+		{name: "Test #1 empty", input: ""},
+		{
+			name:  "Test #2 name and prefix",
+			input: "build_info=0, host_*=600",
+			want: []TTLOverride{
+				{Pattern: "build_info", TTL: 0},
+				{Pattern: "host_*", TTL: 10 * time.Minute},
+			},
+		},
+		{name: "Test #3 missing TTL", input: "host_*", wantErr: true},
+		{name: "Test #4 negative TTL", input: "host_*=-1", wantErr: true},
+		{name: "Test #5 inner wildcard", input: "host_*_cpu=60", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTTLOverrides(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func keys(metrics map[string]repositories.Metric) []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	return names
+}
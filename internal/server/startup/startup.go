@@ -5,23 +5,35 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
+	"github.com/a2sh3r/sysmetrics/internal/compression"
 	"github.com/a2sh3r/sysmetrics/internal/config"
+	"github.com/a2sh3r/sysmetrics/internal/encryption"
+	"github.com/a2sh3r/sysmetrics/internal/hash"
 	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/server/auth"
 	"github.com/a2sh3r/sysmetrics/internal/server/database"
+	"github.com/a2sh3r/sysmetrics/internal/server/grpcserver"
 	"github.com/a2sh3r/sysmetrics/internal/server/handlers"
+	"github.com/a2sh3r/sysmetrics/internal/server/middleware"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 	"github.com/a2sh3r/sysmetrics/internal/server/restore"
 	"github.com/a2sh3r/sysmetrics/internal/server/services"
 	"github.com/a2sh3r/sysmetrics/internal/server/storage/dbstorage"
 	"github.com/a2sh3r/sysmetrics/internal/server/storage/memstorage"
+	"github.com/a2sh3r/sysmetrics/internal/server/stream"
+	"github.com/a2sh3r/sysmetrics/internal/tlsconfig"
 )
 
 // RunServer starts the HTTP server with the provided configuration.
@@ -31,6 +43,97 @@ func RunServer(cfg *config.ServerConfig) error {
 	var err error
 	var db *sql.DB
 
+	if err = cfg.ValidateTLS(); err != nil {
+		logger.Log.Error("Invalid TLS configuration", zap.Error(err))
+		return err
+	}
+
+	if _, err = hash.ParseKeys(cfg.SecretKeys); err != nil {
+		logger.Log.Error("Invalid secret keys", zap.Error(err))
+		return err
+	}
+
+	if _, err = auth.ParseTokens(cfg.APITokens); err != nil {
+		logger.Log.Error("Invalid API tokens", zap.Error(err))
+		return err
+	}
+
+	if _, err = middleware.ParseRateLimitKey(cfg.RateLimitKey); err != nil {
+		logger.Log.Error("Invalid rate limit key", zap.Error(err))
+		return err
+	}
+
+	if _, err = services.ParseCardinalityMode(cfg.CardinalityMode); err != nil {
+		logger.Log.Error("Invalid cardinality mode", zap.Error(err))
+		return err
+	}
+
+	ttlOverrides, err := services.ParseTTLOverrides(cfg.MetricTTLOverrides)
+	if err != nil {
+		logger.Log.Error("Invalid metric TTL overrides", zap.Error(err))
+		return err
+	}
+
+	rollupWindows, err := repositories.ParseRollupWindows(cfg.RollupWindows)
+	if err != nil {
+		logger.Log.Error("Invalid rollup windows", zap.Error(err))
+		return err
+	}
+	if len(rollupWindows) > 0 && cfg.RollupRetention < 1 {
+		err = fmt.Errorf("invalid rollup retention %d", cfg.RollupRetention)
+		logger.Log.Error("Invalid rollup retention", zap.Error(err))
+		return err
+	}
+	rollupConfig := repositories.RollupConfig{Windows: rollupWindows, Retention: cfg.RollupRetention}
+
+	retentionTiers, err := repositories.ParseRetentionTiers(cfg.RetentionTiers)
+	if err != nil {
+		logger.Log.Error("Invalid retention tiers", zap.Error(err))
+		return err
+	}
+	if len(retentionTiers) > 0 {
+		if len(rollupWindows) > 0 {
+			err = errors.New("rollup windows and retention tiers are mutually exclusive")
+			logger.Log.Error("Invalid rollup configuration", zap.Error(err))
+			return err
+		}
+		// Only the first tier is written; compaction fills the others and drops expired windows.
+		rollupConfig = repositories.RollupConfig{Windows: []time.Duration{retentionTiers[0].Window}}
+		for _, tier := range retentionTiers[1:] {
+			rollupConfig.Compacted = append(rollupConfig.Compacted, tier.Window)
+		}
+	}
+
+	if cfg.StreamBuffer < 0 {
+		err = fmt.Errorf("invalid stream buffer %d", cfg.StreamBuffer)
+		logger.Log.Error("Invalid stream buffer", zap.Error(err))
+		return err
+	}
+	if cfg.StreamSubscribers < 0 {
+		err = fmt.Errorf("invalid stream subscriber limit %d", cfg.StreamSubscribers)
+		logger.Log.Error("Invalid stream subscriber limit", zap.Error(err))
+		return err
+	}
+
+	if _, err = compression.ParseCodecs(cfg.CompressCodecs); err != nil {
+		logger.Log.Error("Invalid compression codecs", zap.Error(err))
+		return err
+	}
+
+	for _, subnets := range []string{cfg.TrustedSubnet, cfg.ReadTrustedSubnet, cfg.TrustedProxies} {
+		if _, err = middleware.ParseCIDRs(subnets); err != nil {
+			logger.Log.Error("Invalid subnet list", zap.Error(err))
+			return err
+		}
+	}
+
+	if cfg.CryptoKey != "" {
+		if _, err = encryption.LoadPrivateKey(cfg.CryptoKey); err != nil {
+			logger.Log.Error("Invalid private key", zap.String("path", cfg.CryptoKey), zap.Error(err))
+			return err
+		}
+	}
+
 	if cfg.DatabaseDSN != "" {
 		db, err = database.InitDB(cfg)
 		if err != nil {
@@ -38,11 +141,14 @@ func RunServer(cfg *config.ServerConfig) error {
 			return err
 		}
 		defer database.CloseDB(db)
-		storage, err = dbstorage.NewDBStorage(db)
+		var dbStorage *dbstorage.DBStorage
+		dbStorage, err = dbstorage.NewDBStorage(db)
 		if err != nil {
 			logger.Log.Error("Failed to initialize DBStorage", zap.Error(err))
 			return err
 		}
+		dbStorage.EnableRollups(rollupConfig)
+		storage = dbStorage
 	} else {
 		var memStorage *memstorage.MemStorage
 		if cfg.Restore {
@@ -56,14 +162,49 @@ func RunServer(cfg *config.ServerConfig) error {
 		} else {
 			memStorage = memstorage.NewMemStorage()
 		}
+		memStorage.EnableRollups(rollupConfig)
 		storage = memStorage
 	}
 
+	restoreConfig := restore.NewRestoreConfig(int64(cfg.StoreInterval), cfg.FileStoragePath, storage)
+	if cfg.DatabaseDSN == "" && cfg.FileStoragePath != "" {
+		storage = restore.NewSnapshotStorage(restoreConfig)
+	}
+
 	metricRepo := repositories.NewMetricRepo(storage)
-	metricService := services.NewService(metricRepo)
-	handler := handlers.NewHandler(metricService, metricService, db)
+	metricService := services.NewService(metricRepo,
+		services.WithSeriesQuota(cfg.SeriesQuota),
+		services.WithCardinalityLimit(cfg.CardinalityLimit, cfg.CardinalityMode),
+		services.WithMetricTTL(time.Duration(cfg.MetricTTL)*time.Second, ttlOverrides),
+		services.WithRetentionTiers(retentionTiers))
+	var writer handlers.WriterServiceInterface = metricService
+	var hub *stream.Hub
+	var streamingWriter *handlers.StreamingWriter
+	if cfg.StreamBuffer > 0 {
+		hub = stream.NewHub(cfg.StreamBuffer, cfg.StreamSubscribers)
+		streamingWriter = handlers.NewStreamingWriter(metricService, metricService, hub)
+		writer = streamingWriter
+	}
+	handler := handlers.NewHandler(metricService, writer, db)
+	handler.Admin = metricService
+	handler.Hub = hub
+	limiter := middleware.NewRateLimiter(cfg)
+	handler.Limiter = limiter
 
-	restoreConfig := restore.NewRestoreConfig(int64(cfg.StoreInterval), cfg.FileStoragePath, storage)
+	// The stale collector and the compactor write to the storage, so they are stopped before the
+	// metrics are saved on shutdown.
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	workers.Add(2)
+	go func() {
+		defer workers.Done()
+		metricService.RunStaleCollector(workersCtx)
+	}()
+	go func() {
+		defer workers.Done()
+		metricService.RunCompactor(workersCtx, time.Duration(cfg.CompactionInterval)*time.Second)
+	}()
 
 	if cfg.StoreInterval != 0 {
 		go func() {
@@ -82,6 +223,34 @@ func RunServer(cfg *config.ServerConfig) error {
 		Handler: srvMux,
 	}
 
+	if cfg.TLSEnabled() {
+		srv.TLSConfig, err = tlsconfig.NewServerConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile)
+		if err != nil {
+			logger.Log.Error("Failed to configure TLS", zap.Error(err))
+			return err
+		}
+	}
+
+	var grpcSrv *grpc.Server
+	if cfg.GRPCAddress != "" {
+		grpcSrv, err = grpcserver.NewServer(cfg, writer, limiter)
+		if err != nil {
+			logger.Log.Error("Failed to configure gRPC server", zap.Error(err))
+			return err
+		}
+		listener, err := net.Listen("tcp", cfg.GRPCAddress)
+		if err != nil {
+			logger.Log.Error("Failed to listen for gRPC", zap.String("address", cfg.GRPCAddress), zap.Error(err))
+			return err
+		}
+		go func() {
+			logger.Log.Info("gRPC server is starting", zap.String("address", cfg.GRPCAddress))
+			if err := grpcSrv.Serve(listener); err != nil {
+				logger.Log.Error("gRPC server failed", zap.Error(err))
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
@@ -89,26 +258,43 @@ func RunServer(cfg *config.ServerConfig) error {
 		<-quit
 		logger.Log.Info("Shutting down server...")
 
+		stopWorkers()
+		workers.Wait()
+
 		if err := restoreConfig.SaveToFile(); err != nil {
 			logger.Log.Error("Error saving metrics on shutdown", zap.Error(err))
 		} else {
 			logger.Log.Info("Metrics successfully saved before shutdown")
 		}
 
+		if hub != nil {
+			streamingWriter.Close()
+			hub.Close()
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := srv.Shutdown(ctx); err != nil {
 			logger.Log.Error("Server shutdown error", zap.Error(err))
 		}
+		if grpcSrv != nil {
+			grpcSrv.GracefulStop()
+		}
 	}()
 
 	logger.Log.Info("Server is starting",
 		zap.String("address", cfg.Address),
 		zap.Int("store_interval", cfg.StoreInterval),
 		zap.String("storage_path", cfg.FileStoragePath),
-		zap.Bool("restore", cfg.Restore))
+		zap.Bool("restore", cfg.Restore),
+		zap.Bool("tls", cfg.TLSEnabled()),
+		zap.Bool("mtls", cfg.TLSClientCAFile != ""))
 
-	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if cfg.TLSEnabled() {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 
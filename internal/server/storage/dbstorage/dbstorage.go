@@ -6,74 +6,293 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/a2sh3r/sysmetrics/internal/constants"
 	"github.com/a2sh3r/sysmetrics/internal/logger"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 )
 
+// The metric upserts leave rows stored with another type untouched and affect no rows then, so that
+// type conflicts are reported like by the in-memory storage.
+const (
+	gaugeQuery = `
+		INSERT INTO metrics (tenant, id, type, delta, value)
+		VALUES ($1, $2, 'gauge', NULL, $3)
+		ON CONFLICT (tenant, id) DO UPDATE
+		SET delta = NULL,
+			value = $3,
+			updated_at = now()
+		WHERE metrics.type = EXCLUDED.type`
+
+	counterQuery = `
+		INSERT INTO metrics (tenant, id, type, delta, value)
+		VALUES ($1, $2, 'counter', $3, NULL)
+		ON CONFLICT (tenant, id) DO UPDATE
+		SET delta = metrics.delta + $3,
+			value = NULL,
+			updated_at = now()
+		WHERE metrics.type = EXCLUDED.type`
+
+	createCounterQuery = `
+		INSERT INTO metrics (tenant, id, type, delta, value)
+		VALUES ($1, $2, 'counter', $3, NULL)
+		ON CONFLICT (tenant, id) DO NOTHING`
+
+	metadataQuery = `
+		INSERT INTO metric_metadata (tenant, id, type, unit, help, owner)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant, id) DO UPDATE
+		SET type = $3,
+			unit = $4,
+			help = $5,
+			owner = $6`
+
+	rollupQuery = `
+		INSERT INTO gauge_rollups (tenant, id, window_seconds, start_at, min, max, sum, count, last)
+		VALUES ($1, $2, $3, $4, $5, $5, $5, 1, $5)
+		ON CONFLICT (tenant, id, window_seconds, start_at) DO UPDATE
+		SET min = LEAST(gauge_rollups.min, $5),
+			max = GREATEST(gauge_rollups.max, $5),
+			sum = gauge_rollups.sum + $5,
+			count = gauge_rollups.count + 1,
+			last = $5
+		RETURNING (xmax = 0) AS inserted`
+
+	deleteExpiredQuery = `
+		DELETE FROM metrics
+		WHERE tenant = $1 AND id = $2 AND updated_at <= now() - make_interval(secs => $3)`
+
+	pruneRollupsQuery = `
+		DELETE FROM gauge_rollups
+		WHERE tenant = $1 AND id = $2 AND window_seconds = $3 AND start_at < $4`
+
+	mergeRollupQuery = `
+		INSERT INTO gauge_rollups (tenant, id, window_seconds, start_at, min, max, sum, count, last)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (tenant, id, window_seconds, start_at) DO UPDATE
+		SET min = LEAST(gauge_rollups.min, $5),
+			max = GREATEST(gauge_rollups.max, $6),
+			sum = gauge_rollups.sum + $7,
+			count = gauge_rollups.count + $8,
+			last = $9`
+)
+
 // DBStorage implements Storage using a SQL database.
 type DBStorage struct {
-	db *sql.DB
+	db           *sql.DB
+	rollupConfig repositories.RollupConfig
+	now          func() time.Time
 }
 
-// NewDBStorage creates a new DBStorage instance and initializes the metrics table.
-func NewDBStorage(db *sql.DB) (*DBStorage, error) {
-	query := `
+// migrations create the metrics, metric_metadata and gauge_rollups tables and upgrade tables created
+// before tenants and update times were introduced.
+var migrations = []string{
+	`
 	CREATE TABLE IF NOT EXISTS metrics (
-		id TEXT PRIMARY KEY,
+		tenant TEXT NOT NULL DEFAULT '',
+		id TEXT NOT NULL,
 		type TEXT NOT NULL,
 		delta BIGINT,
-		value DOUBLE PRECISION
-	)`
+		value DOUBLE PRECISION,
+		PRIMARY KEY (tenant, id)
+	)`,
+	`ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT ''`,
+	`
+	DO $$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM information_schema.key_column_usage
+			WHERE table_name = 'metrics' AND constraint_name = 'metrics_pkey' AND column_name = 'tenant'
+		) THEN
+			ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_pkey;
+			ALTER TABLE metrics ADD PRIMARY KEY (tenant, id);
+		END IF;
+	END $$`,
+	`
+	CREATE TABLE IF NOT EXISTS metric_metadata (
+		tenant TEXT NOT NULL DEFAULT '',
+		id TEXT NOT NULL,
+		type TEXT NOT NULL DEFAULT '',
+		unit TEXT NOT NULL DEFAULT '',
+		help TEXT NOT NULL DEFAULT '',
+		owner TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (tenant, id)
+	)`,
+	`
+	CREATE TABLE IF NOT EXISTS gauge_rollups (
+		tenant TEXT NOT NULL DEFAULT '',
+		id TEXT NOT NULL,
+		window_seconds BIGINT NOT NULL,
+		start_at TIMESTAMPTZ NOT NULL,
+		min DOUBLE PRECISION NOT NULL,
+		max DOUBLE PRECISION NOT NULL,
+		sum DOUBLE PRECISION NOT NULL,
+		count BIGINT NOT NULL,
+		last DOUBLE PRECISION NOT NULL,
+		PRIMARY KEY (tenant, id, window_seconds, start_at)
+	)`,
+	`ALTER TABLE metrics ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+}
 
-	_, err := db.Exec(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create metrics table: %w", err)
+// NewDBStorage creates a new DBStorage instance and initializes the metrics table.
+func NewDBStorage(db *sql.DB) (*DBStorage, error) {
+	for _, query := range migrations {
+		if _, err := db.Exec(query); err != nil {
+			return nil, fmt.Errorf("failed to create metrics table: %w", err)
+		}
 	}
 
 	return &DBStorage{db: db}, nil
 }
 
-// UpdateMetric updates a metric in the database.
+// EnableRollups makes the storage keep rollups of the gauge values written from now on. It must be
+// called before the storage is used.
+func (s *DBStorage) EnableRollups(cfg repositories.RollupConfig) {
+	s.rollupConfig = cfg
+	if s.now == nil {
+		s.now = time.Now
+	}
+}
+
+// execer executes statements on a database or within a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// addRollups adds a gauge value to its rollups. The windows beyond the retention, if any, are dropped
+// when the value opens a new window, so that a series is pruned once per window rather than on every write.
+func (s *DBStorage) addRollups(ctx context.Context, exec execer, tenant, name string, value float64) error {
+	if !s.rollupConfig.Enabled() {
+		return nil
+	}
+
+	now := s.now()
+	for _, window := range s.rollupConfig.Windows {
+		start := repositories.RollupStart(now, window)
+		seconds := int64(window / time.Second)
+		var inserted bool
+		if err := exec.QueryRowContext(ctx, rollupQuery, tenant, name, seconds, start, value).Scan(&inserted); err != nil {
+			return fmt.Errorf("failed to update %s rollup of %s: %w", window, name, err)
+		}
+		if !inserted || s.rollupConfig.Retention <= 0 {
+			continue
+		}
+		oldest := start.Add(-time.Duration(s.rollupConfig.Retention-1) * window)
+		if _, err := exec.ExecContext(ctx, pruneRollupsQuery, tenant, name, seconds, oldest); err != nil {
+			return fmt.Errorf("failed to prune %s rollups of %s: %w", window, name, err)
+		}
+	}
+	return nil
+}
+
+// checkUpserted returns repositories.ErrMetricInvalidType when the upsert of a metric affected no row
+// because the metric is stored with another type.
+func checkUpserted(res sql.Result, name string) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s is stored with another type", repositories.ErrMetricInvalidType, name)
+	}
+	return nil
+}
+
+// UpdateMetric updates a metric in the database. It returns repositories.ErrMetricInvalidType when the
+// metric is stored with another type.
 func (s *DBStorage) UpdateMetric(ctx context.Context, name string, metric repositories.Metric) error {
 	switch metric.Type {
 	case "gauge":
-		query := `
-			INSERT INTO metrics (id, type, delta, value)
-			VALUES ($1, 'gauge', NULL, $2)
-			ON CONFLICT (id) DO UPDATE 
-			SET delta = NULL,
-				value = $2`
 		value := metric.Value.(float64)
-		_, err := s.db.ExecContext(ctx, query, name, value)
-		return err
+		if s.rollupConfig.Enabled() {
+			return s.updateGaugeWithRollups(ctx, name, value)
+		}
+		res, err := s.db.ExecContext(ctx, gaugeQuery, identity.Tenant(ctx), name, value)
+		if err != nil {
+			return err
+		}
+		return checkUpserted(res, name)
 	case "counter":
-		query := `
-			INSERT INTO metrics (id, type, delta, value)
-			VALUES ($1, 'counter', $2, NULL)
-			ON CONFLICT (id) DO UPDATE 
-			SET delta = metrics.delta + $2,
-				value = NULL`
 		delta := metric.Value.(int64)
-		_, err := s.db.ExecContext(ctx, query, name, delta)
-		return err
+		res, err := s.db.ExecContext(ctx, counterQuery, identity.Tenant(ctx), name, delta)
+		if err != nil {
+			return err
+		}
+		return checkUpserted(res, name)
 	default:
 		return fmt.Errorf("unknown metric type: %s", metric.Type)
 	}
 }
 
+// CreateCounter inserts a new counter and returns repositories.ErrMetricExists when a metric of that
+// name is stored.
+func (s *DBStorage) CreateCounter(ctx context.Context, name string, delta int64) error {
+	res, err := s.db.ExecContext(ctx, createCounterQuery, identity.Tenant(ctx), name, delta)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", repositories.ErrMetricExists, name)
+	}
+	return nil
+}
+
+// updateGaugeWithRollups writes a gauge and its rollups in one transaction, so that a failed rollup
+// update does not leave the value written without it.
+func (s *DBStorage) updateGaugeWithRollups(ctx context.Context, name string, value float64) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				logger.Log.Error("Failed to rollback transaction", zap.Error(rollbackErr))
+			}
+		}
+	}()
+
+	tenant := identity.Tenant(ctx)
+	res, err := tx.ExecContext(ctx, gaugeQuery, tenant, name, value)
+	if err != nil {
+		return err
+	}
+	if err = checkUpserted(res, name); err != nil {
+		return err
+	}
+	if err = s.addRollups(ctx, tx, tenant, name, value); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
 // GetMetric retrieves a metric from the database.
 func (s *DBStorage) GetMetric(ctx context.Context, name string) (repositories.Metric, error) {
-	query := `SELECT type, delta, value FROM metrics WHERE id = $1`
-	row := s.db.QueryRowContext(ctx, query, name)
+	query := `SELECT type, delta, value FROM metrics WHERE tenant = $1 AND id = $2`
+	row := s.db.QueryRowContext(ctx, query, identity.Tenant(ctx), name)
 
 	var typ string
 	var delta sql.NullInt64
 	var value sql.NullFloat64
 
 	err := row.Scan(&typ, &delta, &value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repositories.Metric{}, fmt.Errorf("%w: %s", repositories.ErrMetricNotFound, name)
+	}
 	if err != nil {
 		return repositories.Metric{}, err
 	}
@@ -92,8 +311,8 @@ func (s *DBStorage) GetMetric(ctx context.Context, name string) (repositories.Me
 }
 
 func (s *DBStorage) GetMetrics(ctx context.Context) (map[string]repositories.Metric, error) {
-	query := `SELECT id, type, delta, value FROM metrics`
-	rows, err := s.db.QueryContext(ctx, query)
+	query := `SELECT id, type, delta, value FROM metrics WHERE tenant = $1`
+	rows, err := s.db.QueryContext(ctx, query, identity.Tenant(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -133,7 +352,9 @@ func (s *DBStorage) GetMetrics(ctx context.Context) (map[string]repositories.Met
 	return metrics, nil
 }
 
-func (s *DBStorage) UpdateMetricsBatch(ctx context.Context, metrics map[string]repositories.Metric) error {
+// UpdateMetricsBatch updates a batch of metrics in a single transaction. The whole batch is rolled back
+// with repositories.ErrMetricInvalidType when a metric is stored with another type.
+func (s *DBStorage) UpdateMetricsBatch(ctx context.Context, metrics map[string]repositories.Metric) (err error) {
 	if len(metrics) == 0 {
 		return nil
 	}
@@ -150,20 +371,6 @@ func (s *DBStorage) UpdateMetricsBatch(ctx context.Context, metrics map[string]r
 		}
 	}()
 
-	counterQuery := `
-		INSERT INTO metrics (id, type, delta, value)
-		VALUES ($1, 'counter', $2, NULL)
-		ON CONFLICT (id) DO UPDATE 
-		SET delta = metrics.delta + $2,
-		value = NULL`
-
-	gaugeQuery := `
-		INSERT INTO metrics (id, type, delta, value)
-		VALUES ($1, 'gauge', NULL, $2)
-		ON CONFLICT (id) DO UPDATE 
-		SET delta = NULL,
-			value = $2`
-
 	counterStmt, err := tx.PrepareContext(ctx, counterQuery)
 	if err != nil {
 		return fmt.Errorf("failed to prepare counter statement: %w", err)
@@ -186,17 +393,39 @@ func (s *DBStorage) UpdateMetricsBatch(ctx context.Context, metrics map[string]r
 		}
 	}(gaugeStmt)
 
-	for id, metric := range metrics {
+	// Rows are written in a stable order so that concurrent batches lock them in the same order.
+	ids := make([]string, 0, len(metrics))
+	for id := range metrics {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	tenant := identity.Tenant(ctx)
+	for _, id := range ids {
+		metric := metrics[id]
 		switch metric.Type {
 		case "gauge":
 			value := metric.Value.(float64)
-			if _, err := gaugeStmt.ExecContext(ctx, id, value); err != nil {
-				return fmt.Errorf("failed to execute gauge statement for metric %s: %w", id, err)
+			res, execErr := gaugeStmt.ExecContext(ctx, tenant, id, value)
+			if execErr != nil {
+				err = fmt.Errorf("failed to execute gauge statement for metric %s: %w", id, execErr)
+				return err
+			}
+			if err = checkUpserted(res, id); err != nil {
+				return err
+			}
+			if err = s.addRollups(ctx, tx, tenant, id, value); err != nil {
+				return err
 			}
 		case "counter":
 			delta := metric.Value.(int64)
-			if _, err := counterStmt.ExecContext(ctx, id, delta); err != nil {
-				return fmt.Errorf("failed to execute counter statement for metric %s: %w", id, err)
+			res, execErr := counterStmt.ExecContext(ctx, tenant, id, delta)
+			if execErr != nil {
+				err = fmt.Errorf("failed to execute counter statement for metric %s: %w", id, execErr)
+				return err
+			}
+			if err = checkUpserted(res, id); err != nil {
+				return err
 			}
 		default:
 			return fmt.Errorf("unknown metric type: %s", metric.Type)
@@ -209,3 +438,407 @@ func (s *DBStorage) UpdateMetricsBatch(ctx context.Context, metrics map[string]r
 
 	return nil
 }
+
+// DeleteMetric removes a metric of the tenant of ctx. It returns repositories.ErrMetricNotFound when there is no such metric.
+func (s *DBStorage) DeleteMetric(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM metrics WHERE tenant = $1 AND id = $2`, identity.Tenant(ctx), name)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%w: %s", repositories.ErrMetricNotFound, name)
+	}
+	return s.deleteRollups(ctx, `DELETE FROM gauge_rollups WHERE tenant = $1 AND id = $2`, identity.Tenant(ctx), name)
+}
+
+// deleteRollups removes the rollups of deleted gauges when rollups are enabled.
+func (s *DBStorage) deleteRollups(ctx context.Context, query string, args ...any) error {
+	if !s.rollupConfig.Enabled() {
+		return nil
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to delete rollups: %w", err)
+	}
+	return nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// DeleteBySelector removes the metrics of the tenant of ctx matched by selector and returns their sorted names.
+func (s *DBStorage) DeleteBySelector(ctx context.Context, selector repositories.Selector) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`DELETE FROM metrics WHERE tenant = $1 AND id LIKE $2 ESCAPE '\' AND ($3 = '' OR type = $3) RETURNING id`,
+		identity.Tenant(ctx), likeEscaper.Replace(selector.Prefix)+"%", selector.Type)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			logger.Log.Error("Error closing rows", zap.Error(closeErr))
+		}
+	}()
+
+	deleted := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred during rows iteration: %w", err)
+	}
+
+	sort.Strings(deleted)
+	if len(deleted) > 0 && selector.Type != constants.MetricTypeCounter {
+		err = s.deleteRollups(ctx, `DELETE FROM gauge_rollups WHERE tenant = $1 AND id LIKE $2 ESCAPE '\'`,
+			identity.Tenant(ctx), likeEscaper.Replace(selector.Prefix)+"%")
+	}
+	return deleted, err
+}
+
+// GetUpdateTimes returns the time of the last write of every metric of the tenant of ctx.
+func (s *DBStorage) GetUpdateTimes(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, updated_at FROM metrics WHERE tenant = $1`, identity.Tenant(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			logger.Log.Error("Error closing rows", zap.Error(closeErr))
+		}
+	}()
+
+	updated := make(map[string]time.Time)
+	for rows.Next() {
+		var name string
+		var at time.Time
+		if err := rows.Scan(&name, &at); err != nil {
+			return nil, err
+		}
+		updated[name] = at
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred during rows iteration: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteExpired removes the series that were not written within their TTL in a single transaction and
+// returns the removed ones. The update time is checked by the DELETE itself, so series written since
+// they were selected are kept.
+func (s *DBStorage) DeleteExpired(ctx context.Context, series []repositories.ExpiringSeries) (removed []repositories.ExpiringSeries, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				logger.Log.Error("Failed to rollback transaction", zap.Error(rollbackErr))
+			}
+		}
+	}()
+
+	removed = make([]repositories.ExpiringSeries, 0)
+	for _, expiring := range series {
+		var res sql.Result
+		res, err = tx.ExecContext(ctx, deleteExpiredQuery, expiring.Tenant, expiring.Name, expiring.TTL.Seconds())
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete expired metric %s: %w", expiring.Name, err)
+		}
+		var deleted int64
+		if deleted, err = res.RowsAffected(); err != nil {
+			return nil, err
+		}
+		if deleted == 0 {
+			continue
+		}
+		if s.rollupConfig.Enabled() {
+			if _, err = tx.ExecContext(ctx, `DELETE FROM gauge_rollups WHERE tenant = $1 AND id = $2`,
+				expiring.Tenant, expiring.Name); err != nil {
+				return nil, fmt.Errorf("failed to delete rollups: %w", err)
+			}
+		}
+		removed = append(removed, expiring)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return removed, nil
+}
+
+// ListTenants lists the tenants that have at least one metric.
+func (s *DBStorage) ListTenants(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT tenant FROM metrics ORDER BY tenant`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			logger.Log.Error("Error closing rows", zap.Error(closeErr))
+		}
+	}()
+
+	tenants := make([]string, 0)
+	for rows.Next() {
+		var tenant string
+		if err := rows.Scan(&tenant); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred during rows iteration: %w", err)
+	}
+
+	return tenants, nil
+}
+
+// DeleteTenant removes every metric of the tenant.
+func (s *DBStorage) DeleteTenant(ctx context.Context, tenant string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM metrics WHERE tenant = $1`, tenant); err != nil {
+		return err
+	}
+	return s.deleteRollups(ctx, `DELETE FROM gauge_rollups WHERE tenant = $1`, tenant)
+}
+
+// UpdateMetadata registers the metadata of metrics of the tenant of ctx in a single transaction,
+// replacing previously registered metadata.
+func (s *DBStorage) UpdateMetadata(ctx context.Context, metadata map[string]repositories.Metadata) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				logger.Log.Error("Failed to rollback transaction", zap.Error(rollbackErr))
+			}
+		}
+	}()
+
+	ids := make([]string, 0, len(metadata))
+	for id := range metadata {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	tenant := identity.Tenant(ctx)
+	for _, id := range ids {
+		meta := metadata[id]
+		if _, err = tx.ExecContext(ctx, metadataQuery, tenant, id, meta.Type, meta.Unit, meta.Help, meta.Owner); err != nil {
+			return fmt.Errorf("failed to update metadata of %s: %w", id, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetMetadata retrieves the metadata registered for metrics of the tenant of ctx.
+func (s *DBStorage) GetMetadata(ctx context.Context) (map[string]repositories.Metadata, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, type, unit, help, owner FROM metric_metadata WHERE tenant = $1`, identity.Tenant(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			logger.Log.Error("Error closing rows", zap.Error(closeErr))
+		}
+	}()
+
+	metadata := make(map[string]repositories.Metadata)
+	for rows.Next() {
+		var name string
+		var meta repositories.Metadata
+		if err := rows.Scan(&name, &meta.Type, &meta.Unit, &meta.Help, &meta.Owner); err != nil {
+			return nil, err
+		}
+		metadata[name] = meta
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred during rows iteration: %w", err)
+	}
+
+	return metadata, nil
+}
+
+// GetRollups retrieves the rollups of a gauge of the tenant of ctx for windows of the given length,
+// ordered by their start. It returns repositories.ErrRollupWindowNotConfigured for other lengths.
+func (s *DBStorage) GetRollups(ctx context.Context, name string, window time.Duration) ([]repositories.Rollup, error) {
+	if !s.rollupConfig.Enabled() || !s.rollupConfig.Has(window) {
+		return nil, fmt.Errorf("%w: %s", repositories.ErrRollupWindowNotConfigured, window)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT start_at, min, max, sum, count, last FROM gauge_rollups
+		WHERE tenant = $1 AND id = $2 AND window_seconds = $3 ORDER BY start_at`,
+		identity.Tenant(ctx), name, int64(window/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			logger.Log.Error("Error closing rows", zap.Error(closeErr))
+		}
+	}()
+
+	rollups := make([]repositories.Rollup, 0)
+	for rows.Next() {
+		r := repositories.Rollup{Window: window}
+		if err := rows.Scan(&r.Start, &r.Min, &r.Max, &r.Sum, &r.Count, &r.Last); err != nil {
+			return nil, err
+		}
+		r.Start = r.Start.UTC()
+		rollups = append(rollups, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred during rows iteration: %w", err)
+	}
+
+	return rollups, nil
+}
+
+// CompactRollups folds the rollups of the tenant of ctx of windows of length window starting before
+// the given time into windows of length into, or drops them when into is zero, and returns the number
+// of windows removed.
+func (s *DBStorage) CompactRollups(ctx context.Context, window, into time.Duration, before time.Time) (removed int, err error) {
+	tenant := identity.Tenant(ctx)
+	seconds := int64(window / time.Second)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				logger.Log.Error("Failed to rollback transaction", zap.Error(rollbackErr))
+			}
+		}
+	}()
+
+	if into > 0 {
+		var series map[string][]repositories.Rollup
+		if series, err = s.compactedRollups(ctx, tx, tenant, window, before); err != nil {
+			return 0, err
+		}
+		// Rows are written in a stable order so that concurrent compactions lock them in the same order.
+		ids := make([]string, 0, len(series))
+		for id := range series {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			for _, r := range repositories.FoldRollups(series[id], into) {
+				if _, err = tx.ExecContext(ctx, mergeRollupQuery, tenant, id, int64(into/time.Second), r.Start,
+					r.Min, r.Max, r.Sum, r.Count, r.Last); err != nil {
+					return 0, fmt.Errorf("failed to fold %s rollups of %s: %w", window, id, err)
+				}
+			}
+		}
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM gauge_rollups WHERE tenant = $1 AND window_seconds = $2 AND start_at < $3`, tenant, seconds, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to drop %s rollups: %w", window, err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int(deleted), nil
+}
+
+// compactedRollups retrieves the rollups of windows of one length starting before the given time per gauge.
+func (s *DBStorage) compactedRollups(ctx context.Context, tx *sql.Tx, tenant string, window time.Duration, before time.Time) (map[string][]repositories.Rollup, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, start_at, min, max, sum, count, last FROM gauge_rollups
+		WHERE tenant = $1 AND window_seconds = $2 AND start_at < $3 ORDER BY id, start_at FOR UPDATE`,
+		tenant, int64(window/time.Second), before)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			logger.Log.Error("Error closing rows", zap.Error(closeErr))
+		}
+	}()
+
+	series := make(map[string][]repositories.Rollup)
+	for rows.Next() {
+		var id string
+		r := repositories.Rollup{Window: window}
+		if err := rows.Scan(&id, &r.Start, &r.Min, &r.Max, &r.Sum, &r.Count, &r.Last); err != nil {
+			return nil, err
+		}
+		r.Start = r.Start.UTC()
+		series[id] = append(series[id], r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred during rows iteration: %w", err)
+	}
+
+	return series, nil
+}
+
+// RollupSizes returns the number of rollup windows of the tenant of ctx kept per window length.
+func (s *DBStorage) RollupSizes(ctx context.Context) (map[time.Duration]int, error) {
+	sizes := make(map[time.Duration]int)
+	if !s.rollupConfig.Enabled() {
+		return sizes, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT window_seconds, COUNT(*) FROM gauge_rollups WHERE tenant = $1 GROUP BY window_seconds`, identity.Tenant(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			logger.Log.Error("Error closing rows", zap.Error(closeErr))
+		}
+	}()
+
+	for rows.Next() {
+		var seconds int64
+		var count int
+		if err := rows.Scan(&seconds, &count); err != nil {
+			return nil, err
+		}
+		sizes[time.Duration(seconds)*time.Second] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred during rows iteration: %w", err)
+	}
+
+	return sizes, nil
+}
@@ -3,11 +3,14 @@ package dbstorage_test
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 	"github.com/a2sh3r/sysmetrics/internal/server/storage/dbstorage"
 	"github.com/stretchr/testify/assert"
@@ -17,12 +20,24 @@ import (
 func expectTableCreation(mock sqlmock.Sqlmock) {
 	mock.ExpectExec(regexp.QuoteMeta(`
     CREATE TABLE IF NOT EXISTS metrics (
-        id TEXT PRIMARY KEY,
+        tenant TEXT NOT NULL DEFAULT '',
+        id TEXT NOT NULL,
         type TEXT NOT NULL,
         delta BIGINT,
-        value DOUBLE PRECISION
+        value DOUBLE PRECISION,
+        PRIMARY KEY (tenant, id)
     )
     `)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT ''`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE metrics ADD PRIMARY KEY (tenant, id)`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS metric_metadata`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS gauge_rollups`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE metrics ADD COLUMN IF NOT EXISTS updated_at`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
 }
 
 func TestDBStorage_UpdateMetric(t *testing.T) {
@@ -51,12 +66,14 @@ func TestDBStorage_UpdateMetric(t *testing.T) {
 			metric:     repositories.Metric{Type: "gauge", Value: float64(42.42)},
 			prepareMock: func() {
 				mock.ExpectExec(regexp.QuoteMeta(`
-            INSERT INTO metrics (id, type, delta, value)
-            VALUES ($1, 'gauge', NULL, $2)
-            ON CONFLICT (id) DO UPDATE 
+            INSERT INTO metrics (tenant, id, type, delta, value)
+            VALUES ($1, $2, 'gauge', NULL, $3)
+            ON CONFLICT (tenant, id) DO UPDATE
             SET delta = NULL,
-                value = $2`)).
-					WithArgs("gauge1", 42.42).
+                value = $3,
+                updated_at = now()
+            WHERE metrics.type = EXCLUDED.type`)).
+					WithArgs("", "gauge1", 42.42).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 		},
@@ -66,12 +83,14 @@ func TestDBStorage_UpdateMetric(t *testing.T) {
 			metric:     repositories.Metric{Type: "counter", Value: int64(10)},
 			prepareMock: func() {
 				mock.ExpectExec(regexp.QuoteMeta(`
-            INSERT INTO metrics (id, type, delta, value)
-            VALUES ($1, 'counter', $2, NULL)
-            ON CONFLICT (id) DO UPDATE 
-            SET delta = metrics.delta + $2,
-                value = NULL`)).
-					WithArgs("counter1", int64(10)).
+            INSERT INTO metrics (tenant, id, type, delta, value)
+            VALUES ($1, $2, 'counter', $3, NULL)
+            ON CONFLICT (tenant, id) DO UPDATE
+            SET delta = metrics.delta + $3,
+                value = NULL,
+                updated_at = now()
+            WHERE metrics.type = EXCLUDED.type`)).
+					WithArgs("", "counter1", int64(10)).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 		},
@@ -125,8 +144,8 @@ func TestDBStorage_GetMetric(t *testing.T) {
 			prepareMock: func() {
 				rows := sqlmock.NewRows([]string{"type", "delta", "value"}).
 					AddRow("gauge", nil, 123.456)
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT type, delta, value FROM metrics WHERE id = $1`)).
-					WithArgs("gauge1").
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT type, delta, value FROM metrics WHERE tenant = $1 AND id = $2`)).
+					WithArgs("", "gauge1").
 					WillReturnRows(rows)
 			},
 			wantMetric: repositories.Metric{Type: "gauge", Value: float64(123.456)},
@@ -137,8 +156,8 @@ func TestDBStorage_GetMetric(t *testing.T) {
 			prepareMock: func() {
 				rows := sqlmock.NewRows([]string{"type", "delta", "value"}).
 					AddRow("counter", int64(10), nil)
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT type, delta, value FROM metrics WHERE id = $1`)).
-					WithArgs("counter1").
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT type, delta, value FROM metrics WHERE tenant = $1 AND id = $2`)).
+					WithArgs("", "counter1").
 					WillReturnRows(rows)
 			},
 			wantMetric: repositories.Metric{Type: "counter", Value: int64(10)},
@@ -147,8 +166,8 @@ func TestDBStorage_GetMetric(t *testing.T) {
 			name:       "metric not found returns error",
 			metricName: "missing",
 			prepareMock: func() {
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT type, delta, value FROM metrics WHERE id = $1`)).
-					WithArgs("missing").
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT type, delta, value FROM metrics WHERE tenant = $1 AND id = $2`)).
+					WithArgs("", "missing").
 					WillReturnError(sql.ErrNoRows)
 			},
 			wantErr: true,
@@ -160,7 +179,7 @@ func TestDBStorage_GetMetric(t *testing.T) {
 			tt.prepareMock()
 			metric, err := storage.GetMetric(ctx, tt.metricName)
 			if tt.wantErr {
-				assert.Error(t, err)
+				assert.ErrorIs(t, err, repositories.ErrMetricNotFound)
 			} else {
 				assert.NoError(t, err)
 				assert.Equal(t, tt.wantMetric, metric)
@@ -188,7 +207,8 @@ func TestDBStorage_GetMetrics(t *testing.T) {
 		AddRow("g1", "gauge", nil, 10.5).
 		AddRow("c1", "counter", int64(7), nil)
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, type, delta, value FROM metrics`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, type, delta, value FROM metrics WHERE tenant = $1`)).
+		WithArgs("").
 		WillReturnRows(rows)
 
 	got, err := storage.GetMetrics(ctx)
@@ -220,17 +240,21 @@ func TestDBStorage_UpdateMetricsBatch(t *testing.T) {
 	mock.ExpectBegin()
 
 	mock.ExpectPrepare(regexp.QuoteMeta(`
-        INSERT INTO metrics (id, type, delta, value)
-        VALUES ($1, 'counter', $2, NULL)
-        ON CONFLICT (id) DO UPDATE 
-        SET delta = metrics.delta + $2,
-        value = NULL`))
+            INSERT INTO metrics (tenant, id, type, delta, value)
+            VALUES ($1, $2, 'counter', $3, NULL)
+            ON CONFLICT (tenant, id) DO UPDATE
+            SET delta = metrics.delta + $3,
+                value = NULL,
+                updated_at = now()
+            WHERE metrics.type = EXCLUDED.type`))
 	mock.ExpectPrepare(regexp.QuoteMeta(`
-        INSERT INTO metrics (id, type, delta, value)
-        VALUES ($1, 'gauge', NULL, $2)
-        ON CONFLICT (id) DO UPDATE 
-        SET delta = NULL,
-            value = $2`))
+            INSERT INTO metrics (tenant, id, type, delta, value)
+            VALUES ($1, $2, 'gauge', NULL, $3)
+            ON CONFLICT (tenant, id) DO UPDATE
+            SET delta = NULL,
+                value = $3,
+                updated_at = now()
+            WHERE metrics.type = EXCLUDED.type`))
 
 	batch := map[string]repositories.Metric{
 		"g1": {Type: "gauge", Value: float64(1.23)},
@@ -238,21 +262,25 @@ func TestDBStorage_UpdateMetricsBatch(t *testing.T) {
 	}
 
 	mock.ExpectExec(regexp.QuoteMeta(`
-        INSERT INTO metrics (id, type, delta, value)
-        VALUES ($1, 'gauge', NULL, $2)
-        ON CONFLICT (id) DO UPDATE 
-        SET delta = NULL,
-            value = $2`)).
-		WithArgs("g1", float64(1.23)).
+            INSERT INTO metrics (tenant, id, type, delta, value)
+            VALUES ($1, $2, 'counter', $3, NULL)
+            ON CONFLICT (tenant, id) DO UPDATE
+            SET delta = metrics.delta + $3,
+                value = NULL,
+                updated_at = now()
+            WHERE metrics.type = EXCLUDED.type`)).
+		WithArgs("", "c1", int64(5)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectExec(regexp.QuoteMeta(`
-        INSERT INTO metrics (id, type, delta, value)
-        VALUES ($1, 'counter', $2, NULL)
-        ON CONFLICT (id) DO UPDATE 
-        SET delta = metrics.delta + $2,
-        value = NULL`)).
-		WithArgs("c1", int64(5)).
+            INSERT INTO metrics (tenant, id, type, delta, value)
+            VALUES ($1, $2, 'gauge', NULL, $3)
+            ON CONFLICT (tenant, id) DO UPDATE
+            SET delta = NULL,
+                value = $3,
+                updated_at = now()
+            WHERE metrics.type = EXCLUDED.type`)).
+		WithArgs("", "g1", float64(1.23)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectCommit()
@@ -261,3 +289,392 @@ func TestDBStorage_UpdateMetricsBatch(t *testing.T) {
 	require.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestDBStorage_TypeConflict(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if errDB := db.Close(); errDB != nil {
+			fmt.Printf("error closing db")
+		}
+	}()
+
+	expectTableCreation(mock)
+	storage, err := dbstorage.NewDBStorage(db)
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO metrics`)).
+		WithArgs("", "shared", 1.5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	err = storage.UpdateMetric(ctx, "shared", repositories.Metric{Type: "gauge", Value: 1.5})
+	assert.ErrorIs(t, err, repositories.ErrMetricInvalidType)
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO metrics`)).
+		WithArgs("", "shared", int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	err = storage.UpdateMetric(ctx, "shared", repositories.Metric{Type: "counter", Value: int64(2)})
+	assert.ErrorIs(t, err, repositories.ErrMetricInvalidType)
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO metrics`))
+	mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO metrics`))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO metrics`)).
+		WithArgs("", "shared", int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	err = storage.UpdateMetricsBatch(ctx, map[string]repositories.Metric{"shared": {Type: "counter", Value: int64(2)}})
+	assert.ErrorIs(t, err, repositories.ErrMetricInvalidType)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_CreateCounter(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if errDB := db.Close(); errDB != nil {
+			fmt.Printf("error closing db")
+		}
+	}()
+
+	expectTableCreation(mock)
+	storage, err := dbstorage.NewDBStorage(db)
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta(`ON CONFLICT (tenant, id) DO NOTHING`)).
+		WithArgs("", "hits", int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.CreateCounter(ctx, "hits", 3))
+
+	mock.ExpectExec(regexp.QuoteMeta(`ON CONFLICT (tenant, id) DO NOTHING`)).
+		WithArgs("", "hits", int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, storage.CreateCounter(ctx, "hits", 5), repositories.ErrMetricExists)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_Expiry(t *testing.T) {
+	ctx := identity.WithTenant(context.Background(), "acme")
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if errDB := db.Close(); errDB != nil {
+			fmt.Printf("error closing db")
+		}
+	}()
+
+	expectTableCreation(mock)
+	storage, err := dbstorage.NewDBStorage(db)
+	require.NoError(t, err)
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, updated_at FROM metrics WHERE tenant = $1`)).
+		WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow("old", at).AddRow("fresh", at.Add(time.Minute)))
+	updated, err := storage.GetUpdateTimes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{"old": at, "fresh": at.Add(time.Minute)}, updated)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM metrics WHERE tenant = $1 AND id = $2 AND updated_at <= now() - make_interval(secs => $3)`)).
+		WithArgs("acme", "old", float64(120)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM metrics`)).
+		WithArgs("", "written-meanwhile", float64(120)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	removed, err := storage.DeleteExpired(ctx, []repositories.ExpiringSeries{
+		{Tenant: "acme", Name: "old", TTL: 2 * time.Minute},
+		{Name: "written-meanwhile", TTL: 2 * time.Minute},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.ExpiringSeries{{Tenant: "acme", Name: "old", TTL: 2 * time.Minute}}, removed)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_Tenants(t *testing.T) {
+	ctx := identity.WithTenant(context.Background(), "acme")
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if errDB := db.Close(); errDB != nil {
+			fmt.Printf("error closing db")
+		}
+	}()
+
+	expectTableCreation(mock)
+	storage, err := dbstorage.NewDBStorage(db)
+	require.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT type, delta, value FROM metrics WHERE tenant = $1 AND id = $2`)).
+		WithArgs("acme", "g1").
+		WillReturnRows(sqlmock.NewRows([]string{"type", "delta", "value"}).AddRow("gauge", nil, 1.5))
+
+	metric, err := storage.GetMetric(ctx, "g1")
+	require.NoError(t, err)
+	assert.Equal(t, repositories.Metric{Type: "gauge", Value: float64(1.5)}, metric)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT tenant FROM metrics ORDER BY tenant`)).
+		WillReturnRows(sqlmock.NewRows([]string{"tenant"}).AddRow("").AddRow("acme"))
+
+	tenants, err := storage.ListTenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "acme"}, tenants)
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM metrics WHERE tenant = $1`)).
+		WithArgs("acme").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	require.NoError(t, storage.DeleteTenant(ctx, "acme"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_DeleteMetric(t *testing.T) {
+	ctx := identity.WithTenant(context.Background(), "acme")
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if errDB := db.Close(); errDB != nil {
+			fmt.Printf("error closing db")
+		}
+	}()
+
+	expectTableCreation(mock)
+	storage, err := dbstorage.NewDBStorage(db)
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM metrics WHERE tenant = $1 AND id = $2`)).
+		WithArgs("acme", "g1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, storage.DeleteMetric(ctx, "g1"))
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM metrics WHERE tenant = $1 AND id = $2`)).
+		WithArgs("acme", "g1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, storage.DeleteMetric(ctx, "g1"), repositories.ErrMetricNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_DeleteBySelector(t *testing.T) {
+	ctx := identity.WithTenant(context.Background(), "acme")
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if errDB := db.Close(); errDB != nil {
+			fmt.Printf("error closing db")
+		}
+	}()
+
+	expectTableCreation(mock)
+	storage, err := dbstorage.NewDBStorage(db)
+	require.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`DELETE FROM metrics WHERE tenant = $1 AND id LIKE $2 ESCAPE '\' AND ($3 = '' OR type = $3) RETURNING id`)).
+		WithArgs("acme", `http\_%`, "gauge").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("http_latency").AddRow("http_bytes"))
+
+	deleted, err := storage.DeleteBySelector(ctx, repositories.Selector{Prefix: "http_", Type: "gauge"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http_bytes", "http_latency"}, deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_Metadata(t *testing.T) {
+	ctx := identity.WithTenant(context.Background(), "acme")
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if errDB := db.Close(); errDB != nil {
+			fmt.Printf("error closing db")
+		}
+	}()
+
+	expectTableCreation(mock)
+	storage, err := dbstorage.NewDBStorage(db)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO metric_metadata`)).
+		WithArgs("acme", "Alloc", "gauge", "bytes", "Allocated heap objects.", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO metric_metadata`)).
+		WithArgs("acme", "PollCount", "counter", "", "Number of polls.", "agent").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, storage.UpdateMetadata(ctx, map[string]repositories.Metadata{
+		"PollCount": {Type: "counter", Help: "Number of polls.", Owner: "agent"},
+		"Alloc":     {Type: "gauge", Unit: "bytes", Help: "Allocated heap objects."},
+	}))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, type, unit, help, owner FROM metric_metadata WHERE tenant = $1`)).
+		WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "unit", "help", "owner"}).
+			AddRow("Alloc", "gauge", "bytes", "Allocated heap objects.", ""))
+
+	metadata, err := storage.GetMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]repositories.Metadata{
+		"Alloc": {Type: "gauge", Unit: "bytes", Help: "Allocated heap objects."},
+	}, metadata)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_Rollups(t *testing.T) {
+	ctx := identity.WithTenant(context.Background(), "acme")
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if errDB := db.Close(); errDB != nil {
+			fmt.Printf("error closing db")
+		}
+	}()
+
+	expectTableCreation(mock)
+	storage, err := dbstorage.NewDBStorage(db)
+	require.NoError(t, err)
+
+	_, err = storage.GetRollups(ctx, "cpu", time.Minute)
+	assert.ErrorIs(t, err, repositories.ErrRollupWindowNotConfigured, "rollups are disabled by default")
+
+	storage.EnableRollups(repositories.RollupConfig{Windows: []time.Duration{time.Minute, time.Hour}, Retention: 10})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO metrics`)).
+		WithArgs("acme", "cpu", 95.0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, seconds := range []int64{60, 3600} {
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO gauge_rollups`)).
+			WithArgs("acme", "cpu", seconds, sqlmock.AnyArg(), 95.0).
+			WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM gauge_rollups`)).
+			WithArgs("acme", "cpu", seconds, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectCommit()
+	require.NoError(t, storage.UpdateMetric(ctx, "cpu", repositories.Metric{Type: "gauge", Value: 95.0}))
+
+	// Values within the open windows leave the older windows alone.
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO metrics`)).
+		WithArgs("acme", "cpu", 20.0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, seconds := range []int64{60, 3600} {
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO gauge_rollups`)).
+			WithArgs("acme", "cpu", seconds, sqlmock.AnyArg(), 20.0).
+			WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(false))
+	}
+	mock.ExpectCommit()
+	require.NoError(t, storage.UpdateMetric(ctx, "cpu", repositories.Metric{Type: "gauge", Value: 20.0}))
+
+	// A failed rollup update rolls back the value of the gauge.
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO metrics`)).
+		WithArgs("acme", "cpu", 30.0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO gauge_rollups`)).
+		WithArgs("acme", "cpu", int64(60), sqlmock.AnyArg(), 30.0).
+		WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+	assert.Error(t, storage.UpdateMetric(ctx, "cpu", repositories.Metric{Type: "gauge", Value: 30.0}))
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO metrics`))
+	mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO metrics`))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO metrics`)).
+		WithArgs("acme", "cpu", 30.0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO gauge_rollups`)).
+		WithArgs("acme", "cpu", int64(60), sqlmock.AnyArg(), 30.0).
+		WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+	assert.Error(t, storage.UpdateMetricsBatch(ctx, map[string]repositories.Metric{"cpu": {Type: "gauge", Value: 30.0}}),
+		"a failed rollup update rolls back the batch")
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT start_at, min, max, sum, count, last FROM gauge_rollups`)).
+		WithArgs("acme", "cpu", int64(60)).
+		WillReturnRows(sqlmock.NewRows([]string{"start_at", "min", "max", "sum", "count", "last"}).
+			AddRow(start, 20.0, 95.0, 145.0, int64(3), 30.0))
+
+	rollups, err := storage.GetRollups(ctx, "cpu", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{
+		{Start: start, Window: time.Minute, Min: 20, Max: 95, Sum: 145, Count: 3, Last: 30},
+	}, rollups)
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM metrics WHERE tenant = $1 AND id = $2`)).
+		WithArgs("acme", "cpu").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM gauge_rollups WHERE tenant = $1 AND id = $2`)).
+		WithArgs("acme", "cpu").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	require.NoError(t, storage.DeleteMetric(ctx, "cpu"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_CompactRollups(t *testing.T) {
+	ctx := identity.WithTenant(context.Background(), "acme")
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if errDB := db.Close(); errDB != nil {
+			fmt.Printf("error closing db")
+		}
+	}()
+
+	expectTableCreation(mock)
+	storage, err := dbstorage.NewDBStorage(db)
+	require.NoError(t, err)
+	storage.EnableRollups(repositories.RollupConfig{Windows: []time.Duration{time.Minute}, Compacted: []time.Duration{time.Hour}})
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := start.Add(2 * time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, start_at, min, max, sum, count, last FROM gauge_rollups`)).
+		WithArgs("acme", int64(60), before).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "start_at", "min", "max", "sum", "count", "last"}).
+			AddRow("cpu", start, 20.0, 95.0, 145.0, int64(3), 30.0).
+			AddRow("cpu", start.Add(time.Minute), 10.0, 10.0, 10.0, int64(1), 10.0).
+			AddRow("cpu", start.Add(time.Hour), 5.0, 5.0, 5.0, int64(1), 5.0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO gauge_rollups`)).
+		WithArgs("acme", "cpu", int64(3600), start, 10.0, 95.0, 155.0, int64(4), 10.0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO gauge_rollups`)).
+		WithArgs("acme", "cpu", int64(3600), start.Add(time.Hour), 5.0, 5.0, 5.0, int64(1), 5.0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM gauge_rollups WHERE tenant = $1 AND window_seconds = $2 AND start_at < $3`)).
+		WithArgs("acme", int64(60), before).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	removed, err := storage.CompactRollups(ctx, time.Minute, time.Hour, before)
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM gauge_rollups WHERE tenant = $1 AND window_seconds = $2 AND start_at < $3`)).
+		WithArgs("acme", int64(3600), before).
+		WillReturnError(errors.New("connection lost"))
+	mock.ExpectRollback()
+
+	_, err = storage.CompactRollups(ctx, time.Hour, 0, before)
+	assert.Error(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT window_seconds, COUNT(*) FROM gauge_rollups`)).
+		WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"window_seconds", "count"}).AddRow(int64(60), 4).AddRow(int64(3600), 2))
+
+	sizes, err := storage.RollupSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[time.Duration]int{time.Minute: 4, time.Hour: 2}, sizes)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -5,31 +5,73 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 )
 
 var (
-	ErrMetricNotFound    = errors.New("metric not found")
+	ErrMetricNotFound    = repositories.ErrMetricNotFound
 	ErrStorageNil        = errors.New("MemStorage is nil")
 	ErrMetricsMapNil     = errors.New("metrics map is nil")
-	ErrMetricInvalidType = errors.New("invalid value type for metric")
-	ErrMetricInvalidName = errors.New("invalid metric error")
+	ErrMetricInvalidType = repositories.ErrMetricInvalidType
+	ErrMetricInvalidName = repositories.ErrMetricInvalidName
 )
 
+// tenantSeparator separates the tenant from the metric name in keys of non-default tenants.
+// Metrics of the default tenant are stored under their bare names.
+const tenantSeparator = "\x00"
+
 // MemStorage implements in-memory storage for metrics.
 type MemStorage struct {
-	metrics map[string]repositories.Metric
+	metrics  map[string]repositories.Metric
+	metadata map[string]repositories.Metadata
+	// updated holds the time of the last write of every metric.
+	updated map[string]time.Time
 	mu      sync.RWMutex
+
+	rollupConfig repositories.RollupConfig
+	rollups      map[string]map[time.Duration][]repositories.Rollup
+	now          func() time.Time
 }
 
 // NewMemStorage creates a new MemStorage instance.
 func NewMemStorage() *MemStorage {
 	return &MemStorage{
-		metrics: make(map[string]repositories.Metric),
+		metrics:  make(map[string]repositories.Metric),
+		metadata: make(map[string]repositories.Metadata),
+		updated:  make(map[string]time.Time),
+	}
+}
+
+// SetClock replaces the time source of the update times and rollups. It must be called before the
+// storage is used.
+func (ms *MemStorage) SetClock(now func() time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.now = now
+}
+
+// clock returns the current time of the storage.
+func (ms *MemStorage) clock() time.Time {
+	if ms.now == nil {
+		return time.Now()
+	}
+	return ms.now()
+}
+
+// touchLocked records a write of the metric stored under key.
+func (ms *MemStorage) touchLocked(key string) {
+	if ms.updated == nil {
+		ms.updated = make(map[string]time.Time)
 	}
+	ms.updated[key] = ms.clock()
 }
 
 // GetMetric retrieves a metric from memory storage.
@@ -49,7 +91,7 @@ func (ms *MemStorage) GetMetric(ctx context.Context, metricName string) (reposit
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
-	if m, ok := ms.metrics[metricName]; ok {
+	if m, ok := ms.metrics[storageKey(identity.Tenant(ctx), metricName)]; ok {
 		return m, nil
 	}
 	return repositories.Metric{}, ErrMetricNotFound
@@ -71,14 +113,353 @@ func (ms *MemStorage) GetMetrics(ctx context.Context) (map[string]repositories.M
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
-	return ms.metrics, nil
+	tenant := identity.Tenant(ctx)
+	metrics := make(map[string]repositories.Metric)
+	for key, metric := range ms.metrics {
+		if keyTenant, name := splitStorageKey(key); keyTenant == tenant {
+			metrics[name] = metric
+		}
+	}
+
+	return metrics, nil
+}
+
+// ListTenants lists the tenants that have at least one metric.
+func (ms *MemStorage) ListTenants(ctx context.Context) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if ms == nil {
+		return nil, ErrStorageNil
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	seen := make(map[string]struct{})
+	for key := range ms.metrics {
+		tenant, _ := splitStorageKey(key)
+		seen[tenant] = struct{}{}
+	}
+
+	tenants := make([]string, 0, len(seen))
+	for tenant := range seen {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	return tenants, nil
+}
+
+// DeleteTenant removes every metric of the tenant.
+func (ms *MemStorage) DeleteTenant(ctx context.Context, tenant string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if ms == nil {
+		return ErrStorageNil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for key := range ms.metrics {
+		if keyTenant, _ := splitStorageKey(key); keyTenant == tenant {
+			delete(ms.metrics, key)
+			delete(ms.updated, key)
+			delete(ms.rollups, key)
+		}
+	}
+
+	return nil
+}
+
+// DeleteMetric removes a metric of the tenant of ctx. It returns ErrMetricNotFound when there is no such metric.
+func (ms *MemStorage) DeleteMetric(ctx context.Context, metricName string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if ms == nil {
+		return ErrStorageNil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	key := storageKey(identity.Tenant(ctx), metricName)
+	if _, ok := ms.metrics[key]; !ok {
+		return ErrMetricNotFound
+	}
+	delete(ms.metrics, key)
+	delete(ms.updated, key)
+	delete(ms.rollups, key)
+
+	return nil
+}
+
+// DeleteBySelector removes the metrics of the tenant of ctx matched by selector and returns their sorted names.
+func (ms *MemStorage) DeleteBySelector(ctx context.Context, selector repositories.Selector) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if ms == nil {
+		return nil, ErrStorageNil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	tenant := identity.Tenant(ctx)
+	deleted := make([]string, 0)
+	for key, metric := range ms.metrics {
+		keyTenant, name := splitStorageKey(key)
+		if keyTenant == tenant && selector.Matches(name, metric) {
+			delete(ms.metrics, key)
+			delete(ms.updated, key)
+			delete(ms.rollups, key)
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(deleted)
+
+	return deleted, nil
+}
+
+// GetUpdateTimes returns the time of the last write of every metric of the tenant of ctx.
+func (ms *MemStorage) GetUpdateTimes(ctx context.Context) (map[string]time.Time, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if ms == nil {
+		return nil, ErrStorageNil
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	tenant := identity.Tenant(ctx)
+	updated := make(map[string]time.Time)
+	for key := range ms.metrics {
+		if keyTenant, name := splitStorageKey(key); keyTenant == tenant {
+			updated[name] = ms.updated[key]
+		}
+	}
+
+	return updated, nil
+}
+
+// DeleteExpired removes the series that were not written within their TTL and returns the removed ones.
+func (ms *MemStorage) DeleteExpired(ctx context.Context, series []repositories.ExpiringSeries) ([]repositories.ExpiringSeries, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if ms == nil {
+		return nil, ErrStorageNil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := ms.clock()
+	removed := make([]repositories.ExpiringSeries, 0)
+	for _, s := range series {
+		key := storageKey(s.Tenant, s.Name)
+		if _, ok := ms.metrics[key]; !ok || now.Sub(ms.updated[key]) < s.TTL {
+			continue
+		}
+		delete(ms.metrics, key)
+		delete(ms.updated, key)
+		delete(ms.rollups, key)
+		removed = append(removed, s)
+	}
+
+	return removed, nil
+}
+
+// UpdateMetadata registers the metadata of metrics of the tenant of ctx, replacing previously registered metadata.
+func (ms *MemStorage) UpdateMetadata(ctx context.Context, metadata map[string]repositories.Metadata) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if ms == nil {
+		return ErrStorageNil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.metadata == nil {
+		ms.metadata = make(map[string]repositories.Metadata)
+	}
+
+	tenant := identity.Tenant(ctx)
+	for name := range metadata {
+		if name == "" || strings.Contains(name, tenantSeparator) {
+			return ErrMetricInvalidName
+		}
+	}
+	for name, meta := range metadata {
+		ms.metadata[storageKey(tenant, name)] = meta
+	}
+
+	return nil
+}
+
+// GetMetadata retrieves the metadata registered for metrics of the tenant of ctx.
+func (ms *MemStorage) GetMetadata(ctx context.Context) (map[string]repositories.Metadata, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if ms == nil {
+		return nil, ErrStorageNil
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	tenant := identity.Tenant(ctx)
+	metadata := make(map[string]repositories.Metadata)
+	for key, meta := range ms.metadata {
+		if keyTenant, name := splitStorageKey(key); keyTenant == tenant {
+			metadata[name] = meta
+		}
+	}
+
+	return metadata, nil
+}
+
+// EnableRollups makes the storage keep rollups of the gauge values written from now on.
+func (ms *MemStorage) EnableRollups(cfg repositories.RollupConfig) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.rollupConfig = cfg
+	ms.rollups = make(map[string]map[time.Duration][]repositories.Rollup)
+	if ms.now == nil {
+		ms.now = time.Now
+	}
+}
+
+// addRollupsLocked adds a gauge value to the rollups of its series.
+func (ms *MemStorage) addRollupsLocked(key string, value float64) {
+	if !ms.rollupConfig.Enabled() {
+		return
+	}
+
+	series, ok := ms.rollups[key]
+	if !ok {
+		series = make(map[time.Duration][]repositories.Rollup, len(ms.rollupConfig.Windows))
+		ms.rollups[key] = series
+	}
+	now := ms.clock()
+	for _, window := range ms.rollupConfig.Windows {
+		series[window] = repositories.AddRollup(series[window], window, ms.rollupConfig.Retention, now, value)
+	}
+}
+
+// GetRollups retrieves the rollups of a gauge of the tenant of ctx for windows of the given length,
+// ordered by their start. It returns repositories.ErrRollupWindowNotConfigured for other lengths.
+func (ms *MemStorage) GetRollups(ctx context.Context, metricName string, window time.Duration) ([]repositories.Rollup, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if ms == nil {
+		return nil, ErrStorageNil
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if !ms.rollupConfig.Enabled() || !ms.rollupConfig.Has(window) {
+		return nil, fmt.Errorf("%w: %s", repositories.ErrRollupWindowNotConfigured, window)
+	}
+
+	rollups := ms.rollups[storageKey(identity.Tenant(ctx), metricName)][window]
+	return append(make([]repositories.Rollup, 0, len(rollups)), rollups...), nil
+}
+
+// CompactRollups folds the rollups of the tenant of ctx of windows of length window starting before
+// the given time into windows of length into, or drops them when into is zero, and returns the number
+// of windows removed.
+func (ms *MemStorage) CompactRollups(ctx context.Context, window, into time.Duration, before time.Time) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	if ms == nil {
+		return 0, ErrStorageNil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	tenant := identity.Tenant(ctx)
+	removed := 0
+	for key, series := range ms.rollups {
+		if keyTenant, _ := splitStorageKey(key); keyTenant != tenant {
+			continue
+		}
+		rollups := series[window]
+		n := sort.Search(len(rollups), func(i int) bool { return !rollups[i].Start.Before(before) })
+		if n == 0 {
+			continue
+		}
+		if into > 0 {
+			series[into] = repositories.CombineRollups(series[into], repositories.FoldRollups(rollups[:n], into))
+		}
+		series[window] = append(rollups[:0:0], rollups[n:]...)
+		removed += n
+	}
+
+	return removed, nil
+}
+
+// RollupSizes returns the number of rollup windows of the tenant of ctx kept per window length.
+func (ms *MemStorage) RollupSizes(ctx context.Context) (map[time.Duration]int, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if ms == nil {
+		return nil, ErrStorageNil
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	tenant := identity.Tenant(ctx)
+	sizes := make(map[time.Duration]int)
+	for key, series := range ms.rollups {
+		if keyTenant, _ := splitStorageKey(key); keyTenant != tenant {
+			continue
+		}
+		for window, rollups := range series {
+			if len(rollups) > 0 {
+				sizes[window] += len(rollups)
+			}
+		}
+	}
+
+	return sizes, nil
+}
+
+func storageKey(tenant, name string) string {
+	if tenant == "" {
+		return name
+	}
+	return tenant + tenantSeparator + name
+}
+
+func splitStorageKey(key string) (string, string) {
+	if tenant, name, ok := strings.Cut(key, tenantSeparator); ok {
+		return tenant, name
+	}
+	return "", key
 }
 
 func (ms *MemStorage) UpdateMetric(ctx context.Context, metricName string, metric repositories.Metric) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
-	if metricName == "" {
+	if metricName == "" || strings.Contains(metricName, tenantSeparator) {
 		return ErrMetricInvalidName
 	}
 	if ms == nil {
@@ -96,10 +477,15 @@ func (ms *MemStorage) UpdateMetric(ctx context.Context, metricName string, metri
 		return ErrMetricInvalidType
 	}
 
-	existingMetric, exists := ms.metrics[metricName]
+	key := storageKey(identity.Tenant(ctx), metricName)
+	existingMetric, exists := ms.metrics[key]
 
 	if !exists {
-		ms.metrics[metricName] = metric
+		if value, ok := metric.Value.(float64); ok && metric.Type == constants.MetricTypeGauge {
+			ms.addRollupsLocked(key, value)
+		}
+		ms.metrics[key] = metric
+		ms.touchLocked(key)
 		return nil
 	}
 
@@ -118,10 +504,41 @@ func (ms *MemStorage) UpdateMetric(ctx context.Context, metricName string, metri
 		if err != nil {
 			return err
 		}
+		ms.addRollupsLocked(key, existingMetric.Value.(float64))
 	default:
 		return ErrMetricInvalidType
 	}
-	ms.metrics[metricName] = existingMetric
+	ms.metrics[key] = existingMetric
+	ms.touchLocked(key)
+	return nil
+}
+
+// CreateCounter stores a new counter and returns repositories.ErrMetricExists when a metric of that
+// name is stored.
+func (ms *MemStorage) CreateCounter(ctx context.Context, metricName string, delta int64) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if metricName == "" || strings.Contains(metricName, tenantSeparator) {
+		return ErrMetricInvalidName
+	}
+	if ms == nil {
+		return ErrStorageNil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.metrics == nil {
+		return ErrMetricsMapNil
+	}
+
+	key := storageKey(identity.Tenant(ctx), metricName)
+	if _, exists := ms.metrics[key]; exists {
+		return repositories.ErrMetricExists
+	}
+	ms.metrics[key] = repositories.Metric{Type: constants.MetricTypeCounter, Value: delta}
+	ms.touchLocked(key)
 	return nil
 }
 
@@ -172,49 +589,54 @@ func (ms *MemStorage) UpdateMetricsBatch(ctx context.Context, metrics map[string
 		return ErrMetricsMapNil
 	}
 
+	// The batch is validated before it is applied, so a rejected batch leaves the storage unchanged.
+	tenant := identity.Tenant(ctx)
 	for name, metric := range metrics {
-		if name == "" {
+		if name == "" || strings.Contains(name, tenantSeparator) {
 			return ErrMetricInvalidName
 		}
 
-		if metric.Type != constants.MetricTypeCounter && metric.Type != constants.MetricTypeGauge {
+		switch metric.Type {
+		case constants.MetricTypeCounter:
+			if _, ok := metric.Value.(int64); !ok {
+				return ErrMetricInvalidType
+			}
+		case constants.MetricTypeGauge:
+			if _, ok := metric.Value.(float64); !ok {
+				return fmt.Errorf("invalid gauge value type: %T", metric.Value)
+			}
+		default:
 			return ErrMetricInvalidType
 		}
 
-		existingMetric, exists := ms.metrics[name]
-
-		if !exists {
-			ms.metrics[name] = metric
-			continue
+		if existingMetric, exists := ms.metrics[storageKey(tenant, name)]; exists && existingMetric.Type != metric.Type {
+			return ErrMetricInvalidType
 		}
+	}
 
-		if existingMetric.Type != metric.Type {
-			return ErrMetricInvalidType
+	for name, metric := range metrics {
+		key := storageKey(tenant, name)
+		ms.touchLocked(key)
+		if metric.Type == constants.MetricTypeGauge {
+			ms.addRollupsLocked(key, metric.Value.(float64))
 		}
 
-		switch metric.Type {
-		case constants.MetricTypeCounter:
-			newValue, ok := metric.Value.(int64)
-			if !ok {
-				return ErrMetricInvalidType
-			}
+		existingMetric, exists := ms.metrics[key]
+		if !exists {
+			ms.metrics[key] = metric
+			continue
+		}
 
+		if metric.Type == constants.MetricTypeCounter {
 			existingValue, ok := existingMetric.Value.(int64)
 			if !ok {
 				existingValue = 0
 			}
-
-			existingMetric.Value = existingValue + newValue
-		case constants.MetricTypeGauge:
-			newValue, ok := metric.Value.(float64)
-			if !ok {
-				return fmt.Errorf("invalid gauge value type: %T", metric.Value)
-			}
-			existingMetric.Value = newValue
-		default:
-			return ErrMetricInvalidType
+			existingMetric.Value = existingValue + metric.Value.(int64)
+		} else {
+			existingMetric.Value = metric.Value
 		}
-		ms.metrics[name] = existingMetric
+		ms.metrics[key] = existingMetric
 	}
 
 	return nil
@@ -4,10 +4,12 @@ import (
 	"context"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/server/identity"
 	"github.com/a2sh3r/sysmetrics/internal/server/repositories"
 )
 
@@ -523,6 +525,27 @@ func TestMemStorage_UpdateMetricsBatch(t *testing.T) {
 			want:    map[string]repositories.Metric{},
 			wantErr: true,
 		},
+		{
+			name: "Batch update: type conflict leaves storage unchanged",
+			fields: fields{
+				metrics: map[string]repositories.Metric{
+					"counter1": {Type: constants.MetricTypeCounter, Value: int64(5)},
+					"gauge1":   {Type: constants.MetricTypeGauge, Value: 2.34},
+				},
+			},
+			args: args{
+				metrics: map[string]repositories.Metric{
+					"counter1": {Type: constants.MetricTypeCounter, Value: int64(1)},
+					"gauge1":   {Type: constants.MetricTypeCounter, Value: int64(1)},
+					"gauge2":   {Type: constants.MetricTypeGauge, Value: 1.0},
+				},
+			},
+			want: map[string]repositories.Metric{
+				"counter1": {Type: constants.MetricTypeCounter, Value: int64(5)},
+				"gauge1":   {Type: constants.MetricTypeGauge, Value: 2.34},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -535,12 +558,286 @@ func TestMemStorage_UpdateMetricsBatch(t *testing.T) {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tt.want, ms.metrics)
 			}
+			assert.Equal(t, tt.want, ms.metrics)
 		})
 	}
 }
 
+func TestMemStorage_Tenants(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	ms := NewMemStorage()
+
+	assert.NoError(t, ms.UpdateMetric(ctx, "HeapAlloc", repositories.Metric{Type: constants.MetricTypeGauge, Value: float64(1)}))
+	assert.NoError(t, ms.UpdateMetric(teamA, "HeapAlloc", repositories.Metric{Type: constants.MetricTypeGauge, Value: float64(2)}))
+	assert.NoError(t, ms.UpdateMetricsBatch(teamA, map[string]repositories.Metric{
+		"PollCount": {Type: constants.MetricTypeCounter, Value: int64(3)},
+	}))
+
+	got, err := ms.GetMetric(ctx, "HeapAlloc")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), got.Value)
+
+	all, err := ms.GetMetrics(teamA)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]repositories.Metric{
+		"HeapAlloc": {Type: constants.MetricTypeGauge, Value: float64(2)},
+		"PollCount": {Type: constants.MetricTypeCounter, Value: int64(3)},
+	}, all)
+
+	tenants, err := ms.ListTenants(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "team-a"}, tenants)
+
+	assert.NoError(t, ms.DeleteTenant(ctx, "team-a"))
+	_, err = ms.GetMetric(teamA, "HeapAlloc")
+	assert.Error(t, err)
+	_, err = ms.GetMetric(ctx, "HeapAlloc")
+	assert.NoError(t, err)
+}
+
+func TestMemStorage_CreateCounter(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	ms := NewMemStorage()
+	assert.NoError(t, ms.UpdateMetric(ctx, "load", repositories.Metric{Type: constants.MetricTypeGauge, Value: float64(1)}))
+
+	assert.NoError(t, ms.CreateCounter(ctx, "hits", 3))
+	assert.ErrorIs(t, ms.CreateCounter(ctx, "hits", 5), repositories.ErrMetricExists)
+	assert.ErrorIs(t, ms.CreateCounter(ctx, "load", 5), repositories.ErrMetricExists)
+	assert.NoError(t, ms.CreateCounter(teamA, "hits", 7), "tenants create their own counters")
+	assert.ErrorIs(t, ms.CreateCounter(ctx, "", 1), ErrMetricInvalidName)
+
+	metric, err := ms.GetMetric(ctx, "hits")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), metric.Value)
+}
+
+func TestMemStorage_DeleteMetric(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	ms := NewMemStorage()
+
+	assert.NoError(t, ms.UpdateMetric(ctx, "HeapAlloc", repositories.Metric{Type: constants.MetricTypeGauge, Value: float64(1)}))
+	assert.NoError(t, ms.UpdateMetric(teamA, "HeapAlloc", repositories.Metric{Type: constants.MetricTypeGauge, Value: float64(2)}))
+
+	assert.NoError(t, ms.DeleteMetric(teamA, "HeapAlloc"))
+	_, err := ms.GetMetric(teamA, "HeapAlloc")
+	assert.ErrorIs(t, err, ErrMetricNotFound)
+	_, err = ms.GetMetric(ctx, "HeapAlloc")
+	assert.NoError(t, err, "other tenants keep their metric")
+
+	assert.ErrorIs(t, ms.DeleteMetric(teamA, "HeapAlloc"), ErrMetricNotFound)
+}
+
+func TestMemStorage_DeleteBySelector(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	ms := NewMemStorage()
+
+	assert.NoError(t, ms.UpdateMetricsBatch(ctx, map[string]repositories.Metric{
+		"http_requests": {Type: constants.MetricTypeCounter, Value: int64(1)},
+		"http_latency":  {Type: constants.MetricTypeGauge, Value: float64(0.2)},
+		"HeapAlloc":     {Type: constants.MetricTypeGauge, Value: float64(1)},
+	}))
+	assert.NoError(t, ms.UpdateMetric(teamA, "http_requests", repositories.Metric{Type: constants.MetricTypeCounter, Value: int64(2)}))
+
+	deleted, err := ms.DeleteBySelector(ctx, repositories.Selector{Prefix: "http_", Type: constants.MetricTypeGauge})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http_latency"}, deleted)
+
+	deleted, err = ms.DeleteBySelector(ctx, repositories.Selector{Prefix: "http_"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http_requests"}, deleted)
+
+	remaining, err := ms.GetMetrics(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]repositories.Metric{
+		"HeapAlloc": {Type: constants.MetricTypeGauge, Value: float64(1)},
+	}, remaining)
+	_, err = ms.GetMetric(teamA, "http_requests")
+	assert.NoError(t, err, "other tenants keep their metrics")
+
+	deleted, err = ms.DeleteBySelector(ctx, repositories.Selector{Prefix: "none_"})
+	assert.NoError(t, err)
+	assert.Empty(t, deleted)
+}
+
+func TestMemStorage_DeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	ms := NewMemStorage()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ms.SetClock(func() time.Time { return now })
+
+	assert.NoError(t, ms.UpdateMetricsBatch(ctx, map[string]repositories.Metric{
+		"old":   {Type: constants.MetricTypeGauge, Value: float64(1)},
+		"fresh": {Type: constants.MetricTypeGauge, Value: float64(1)},
+	}))
+	assert.NoError(t, ms.UpdateMetric(teamA, "old", repositories.Metric{Type: constants.MetricTypeCounter, Value: int64(1)}))
+	now = now.Add(time.Minute)
+	assert.NoError(t, ms.UpdateMetric(ctx, "fresh", repositories.Metric{Type: constants.MetricTypeGauge, Value: float64(2)}))
+
+	updated, err := ms.GetUpdateTimes(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{"old": now.Add(-time.Minute), "fresh": now}, updated)
+
+	removed, err := ms.DeleteExpired(ctx, []repositories.ExpiringSeries{
+		{Name: "old", TTL: time.Minute},
+		{Name: "fresh", TTL: time.Minute},
+		{Tenant: "team-a", Name: "old", TTL: time.Minute},
+		{Name: "missing", TTL: time.Minute},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []repositories.ExpiringSeries{
+		{Name: "old", TTL: time.Minute},
+		{Tenant: "team-a", Name: "old", TTL: time.Minute},
+	}, removed, "series written within their TTL are kept")
+
+	remaining, err := ms.GetMetrics(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]repositories.Metric{
+		"fresh": {Type: constants.MetricTypeGauge, Value: float64(2)},
+	}, remaining)
+	updated, err = ms.GetUpdateTimes(teamA)
+	assert.NoError(t, err)
+	assert.Empty(t, updated)
+}
+
+func TestMemStorage_Metadata(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	ms := NewMemStorage()
+
+	assert.NoError(t, ms.UpdateMetadata(ctx, map[string]repositories.Metadata{
+		"Alloc":     {Type: constants.MetricTypeGauge, Unit: "bytes"},
+		"PollCount": {Type: constants.MetricTypeCounter, Help: "Number of polls."},
+	}))
+	assert.NoError(t, ms.UpdateMetadata(ctx, map[string]repositories.Metadata{
+		"Alloc": {Type: constants.MetricTypeGauge, Unit: "bytes", Help: "Allocated heap objects."},
+	}))
+	assert.NoError(t, ms.UpdateMetadata(teamA, map[string]repositories.Metadata{
+		"Alloc": {Unit: "kilobytes"},
+	}))
+	assert.ErrorIs(t, ms.UpdateMetadata(ctx, map[string]repositories.Metadata{"": {Unit: "bytes"}}), ErrMetricInvalidName)
+
+	metadata, err := ms.GetMetadata(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]repositories.Metadata{
+		"Alloc":     {Type: constants.MetricTypeGauge, Unit: "bytes", Help: "Allocated heap objects."},
+		"PollCount": {Type: constants.MetricTypeCounter, Help: "Number of polls."},
+	}, metadata)
+
+	metadata, err = ms.GetMetadata(teamA)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]repositories.Metadata{"Alloc": {Unit: "kilobytes"}}, metadata)
+}
+
+func TestMemStorage_Rollups(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	ms := NewMemStorage()
+
+	_, err := ms.GetRollups(ctx, "cpu", time.Minute)
+	assert.ErrorIs(t, err, repositories.ErrRollupWindowNotConfigured, "rollups are disabled by default")
+
+	ms.EnableRollups(repositories.RollupConfig{Windows: []time.Duration{time.Minute, time.Hour}, Retention: 2})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ms.now = func() time.Time { return now }
+
+	assert.NoError(t, ms.UpdateMetric(ctx, "cpu", repositories.Metric{Type: constants.MetricTypeGauge, Value: 20.0}))
+	assert.NoError(t, ms.UpdateMetricsBatch(ctx, map[string]repositories.Metric{
+		"cpu":   {Type: constants.MetricTypeGauge, Value: 95.0},
+		"polls": {Type: constants.MetricTypeCounter, Value: int64(1)},
+	}))
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, ms.UpdateMetric(ctx, "cpu", repositories.Metric{Type: constants.MetricTypeGauge, Value: 30.0}))
+	now = now.Add(time.Minute)
+	assert.NoError(t, ms.UpdateMetric(ctx, "cpu", repositories.Metric{Type: constants.MetricTypeGauge, Value: 10.0}))
+	assert.NoError(t, ms.UpdateMetric(teamA, "cpu", repositories.Metric{Type: constants.MetricTypeGauge, Value: 50.0}))
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rollups, err := ms.GetRollups(ctx, "cpu", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{
+		{Start: start, Window: time.Minute, Min: 20, Max: 95, Sum: 145, Count: 3, Last: 30},
+		{Start: start.Add(time.Minute), Window: time.Minute, Min: 10, Max: 10, Sum: 10, Count: 1, Last: 10},
+	}, rollups)
+
+	rollups, err = ms.GetRollups(ctx, "cpu", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{
+		{Start: start, Window: time.Hour, Min: 10, Max: 95, Sum: 155, Count: 4, Last: 10},
+	}, rollups)
+
+	rollups, err = ms.GetRollups(ctx, "polls", time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, rollups, "counters have no rollups")
+
+	_, err = ms.GetRollups(ctx, "cpu", 5*time.Minute)
+	assert.ErrorIs(t, err, repositories.ErrRollupWindowNotConfigured)
+
+	assert.NoError(t, ms.DeleteMetric(ctx, "cpu"))
+	rollups, err = ms.GetRollups(ctx, "cpu", time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, rollups)
+
+	rollups, err = ms.GetRollups(teamA, "cpu", time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, rollups, 1, "tenants keep their own rollups")
+}
+
+func TestMemStorage_CompactRollups(t *testing.T) {
+	ctx := context.Background()
+	teamA := identity.WithTenant(ctx, "team-a")
+	ms := NewMemStorage()
+	ms.EnableRollups(repositories.RollupConfig{Windows: []time.Duration{time.Minute}, Compacted: []time.Duration{time.Hour}})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	ms.now = func() time.Time { return now }
+
+	for i, value := range []float64{20, 95, 30, 10} {
+		now = start.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, ms.UpdateMetric(ctx, "cpu", repositories.Metric{Type: constants.MetricTypeGauge, Value: value}))
+	}
+	assert.NoError(t, ms.UpdateMetric(teamA, "cpu", repositories.Metric{Type: constants.MetricTypeGauge, Value: 50.0}))
+
+	removed, err := ms.CompactRollups(ctx, time.Minute, time.Hour, start.Add(2*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	removed, err = ms.CompactRollups(ctx, time.Minute, time.Hour, start.Add(3*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	rollups, err := ms.GetRollups(ctx, "cpu", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{
+		{Start: start.Add(3 * time.Minute), Window: time.Minute, Min: 10, Max: 10, Sum: 10, Count: 1, Last: 10},
+	}, rollups)
+
+	rollups, err = ms.GetRollups(ctx, "cpu", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{
+		{Start: start, Window: time.Hour, Min: 20, Max: 95, Sum: 145, Count: 3, Last: 30},
+	}, rollups)
+
+	sizes, err := ms.RollupSizes(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[time.Duration]int{time.Minute: 1, time.Hour: 1}, sizes)
+
+	removed, err = ms.CompactRollups(ctx, time.Hour, 0, start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	rollups, err = ms.GetRollups(ctx, "cpu", time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, rollups, "the last tier is dropped")
+
+	sizes, err = ms.RollupSizes(teamA)
+	assert.NoError(t, err)
+	assert.Equal(t, map[time.Duration]int{time.Minute: 1}, sizes, "other tenants are not compacted")
+}
+
 func BenchmarkUpdateMetric(b *testing.B) {
 	ms := NewMemStorage()
 	ctx := context.Background()
@@ -0,0 +1,229 @@
+// Package stream fans metric updates out to live subscribers.
+//
+// Publishing never blocks: every subscriber has a buffer of updates, and a subscriber whose buffer is
+// full is disconnected rather than waited for.
+package stream
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/a2sh3r/sysmetrics/internal/models"
+)
+
+// DefaultBufferSize is the number of updates buffered per subscriber when none is configured.
+const DefaultBufferSize = 256
+
+// Reasons a subscription ends, returned by Subscription.Err.
+var (
+	// ErrSlowConsumer ends subscriptions whose buffer was full when an update was published, or whose
+	// updates a publisher had to drop.
+	ErrSlowConsumer = errors.New("subscriber too slow: update buffer full")
+	// ErrHubClosed ends subscriptions when the hub is closed.
+	ErrHubClosed = errors.New("stream closed")
+	// ErrTooManySubscribers ends new subscriptions when the hub has as many as it accepts.
+	ErrTooManySubscribers = errors.New("too many stream subscribers")
+)
+
+// Filter selects the metrics of a subscription by exact name or name prefix. An empty filter selects
+// every metric.
+type Filter struct {
+	Names    []string
+	Prefixes []string
+}
+
+// Matches reports whether the filter selects a metric.
+func (f Filter) Matches(name string) bool {
+	if len(f.Names) == 0 && len(f.Prefixes) == 0 {
+		return true
+	}
+	for _, n := range f.Names {
+		if n == name {
+			return true
+		}
+	}
+	for _, p := range f.Prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives the updates of the metrics of one tenant selected by its filter.
+type Subscription struct {
+	hub    *Hub
+	tenant string
+	filter Filter
+	ch     chan models.Metrics
+
+	mu   sync.Mutex
+	err  error
+	done bool
+}
+
+// Updates returns the channel updates are delivered on. It is closed when the subscription ends.
+func (s *Subscription) Updates() <-chan models.Metrics {
+	return s.ch
+}
+
+// Err returns why the subscription ended, or nil when it is active or was ended by Close.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.hub.remove(s, nil)
+}
+
+// end closes the channel of the subscription once. The caller holds the lock of the hub.
+func (s *Subscription) end(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return
+	}
+	s.done = true
+	s.err = err
+	close(s.ch)
+}
+
+// Hub fans metric updates out to subscriptions.
+type Hub struct {
+	bufferSize     int
+	maxSubscribers int
+
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub creates a Hub buffering bufferSize updates per subscriber, DefaultBufferSize when it is not
+// positive, and accepting at most maxSubscribers subscriptions at a time, any number when it is not positive.
+func NewHub(bufferSize, maxSubscribers int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{
+		bufferSize:     bufferSize,
+		maxSubscribers: maxSubscribers,
+		subs:           make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe subscribes to the updates of the metrics of a tenant selected by filter. The subscription
+// of a closed hub has already ended with ErrHubClosed, and that of a hub with as many subscriptions as
+// it accepts with ErrTooManySubscribers.
+func (h *Hub) Subscribe(tenant string, filter Filter) *Subscription {
+	sub := &Subscription{hub: h, tenant: tenant, filter: filter, ch: make(chan models.Metrics, h.bufferSize)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		sub.end(ErrHubClosed)
+		return sub
+	}
+	if h.maxSubscribers > 0 && len(h.subs) >= h.maxSubscribers {
+		sub.end(ErrTooManySubscribers)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Subscribers returns the number of active subscriptions.
+func (h *Hub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+// Wants reports whether a subscription of the tenant selects the metric, so that publishers can skip
+// preparing updates nobody receives.
+func (h *Hub) Wants(tenant, name string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs {
+		if sub.tenant == tenant && sub.filter.Matches(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish delivers updates of metrics of a tenant to the subscriptions selecting them without blocking.
+// Subscriptions whose buffer is full end with ErrSlowConsumer.
+func (h *Hub) Publish(tenant string, updates ...models.Metrics) {
+	var slow []*Subscription
+
+	h.mu.RLock()
+	for sub := range h.subs {
+		if sub.tenant != tenant {
+			continue
+		}
+	deliver:
+		for _, update := range updates {
+			if !sub.filter.Matches(update.ID) {
+				continue
+			}
+			select {
+			case sub.ch <- update:
+			default:
+				slow = append(slow, sub)
+				break deliver
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range slow {
+		h.remove(sub, ErrSlowConsumer)
+	}
+}
+
+// Drop ends the subscriptions of a tenant selecting any of the metrics with ErrSlowConsumer. Publishers
+// call it for updates they could not publish, so that no subscriber silently misses them.
+func (h *Hub) Drop(tenant string, names ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		if sub.tenant != tenant {
+			continue
+		}
+		for _, name := range names {
+			if sub.filter.Matches(name) {
+				delete(h.subs, sub)
+				sub.end(ErrSlowConsumer)
+				break
+			}
+		}
+	}
+}
+
+// Close ends every subscription with ErrHubClosed and refuses new ones.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		sub.end(ErrHubClosed)
+	}
+}
+
+// remove ends a subscription with err.
+func (h *Hub) remove(sub *Subscription, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs, sub)
+	sub.end(err)
+}
@@ -0,0 +1,150 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+)
+
+func gauge(name string, value float64) models.Metrics {
+	return models.Metrics{ID: name, MType: constants.MetricTypeGauge, Value: &value}
+}
+
+// drain returns the names of the updates buffered for sub.
+func drain(sub *Subscription) []string {
+	var names []string
+	for {
+		select {
+		case update, ok := <-sub.Updates():
+			if !ok {
+				return names
+			}
+			names = append(names, update.ID)
+		default:
+			return names
+		}
+	}
+}
+
+func TestFilter_Matches(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		metric string
+		want   bool
+	}{
+		{name: "Test #1 empty filter", metric: "Alloc", want: true},
+		{name: "Test #2 name", filter: Filter{Names: []string{"Alloc"}}, metric: "Alloc", want: true},
+		{name: "Test #3 other name", filter: Filter{Names: []string{"Alloc"}}, metric: "Allocs", want: false},
+		{name: "Test #4 prefix", filter: Filter{Prefixes: []string{"Heap"}}, metric: "HeapInuse", want: true},
+		{name: "Test #5 other prefix", filter: Filter{Prefixes: []string{"Heap"}}, metric: "StackInuse", want: false},
+		{name: "Test #6 name or prefix", filter: Filter{Names: []string{"Alloc"}, Prefixes: []string{"Heap"}}, metric: "HeapIdle", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Matches(tt.metric))
+		})
+	}
+}
+
+func TestHub_Publish(t *testing.T) {
+	hub := NewHub(8, 0)
+	all := hub.Subscribe("", Filter{})
+	heap := hub.Subscribe("", Filter{Prefixes: []string{"Heap"}})
+	other := hub.Subscribe("team-a", Filter{})
+
+	assert.Equal(t, 3, hub.Subscribers())
+	assert.True(t, hub.Wants("", "HeapInuse"))
+	assert.True(t, hub.Wants("team-a", "Alloc"))
+	assert.False(t, hub.Wants("team-b", "Alloc"))
+
+	hub.Publish("", gauge("Alloc", 1), gauge("HeapInuse", 2))
+
+	assert.Equal(t, []string{"Alloc", "HeapInuse"}, drain(all))
+	assert.Equal(t, []string{"HeapInuse"}, drain(heap))
+	assert.Empty(t, drain(other))
+
+	heap.Close()
+	_, ok := <-heap.Updates()
+	assert.False(t, ok)
+	assert.NoError(t, heap.Err())
+	assert.Equal(t, 2, hub.Subscribers())
+}
+
+func TestHub_SlowConsumer(t *testing.T) {
+	hub := NewHub(2, 0)
+	slow := hub.Subscribe("", Filter{})
+	fast := hub.Subscribe("", Filter{})
+
+	for i := 0; i < 3; i++ {
+		hub.Publish("", gauge("Alloc", float64(i)))
+		drain(fast)
+	}
+
+	assert.Len(t, drain(slow), 2)
+	_, ok := <-slow.Updates()
+	assert.False(t, ok)
+	assert.ErrorIs(t, slow.Err(), ErrSlowConsumer)
+	assert.NoError(t, fast.Err())
+	assert.Equal(t, 1, hub.Subscribers())
+
+	hub.Publish("", gauge("Alloc", 3))
+	assert.Equal(t, []string{"Alloc"}, drain(fast))
+}
+
+func TestHub_Drop(t *testing.T) {
+	hub := NewHub(2, 0)
+	cpu := hub.Subscribe("", Filter{Prefixes: []string{"cpu_"}})
+	mem := hub.Subscribe("", Filter{Names: []string{"Alloc"}})
+	other := hub.Subscribe("acme", Filter{})
+
+	hub.Drop("", "cpu_user", "cpu_system")
+
+	_, ok := <-cpu.Updates()
+	assert.False(t, ok)
+	assert.ErrorIs(t, cpu.Err(), ErrSlowConsumer)
+	assert.NoError(t, mem.Err())
+	assert.NoError(t, other.Err())
+	assert.Equal(t, 2, hub.Subscribers())
+}
+
+func TestHub_Close(t *testing.T) {
+	hub := NewHub(0, 0)
+	sub := hub.Subscribe("", Filter{})
+
+	hub.Close()
+	_, ok := <-sub.Updates()
+	assert.False(t, ok)
+	assert.ErrorIs(t, sub.Err(), ErrHubClosed)
+	sub.Close()
+
+	late := hub.Subscribe("", Filter{})
+	_, ok = <-late.Updates()
+	require.False(t, ok)
+	assert.ErrorIs(t, late.Err(), ErrHubClosed)
+	assert.Equal(t, 0, hub.Subscribers())
+	assert.NotPanics(t, func() { hub.Publish("", gauge("Alloc", 1)) })
+}
+
+func TestHub_MaxSubscribers(t *testing.T) {
+	hub := NewHub(0, 2)
+	first := hub.Subscribe("", Filter{})
+	second := hub.Subscribe("team-a", Filter{})
+
+	full := hub.Subscribe("", Filter{})
+	_, ok := <-full.Updates()
+	require.False(t, ok)
+	assert.ErrorIs(t, full.Err(), ErrTooManySubscribers)
+	full.Close()
+	assert.Equal(t, 2, hub.Subscribers())
+
+	first.Close()
+	third := hub.Subscribe("", Filter{})
+	assert.NoError(t, third.Err())
+	assert.NoError(t, second.Err())
+	assert.Equal(t, 2, hub.Subscribers())
+}
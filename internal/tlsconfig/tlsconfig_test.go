@@ -0,0 +1,169 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certPath string
+	keyPath  string
+}
+
+func newTestCert(t *testing.T, dir, name string, parent *testCert, isCA bool, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if !isCA {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certPath: filepath.Join(dir, name+".crt"),
+		keyPath:  filepath.Join(dir, name+".key"),
+	}
+	require.NoError(t, os.WriteFile(c.certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(c.keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return c
+}
+
+func startServer(t *testing.T, cfg *tls.Config) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, PeerIdentity(r.TLS))
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil, true, 0)
+	server := newTestCert(t, dir, "server", ca, false, x509.ExtKeyUsageServerAuth)
+	client := newTestCert(t, dir, "agent-42", ca, false, x509.ExtKeyUsageClientAuth)
+	otherCA := newTestCert(t, dir, "other-ca", nil, true, 0)
+	stranger := newTestCert(t, dir, "stranger", otherCA, false, x509.ExtKeyUsageClientAuth)
+
+	serverCfg, err := NewServerConfig(server.certPath, server.keyPath, ca.certPath)
+	require.NoError(t, err)
+	srv := startServer(t, serverCfg)
+
+	tests := []struct {
+		name     string
+		certPath string
+		keyPath  string
+		wantErr  bool
+		wantBody string
+	}{
+		{name: "Test #1 trusted client certificate", certPath: client.certPath, keyPath: client.keyPath, wantBody: "agent-42"},
+		{name: "Test #2 no client certificate", wantErr: true},
+		{name: "Test #3 certificate from unknown CA", certPath: stranger.certPath, keyPath: stranger.keyPath, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientCfg, err := NewClientConfig(ca.certPath, tt.certPath, tt.keyPath)
+			require.NoError(t, err)
+			httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+
+			resp, err := httpClient.Get(srv.URL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
+
+func TestServerTLSWithoutClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil, true, 0)
+	server := newTestCert(t, dir, "server", ca, false, x509.ExtKeyUsageServerAuth)
+
+	serverCfg, err := NewServerConfig(server.certPath, server.keyPath, "")
+	require.NoError(t, err)
+	srv := startServer(t, serverCfg)
+
+	clientCfg, err := NewClientConfig(ca.certPath, "", "")
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}).Get(srv.URL)
+	require.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = (&http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12}}}).Get(srv.URL)
+	assert.Error(t, err, "self-signed server must not be trusted without the CA bundle")
+}
+
+func TestConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(empty, []byte("nothing here"), 0600))
+
+	_, err := NewServerConfig(filepath.Join(dir, "missing.crt"), filepath.Join(dir, "missing.key"), "")
+	assert.Error(t, err)
+
+	_, err = NewClientConfig(empty, "", "")
+	assert.ErrorIs(t, err, ErrNoCertificates)
+
+	_, err = NewClientConfig("", filepath.Join(dir, "missing.crt"), "")
+	assert.Error(t, err)
+}
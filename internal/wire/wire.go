@@ -0,0 +1,207 @@
+// Package wire implements the compact binary encoding of metric batches accepted by /updates/.
+//
+// A batch starts with the magic bytes "SMB" and a version byte, followed by the number of records
+// as a uvarint. Every record is prefixed with its length as a uvarint and holds:
+//
+//   - the metric type: 1 for gauge, 2 for counter, 3 for a counter in models.CounterModeCumulative;
+//   - the metric name: a uvarint reference to a name seen earlier in the batch (1-based), or 0
+//     followed by the uvarint length and bytes of a new name, which is then added to the table;
+//   - the value: the little-endian IEEE 754 bits of a gauge, or the zigzag varint delta or running
+//     total of a counter.
+package wire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+)
+
+// ContentType is the media type of binary encoded batches.
+const ContentType = "application/x-sysmetrics-batch"
+
+const (
+	version               = 1
+	typeGauge             = 1
+	typeCounter           = 2
+	typeCumulativeCounter = 3
+)
+
+// Limits protecting the decoder against malformed batches.
+const (
+	maxRecordLen = 1 << 16
+	maxNameLen   = 1 << 10
+)
+
+var magic = [3]byte{'S', 'M', 'B'}
+
+// ErrInvalidBatch is returned when a batch cannot be decoded.
+var ErrInvalidBatch = errors.New("invalid binary batch")
+
+// Encode encodes metrics in the binary format. Metrics without a name or the value of their type are
+// rejected, so that every encoded batch can be decoded.
+func Encode(metrics []*models.Metrics) ([]byte, error) {
+	buf := make([]byte, 0, 4+binary.MaxVarintLen64+len(metrics)*16)
+	buf = append(buf, magic[:]...)
+	buf = append(buf, version)
+	buf = binary.AppendUvarint(buf, uint64(len(metrics)))
+
+	names := make(map[string]uint64, len(metrics))
+	record := make([]byte, 0, 64)
+	for _, m := range metrics {
+		record = record[:0]
+		if m.ID == "" {
+			return nil, errors.New("missing metric name")
+		}
+
+		switch m.MType {
+		case constants.MetricTypeGauge:
+			if m.Value == nil {
+				return nil, fmt.Errorf("missing value for gauge %q", m.ID)
+			}
+			record = append(record, typeGauge)
+		case constants.MetricTypeCounter:
+			if m.Delta == nil {
+				return nil, fmt.Errorf("missing delta for counter %q", m.ID)
+			}
+			if m.Mode == models.CounterModeCumulative {
+				record = append(record, typeCumulativeCounter)
+			} else {
+				record = append(record, typeCounter)
+			}
+		default:
+			return nil, fmt.Errorf("unknown metric type %q", m.MType)
+		}
+
+		if ref, ok := names[m.ID]; ok {
+			record = binary.AppendUvarint(record, ref)
+		} else {
+			if len(m.ID) > maxNameLen {
+				return nil, fmt.Errorf("metric name %q is too long", m.ID)
+			}
+			names[m.ID] = uint64(len(names) + 1)
+			record = binary.AppendUvarint(record, 0)
+			record = binary.AppendUvarint(record, uint64(len(m.ID)))
+			record = append(record, m.ID...)
+		}
+
+		if m.MType == constants.MetricTypeGauge {
+			record = binary.LittleEndian.AppendUint64(record, math.Float64bits(*m.Value))
+		} else {
+			record = binary.AppendVarint(record, *m.Delta)
+		}
+
+		buf = binary.AppendUvarint(buf, uint64(len(record)))
+		buf = append(buf, record...)
+	}
+
+	return buf, nil
+}
+
+// Decode reads a binary encoded batch from r.
+func Decode(r io.Reader) ([]models.Metrics, error) {
+	br := bufio.NewReader(r)
+
+	var header [4]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+	}
+	if [3]byte(header[:3]) != magic || header[3] != version {
+		return nil, fmt.Errorf("%w: unsupported header", ErrInvalidBatch)
+	}
+
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+	}
+
+	metrics := make([]models.Metrics, 0, min(count, 1024))
+	var names []string
+	record := make([]byte, 0, 64)
+	for i := uint64(0); i < count; i++ {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", ErrInvalidBatch, i, err)
+		}
+		if n == 0 || n > maxRecordLen {
+			return nil, fmt.Errorf("%w: record %d has invalid length %d", ErrInvalidBatch, i, n)
+		}
+		if uint64(cap(record)) < n {
+			record = make([]byte, n)
+		}
+		record = record[:n]
+		if _, err := io.ReadFull(br, record); err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", ErrInvalidBatch, i, err)
+		}
+
+		m, name, err := decodeRecord(record, names)
+		if err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", ErrInvalidBatch, i, err)
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+		metrics = append(metrics, m)
+	}
+
+	return metrics, nil
+}
+
+// decodeRecord decodes a single record. It returns the new name the record adds to the table, if any.
+func decodeRecord(record []byte, names []string) (models.Metrics, string, error) {
+	var m models.Metrics
+	kind := record[0]
+	rest := record[1:]
+
+	ref, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return m, "", errors.New("invalid name reference")
+	}
+	rest = rest[n:]
+
+	var added string
+	if ref == 0 {
+		length, n := binary.Uvarint(rest)
+		if n <= 0 || length == 0 || length > maxNameLen || uint64(len(rest)-n) < length {
+			return m, "", errors.New("invalid name")
+		}
+		rest = rest[n:]
+		m.ID = string(rest[:length])
+		rest = rest[length:]
+		added = m.ID
+	} else {
+		if ref > uint64(len(names)) {
+			return m, "", fmt.Errorf("unknown name reference %d", ref)
+		}
+		m.ID = names[ref-1]
+	}
+
+	switch kind {
+	case typeGauge:
+		if len(rest) != 8 {
+			return m, "", errors.New("invalid gauge value")
+		}
+		value := math.Float64frombits(binary.LittleEndian.Uint64(rest))
+		m.MType = constants.MetricTypeGauge
+		m.Value = &value
+	case typeCounter, typeCumulativeCounter:
+		delta, n := binary.Varint(rest)
+		if n <= 0 || n != len(rest) {
+			return m, "", errors.New("invalid counter delta")
+		}
+		m.MType = constants.MetricTypeCounter
+		m.Delta = &delta
+		if kind == typeCumulativeCounter {
+			m.Mode = models.CounterModeCumulative
+		}
+	default:
+		return m, "", fmt.Errorf("unknown metric type %d", kind)
+	}
+
+	return m, added, nil
+}
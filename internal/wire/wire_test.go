@@ -0,0 +1,216 @@
+package wire
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a2sh3r/sysmetrics/internal/constants"
+	"github.com/a2sh3r/sysmetrics/internal/models"
+)
+
+func gauge(id string, v float64) *models.Metrics {
+	return &models.Metrics{ID: id, MType: constants.MetricTypeGauge, Value: &v}
+}
+
+func counter(id string, d int64) *models.Metrics {
+	return &models.Metrics{ID: id, MType: constants.MetricTypeCounter, Delta: &d}
+}
+
+// pollBatch builds a batch shaped like the one the agent sends every report interval.
+func pollBatch() []*models.Metrics {
+	batch := make([]*models.Metrics, 0, 64)
+	for i := 0; i < 58; i++ {
+		batch = append(batch, gauge(fmt.Sprintf("RuntimeGauge%d", i), float64(i)*1234.5678))
+	}
+	batch = append(batch, counter("PollCount", 5), gauge("RandomValue", 0.42))
+	for i := 1; i <= 4; i++ {
+		batch = append(batch, gauge(fmt.Sprintf("CPUutilization%d", i), float64(i)*12.5))
+	}
+	return batch
+}
+
+func TestEncodeDecode(t *testing.T) {
+	batch := []*models.Metrics{
+		gauge("Alloc", 1.5),
+		counter("PollCount", -3),
+		counter("PollCount", 1<<40),
+		gauge("Alloc", 2.5),
+		{ID: "Polls", MType: constants.MetricTypeCounter, Delta: counter("Polls", 42).Delta, Mode: models.CounterModeCumulative},
+	}
+
+	data, err := Encode(batch)
+	require.NoError(t, err)
+
+	got, err := Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Len(t, got, len(batch))
+	for i, want := range batch {
+		assert.Equal(t, *want, got[i])
+	}
+}
+
+func TestEncode_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric *models.Metrics
+	}{
+		{name: "Test #1 gauge without value", metric: &models.Metrics{ID: "Alloc", MType: constants.MetricTypeGauge}},
+		{name: "Test #2 counter without delta", metric: &models.Metrics{ID: "PollCount", MType: constants.MetricTypeCounter}},
+		{name: "Test #3 unknown type", metric: &models.Metrics{ID: "Alloc", MType: "histogram"}},
+		{name: "Test #4 empty name", metric: gauge("", 1)},
+		{name: "Test #5 name too long", metric: gauge(strings.Repeat("a", maxNameLen+1), 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Encode([]*models.Metrics{tt.metric})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		batch []*models.Metrics
+	}{
+		{name: "Test #1 empty batch", batch: []*models.Metrics{}},
+		{name: "Test #2 longest name", batch: []*models.Metrics{gauge(strings.Repeat("a", maxNameLen), 1)}},
+		{name: "Test #3 unicode name", batch: []*models.Metrics{gauge("загрузка.cpu", 0.5), counter("загрузка.cpu", 1)}},
+		{name: "Test #4 extreme values", batch: []*models.Metrics{
+			gauge("inf", math.Inf(-1)), gauge("max", math.MaxFloat64), counter("min", math.MinInt64), counter("max", math.MaxInt64),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Encode(tt.batch)
+			require.NoError(t, err)
+
+			got, err := Decode(bytes.NewReader(data))
+			require.NoError(t, err, "every encoded batch decodes")
+			require.Len(t, got, len(tt.batch))
+			for i, want := range tt.batch {
+				assert.Equal(t, *want, got[i])
+			}
+		})
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	valid, err := Encode([]*models.Metrics{gauge("Alloc", 1), counter("PollCount", 1)})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Test #1 empty", data: nil},
+		{name: "Test #2 wrong magic", data: []byte("JSON\x00")},
+		{name: "Test #3 unsupported version", data: []byte("SMB\x02\x00")},
+		{name: "Test #4 truncated", data: valid[:len(valid)-3]},
+		{name: "Test #5 unknown name reference", data: []byte("SMB\x01\x01\x0a\x01\x05\x00\x00\x00\x00\x00\x00\x00\x00")},
+		{name: "Test #6 unknown type", data: []byte("SMB\x01\x01\x05\x07\x00\x01a\x02")},
+		{name: "Test #7 trailing bytes in record", data: []byte("SMB\x01\x01\x06\x02\x00\x01a\x02\x00")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(tt.data))
+			assert.ErrorIs(t, err, ErrInvalidBatch)
+		})
+	}
+}
+
+func TestEncode_Size(t *testing.T) {
+	batch := pollBatch()
+
+	data, err := Encode(batch)
+	require.NoError(t, err)
+	jsonData, err := json.Marshal(batch)
+	require.NoError(t, err)
+
+	assert.Less(t, len(data), len(jsonData)/2)
+	t.Logf("binary: %d bytes, json: %d bytes, json+gzip: %d bytes", len(data), len(jsonData), len(gzipData(t, jsonData)))
+}
+
+func gzipData(tb testing.TB, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(tb, err)
+	require.NoError(tb, zw.Close())
+	return buf.Bytes()
+}
+
+func BenchmarkEncode_Binary(b *testing.B) {
+	batch := pollBatch()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, err := Encode(batch)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(data)))
+	}
+}
+
+func BenchmarkEncode_BinaryGzip(b *testing.B) {
+	batch := pollBatch()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, err := Encode(batch)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(gzipData(b, data))))
+	}
+}
+
+func BenchmarkEncode_JSONGzip(b *testing.B) {
+	batch := pollBatch()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, err := json.Marshal(batch)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(gzipData(b, data))))
+	}
+}
+
+func BenchmarkDecode_Binary(b *testing.B) {
+	data, err := Encode(pollBatch())
+	require.NoError(b, err)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Decode(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode_JSONGzip(b *testing.B) {
+	jsonData, err := json.Marshal(pollBatch())
+	require.NoError(b, err)
+	data := gzipData(b, jsonData)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		var metrics []models.Metrics
+		if err := json.NewDecoder(io.Reader(zr)).Decode(&metrics); err != nil {
+			b.Fatal(err)
+		}
+	}
+}